@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/automation"
+	"github.com/mqtt-home/mqtt-lamarzocco/config"
+	"github.com/mqtt-home/mqtt-lamarzocco/expr"
+	"github.com/mqtt-home/mqtt-lamarzocco/scheduler"
+	"github.com/philipparndt/go-logger"
+	"github.com/philipparndt/mqtt-gateway/mqtt"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	triggerPollTimeout = 10 * time.Second
+	triggerRetryDelay  = time.Minute // A trigger that failed temporarily is deferred once by this
+)
+
+func (g *gateway) subscribeToTriggers() {
+	if len(g.cfg.Triggers) == 0 {
+		logger.Debug("No triggers configured")
+		return
+	}
+
+	g.triggerExpressions = make(map[string]*expr.Expression)
+	for _, trigger := range g.cfg.Triggers {
+		if trigger.Expression != "" {
+			// Validated by LoadConfig
+			g.triggerExpressions[trigger.Expression], _ = expr.Compile(trigger.Expression)
+		}
+	}
+
+	// Group MQTT triggers by topic, HTTP and cron sources run on their own
+	triggersByTopic := make(map[string][]int)
+	for i, trigger := range g.cfg.Triggers {
+		g.automationStats.Register(automation.KindTrigger, triggerName(i, trigger))
+		switch trigger.SourceType() {
+		case config.TriggerSourceHTTP:
+			go g.pollTrigger(i, trigger)
+		case config.TriggerSourceCron:
+			g.startCronTrigger(i, trigger)
+		default:
+			triggersByTopic[trigger.Topic] = append(triggersByTopic[trigger.Topic], i)
+		}
+	}
+
+	// Subscribe to each unique topic
+	for topic, triggers := range triggersByTopic {
+		subscribeTopic := topic   // capture topic for closure
+		topicTriggers := triggers // capture triggers for closure
+		logger.Info("Subscribing to trigger topic", "topic", subscribeTopic, "triggers", len(topicTriggers))
+
+		mqtt.Subscribe(subscribeTopic, func(msgTopic string, payload []byte) {
+			logger.Info("Received trigger message", "topic", msgTopic, "payload_len", len(payload))
+
+			payloadStr := string(payload)
+
+			// Check each trigger for this topic, stop after the first one that fired
+			for _, i := range topicTriggers {
+				trigger := g.cfg.Triggers[i]
+				if !g.matchTrigger(trigger, payloadStr) {
+					logger.Debug("Trigger did not match", "trigger_index", i)
+					continue
+				}
+				if g.fireTrigger(i, trigger, msgTopic) {
+					return
+				}
+			}
+
+			logger.Debug("No trigger matched for message", "topic", msgTopic)
+		})
+	}
+
+	logger.Info("Trigger subscriptions active", "topics", len(triggersByTopic), "triggers", len(g.cfg.Triggers))
+}
+
+// fireTrigger sets the dose mode of a matched trigger unless its time window
+// or variables prevent it, and reports whether it did
+func (g *gateway) fireTrigger(index int, trigger config.Trigger, source string) bool {
+	name := triggerName(index, trigger)
+	if !g.triggerInWindow(trigger) {
+		logger.Debug("Trigger matched outside of its time window", "trigger_index", index)
+		g.automationStats.Suppressed(automation.KindTrigger, name, automation.SuppressedTimeWindow)
+		return false
+	}
+
+	if !g.variables.Matches(trigger.When) {
+		logger.Debug("Trigger matched but conditions not met", "trigger_index", index, "when", trigger.When)
+		g.automationStats.Suppressed(automation.KindTrigger, name, automation.SuppressedVariables)
+		return false
+	}
+
+	mode := lamarzocco.ParseDoseMode(trigger.Action.Mode)
+	logger.Info("Trigger matched, setting dose mode",
+		"trigger", name,
+		"source", source,
+		"mode", mode)
+
+	g.automationStats.Fired(automation.KindTrigger, name)
+	g.recordCommand(sourceTrigger, "mode", name)
+	go func(m lamarzocco.DoseMode) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Panic in trigger processing", "panic", r)
+				g.automationStats.Result(automation.KindTrigger, name, fmt.Errorf("panic: %v", r))
+			}
+		}()
+
+		err := g.client.SetMode(g.ctx, m)
+		switch {
+		case errors.Is(err, lamarzocco.ErrTransient) || errors.Is(err, lamarzocco.ErrRateLimited):
+			pending := g.sched.Schedule(sourceTrigger, lamarzocco.Command{Mode: string(m), Requester: name}, triggerRetryDelay)
+			logger.Warn("Failed to set mode from trigger, retrying", "error", err, "id", pending.ID, "execute_at", pending.ExecuteAt)
+		case err != nil:
+			logger.Error("Failed to set mode from trigger", "error", err)
+			g.commandFailed(sourceTrigger, name, err)
+		}
+		g.automationStats.Result(automation.KindTrigger, name, err)
+	}(mode)
+	return true
+}
+
+// triggerName returns the configured name, trigger-<index> otherwise
+func triggerName(index int, trigger config.Trigger) string {
+	if trigger.Name != "" {
+		return trigger.Name
+	}
+	return "trigger-" + strconv.Itoa(index)
+}
+
+// pollTrigger fetches the URL of an HTTP trigger every interval. It fires
+// once when the conditions start to match, not on every poll.
+func (g *gateway) pollTrigger(index int, trigger config.Trigger) {
+	source := *trigger.Source
+	logger.Info("Polling trigger source", "trigger_index", index, "url", source.URL, "interval", source.Interval)
+
+	client := &http.Client{Timeout: triggerPollTimeout}
+	ticker := time.NewTicker(time.Duration(source.Interval) * time.Second)
+	defer ticker.Stop()
+
+	matched := false
+	for {
+		payload, err := fetchTriggerSource(client, source.URL)
+		if err != nil {
+			logger.Warn("Failed to poll trigger source", "trigger_index", index, "url", source.URL, "error", err)
+		} else {
+			match := g.matchTrigger(trigger, payload)
+			if match && !matched {
+				// Retried on the next poll if the window or variables prevented it
+				matched = g.fireTrigger(index, trigger, source.URL)
+			} else {
+				matched = match
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-g.stopCh:
+			return
+		}
+	}
+}
+
+func fetchTriggerSource(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// startCronTrigger checks a cron trigger at every full minute. Its conditions
+// apply to {"time", "hour", "minute", "weekday"} of the minute.
+func (g *gateway) startCronTrigger(index int, trigger config.Trigger) {
+	spec, err := scheduler.ParseCron(trigger.Source.Cron)
+	if err != nil {
+		logger.Error("Invalid trigger cron expression, skipping", "trigger_index", index, "error", err)
+		return
+	}
+	logger.Info("Scheduling cron trigger", "trigger_index", index, "cron", trigger.Source.Cron)
+
+	go func() {
+		for {
+			now := g.clock.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-timer.C:
+			case <-g.stopCh:
+				timer.Stop()
+				return
+			}
+
+			if !spec.Matches(next) {
+				continue
+			}
+			payload, _ := json.Marshal(map[string]interface{}{
+				"time":    next.Format(time.RFC3339),
+				"hour":    next.Hour(),
+				"minute":  next.Minute(),
+				"weekday": strings.ToLower(next.Weekday().String()[:3]),
+			})
+			if g.matchTrigger(trigger, string(payload)) {
+				g.fireTrigger(index, trigger, trigger.Source.Cron)
+			}
+		}
+	}()
+}
+
+// matchTrigger reports whether the payload satisfies the conditions and the
+// expression of a trigger
+func (g *gateway) matchTrigger(trigger config.Trigger, payload string) bool {
+	if !matchConditions(payload, trigger.Conditions) {
+		return false
+	}
+
+	expression := g.triggerExpressions[trigger.Expression]
+	if expression == nil {
+		return true
+	}
+	match, err := expression.Match(g.expressionEnv(payload))
+	if err != nil {
+		logger.Warn("Trigger expression failed", "expression", expression, "error", err)
+		return false
+	}
+	return match
+}
+
+// expressionEnv provides payload, status, vars and time to expressions.
+// Payloads that are not JSON are strings.
+func (g *gateway) expressionEnv(payload string) map[string]interface{} {
+	var parsed interface{} = payload
+	if gjson.Valid(payload) {
+		parsed = gjson.Parse(payload).Value()
+	}
+
+	var status map[string]interface{}
+	if data, err := json.Marshal(g.client.GetStatus()); err == nil {
+		json.Unmarshal(data, &status)
+	}
+
+	now := g.clock.Now()
+	return map[string]interface{}{
+		"payload": parsed,
+		"status":  status,
+		"vars":    g.variables.All(),
+		"time": map[string]interface{}{
+			"hour":    float64(now.Hour()),
+			"minute":  float64(now.Minute()),
+			"weekday": strings.ToLower(now.Weekday().String()[:3]),
+			"day":     float64(now.Day()),
+			"month":   float64(now.Month()),
+			"year":    float64(now.Year()),
+			"unix":    float64(now.Unix()),
+		},
+	}
+}
+
+// matchConditions reports whether the payload satisfies all conditions
+func matchConditions(payload string, conditions []config.TriggerCondition) bool {
+	for _, condition := range conditions {
+		result := gjson.Get(payload, condition.Selector)
+		logger.Debug("Checking condition",
+			"selector", condition.Selector,
+			"expected", condition.Value,
+			"actual", result.Value(),
+			"exists", result.Exists())
+		if !matchValue(result, condition.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchValue(actual gjson.Result, expected interface{}) bool {
+	if !actual.Exists() {
+		return false
+	}
+
+	switch v := expected.(type) {
+	case float64:
+		return actual.Num == v
+	case string:
+		return actual.Str == v
+	case bool:
+		return actual.Bool() == v
+	default:
+		return actual.String() == v
+	}
+}
+
+// triggerInWindow reports whether the trigger's optional time window allows firing now
+func (g *gateway) triggerInWindow(trigger config.Trigger) bool {
+	if trigger.TimeWindow == nil {
+		return true
+	}
+
+	window, err := scheduler.ParseTimeWindow(trigger.TimeWindow.From, trigger.TimeWindow.To)
+	if err != nil {
+		logger.Error("Invalid trigger time window", "error", err)
+		return false
+	}
+
+	return window.Contains(g.clock.Now(), schedulerLocation(g.cfg))
+}
+
+func schedulerLocation(cfg config.Config) scheduler.Location {
+	if cfg.Location == nil {
+		return scheduler.Location{}
+	}
+	return scheduler.Location{
+		Latitude:  cfg.Location.Latitude,
+		Longitude: cfg.Location.Longitude,
+	}
+}
+
+func (g *gateway) loadSchedules() []scheduler.ScheduleEntry {
+	var entries []scheduler.ScheduleEntry
+	for i, entry := range g.cfg.Schedules {
+		name := entry.Name
+		if name == "" {
+			name = "schedule-" + strconv.Itoa(i)
+		}
+
+		spec, err := scheduler.ParseTimeSpec(entry.Time)
+		if err != nil {
+			logger.Error("Invalid schedule time, skipping", "name", name, "error", err)
+			continue
+		}
+		if spec.UsesSun() && g.cfg.Location == nil {
+			logger.Error("Schedule uses sunrise/sunset but no location is configured, skipping", "name", name)
+			continue
+		}
+
+		days, err := scheduler.ParseWeekdays(entry.Days)
+		if err != nil {
+			logger.Error("Invalid schedule days, skipping", "name", name, "error", err)
+			continue
+		}
+
+		cmd, err := lamarzocco.ParseCommand(entry.Command)
+		if err != nil {
+			logger.Error("Invalid schedule command, skipping", "name", name, "error", err)
+			continue
+		}
+		if cmd.Requester == "" {
+			cmd.Requester = name
+		}
+
+		entries = append(entries, scheduler.ScheduleEntry{
+			Name:    name,
+			Time:    spec,
+			Days:    days,
+			Command: *cmd,
+			When:    entry.When,
+		})
+	}
+
+	return entries
+}
+
+func (g *gateway) subscribeToPresence() {
+	if g.cfg.Presence == nil || g.cfg.Presence.Topic == "" {
+		return
+	}
+
+	presence := *g.cfg.Presence
+	logger.Info("Subscribing to presence topic", "topic", presence.Topic)
+
+	mqtt.Subscribe(presence.Topic, func(topic string, payload []byte) {
+		var state gjson.Result
+		if presence.Selector == "" {
+			state = gjson.Parse(string(payload))
+			if !state.Exists() {
+				// Plain text payload such as "home" or "not_home"
+				state = gjson.Result{Type: gjson.String, Str: string(payload), Raw: string(payload)}
+			}
+		} else {
+			state = gjson.Get(string(payload), presence.Selector)
+		}
+
+		value := "away"
+		if matchValue(state, presence.Home) {
+			value = "home"
+		}
+		g.variables.Set("presence", value)
+	})
+}
+
+func (g *gateway) subscribeToGrinder() {
+	if g.cfg.Grinder == nil || g.cfg.Grinder.Topic == "" {
+		return
+	}
+
+	grinder := *g.cfg.Grinder
+	logger.Info("Subscribing to grinder topic", "topic", grinder.Topic)
+
+	mqtt.Subscribe(grinder.Topic, func(topic string, payload []byte) {
+		var weight gjson.Result
+		if grinder.Selector == "" {
+			weight = gjson.Parse(string(payload))
+		} else {
+			weight = gjson.Get(string(payload), grinder.Selector)
+		}
+
+		if weight.Type != gjson.Number || weight.Num <= 0 {
+			logger.Warn("Ignoring grinder message without a valid weight", "topic", topic, "payload", string(payload))
+			return
+		}
+
+		logger.Info("Received ground weight", "grams", weight.Num)
+		g.brewHistory.SetGroundWeight(weight.Num)
+		if !g.safeMode {
+			go g.adjustDoseToGroundWeight(weight.Num)
+		}
+	})
+}
+
+func (g *gateway) subscribeToAmbient() {
+	if g.cfg.Ambient == nil || g.cfg.Ambient.Topic == "" {
+		return
+	}
+
+	ambient := *g.cfg.Ambient
+	logger.Info("Subscribing to ambient temperature topic", "topic", ambient.Topic)
+
+	mqtt.Subscribe(ambient.Topic, func(topic string, payload []byte) {
+		var temperature gjson.Result
+		if ambient.Selector == "" {
+			temperature = gjson.Parse(string(payload))
+		} else {
+			temperature = gjson.Get(string(payload), ambient.Selector)
+		}
+
+		if temperature.Type != gjson.Number {
+			logger.Warn("Ignoring ambient message without a valid temperature", "topic", topic, "payload", string(payload))
+			return
+		}
+
+		logger.Debug("Received ambient temperature", "celsius", temperature.Num)
+		g.warmup.SetAmbient(temperature.Num)
+	})
+}
@@ -0,0 +1,149 @@
+package automation
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+)
+
+// Kinds of automations
+const (
+	KindTrigger  = "trigger"
+	KindSchedule = "schedule"
+)
+
+// Suppression reasons
+const (
+	SuppressedTimeWindow      = "time_window"
+	SuppressedVariables       = "when"
+	SuppressedAutoOnSuspended = "auto_on_suspended"
+)
+
+// Stat tells whether an automation actually runs
+type Stat struct {
+	Kind                 string         `json:"kind"`
+	Name                 string         `json:"name"`
+	Fired                int            `json:"fired"`
+	LastFired            *time.Time     `json:"lastFired,omitempty"`
+	LastResult           string         `json:"lastResult,omitempty"` // "ok" or the error of the last run
+	Suppressed           map[string]int `json:"suppressed,omitempty"` // Count by reason
+	LastSuppressed       *time.Time     `json:"lastSuppressed,omitempty"`
+	LastSuppressedReason string         `json:"lastSuppressedReason,omitempty"`
+}
+
+// Stats counts fired and suppressed automations since the start. All methods
+// are no-ops on a nil Stats.
+type Stats struct {
+	stats map[string]*Stat
+	clock clock.Clock
+	mu    sync.Mutex
+
+	onChange func(Stat)
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		stats: make(map[string]*Stat),
+		clock: clock.System,
+	}
+}
+
+// SetClock replaces the system clock, e.g. for tests
+func (s *Stats) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+func (s *Stats) SetChangeCallback(callback func(Stat)) {
+	s.onChange = callback
+}
+
+// Register lists an automation before it fired for the first time
+func (s *Stats) Register(kind, name string) {
+	s.update(kind, name, func(*Stat, time.Time) {})
+}
+
+// Fired records that an automation ran, Result follows once it finished
+func (s *Stats) Fired(kind, name string) {
+	s.update(kind, name, func(stat *Stat, now time.Time) {
+		stat.Fired++
+		stat.LastFired = &now
+		stat.LastResult = ""
+	})
+}
+
+// Result records the outcome of the last run
+func (s *Stats) Result(kind, name string, err error) {
+	s.update(kind, name, func(stat *Stat, _ time.Time) {
+		stat.LastResult = "ok"
+		if err != nil {
+			stat.LastResult = err.Error()
+		}
+	})
+}
+
+// Suppressed records that an automation was due but did not run
+func (s *Stats) Suppressed(kind, name, reason string) {
+	s.update(kind, name, func(stat *Stat, now time.Time) {
+		if stat.Suppressed == nil {
+			stat.Suppressed = make(map[string]int)
+		}
+		stat.Suppressed[reason]++
+		stat.LastSuppressed = &now
+		stat.LastSuppressedReason = reason
+	})
+}
+
+func (s *Stats) update(kind, name string, change func(*Stat, time.Time)) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	key := kind + "/" + name
+	stat, ok := s.stats[key]
+	if !ok {
+		stat = &Stat{Kind: kind, Name: name}
+		s.stats[key] = stat
+	}
+	change(stat, s.clock.Now())
+	updated := copyStat(stat)
+	s.mu.Unlock()
+
+	if s.onChange != nil {
+		s.onChange(updated)
+	}
+}
+
+// All returns the stats of every registered automation, sorted by kind and name
+func (s *Stats) All() []Stat {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make([]Stat, 0, len(s.stats))
+	for _, stat := range s.stats {
+		all = append(all, copyStat(stat))
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Kind != all[j].Kind {
+			return all[i].Kind < all[j].Kind
+		}
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+func copyStat(stat *Stat) Stat {
+	c := *stat
+	if stat.Suppressed != nil {
+		c.Suppressed = make(map[string]int, len(stat.Suppressed))
+		for reason, count := range stat.Suppressed {
+			c.Suppressed[reason] = count
+		}
+	}
+	return c
+}
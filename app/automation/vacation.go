@@ -0,0 +1,116 @@
+package automation
+
+import (
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/philipparndt/go-logger"
+)
+
+const vacationCheckInterval = time.Hour
+
+// VacationDetector suspends auto-on schedules after the machine has not been
+// used for a number of days and resumes them on the next power-on by a user.
+type VacationDetector struct {
+	days  int
+	store *state.Store
+	clock clock.Clock
+
+	onChange func(suspended bool, lastBrew time.Time)
+}
+
+func NewVacationDetector(days int, store *state.Store, c clock.Clock) *VacationDetector {
+	v := &VacationDetector{
+		days:  days,
+		store: store,
+		clock: c,
+	}
+
+	// Start counting from now if we never saw a brew
+	if store.Get().LastBrew.IsZero() {
+		v.update(func(s *state.State) {
+			s.LastBrew = v.clock.Now()
+		})
+	}
+
+	return v
+}
+
+func (v *VacationDetector) SetChangeCallback(callback func(suspended bool, lastBrew time.Time)) {
+	v.onChange = callback
+}
+
+func (v *VacationDetector) Suspended() bool {
+	return v.store.Get().AutoOnSuspended
+}
+
+// OnBrew records a brew event
+func (v *VacationDetector) OnBrew(at time.Time) {
+	v.update(func(s *state.State) {
+		s.LastBrew = at
+	})
+}
+
+// OnPowerOn resumes suspended auto-on schedules. source is the origin of the
+// power-on as reported in lastCommand, empty for the machine's button or the
+// official app. Power-ons by triggers or schedules keep them suspended.
+func (v *VacationDetector) OnPowerOn(source string) {
+	if !v.Suspended() || source == KindTrigger || source == KindSchedule {
+		return
+	}
+
+	v.update(func(s *state.State) {
+		s.AutoOnSuspended = false
+	})
+	logger.Info("Machine powered on, resuming auto-on schedules")
+	v.notifyChange()
+}
+
+// Check suspends auto-on schedules when the last brew is too long ago
+func (v *VacationDetector) Check() {
+	current := v.store.Get()
+	if current.AutoOnSuspended {
+		return
+	}
+
+	idle := v.clock.Now().Sub(current.LastBrew)
+	if idle < time.Duration(v.days)*24*time.Hour {
+		return
+	}
+
+	v.update(func(s *state.State) {
+		s.AutoOnSuspended = true
+	})
+	logger.Info("No brews recorded, suspending auto-on schedules", "last_brew", current.LastBrew, "days", v.days)
+	v.notifyChange()
+}
+
+func (v *VacationDetector) Run(stopCh <-chan struct{}) {
+	v.Check()
+
+	ticker := v.clock.NewTicker(vacationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			v.Check()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (v *VacationDetector) update(fn func(*state.State)) {
+	if err := v.store.Update(fn); err != nil {
+		logger.Error("Failed to persist state", "error", err)
+	}
+}
+
+func (v *VacationDetector) notifyChange() {
+	if v.onChange != nil {
+		current := v.store.Get()
+		v.onChange(current.AutoOnSuspended, current.LastBrew)
+	}
+}
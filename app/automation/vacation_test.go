@@ -0,0 +1,43 @@
+package automation
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+)
+
+func TestVacationResumesOnlyOnUserPowerOn(t *testing.T) {
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	start := time.Date(2026, time.August, 1, 8, 0, 0, 0, time.UTC)
+	manual := clock.NewManual(start)
+	v := NewVacationDetector(3, store, manual)
+	if got := store.Get().LastBrew; !got.Equal(start) {
+		t.Fatalf("LastBrew = %s, want the injected clock's %s", got, start)
+	}
+
+	manual.Advance(4 * 24 * time.Hour)
+	v.Check()
+	if !v.Suspended() {
+		t.Fatal("not suspended after 4 days without brews")
+	}
+
+	for _, source := range []string{KindSchedule, KindTrigger} {
+		v.OnPowerOn(source)
+		if !v.Suspended() {
+			t.Fatalf("resumed on a power-on by %s", source)
+		}
+	}
+
+	v.OnPowerOn("")
+	if v.Suspended() {
+		t.Fatal("still suspended after a manual power-on")
+	}
+}
@@ -0,0 +1,75 @@
+package automation
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Variables holds named values (e.g. presence) that schedules and triggers
+// can condition on
+type Variables struct {
+	values map[string]interface{}
+	mu     sync.RWMutex
+
+	onChange func(name string, value interface{})
+}
+
+func NewVariables() *Variables {
+	return &Variables{
+		values: make(map[string]interface{}),
+	}
+}
+
+func (v *Variables) SetChangeCallback(callback func(name string, value interface{})) {
+	v.onChange = callback
+}
+
+func (v *Variables) Set(name string, value interface{}) {
+	v.mu.Lock()
+	old, existed := v.values[name]
+	v.values[name] = value
+	v.mu.Unlock()
+
+	if (!existed || fmt.Sprint(old) != fmt.Sprint(value)) && v.onChange != nil {
+		v.onChange(name, value)
+	}
+}
+
+func (v *Variables) Get(name string) (interface{}, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	value, ok := v.values[name]
+	return value, ok
+}
+
+// All returns a copy of all variables
+func (v *Variables) All() map[string]interface{} {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	result := make(map[string]interface{}, len(v.values))
+	for name, value := range v.values {
+		result[name] = value
+	}
+	return result
+}
+
+// Matches reports whether all required variables have the expected value.
+// Unknown variables never match.
+func (v *Variables) Matches(required map[string]interface{}) bool {
+	if len(required) == 0 {
+		return true
+	}
+	if v == nil {
+		return false
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for name, expected := range required {
+		actual, ok := v.values[name]
+		if !ok || fmt.Sprint(actual) != fmt.Sprint(expected) {
+			return false
+		}
+	}
+	return true
+}
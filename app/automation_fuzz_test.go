@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/config"
+)
+
+func FuzzMatchConditions(f *testing.F) {
+	f.Add(`{"button":1,"event":"press"}`, "button", "1", 1.0, true)
+	f.Add(`{"action":"single"}`, "action", "single", 0.0, false)
+	f.Add(`{"state":{"on":true}}`, "state.on", "", 0.0, true)
+	f.Add(`[1,2,3]`, "#", "3", 3.0, false)
+	f.Add(`not json`, "..", "", -1.0, false)
+
+	f.Fuzz(func(t *testing.T, payload, selector, text string, number float64, flag bool) {
+		for _, expected := range []interface{}{text, number, flag, nil, []interface{}{text}} {
+			matchConditions(payload, []config.TriggerCondition{
+				{Selector: selector, Value: expected},
+			})
+		}
+	})
+}
@@ -0,0 +1,154 @@
+// Package backup periodically snapshots the persistent state. Snapshots use
+// the JSON state file format, so they can be restored via state_file.
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/philipparndt/go-logger"
+)
+
+const (
+	filePrefix = "state-"
+	fileSuffix = ".json"
+	fileTime   = "20060102-150405"
+
+	DefaultInterval = 24 * time.Hour
+	DefaultKeep     = 7
+)
+
+type Options struct {
+	Interval time.Duration
+	Dir      string // Directory for snapshot files, empty to disable
+	Keep     int    // Snapshot files to keep
+}
+
+// Backup writes snapshots of the state without plain credentials
+type Backup struct {
+	store *state.Store
+	clock clock.Clock
+	opts  Options
+
+	publish func(payload []byte)
+}
+
+func New(store *state.Store, opts Options) *Backup {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Keep <= 0 {
+		opts.Keep = DefaultKeep
+	}
+	return &Backup{
+		store: store,
+		clock: clock.System,
+		opts:  opts,
+	}
+}
+
+// SetClock replaces the system clock, e.g. for tests
+func (b *Backup) SetClock(c clock.Clock) {
+	b.clock = c
+}
+
+// SetPublisher sends each snapshot to a retained MQTT topic
+func (b *Backup) SetPublisher(publish func(payload []byte)) {
+	b.publish = publish
+}
+
+// Run writes a snapshot now and then every interval until stopCh is closed
+func (b *Backup) Run(stopCh <-chan struct{}) {
+	b.snapshotAndLog()
+
+	ticker := time.NewTicker(b.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.snapshotAndLog()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (b *Backup) snapshotAndLog() {
+	if err := b.Snapshot(); err != nil {
+		logger.Error("Failed to back up state", "error", err)
+	}
+}
+
+// Snapshot writes the current state to the configured targets
+func (b *Backup) Snapshot() error {
+	snapshot := b.store.Get()
+	// Plain credentials would grant control of the account, a restored
+	// gateway registers again. Encrypted ones are kept.
+	snapshot.Credentials = nil
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	if b.publish != nil {
+		b.publish(data)
+	}
+
+	if b.opts.Dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(b.opts.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	name := filePrefix + b.clock.Now().UTC().Format(fileTime) + fileSuffix
+	path := filepath.Join(b.opts.Dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	logger.Info("Backed up state", "path", path)
+
+	return b.prune()
+}
+
+// prune removes the oldest snapshot files beyond the configured count
+func (b *Backup) prune() error {
+	entries, err := os.ReadDir(b.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var snapshots []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			snapshots = append(snapshots, name)
+		}
+	}
+	if len(snapshots) <= b.opts.Keep {
+		return nil
+	}
+
+	// The timestamp in the name sorts chronologically
+	sort.Strings(snapshots)
+	for _, name := range snapshots[:len(snapshots)-b.opts.Keep] {
+		if err := os.Remove(filepath.Join(b.opts.Dir, name)); err != nil {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/philipparndt/go-logger"
+)
+
+// machineSummary is one machine in the aggregate status
+type machineSummary struct {
+	Serial    string `json:"serial"`
+	Model     string `json:"model,omitempty"`
+	Topic     string `json:"topic"`
+	MachineOn bool   `json:"machineOn"`
+	Ready     bool   `json:"ready"`           // On and the coffee boiler is at temperature
+	Brewing   bool   `json:"brewing"`         // A shot is running
+	Error     string `json:"error,omitempty"` // Why the machine cannot be reached
+}
+
+// aggregateStatus summarizes the machines of an account, published to
+// <topic>/all/status
+type aggregateStatus struct {
+	Machines int              `json:"machines"`
+	On       int              `json:"on"`
+	Ready    int              `json:"ready"`
+	Brewing  int              `json:"brewing"`
+	Errors   int              `json:"errors"`
+	List     []machineSummary `json:"list"`
+}
+
+// fleet returns the gateways of all machines of the account, the first one
+// first
+func (g *gateway) fleet() []*gateway {
+	return append([]*gateway{g}, g.machineList()...)
+}
+
+func summarize(status lamarzocco.MachineStatus, topic string) machineSummary {
+	summary := machineSummary{
+		Serial:    status.Serial,
+		Model:     status.Model,
+		Topic:     topic,
+		MachineOn: status.MachineOn,
+		Brewing:   status.Brewing,
+	}
+	if status.Boilers != nil && status.Boilers.Coffee != nil {
+		summary.Ready = status.MachineOn && status.Boilers.Coffee.Ready
+	}
+	switch {
+	case status.PollError != "":
+		summary.Error = status.PollError
+	case !status.Connected:
+		summary.Error = "not connected"
+	case status.ReceivedAt != nil && !status.CloudConnected:
+		summary.Error = "machine offline"
+	}
+	return summary
+}
+
+// publishAggregate publishes the aggregate status of the account's machines
+// if it changed. Accounts with a single machine have none.
+func (g *gateway) publishAggregate() {
+	fleet := g.fleet()
+	if len(fleet) == 1 {
+		return
+	}
+
+	aggregate := aggregateStatus{List: []machineSummary{}}
+	for _, m := range fleet {
+		summary := summarize(m.client.GetStatus(), m.cfg.MQTT.Topic)
+		aggregate.Machines++
+		if summary.MachineOn {
+			aggregate.On++
+		}
+		if summary.Ready {
+			aggregate.Ready++
+		}
+		if summary.Brewing {
+			aggregate.Brewing++
+		}
+		if summary.Error != "" {
+			aggregate.Errors++
+		}
+		aggregate.List = append(aggregate.List, summary)
+	}
+
+	data, err := json.Marshal(aggregate)
+	if err != nil {
+		logger.Error("Failed to marshal aggregate status", err)
+		return
+	}
+
+	g.aggregateMu.Lock()
+	defer g.aggregateMu.Unlock()
+	if bytes.Equal(data, g.lastAggregate) {
+		return
+	}
+	g.lastAggregate = data
+	g.publish(g.baseTopic+"/all/status", data, true)
+}
+
+// clearAggregate removes the retained aggregate status, e.g. when the other
+// machines were removed from the account
+func (g *gateway) clearAggregate() {
+	g.aggregateMu.Lock()
+	defer g.aggregateMu.Unlock()
+	if g.lastAggregate == nil {
+		return
+	}
+	g.lastAggregate = nil
+	g.unpublish(g.baseTopic + "/all/status")
+}
+
+// subscribeToBroadcast applies commands sent to <topic>/all/set to every
+// machine of the account, e.g. {"power": false} at closing time. It subscribes
+// once the account has more than one machine.
+func (g *gateway) subscribeToBroadcast() {
+	machines := len(g.fleet())
+	if machines == 1 {
+		return
+	}
+	g.broadcastOnce.Do(func() {
+		topic := g.baseTopic + "/all/set"
+
+		logger.Info("Subscribing to commands for all machines", "topic", topic, "machines", machines)
+		g.subscribe(topic, func(topic string, payload []byte) {
+			logger.Debug("Received MQTT command for all machines", "topic", topic, "payload", string(payload))
+
+			for _, m := range g.fleet() {
+				if err := m.handleCommand(sourceBroadcast, payload); err != nil {
+					logger.Error("Failed to parse command", "error", err)
+					return
+				}
+			}
+		})
+	})
+}
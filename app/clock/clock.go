@@ -0,0 +1,213 @@
+// Package clock provides an injectable time source, so time dependent logic
+// (schedules, countdowns, accounting) can be tested deterministically.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f once the duration elapsed
+	AfterFunc(d time.Duration, f func()) Timer
+	// NewTicker sends the time on its channel every d, like time.NewTicker
+	NewTicker(d time.Duration) Ticker
+}
+
+type Timer interface {
+	// Stop prevents the timer from firing, returns false if it already fired or was stopped
+	Stop() bool
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type systemClock struct{}
+
+// System is the real wall clock
+var System Clock = systemClock{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+type locationClock struct {
+	Clock
+	loc *time.Location
+}
+
+// InLocation returns a clock reporting the time of c in loc, so calendar
+// logic (days, time of day) follows that time zone
+func InLocation(c Clock, loc *time.Location) Clock {
+	return locationClock{Clock: c, loc: loc}
+}
+
+func (l locationClock) Now() time.Time {
+	return l.Clock.Now().In(l.loc)
+}
+
+// Manual is a clock that only moves when Set or Advance is called. Timers fire
+// synchronously within Set/Advance once their time is reached, tickers send
+// without blocking and drop ticks a slow receiver missed.
+type Manual struct {
+	now     time.Time
+	timers  []*manualTimer
+	tickers []*manualTicker
+	mu      sync.Mutex
+}
+
+type manualTicker struct {
+	clock  *Manual
+	period time.Duration
+	next   time.Time
+	c      chan time.Time
+}
+
+type manualTimer struct {
+	clock   *Manual
+	at      time.Time
+	f       func()
+	fired   bool
+	stopped bool
+}
+
+func NewManual(now time.Time) *Manual {
+	return &Manual{now: now}
+}
+
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+func (m *Manual) AfterFunc(d time.Duration, f func()) Timer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	timer := &manualTimer{clock: m, at: m.now.Add(d), f: f}
+	m.timers = append(m.timers, timer)
+	return timer
+}
+
+func (m *Manual) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ticker := &manualTicker{clock: m, period: d, next: m.now.Add(d), c: make(chan time.Time, 1)}
+	m.tickers = append(m.tickers, ticker)
+	return ticker
+}
+
+// WaitForTickers blocks until at least n tickers are running, so a test can
+// advance the clock once a loop started in a goroutine is ready
+func (m *Manual) WaitForTickers(n int) {
+	for {
+		m.mu.Lock()
+		running := len(m.tickers)
+		m.mu.Unlock()
+		if running >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Advance moves the clock forward and fires due timers
+func (m *Manual) Advance(d time.Duration) {
+	m.Set(m.Now().Add(d))
+}
+
+// Set moves the clock to the given time and fires due timers in order
+func (m *Manual) Set(now time.Time) {
+	m.mu.Lock()
+	m.now = now
+
+	var due, pending []*manualTimer
+	for _, timer := range m.timers {
+		if !timer.at.After(now) {
+			timer.fired = true
+			due = append(due, timer)
+		} else {
+			pending = append(pending, timer)
+		}
+	}
+	m.timers = pending
+
+	for _, ticker := range m.tickers {
+		if ticker.next.After(now) {
+			continue
+		}
+		select {
+		case ticker.c <- now:
+		default:
+		}
+		for !ticker.next.After(now) {
+			ticker.next = ticker.next.Add(ticker.period)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].at.Before(due[j].at)
+	})
+	for _, timer := range due {
+		timer.f()
+	}
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	if t.fired || t.stopped {
+		return false
+	}
+	t.stopped = true
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	for i, ticker := range t.clock.tickers {
+		if ticker == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualTicker(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	m := NewManual(start)
+	ticker := m.NewTicker(time.Minute)
+
+	m.Advance(30 * time.Second)
+	select {
+	case at := <-ticker.C():
+		t.Fatalf("ticked at %s before the interval elapsed", at)
+	default:
+	}
+
+	m.Advance(30 * time.Second)
+	select {
+	case at := <-ticker.C():
+		if !at.Equal(start.Add(time.Minute)) {
+			t.Errorf("ticked at %s, want %s", at, start.Add(time.Minute))
+		}
+	default:
+		t.Fatal("no tick after the interval elapsed")
+	}
+
+	// Missed ticks are dropped like with time.Ticker
+	m.Advance(5 * time.Minute)
+	<-ticker.C()
+	select {
+	case at := <-ticker.C():
+		t.Fatalf("unexpected second tick at %s", at)
+	default:
+	}
+
+	ticker.Stop()
+	m.Advance(time.Hour)
+	select {
+	case at := <-ticker.C():
+		t.Fatalf("stopped ticker ticked at %s", at)
+	default:
+	}
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/philipparndt/go-logger"
+)
+
+func (g *gateway) subscribeToCommands() {
+	topic := g.cfg.MQTT.Topic + "/set"
+
+	logger.Info("Subscribing to MQTT commands", "topic", topic)
+
+	g.subscribe(topic, func(topic string, payload []byte) {
+		logger.Debug("Received MQTT command", "topic", topic, "payload", string(payload))
+
+		if err := g.handleCommand(sourceMQTT, payload); err != nil {
+			logger.Error("Failed to parse command", "error", err)
+		}
+	})
+}
+
+type annotation struct {
+	ID     string `json:"id"` // Latest brew if empty
+	Rating int    `json:"rating"`
+	Note   string `json:"note"`
+}
+
+// subscribeToAnnotations rates brews via <topic>/annotate
+func (g *gateway) subscribeToAnnotations() {
+	topic := g.cfg.MQTT.Topic + "/annotate"
+
+	g.subscribe(topic, func(topic string, payload []byte) {
+		var req annotation
+		if err := json.Unmarshal(payload, &req); err != nil {
+			logger.Error("Failed to parse annotation", "error", err)
+			return
+		}
+
+		record, err := g.brewHistory.Annotate(req.ID, req.Rating, req.Note)
+		if err != nil {
+			logger.Error("Failed to annotate brew", "id", req.ID, "error", err)
+			return
+		}
+		logger.Info("Annotated brew", "id", record.ID, "rating", record.Rating)
+	})
+}
+
+type scheduleRequest struct {
+	lamarzocco.WakeUpSchedule
+	Delete bool `json:"delete,omitempty"` // Remove the schedule with the ID
+}
+
+// subscribeToSchedule updates the machine's wake-up schedule via <topic>/schedule/set
+func (g *gateway) subscribeToSchedule() {
+	topic := g.cfg.MQTT.Topic + "/schedule/set"
+
+	g.subscribe(topic, func(topic string, payload []byte) {
+		var req scheduleRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			logger.Error("Failed to parse schedule", "error", err)
+			return
+		}
+
+		go func() {
+			var err error
+			if req.Delete {
+				_, err = g.client.DeleteWakeUpSchedule(g.ctx, req.ID)
+			} else {
+				_, err = g.client.SetWakeUpSchedule(g.ctx, req.WakeUpSchedule)
+			}
+			if err != nil {
+				logger.Error("Failed to update schedule", "id", req.ID, "error", err)
+			}
+		}()
+	})
+}
+
+// fetchSchedule publishes the machine's wake-up schedule, if supported
+func (g *gateway) fetchSchedule() {
+	if _, err := g.client.FetchSchedule(g.ctx); err != nil && !errors.Is(err, lamarzocco.ErrNotSupported) {
+		logger.Warn("Failed to fetch schedule", "error", err)
+	}
+}
+
+// Command sources reported in lastCommand
+const (
+	sourceMQTT      = "mqtt"
+	sourceWeb       = "web"
+	sourceGRPC      = "grpc"
+	sourceTrigger   = "trigger"
+	sourceSchedule  = "schedule"  // Schedules
+	sourceStartup   = "startup"   // on_start commands
+	sourceBroadcast = "broadcast" // <topic>/all/set, sent to every machine of the account
+)
+
+// commandOrigin tells which path sent the last command to the machine
+type commandOrigin struct {
+	Source    string    `json:"source"`
+	Command   string    `json:"command"`             // Settings changed, e.g. "dose1,mode"
+	Requester string    `json:"requester,omitempty"` // Client IP, trigger or schedule name, or the requester of the command
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// recordCommand remembers the origin of a command and republishes the status with it
+func (g *gateway) recordCommand(source, command, requester string) {
+	g.lastCommandMu.Lock()
+	g.lastCommand = &commandOrigin{
+		Source:    source,
+		Command:   command,
+		Requester: requester,
+		Timestamp: g.clock.Now().UTC(),
+	}
+	g.lastCommandMu.Unlock()
+
+	g.publishStatus(g.client.GetStatus())
+}
+
+func (g *gateway) getLastCommand() *commandOrigin {
+	g.lastCommandMu.Lock()
+	defer g.lastCommandMu.Unlock()
+	return g.lastCommand
+}
+
+// powerOnAttribution is how long after a power command a power-on is
+// attributed to it instead of the machine's button or the official app
+const powerOnAttribution = 2 * time.Minute
+
+// powerOnSource is the source of the last power command if it explains a
+// power-on that was just observed, empty otherwise
+func (g *gateway) powerOnSource() string {
+	last := g.getLastCommand()
+	if last == nil || g.clock.Now().Sub(last.Timestamp) > powerOnAttribution {
+		return ""
+	}
+	if !slices.Contains(strings.Split(last.Command, ","), "power") {
+		return ""
+	}
+	return last.Source
+}
+
+// handleCommand parses a JSON command and executes, defers or cancels it
+func (g *gateway) handleCommand(source string, payload []byte) error {
+	cmd, err := lamarzocco.ParseCommand(payload)
+	if err != nil {
+		return err
+	}
+
+	if cmd.HasCancel() {
+		g.cancelPending(cmd.Cancel)
+		return nil
+	}
+
+	if cmd.HasReadyBy() {
+		g.scheduleReadyBy(source, *cmd)
+		return nil
+	}
+
+	if cmd.HasDelay() {
+		pending := g.sched.Schedule(source, *cmd, cmd.GetDelay())
+		logger.Info("Command deferred", "id", pending.ID, "execute_at", pending.ExecuteAt)
+		return nil
+	}
+
+	now, run := g.deferUntilReady(source, *cmd)
+	if !run {
+		return nil
+	}
+
+	g.recordCommand(source, now.Kinds(), now.Requester)
+	go g.runCommand(source, now)
+	return nil
+}
+
+// scheduleReadyBy defers a power-on by the learned warm-up time, so the
+// machine is ready at the requested time
+func (g *gateway) scheduleReadyBy(source string, cmd lamarzocco.Command) {
+	now := g.clock.Now()
+	readyAt := cmd.GetReadyBy(now)
+	warmupTime := g.warmup.Estimate()
+
+	delay := readyAt.Sub(now) - warmupTime
+	if delay <= 0 {
+		logger.Info("Not enough time to warm up, powering on now", "ready_by", cmd.ReadyBy, "warmup", warmupTime)
+		g.recordCommand(source, cmd.Kinds(), cmd.Requester)
+		go g.runCommand(source, cmd)
+		return
+	}
+
+	pending := g.sched.Schedule(source, cmd, delay)
+	logger.Info("Power-on scheduled", "id", pending.ID, "execute_at", pending.ExecuteAt, "ready_by", readyAt, "warmup", warmupTime)
+}
+
+// executeScheduled runs recurring schedules and deferred commands. Deferred
+// commands keep the source they were sent from.
+func (g *gateway) executeScheduled(source string, cmd lamarzocco.Command) error {
+	if source == "" {
+		source = sourceSchedule
+	}
+	now, run := g.deferUntilReady(source, cmd)
+	if !run {
+		return nil
+	}
+	g.recordCommand(source, now.Kinds(), now.Requester)
+	return g.runCommand(source, now)
+}
+
+// runCommand executes a command and publishes a command_failed event if it failed
+func (g *gateway) runCommand(source string, cmd lamarzocco.Command) error {
+	err := g.executeCommand(cmd)
+	if err != nil {
+		g.commandFailed(source, cmd.Requester, err)
+	}
+	return err
+}
+
+// commandFailed publishes a command_failed event. Its reason tells users to
+// wait (transient, rate_limited), check the machine (machine_offline) or the
+// account (unauthorized).
+func (g *gateway) commandFailed(source, requester string, err error) {
+	if g.ctx.Err() != nil {
+		// Aborted by the shutdown
+		return
+	}
+	event := map[string]interface{}{
+		"source": source,
+		"reason": lamarzocco.ErrorClass(err),
+		"error":  err.Error(),
+	}
+	if requester != "" {
+		event["requester"] = requester
+	}
+	g.publishEvent("command_failed", event)
+}
+
+// executeCommand applies all settings of a command, failures are logged and
+// returned together
+func (g *gateway) executeCommand(cmd lamarzocco.Command) (err error) {
+	var errs []error
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic in command processing", "panic", r)
+			err = errors.Join(append(errs, fmt.Errorf("panic: %v", r))...)
+		}
+	}()
+
+	// Handle profile command first, explicit settings in the same command win
+	if cmd.HasProfile() {
+		logger.Info("Applying profile", "profile", cmd.Profile)
+		if err := g.profileManager.Apply(g.ctx, cmd.Profile); err != nil {
+			logger.Error("Failed to apply profile", "profile", cmd.Profile, "error", err)
+			errs = append(errs, fmt.Errorf("apply profile: %w", err))
+		}
+	}
+
+	// Handle ratio command, explicit doses in the same command win
+	if cmd.HasRatio() {
+		if err := g.applyRatio(cmd.GetRatio()); err != nil {
+			errs = append(errs, fmt.Errorf("apply ratio: %w", err))
+		}
+	}
+
+	// Handle dose1 command
+	if cmd.HasDose1() {
+		logger.Info("Setting dose1 weight", "weight", cmd.GetDose1())
+		if err := g.client.SetDose(g.ctx, "Dose1", cmd.GetDose1()); err != nil {
+			logger.Error("Failed to set dose1", "error", err)
+			errs = append(errs, fmt.Errorf("set dose1: %w", err))
+		}
+	}
+
+	// Handle dose2 command
+	if cmd.HasDose2() {
+		logger.Info("Setting dose2 weight", "weight", cmd.GetDose2())
+		if err := g.client.SetDose(g.ctx, "Dose2", cmd.GetDose2()); err != nil {
+			logger.Error("Failed to set dose2", "error", err)
+			errs = append(errs, fmt.Errorf("set dose2: %w", err))
+		}
+	}
+
+	// Handle mode command
+	if cmd.HasMode() {
+		mode := cmd.GetDoseMode()
+		logger.Info("Setting dose mode", "mode", mode)
+		if err := g.client.SetMode(g.ctx, mode); err != nil {
+			logger.Error("Failed to set mode", "error", err)
+			errs = append(errs, fmt.Errorf("set mode: %w", err))
+		}
+	}
+
+	// Handle back flush command
+	if cmd.HasBackFlush() {
+		if _, err := g.startBackFlush(); err != nil {
+			logger.Error("Failed to start back flush", "error", err)
+			errs = append(errs, fmt.Errorf("start back flush: %w", err))
+		}
+	}
+
+	// Handle steam boiler commands
+	if cmd.HasSteam() {
+		enabled := cmd.GetSteam()
+		logger.Info("Setting steam boiler", "enabled", enabled)
+		if err := g.client.SetSteamBoiler(g.ctx, enabled); err != nil {
+			logger.Error("Failed to set steam boiler", "error", err)
+			errs = append(errs, fmt.Errorf("set steam boiler: %w", err))
+		}
+	}
+
+	if cmd.HasSteamLevel() {
+		logger.Info("Setting steam level", "level", cmd.SteamLevel)
+		if err := g.client.SetSteamLevel(g.ctx, cmd.SteamLevel); err != nil {
+			logger.Error("Failed to set steam level", "error", err)
+			errs = append(errs, fmt.Errorf("set steam level: %w", err))
+		}
+	}
+
+	// Handle pre-brewing / pre-infusion command, the mode first so times apply to it
+	if cmd.HasPreExtraction() {
+		if err := g.setPreExtraction(cmd.PreExtraction); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cmd.HasHotWater() {
+		logger.Info("Setting hot water dose", "dose", cmd.HotWater.Dose, "seconds", cmd.HotWater.Seconds)
+		if err := g.client.SetHotWaterDose(g.ctx, cmd.HotWater.Dose, cmd.HotWater.Seconds); err != nil {
+			logger.Error("Failed to set hot water dose", "error", err)
+			errs = append(errs, fmt.Errorf("set hot water dose: %w", err))
+		}
+	}
+
+	if cmd.HasCupWarmer() {
+		logger.Info("Setting cup warmer", "enabled", *cmd.CupWarmer)
+		if err := g.client.SetCupWarmer(g.ctx, *cmd.CupWarmer); err != nil {
+			logger.Error("Failed to set cup warmer", "error", err)
+			errs = append(errs, fmt.Errorf("set cup warmer: %w", err))
+		}
+	}
+
+	if cmd.HasBaristaLights() {
+		logger.Info("Setting barista lights", "enabled", *cmd.BaristaLights)
+		if err := g.client.SetBaristaLights(g.ctx, *cmd.BaristaLights); err != nil {
+			logger.Error("Failed to set barista lights", "error", err)
+			errs = append(errs, fmt.Errorf("set barista lights: %w", err))
+		}
+	}
+
+	if cmd.HasScale() {
+		logger.Info("Changing scale", "pair", cmd.Scale.Pair, "unpair", cmd.Scale.Unpair, "name", cmd.Scale.Name)
+		if err := g.setScale(cmd.Scale); err != nil {
+			logger.Error("Failed to change scale", "error", err)
+			errs = append(errs, fmt.Errorf("change scale: %w", err))
+		}
+	}
+
+	// Handle power command
+	if cmd.HasPower() {
+		logger.Info("Setting power", "power", cmd.Power)
+		if err := g.client.SetPowerState(g.ctx, cmd.Power); err != nil {
+			logger.Error("Failed to set power", "error", err)
+			errs = append(errs, fmt.Errorf("set power: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *gateway) setScale(cmd *lamarzocco.ScaleCommand) error {
+	switch {
+	case cmd.Unpair:
+		return g.client.UnpairScale(g.ctx)
+	case cmd.Pair != "":
+		return g.client.PairScale(g.ctx, cmd.Pair, cmd.Name)
+	}
+	return g.client.RenameScale(g.ctx, cmd.Name)
+}
+
+// machineReady reports whether the machine is on and the coffee boiler ready
+func machineReady(status lamarzocco.MachineStatus) bool {
+	return status.MachineOn && status.Boilers != nil && status.Boilers.Coffee != nil && status.Boilers.Coffee.Ready
+}
+
+// deferUntilReady queues a command with when_ready, or of a kind in
+// defer_until_ready, while the machine is not ready. It runs on the status
+// change that makes the machine ready. A power-on is split off and returned
+// to run now, the machine only gets ready after it. The result is false if
+// nothing is left to run now.
+func (g *gateway) deferUntilReady(source string, cmd lamarzocco.Command) (lamarzocco.Command, bool) {
+	if cmd.Power != "" && !cmd.Power.On() {
+		return cmd, true
+	}
+	rest := cmd
+	rest.Power = ""
+	if rest.Kinds() == "" || !cmd.WhenReady && !slices.ContainsFunc(strings.Split(rest.Kinds(), ","), func(kind string) bool {
+		return slices.Contains(g.cfg.DeferUntilReady, kind)
+	}) {
+		return cmd, true
+	}
+	if machineReady(g.client.GetStatus()) {
+		return cmd, true
+	}
+
+	pending := g.sched.DeferUntilReady(source, rest)
+	logger.Info("Command deferred until the machine is ready", "id", pending.ID, "command", rest.Kinds())
+	if cmd.Power == "" {
+		return lamarzocco.Command{}, false
+	}
+	return lamarzocco.Command{Power: cmd.Power, Requester: cmd.Requester}, true
+}
+
+func (g *gateway) cancelPending(id string) {
+	if id == "all" {
+		g.sched.CancelAll()
+		return
+	}
+	if !g.sched.Cancel(id) {
+		logger.Warn("Pending command not found", "id", id)
+	}
+}
+
+func (g *gateway) targetRatio() float64 {
+	if ratio := g.store.Get().TargetRatio; ratio > 0 {
+		return ratio
+	}
+	return g.cfg.Brew.TargetRatio
+}
+
+// applyRatio stores the target ratio and derives both dose targets from it,
+// a ratio of 0 disables automatic dose targets
+func (g *gateway) applyRatio(ratio float64) error {
+	var errs []error
+	if err := g.store.Update(func(s *state.State) {
+		s.TargetRatio = ratio
+	}); err != nil {
+		logger.Error("Failed to persist target ratio", "error", err)
+		errs = append(errs, fmt.Errorf("persist target ratio: %w", err))
+	}
+
+	if ratio == 0 {
+		return errors.Join(errs...)
+	}
+
+	dose1 := lamarzocco.RoundTenth(ratio * g.cfg.Brew.Dose1Input)
+	dose2 := lamarzocco.RoundTenth(ratio * g.cfg.Brew.Dose2Input)
+
+	logger.Info("Deriving dose targets from ratio", "ratio", ratio, "dose1", dose1, "dose2", dose2)
+	if err := g.client.SetDose(g.ctx, "Dose1", dose1); err != nil {
+		logger.Error("Failed to set dose1 from ratio", "error", err)
+		errs = append(errs, fmt.Errorf("set dose1: %w", err))
+	}
+	if err := g.client.SetDose(g.ctx, "Dose2", dose2); err != nil {
+		logger.Error("Failed to set dose2 from ratio", "error", err)
+		errs = append(errs, fmt.Errorf("set dose2: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// adjustDoseToGroundWeight sets the active dose target to match the target ratio
+// for a freshly ground dose
+func (g *gateway) adjustDoseToGroundWeight(grams float64) {
+	ratio := g.targetRatio()
+	if ratio == 0 {
+		return
+	}
+
+	mode := g.client.GetStatus().Mode
+	if mode != lamarzocco.DoseModeDose1 && mode != lamarzocco.DoseModeDose2 {
+		return
+	}
+
+	target := lamarzocco.RoundTenth(ratio * grams)
+	logger.Info("Adjusting dose target to ground weight", "dose", mode, "ground", grams, "ratio", ratio, "target", target)
+	if err := g.client.SetDose(g.ctx, string(mode), target); err != nil {
+		logger.Error("Failed to adjust dose target", "error", err)
+	}
+}
+
+// setPreExtraction sets the mode before the times, so they apply to it
+func (g *gateway) setPreExtraction(cmd *lamarzocco.PreExtractionCommand) error {
+	if cmd.Mode != "" {
+		logger.Info("Setting pre-extraction mode", "mode", cmd.Mode)
+		if err := g.client.SetPreExtractionMode(g.ctx, lamarzocco.PreExtractionMode(cmd.Mode)); err != nil {
+			logger.Error("Failed to set pre-extraction mode", "error", err)
+			return fmt.Errorf("set pre-extraction mode: %w", err)
+		}
+	}
+	if cmd.HasTimes() {
+		logger.Info("Setting pre-extraction times", "dose", cmd.Dose, "in", cmd.GetIn(), "out", cmd.GetOut())
+		if err := g.client.SetPreExtractionTimes(g.ctx, cmd.Dose, cmd.GetIn(), cmd.GetOut()); err != nil {
+			logger.Error("Failed to set pre-extraction times", "error", err)
+			return fmt.Errorf("set pre-extraction times: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/compat"
+	"github.com/philipparndt/go-logger"
+	"github.com/philipparndt/mqtt-gateway/mqtt"
+)
+
+// migrations are the breaking changes of the topics and payloads, an
+// installation with an earlier compat_version keeps getting the layout before
+// them as well
+func (g *gateway) migrations() []compat.Migration {
+	return []compat.Migration{
+		{
+			Version:     2,
+			Description: "serial_topics moves the first machine of the account from <topic> to <topic>/<serial>",
+			Topic:       g.serialTopicsLegacy,
+		},
+	}
+}
+
+// serialTopicsLegacy returns the topic of the first machine below the base
+// topic of the account, where it was before serial_topics
+func (g *gateway) serialTopicsLegacy(topic string) string {
+	if g.machine != "" || g.cfg.MQTT.Topic == g.baseTopic {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(topic, g.cfg.MQTT.Topic+"/"); ok {
+		return g.baseTopic + "/" + rest
+	}
+	return ""
+}
+
+// warnDeprecated logs the layouts that are still published for compat_version
+func (g *gateway) warnDeprecated() {
+	for _, m := range g.compat.Deprecated() {
+		logger.Warn("Publishing the deprecated layout as well, update consumers and raise compat_version",
+			"version", m.Version, "change", m.Description, "compat_version", g.cfg.CompatVersion)
+	}
+}
+
+// subscribe subscribes to a topic of the current layout and, for
+// compat_version, to the same topic in the earlier layout
+func (g *gateway) subscribe(topic string, handler func(topic string, payload []byte)) {
+	// Subscriptions outlive a stopped gateway, e.g. of a machine removed from the account
+	active := func(msgTopic string, payload []byte) {
+		if g.ctx.Err() == nil {
+			handler(msgTopic, payload)
+		}
+	}
+	mqtt.Subscribe(topic, active)
+
+	legacy, ok := g.compat.Topic(topic)
+	if !ok {
+		return
+	}
+	var warnOnce sync.Once
+	mqtt.Subscribe(legacy, func(msgTopic string, payload []byte) {
+		warnOnce.Do(func() {
+			logger.Warn("Received a message on a deprecated topic", "topic", legacy, "replacement", topic)
+		})
+		active(msgTopic, payload)
+	})
+}
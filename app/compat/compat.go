@@ -0,0 +1,109 @@
+// Package compat keeps publishing the topic layout and payload schemas of an
+// earlier version next to the current ones, so installations can move their
+// consumers over during a transition period instead of breaking on upgrade
+package compat
+
+import "sort"
+
+// Current is the version of the topic layout and payload schemas
+const Current = 2
+
+// Migration is a breaking change introduced with Version
+type Migration struct {
+	Version     int
+	Description string
+
+	// Topic returns the topic in the layout before the change, empty if it
+	// did not change
+	Topic func(topic string) string
+	// Payload returns the payload in the schema before the change, nil if it
+	// did not change
+	Payload func(topic string, data []byte) []byte
+}
+
+// Layer translates the current layout into the one of the installation
+type Layer struct {
+	version    int
+	migrations []Migration // Changes after version, newest first
+}
+
+// New returns the layer for an installation set up with version, 0 stands
+// for the current version. Migrations up to version are already done and
+// ignored.
+func New(version int, migrations ...Migration) *Layer {
+	l := &Layer{version: version}
+	if version <= 0 {
+		return l
+	}
+	for _, m := range migrations {
+		if m.Version > version {
+			l.migrations = append(l.migrations, m)
+		}
+	}
+	sort.SliceStable(l.migrations, func(i, j int) bool {
+		return l.migrations[i].Version > l.migrations[j].Version
+	})
+	return l
+}
+
+// Active reports whether an earlier layout is published as well
+func (l *Layer) Active() bool {
+	return len(l.migrations) > 0
+}
+
+// Deprecated returns the changes whose earlier layout is still published,
+// oldest first
+func (l *Layer) Deprecated() []Migration {
+	result := make([]Migration, len(l.migrations))
+	for i, m := range l.migrations {
+		result[len(l.migrations)-1-i] = m
+	}
+	return result
+}
+
+// Topic returns the topic in the layout of the installation, ok is false if
+// it is the same
+func (l *Layer) Topic(topic string) (legacy string, ok bool) {
+	legacy = topic
+	for _, m := range l.migrations {
+		if m.Topic == nil {
+			continue
+		}
+		if t := m.Topic(legacy); t != "" {
+			legacy = t
+		}
+	}
+	return legacy, legacy != topic
+}
+
+// Publication is a message to publish
+type Publication struct {
+	Topic string
+	Data  []byte
+}
+
+// Publications returns the messages to publish for one of the current layout:
+// the message itself and the one in the layout of the installation if that
+// moved to another topic. A payload whose topic did not change has room for
+// one schema only, so payload migrations keep the fields of the current
+// schema and their result replaces the message.
+func (l *Layer) Publications(topic string, data []byte) []Publication {
+	legacyTopic, legacyData := topic, data
+	for _, m := range l.migrations {
+		if m.Payload != nil {
+			if d := m.Payload(legacyTopic, legacyData); d != nil {
+				legacyData = d
+			}
+		}
+		if m.Topic != nil {
+			if t := m.Topic(legacyTopic); t != "" {
+				legacyTopic = t
+			}
+		}
+	}
+
+	if legacyTopic == topic {
+		return []Publication{{Topic: topic, Data: legacyData}}
+	}
+	return []Publication{{Topic: topic, Data: data}, {Topic: legacyTopic, Data: legacyData}}
+}
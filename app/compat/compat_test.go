@@ -0,0 +1,87 @@
+package compat
+
+import (
+	"strings"
+	"testing"
+)
+
+func moveBelowSerial(topic string) string {
+	if rest, ok := strings.CutPrefix(topic, "home/lm/GS1/"); ok {
+		return "home/lm/" + rest
+	}
+	return ""
+}
+
+func renameField(topic string, data []byte) []byte {
+	if !strings.HasSuffix(topic, "/status") {
+		return nil
+	}
+	return []byte(strings.Replace(string(data), `{`, `{"old":true,`, 1))
+}
+
+func TestPublications(t *testing.T) {
+	migrations := []Migration{
+		{Version: 2, Description: "serial topics", Topic: moveBelowSerial},
+		{Version: 3, Description: "field", Payload: renameField},
+	}
+
+	tests := []struct {
+		name    string
+		version int
+		topic   string
+		want    []Publication
+	}{
+		{"current only", 0, "home/lm/GS1/status", []Publication{
+			{Topic: "home/lm/GS1/status", Data: []byte(`{"new":true}`)},
+		}},
+		{"up to date", 3, "home/lm/GS1/status", []Publication{
+			{Topic: "home/lm/GS1/status", Data: []byte(`{"new":true}`)},
+		}},
+		{"payload replaced", 2, "home/lm/GS1/status", []Publication{
+			{Topic: "home/lm/GS1/status", Data: []byte(`{"old":true,"new":true}`)},
+		}},
+		{"moved and changed", 1, "home/lm/GS1/status", []Publication{
+			{Topic: "home/lm/GS1/status", Data: []byte(`{"new":true}`)},
+			{Topic: "home/lm/status", Data: []byte(`{"old":true,"new":true}`)},
+		}},
+		{"moved", 1, "home/lm/GS1/schedule", []Publication{
+			{Topic: "home/lm/GS1/schedule", Data: []byte(`{"new":true}`)},
+			{Topic: "home/lm/schedule", Data: []byte(`{"new":true}`)},
+		}},
+		{"unaffected", 1, "home/lm/bridge/state", []Publication{
+			{Topic: "home/lm/bridge/state", Data: []byte(`{"new":true}`)},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New(tt.version, migrations...).Publications(tt.topic, []byte(`{"new":true}`))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d publications, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].Topic != tt.want[i].Topic || string(got[i].Data) != string(tt.want[i].Data) {
+					t.Errorf("publication %d = %s %s, want %s %s", i, got[i].Topic, got[i].Data, tt.want[i].Topic, tt.want[i].Data)
+				}
+			}
+		})
+	}
+}
+
+func TestTopicAndDeprecated(t *testing.T) {
+	l := New(1,
+		Migration{Version: 3, Description: "field", Payload: renameField},
+		Migration{Version: 2, Description: "serial topics", Topic: moveBelowSerial},
+	)
+
+	if legacy, ok := l.Topic("home/lm/GS1/set"); !ok || legacy != "home/lm/set" {
+		t.Errorf("Topic = %q %v, want home/lm/set true", legacy, ok)
+	}
+	if _, ok := l.Topic("home/lm/bridge/state"); ok {
+		t.Error("unaffected topic reported as moved")
+	}
+
+	deprecated := l.Deprecated()
+	if len(deprecated) != 2 || deprecated[0].Version != 2 || deprecated[1].Version != 3 {
+		t.Errorf("Deprecated = %+v, want versions 2 and 3", deprecated)
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var accountName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// AccountConfig is an additional La Marzocco account, with its own client,
+// topic namespace and state next to the main account
+type AccountConfig struct {
+	Name       string           `json:"name"`            // Lowercase identifier used in topics, file names and URLs
+	Topic      string           `json:"topic,omitempty"` // Default: <mqtt.topic>-<name>
+	LaMarzocco LaMarzoccoConfig `json:"lamarzocco"`
+	Schedules  []ScheduleEntry  `json:"schedules,omitempty"`
+	OnStart    []StartupAction  `json:"on_start,omitempty"`
+}
+
+func validateAccounts(accounts []AccountConfig) error {
+	seen := make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		if !accountName.MatchString(account.Name) {
+			return fmt.Errorf("invalid account name %q, use lowercase letters, digits, - and _", account.Name)
+		}
+		if seen[account.Name] {
+			return fmt.Errorf("duplicate account name %q", account.Name)
+		}
+		seen[account.Name] = true
+	}
+	return nil
+}
+
+// ForAccount derives the configuration of an additional account. Brew,
+// inventory and water settings are shared. Automation inputs (presence,
+// grinder, ambient, triggers), web and gRPC belong to the main account.
+func (cfg Config) ForAccount(account AccountConfig) Config {
+	result := cfg.separate(account.Name)
+	result.LaMarzocco = account.LaMarzocco
+	result.Schedules = account.Schedules
+	result.OnStart = account.OnStart
+
+	result.MQTT.Topic = account.Topic
+	if result.MQTT.Topic == "" {
+		result.MQTT.Topic = cfg.MQTT.Topic + "-" + account.Name
+	}
+	return result
+}
+
+// ForMachine derives the configuration of another machine of the same
+// account, published below <mqtt.topic>/<serial>. Like additional accounts
+// it has its own state but no automation inputs.
+func (cfg Config) ForMachine(serial, deviceID string) Config {
+	result := cfg.separate(serial)
+	result.LaMarzocco.Serial = serial
+	result.Schedules = nil
+	result.OnStart = nil
+	result.MQTT.Topic = cfg.MachineTopic(deviceID)
+	return result
+}
+
+// MachineTopic is the topic of a machine of the account below mqtt.topic,
+// deviceID is the serial or its pseudonym with redact_serial
+func (cfg Config) MachineTopic(deviceID string) string {
+	return cfg.MQTT.Topic + "/" + deviceID
+}
+
+// separate gives a derived configuration its own state and backups, and drops
+// what belongs to the main gateway only
+func (cfg Config) separate(name string) Config {
+	result := cfg
+	result.Accounts = nil
+
+	result.StateFile = accountPath(cfg.StateFile, name)
+	result.Storage.Path = accountPath(cfg.Storage.Path, name)
+	if cfg.Backup != nil {
+		backup := *cfg.Backup
+		if backup.Path != "" {
+			backup.Path = filepath.Join(backup.Path, name)
+		}
+		if backup.Topic != "" {
+			backup.Topic += "/" + name
+		}
+		result.Backup = &backup
+	}
+
+	result.Triggers = nil
+	result.Presence = nil
+	result.Grinder = nil
+	result.Ambient = nil
+	result.GRPC.Enabled = false
+	return result
+}
+
+// accountPath inserts the account name before the extension, state.db becomes state-home.db
+func accountPath(path, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
+
+func accountLaMarzocco(accounts []AccountConfig) []*LaMarzoccoConfig {
+	result := make([]*LaMarzoccoConfig, len(accounts))
+	for i := range accounts {
+		result[i] = &accounts[i].LaMarzocco
+	}
+	return result
+}
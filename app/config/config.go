@@ -2,14 +2,23 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/mqtt-home/mqtt-lamarzocco/compat"
+	"github.com/mqtt-home/mqtt-lamarzocco/expr"
+	"github.com/mqtt-home/mqtt-lamarzocco/i18n"
+	"github.com/mqtt-home/mqtt-lamarzocco/payload"
 	"github.com/philipparndt/go-logger"
 	"github.com/philipparndt/mqtt-gateway/config"
 )
 
-var cfg Config
-
 type TriggerCondition struct {
 	Selector string      `json:"selector"` // JSON path (e.g., "button", "event")
 	Value    interface{} `json:"value"`    // Expected value (number, string, bool)
@@ -19,29 +28,495 @@ type TriggerAction struct {
 	Mode string `json:"mode"` // Dose mode to set
 }
 
+type TimeWindow struct {
+	From string `json:"from"` // "HH:MM", "sunrise", "sunset" with optional offset (e.g. "sunset-30m")
+	To   string `json:"to"`
+}
+
+// Trigger sources
+const (
+	TriggerSourceMQTT = "mqtt"
+	TriggerSourceHTTP = "http"
+	TriggerSourceCron = "cron"
+)
+
+// TriggerSource replaces the MQTT topic as input of a trigger
+type TriggerSource struct {
+	Type     string `json:"type"`               // mqtt (default), http or cron
+	URL      string `json:"url,omitempty"`      // http: fetched every interval, conditions apply to the response
+	Interval int    `json:"interval,omitempty"` // http: seconds between fetches (default: 60)
+	Cron     string `json:"cron,omitempty"`     // cron: "minute hour day month weekday"
+}
+
 type Trigger struct {
-	Topic      string             `json:"topic"`
-	Conditions []TriggerCondition `json:"conditions"`
-	Action     TriggerAction      `json:"action"`
+	Name       string                 `json:"name,omitempty"` // Used in automation stats, default: trigger-<index>
+	Topic      string                 `json:"topic,omitempty"`
+	Source     *TriggerSource         `json:"source,omitempty"` // Default: the MQTT topic
+	Conditions []TriggerCondition     `json:"conditions"`
+	Action     TriggerAction          `json:"action"`
+	TimeWindow *TimeWindow            `json:"time_window,omitempty"` // Only fire within this daily window
+	When       map[string]interface{} `json:"when,omitempty"`        // Required automation variables (e.g. {"presence": "home"})
+	Expression string                 `json:"expression,omitempty"`  // Must be true as well, e.g. "payload.temperature < 18"
+}
+
+// SourceType returns the type of the trigger source, mqtt if none is set
+func (t Trigger) SourceType() string {
+	if t.Source == nil || t.Source.Type == "" {
+		return TriggerSourceMQTT
+	}
+	return t.Source.Type
+}
+
+type ScheduleEntry struct {
+	Name    string                 `json:"name,omitempty"`
+	Time    string                 `json:"time"`           // "HH:MM", "sunrise", "sunset" with optional offset (e.g. "sunrise+30m")
+	Days    []string               `json:"days,omitempty"` // "mon".."sun", "weekdays", "weekends"; empty for every day
+	Command json.RawMessage        `json:"command"`        // Same format as MQTT commands
+	When    map[string]interface{} `json:"when,omitempty"` // Required automation variables (e.g. {"presence": "home"})
+}
+
+// StartupAction runs once after the gateway connected, set one of the fields
+type StartupAction struct {
+	Refresh bool            `json:"refresh,omitempty"` // Fetch the machine state
+	Command json.RawMessage `json:"command,omitempty"` // Same format as MQTT commands, e.g. {"profile": "default"}
+	Notify  string          `json:"notify,omitempty"`  // Publish a gateway_started event with this message
+}
+
+func validateStartupActions(actions []StartupAction) error {
+	for i, action := range actions {
+		set := 0
+		for _, ok := range []bool{action.Refresh, len(action.Command) > 0, action.Notify != ""} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("on_start action %d must set exactly one of refresh, command or notify", i)
+		}
+	}
+	return nil
+}
+
+type PresenceConfig struct {
+	Topic    string      `json:"topic"`
+	Selector string      `json:"selector,omitempty"` // JSON path of the state, whole payload if empty
+	Home     interface{} `json:"home"`               // Value meaning somebody is home (e.g. "home", true)
+}
+
+type BrewConfig struct {
+	DefaultDose float64 `json:"default_dose"`       // Ground coffee per shot in grams
+	MinDose     float64 `json:"min_dose,omitempty"` // Dose targets are clamped to min_dose..max_dose (default: 5-100g)
+	MaxDose     float64 `json:"max_dose,omitempty"`
+	Dose1Input  float64 `json:"dose1_input,omitempty"` // Ground coffee for Dose1, defaults to default_dose
+	Dose2Input  float64 `json:"dose2_input,omitempty"` // Ground coffee for Dose2, defaults to default_dose
+	TargetRatio float64 `json:"target_ratio,omitempty"`
+}
+
+type MaintenanceConfig struct {
+	BackflushShots int `json:"backflush_shots,omitempty"` // Shots after which a backflush is recommended, negative disables (default: 100)
+}
+
+type GrinderConfig struct {
+	Topic    string `json:"topic"`
+	Selector string `json:"selector,omitempty"` // JSON path of the ground weight, whole payload if empty
+}
+
+type AmbientConfig struct {
+	Topic    string `json:"topic"`
+	Selector string `json:"selector,omitempty"` // JSON path of the temperature in °C, whole payload if empty
+}
+
+type RetentionConfig struct {
+	Days       int `json:"days,omitempty"`        // Keep detailed brew history for this many days
+	MaxEntries int `json:"max_entries,omitempty"` // Keep at most this many detailed entries
+}
+
+type StorageConfig struct {
+	Backend string `json:"backend,omitempty"` // "bbolt" (default), "sqlite" or "json"
+	Path    string `json:"path,omitempty"`
+
+	// 32 random bytes as hex or base64 used to encrypt the stored credentials, e.g. "${LAMARZOCCO_STATE_KEY}"
+	EncryptionKey     string `json:"encryption_key,omitempty"`
+	EncryptionKeyFile string `json:"encryption_key_file,omitempty"` // File containing the key
+}
+
+type BackupConfig struct {
+	Interval string `json:"interval,omitempty"` // Duration between snapshots (default: 24h)
+	Path     string `json:"path,omitempty"`     // Directory for snapshot files
+	Topic    string `json:"topic,omitempty"`    // Retained MQTT topic for the latest snapshot
+	Keep     int    `json:"keep,omitempty"`     // Snapshot files to keep (default: 7)
+}
+
+// CompressionConfig shrinks the payloads of selected topics
+type CompressionConfig struct {
+	Mode    string   `json:"mode"`               // "gzip" or "compact" (drop null and empty values)
+	Topics  []string `json:"topics"`             // Below mqtt.topic (e.g. "statistics") or absolute
+	MinSize int      `json:"min_size,omitempty"` // Smallest payload in bytes to gzip (default: 512)
+}
+
+type InventoryConfig struct {
+	BagSize      float64 `json:"bag_size"`      // Grams per bean bag
+	LowThreshold float64 `json:"low_threshold"` // Warn below this many grams
+}
+
+type WaterConfig struct {
+	ShotOverheadMl float64 `json:"shot_overhead_ml"` // Added to each shot's output weight
+	DefaultShotMl  float64 `json:"default_shot_ml"`  // Shots without a target weight
+	BackflushMl    float64 `json:"backflush_ml"`
+	FilterCapacity float64 `json:"filter_capacity,omitempty"` // Liters between filter changes
+}
+
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
 }
 
 type Config struct {
-	MQTT       config.MQTTConfig `json:"mqtt"`
-	LaMarzocco LaMarzoccoConfig  `json:"lamarzocco"`
-	Web        WebConfig         `json:"web"`
-	Triggers   []Trigger         `json:"triggers,omitempty"`
-	LogLevel   string            `json:"loglevel,omitempty"`
+	MQTT            config.MQTTConfig  `json:"mqtt"`
+	LaMarzocco      LaMarzoccoConfig   `json:"lamarzocco"`
+	Accounts        []AccountConfig    `json:"accounts,omitempty"` // Additional accounts
+	Web             WebConfig          `json:"web"`
+	GRPC            GRPCConfig         `json:"grpc"`
+	Triggers        []Trigger          `json:"triggers,omitempty"`
+	Notifiers       []NotifierConfig   `json:"notifiers,omitempty"`
+	Schedules       []ScheduleEntry    `json:"schedules,omitempty"`
+	OnStart         []StartupAction    `json:"on_start,omitempty"` // Run once after connecting, in order
+	Location        *Location          `json:"location,omitempty"`
+	Presence        *PresenceConfig    `json:"presence,omitempty"`
+	StateFile       string             `json:"state_file,omitempty"` // JSON state, imported into a new database
+	Storage         StorageConfig      `json:"storage"`
+	Backup          *BackupConfig      `json:"backup,omitempty"`
+	Compression     *CompressionConfig `json:"compression,omitempty"`
+	Brew            BrewConfig         `json:"brew"`
+	Inventory       *InventoryConfig   `json:"inventory,omitempty"`
+	Grinder         *GrinderConfig     `json:"grinder,omitempty"`
+	Ambient         *AmbientConfig     `json:"ambient,omitempty"` // Room temperature used for warm-up learning
+	Water           *WaterConfig       `json:"water,omitempty"`
+	Retention       RetentionConfig    `json:"retention"`
+	Maintenance     MaintenanceConfig  `json:"maintenance"`
+	AutomationStats bool               `json:"automation_stats,omitempty"` // Publish automation stats retained to <topic>/automation/<kind>/<name>
+	StatusTopics    bool               `json:"status_topics,omitempty"`    // Publish each status value retained to <topic>/status/<path> as well
+	VacationDays    int                `json:"vacation_days,omitempty"`    // Suspend auto-on schedules after this many days without brews
+	FlapWindow      int                `json:"flap_window,omitempty"`      // Seconds an outage must last before its events are published
+	MorningReport   string             `json:"morning_report,omitempty"`   // Time of day ("HH:MM") to publish the morning_report event
+	// Command kinds (e.g. "backflush", "dose1") queued until the machine is on and the coffee boiler ready
+	DeferUntilReady []string `json:"defer_until_ready,omitempty"`
+	CompatVersion   int      `json:"compat_version,omitempty"` // Keep publishing the topics and payloads of this layout version, default: the current one only
+	Timezone        string   `json:"timezone,omitempty"`       // IANA name (e.g. "Europe/Berlin"), defaults to the system time zone
+	Language        string   `json:"language,omitempty"`       // Language of event messages: "en", "de", "it"
+	LogLevel        string   `json:"loglevel,omitempty"`
 }
 
 type WebConfig struct {
+	Enabled bool     `json:"enabled"`
+	Port    int      `json:"port"`
+	Listen  []string `json:"listen,omitempty"` // host:port or unix socket paths, replaces port
+	// IPs or CIDR ranges of reverse proxies whose X-Forwarded-* headers are honored
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
+	GraphQL        bool     `json:"graphql,omitempty"` // Enable /api/graphql
+	// Bearer token of the admin endpoints that are not enabled by default
+	AdminToken  string `json:"admin_token,omitempty"`
+	RawCommands bool   `json:"raw_commands,omitempty"` // Enable /api/raw/command/{name}, requires admin_token
+	// Login for the web UI and API, open to everybody who can reach it if unset
+	Auth *WebAuthConfig `json:"auth,omitempty"`
+}
+
+// Auth providers of the web UI and API
+const (
+	AuthToken   = "token"   // Static bearer token
+	AuthBasic   = "basic"   // HTTP basic auth with the configured users
+	AuthForward = "forward" // User name in a header set by an SSO reverse proxy
+)
+
+// WebAuthConfig selects how requests to the web UI and API are authenticated
+type WebAuthConfig struct {
+	Provider string    `json:"provider"`         // token, basic or forward
+	Token    string    `json:"token,omitempty"`  // token: accepted as "Authorization: Bearer <token>"
+	Users    []WebUser `json:"users,omitempty"`  // basic: accounts that may log in
+	Header   string    `json:"header,omitempty"` // forward: header with the user name, default Remote-User
+	// forward: users allowed in, default all users the proxy authenticated
+	AllowedUsers []string `json:"allowed_users,omitempty"`
+}
+
+type WebUser struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func validateWebAuth(web WebConfig) error {
+	auth := web.Auth
+	if auth == nil {
+		return nil
+	}
+	switch auth.Provider {
+	case AuthToken:
+		if auth.Token == "" {
+			return fmt.Errorf("web.auth provider token requires a token")
+		}
+	case AuthBasic:
+		if len(auth.Users) == 0 {
+			return fmt.Errorf("web.auth provider basic requires users")
+		}
+		for i, user := range auth.Users {
+			if user.Username == "" || user.Password == "" || strings.Contains(user.Username, ":") {
+				return fmt.Errorf("web.auth user %d needs a username without colon and a password", i)
+			}
+		}
+	case AuthForward:
+		// The header is trusted from the proxy only, everybody else could set it
+		if len(web.TrustedProxies) == 0 && !slices.ContainsFunc(web.Listen, func(address string) bool {
+			_, ok := UnixSocketPath(address)
+			return ok
+		}) {
+			return fmt.Errorf("web.auth provider forward requires web.trusted_proxies or a unix socket")
+		}
+	default:
+		return fmt.Errorf("unknown web.auth provider %q", auth.Provider)
+	}
+	return nil
+}
+
+// Addresses returns the addresses to listen on, all interfaces on port unless listen is set
+func (c WebConfig) Addresses() []string {
+	if len(c.Listen) > 0 {
+		return c.Listen
+	}
+	return []string{fmt.Sprintf(":%d", c.Port)}
+}
+
+// UnixSocketPath returns the path of a listen address that is a unix socket,
+// either an absolute path or "unix:<path>"
+func UnixSocketPath(address string) (string, bool) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return path, true
+	}
+	return address, filepath.IsAbs(address)
+}
+
+// TrustedProxyPrefixes returns the trusted proxies as prefixes, single IPs
+// match exactly. Invalid entries are rejected by LoadConfig.
+func (c WebConfig) TrustedProxyPrefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, proxy := range c.TrustedProxies {
+		if prefix, err := parseTrustedProxy(proxy); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func parseTrustedProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func validateTriggers(triggers []Trigger) error {
+	for i, t := range triggers {
+		switch t.SourceType() {
+		case TriggerSourceMQTT:
+			if t.Topic == "" {
+				return fmt.Errorf("trigger %d requires a topic", i)
+			}
+		case TriggerSourceHTTP:
+			if t.Source.URL == "" {
+				return fmt.Errorf("http trigger %d requires a url", i)
+			}
+		case TriggerSourceCron:
+			if t.Source.Cron == "" {
+				return fmt.Errorf("cron trigger %d requires a cron expression", i)
+			}
+		default:
+			return fmt.Errorf("trigger %d has unknown source %q, must be mqtt, http or cron", i, t.Source.Type)
+		}
+		if t.Expression != "" {
+			if _, err := expr.Compile(t.Expression); err != nil {
+				return fmt.Errorf("trigger %d has an invalid expression: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// deferrableCommands are the command kinds defer_until_ready accepts. Power
+// is not among them, the machine only gets ready after it.
+var deferrableCommands = []string{"profile", "ratio", "dose1", "dose2", "mode", "backflush", "steam", "steam_level",
+	"pre_extraction", "hot_water", "cupwarmer", "baristalights", "scale"}
+
+func validateDeferUntilReady(kinds []string) error {
+	for _, kind := range kinds {
+		if !slices.Contains(deferrableCommands, kind) {
+			return fmt.Errorf("defer_until_ready: unknown command %q, expected one of %s", kind, strings.Join(deferrableCommands, ", "))
+		}
+	}
+	return nil
+}
+
+func validateNotifiers(notifiers []NotifierConfig) error {
+	names := make(map[string]bool)
+	for _, n := range notifiers {
+		if n.Name == "" {
+			return fmt.Errorf("notifier without name")
+		}
+		if names[n.Name] {
+			return fmt.Errorf("duplicate notifier %q", n.Name)
+		}
+		names[n.Name] = true
+		if n.URL == "" {
+			return fmt.Errorf("notifier %q requires a url", n.Name)
+		}
+	}
+	return nil
+}
+
+func validateListen(addresses []string) error {
+	for _, address := range addresses {
+		if path, ok := UnixSocketPath(address); ok {
+			if path == "" {
+				return fmt.Errorf("unix socket address %q has no path", address)
+			}
+			continue
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("invalid listen address %q: %w", address, err)
+		}
+	}
+	return nil
+}
+
+// NotifierConfig sends events to a webhook or notification service. URL,
+// header values and body are Go templates over the event and the status.
+type NotifierConfig struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`  // Default: POST
+	Headers map[string]string `json:"headers,omitempty"` // e.g. ntfy "Priority"
+	Body    string            `json:"body,omitempty"`    // Default: the event as JSON
+	Events  []string          `json:"events,omitempty"`  // Event types, empty for all
+}
+
+// RetryConfig retries cloud requests after server errors, timeouts and dropped connections
+type RetryConfig struct {
+	Attempts  int     `json:"attempts"`         // Total attempts, 1 disables retries (default: 3)
+	BaseDelay float64 `json:"base_delay"`       // Seconds before the second attempt, doubled after each one (default: 0.5)
+	Jitter    float64 `json:"jitter,omitempty"` // Random share of each delay, 0 to 1
+	// Retry commands after timeouts and server errors too, they may run twice
+	Commands bool `json:"commands,omitempty"`
+}
+
+// CircuitBreakerConfig suspends cloud requests after consecutive failures and probes with increasing delays
+type CircuitBreakerConfig struct {
+	Failures  int `json:"failures"`             // Consecutive failures that open the circuit, negative disables (default: 5)
+	BaseDelay int `json:"base_delay,omitempty"` // Seconds until the first probe, doubled after each failed one (default: 30)
+	MaxDelay  int `json:"max_delay,omitempty"`  // Seconds (default: 600)
+}
+
+// AuthBackoffConfig spaces out sign-ins after the credentials were rejected
+type AuthBackoffConfig struct {
+	BaseDelay int `json:"base_delay,omitempty"` // Seconds after the first rejected sign-in, doubled after each one (default: 60)
+	MaxDelay  int `json:"max_delay,omitempty"`  // Seconds (default: 3600)
+}
+
+// IdentityConfig is sent with every request to the cloud, e.g. to introduce
+// the gateway as a specific app version should the cloud require one
+type IdentityConfig struct {
+	UserAgent string            `json:"user_agent,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"` // e.g. {"X-App-Version": "5.2.0"}
+}
+
+// RateLimitConfig limits outgoing machine commands with a token bucket
+type RateLimitConfig struct {
+	Rate    float64 `json:"rate"`               // Commands per minute, negative disables (default: 20)
+	Burst   int     `json:"burst,omitempty"`    // Commands sent without delay after a quiet period (default: 10)
+	MaxWait float64 `json:"max_wait,omitempty"` // Seconds a command may be delayed before it is rejected (default: 30)
+}
+
+// PollBudgetConfig limits the status polls of all machines of an account
+type PollBudgetConfig struct {
+	Rate  float64 `json:"rate"`            // Polls per minute, negative disables (default: 20)
+	Burst int     `json:"burst,omitempty"` // Polls sent without delay after a quiet period (default: 4)
+}
+
+type GRPCConfig struct {
 	Enabled bool `json:"enabled"`
 	Port    int  `json:"port"`
 }
 
 type LaMarzoccoConfig struct {
-	Username        string `json:"username"`
-	Password        string `json:"password"`
-	PollingInterval int    `json:"polling_interval"`
+	Username        string                `json:"username"`
+	Password        string                `json:"password"`
+	Serial          string                `json:"serial,omitempty"` // Machine served on the main topic, default: the first of the account
+	PollingInterval int                   `json:"polling_interval"`
+	Streaming       *bool                 `json:"streaming,omitempty"` // Receive live updates over the cloud websocket (default: true)
+	StatsInterval   int                   `json:"statistics_interval"` // Seconds between statistics fetches, negative disables
+	ThingsInterval  int                   `json:"things_interval"`     // Seconds between checks for machines added to or removed from the account, negative disables
+	Calibration     *CalibrationConfig    `json:"calibration,omitempty"`
+	Transports      []TransportConfig     `json:"transports,omitempty"` // Priority order, default: cloud only
+	Retry           *RetryConfig          `json:"retry,omitempty"`
+	CircuitBreaker  *CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+	RateLimit       *RateLimitConfig      `json:"rate_limit,omitempty"`
+	PollBudget      *PollBudgetConfig     `json:"poll_budget,omitempty"` // Shared by the machines of the account
+	AuthBackoff     *AuthBackoffConfig    `json:"auth_backoff,omitempty"`
+	Identity        *IdentityConfig       `json:"identity,omitempty"`      // How the gateway introduces itself to the cloud
+	DoseDebounce    float64               `json:"dose_debounce,omitempty"` // Seconds without a new dose target before it is sent, negative disables
+	PollFailures    int                   `json:"poll_failures,omitempty"` // Consecutive failed polls until the status is disconnected, negative disables
+	SerialTopics    bool                  `json:"serial_topics,omitempty"` // Publish the first machine below <topic>/<serial> as well
+	RedactSerial    bool                  `json:"redact_serial,omitempty"` // Replace the serial in topics, payloads and logs with a pseudonymous ID
+}
+
+// TransportConfig is a path to the machine, the next one is used when it fails
+type TransportConfig struct {
+	Type  string `json:"type"`            // "cloud" or "local"
+	URL   string `json:"url,omitempty"`   // Local endpoint serving the cloud API format
+	Token string `json:"token,omitempty"` // Bearer token of the local endpoint
+}
+
+// HasTransport reports whether a transport of the type is configured
+func (c LaMarzoccoConfig) HasTransport(transportType string) bool {
+	for _, t := range c.Transports {
+		if t.Type == transportType {
+			return true
+		}
+	}
+	return false
+}
+
+func validateTransports(transports []TransportConfig) error {
+	for _, t := range transports {
+		switch t.Type {
+		case "cloud":
+		case "local":
+			if t.URL == "" {
+				return fmt.Errorf("local transport requires a url")
+			}
+		case "ble":
+			return fmt.Errorf("ble transport is not supported yet")
+		default:
+			return fmt.Errorf("unknown transport %q, must be cloud or local", t.Type)
+		}
+	}
+	return nil
+}
+
+// StreamingEnabled reports whether live updates are received, polling remains the fallback
+func (c LaMarzoccoConfig) StreamingEnabled() bool {
+	return c.Streaming == nil || *c.Streaming
+}
+
+// CalibrationConfig holds offsets in grams applied to brew-by-weight targets
+type CalibrationConfig struct {
+	Dose1 float64 `json:"dose1"`
+	Dose2 float64 `json:"dose2"`
 }
 
 func LoadConfig(file string) (Config, error) {
@@ -53,28 +528,276 @@ func LoadConfig(file string) (Config, error) {
 
 	data = config.ReplaceEnvVariables(data)
 
+	var cfg Config
 	err = json.Unmarshal(data, &cfg)
 	if err != nil {
 		logger.Error("Unmarshaling JSON:", err)
 		return Config{}, err
 	}
 
+	if cfg.Timezone != "" {
+		if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+			logger.Error("Invalid timezone", "timezone", cfg.Timezone, "error", err)
+			return Config{}, err
+		}
+	}
+
+	if cfg.CompatVersion < 0 || cfg.CompatVersion > compat.Current {
+		logger.Error("Invalid compat version", "compat_version", cfg.CompatVersion)
+		return Config{}, fmt.Errorf("compat_version must be between 1 and %d, got %d", compat.Current, cfg.CompatVersion)
+	}
+
+	if cfg.FlapWindow < 0 {
+		logger.Error("Invalid flap window", "flap_window", cfg.FlapWindow)
+		return Config{}, fmt.Errorf("flap_window must not be negative, got %d", cfg.FlapWindow)
+	}
+
+	if cfg.MorningReport != "" {
+		if _, err := time.Parse("15:04", cfg.MorningReport); err != nil {
+			logger.Error("Invalid morning report time", "morning_report", cfg.MorningReport)
+			return Config{}, fmt.Errorf("morning_report must be HH:MM, got %q", cfg.MorningReport)
+		}
+	}
+
+	if err := validateDeferUntilReady(cfg.DeferUntilReady); err != nil {
+		logger.Error("Invalid defer_until_ready", "error", err)
+		return Config{}, err
+	}
+
+	if cfg.Language != "" && !i18n.Supported(cfg.Language) {
+		logger.Warn("Unsupported language, using English for messages", "language", cfg.Language)
+	}
+
 	// Set default values
 	if cfg.LogLevel == "" {
 		cfg.LogLevel = "info"
 	}
+	if cfg.Maintenance.BackflushShots == 0 {
+		cfg.Maintenance.BackflushShots = 100
+	}
+
+	if err := validateAccounts(cfg.Accounts); err != nil {
+		logger.Error("Invalid accounts", "error", err)
+		return Config{}, err
+	}
 
-	if cfg.LaMarzocco.PollingInterval == 0 {
-		cfg.LaMarzocco.PollingInterval = 30
+	for _, lm := range append([]*LaMarzoccoConfig{&cfg.LaMarzocco}, accountLaMarzocco(cfg.Accounts)...) {
+		if lm.PollingInterval == 0 {
+			lm.PollingInterval = 30
+		}
+		if lm.StatsInterval == 0 {
+			lm.StatsInterval = 900
+		}
+		if lm.ThingsInterval == 0 {
+			lm.ThingsInterval = 3600
+		}
+		if lm.DoseDebounce == 0 {
+			lm.DoseDebounce = 0.5
+		}
+		if lm.PollFailures == 0 {
+			lm.PollFailures = 3
+		}
+		if err := validateTransports(lm.Transports); err != nil {
+			logger.Error("Invalid transports", "error", err)
+			return Config{}, err
+		}
+		if lm.Identity != nil {
+			for name := range lm.Identity.Headers {
+				if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " :\r\n") {
+					logger.Error("Invalid identity header", "header", name)
+					return Config{}, fmt.Errorf("invalid identity header name %q", name)
+				}
+			}
+		}
+		if lm.Retry != nil {
+			if lm.Retry.Attempts <= 0 {
+				lm.Retry.Attempts = 3
+			}
+			if lm.Retry.BaseDelay <= 0 {
+				lm.Retry.BaseDelay = 0.5
+			}
+			if lm.Retry.Jitter < 0 || lm.Retry.Jitter > 1 {
+				logger.Error("Invalid retry jitter", "jitter", lm.Retry.Jitter)
+				return Config{}, fmt.Errorf("retry jitter must be between 0 and 1, got %v", lm.Retry.Jitter)
+			}
+		}
+		if lm.CircuitBreaker != nil {
+			if lm.CircuitBreaker.Failures == 0 {
+				lm.CircuitBreaker.Failures = 5
+			}
+			if lm.CircuitBreaker.BaseDelay <= 0 {
+				lm.CircuitBreaker.BaseDelay = 30
+			}
+			if lm.CircuitBreaker.MaxDelay <= 0 {
+				lm.CircuitBreaker.MaxDelay = 600
+			}
+		}
+		if lm.AuthBackoff != nil {
+			if lm.AuthBackoff.BaseDelay <= 0 {
+				lm.AuthBackoff.BaseDelay = 60
+			}
+			if lm.AuthBackoff.MaxDelay <= 0 {
+				lm.AuthBackoff.MaxDelay = 3600
+			}
+		}
+		if lm.RateLimit != nil {
+			if lm.RateLimit.Rate == 0 {
+				lm.RateLimit.Rate = 20
+			}
+			if lm.RateLimit.Burst <= 0 {
+				lm.RateLimit.Burst = 10
+			}
+			if lm.RateLimit.MaxWait <= 0 {
+				lm.RateLimit.MaxWait = 30
+			}
+		}
+		if lm.PollBudget != nil {
+			if lm.PollBudget.Rate == 0 {
+				lm.PollBudget.Rate = 20
+			}
+			if lm.PollBudget.Burst <= 0 {
+				lm.PollBudget.Burst = 4
+			}
+		}
+		if lm.Streaming == nil {
+			streaming := true
+			lm.Streaming = &streaming
+		}
+	}
+
+	if cfg.StateFile == "" {
+		cfg.StateFile = filepath.Join(filepath.Dir(file), "state.json")
+	}
+
+	if cfg.Storage.Backend == "" {
+		cfg.Storage.Backend = "bbolt"
+	}
+	if cfg.Storage.Path == "" {
+		switch cfg.Storage.Backend {
+		case "json":
+			cfg.Storage.Path = cfg.StateFile
+		case "sqlite":
+			cfg.Storage.Path = filepath.Join(filepath.Dir(file), "state.sqlite")
+		default:
+			cfg.Storage.Path = filepath.Join(filepath.Dir(file), "state.db")
+		}
+	}
+
+	if cfg.Brew.DefaultDose == 0 {
+		cfg.Brew.DefaultDose = 18
+	}
+	if cfg.Brew.MinDose == 0 {
+		cfg.Brew.MinDose = 5
+	}
+	if cfg.Brew.MaxDose == 0 {
+		cfg.Brew.MaxDose = 100
+	}
+	if cfg.Brew.MinDose > cfg.Brew.MaxDose {
+		return Config{}, fmt.Errorf("brew.min_dose %v exceeds brew.max_dose %v", cfg.Brew.MinDose, cfg.Brew.MaxDose)
+	}
+	if cfg.Brew.Dose1Input == 0 {
+		cfg.Brew.Dose1Input = cfg.Brew.DefaultDose
+	}
+	if cfg.Brew.Dose2Input == 0 {
+		cfg.Brew.Dose2Input = cfg.Brew.DefaultDose
+	}
+
+	if cfg.Inventory != nil {
+		if cfg.Inventory.BagSize == 0 {
+			cfg.Inventory.BagSize = 1000
+		}
+		if cfg.Inventory.LowThreshold == 0 {
+			cfg.Inventory.LowThreshold = 100
+		}
+	}
+
+	if cfg.Water != nil {
+		if cfg.Water.ShotOverheadMl == 0 {
+			cfg.Water.ShotOverheadMl = 30
+		}
+		if cfg.Water.DefaultShotMl == 0 {
+			cfg.Water.DefaultShotMl = 40
+		}
+		if cfg.Water.BackflushMl == 0 {
+			cfg.Water.BackflushMl = 500
+		}
+	}
+
+	if cfg.Backup != nil {
+		if cfg.Backup.Interval == "" {
+			cfg.Backup.Interval = "24h"
+		}
+		if interval, err := time.ParseDuration(cfg.Backup.Interval); err != nil || interval <= 0 {
+			logger.Error("Invalid backup interval", "interval", cfg.Backup.Interval)
+			return Config{}, fmt.Errorf("invalid backup interval %q", cfg.Backup.Interval)
+		}
+	}
+
+	if cfg.Compression != nil {
+		if !payload.Valid(cfg.Compression.Mode) {
+			logger.Error("Invalid compression mode", "mode", cfg.Compression.Mode)
+			return Config{}, fmt.Errorf("invalid compression mode %q, must be gzip or compact", cfg.Compression.Mode)
+		}
+		if cfg.Compression.MinSize == 0 {
+			cfg.Compression.MinSize = payload.DefaultMinSize
+		}
+	}
+
+	if cfg.Retention.MaxEntries == 0 {
+		cfg.Retention.MaxEntries = 1000
 	}
 
 	if cfg.Web.Port == 0 {
 		cfg.Web.Port = 8080
 	}
+	if err := validateListen(cfg.Web.Listen); err != nil {
+		logger.Error("Invalid web listen addresses", "error", err)
+		return Config{}, err
+	}
+	if err := validateTriggers(cfg.Triggers); err != nil {
+		logger.Error("Invalid triggers", "error", err)
+		return Config{}, err
+	}
+	for _, t := range cfg.Triggers {
+		if t.SourceType() == TriggerSourceHTTP && t.Source.Interval <= 0 {
+			t.Source.Interval = 60
+		}
+	}
+	if err := validateStartupActions(cfg.OnStart); err != nil {
+		logger.Error("Invalid on_start actions", "error", err)
+		return Config{}, err
+	}
+	for _, account := range cfg.Accounts {
+		if err := validateStartupActions(account.OnStart); err != nil {
+			logger.Error("Invalid on_start actions", "account", account.Name, "error", err)
+			return Config{}, err
+		}
+	}
+	if err := validateNotifiers(cfg.Notifiers); err != nil {
+		logger.Error("Invalid notifiers", "error", err)
+		return Config{}, err
+	}
+	if cfg.Web.RawCommands && cfg.Web.AdminToken == "" {
+		logger.Error("Raw commands require an admin token")
+		return Config{}, fmt.Errorf("web.raw_commands requires web.admin_token")
+	}
+	for _, proxy := range cfg.Web.TrustedProxies {
+		if _, err := parseTrustedProxy(proxy); err != nil {
+			logger.Error("Invalid trusted proxy", "proxy", proxy, "error", err)
+			return Config{}, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+	}
+	if err := validateWebAuth(cfg.Web); err != nil {
+		logger.Error("Invalid web auth", "error", err)
+		return Config{}, err
+	}
+	if cfg.Web.Auth != nil && cfg.Web.Auth.Provider == AuthForward && cfg.Web.Auth.Header == "" {
+		cfg.Web.Auth.Header = "Remote-User"
+	}
 
-	return cfg, nil
-}
+	if cfg.GRPC.Port == 0 {
+		cfg.GRPC.Port = 9090
+	}
 
-func Get() Config {
-	return cfg
+	return cfg, nil
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/selftest"
+	"github.com/mqtt-home/mqtt-lamarzocco/version"
+)
+
+// conformanceReport describes how much of a machine the gateway understands.
+// It leaves out the serial and account, so users can attach it to an issue.
+type conformanceReport struct {
+	selftest.Report
+	GatewayVersion       string                    `json:"gatewayVersion"`
+	Model                string                    `json:"model,omitempty"`
+	Widgets              []string                  `json:"widgets"`              // Codes of the dashboard widgets
+	UnknownWidgets       []lamarzocco.RawWidget    `json:"unknownWidgets"`       // Widgets the gateway cannot read
+	UnknownStates        []lamarzocco.UnknownState `json:"unknownStates"`        // Status values the gateway does not know
+	UnsupportedEndpoints []string                  `json:"unsupportedEndpoints"` // Endpoints the cloud rejected for the machine
+}
+
+// conformance runs read-only checks against the machine of the account. The
+// client must be created WithReadOnly, so a check can never change the machine.
+func (g *gateway) conformance() conformanceReport {
+	report := conformanceReport{
+		GatewayVersion:       version.Version,
+		UnsupportedEndpoints: []string{},
+	}
+
+	report.Report = selftest.Run([]selftest.Check{
+		{Name: "cloud_auth", Run: g.checkCloudAuth},
+		{Name: "machine", Run: g.conformanceMachine},
+		{Name: "dashboard", Run: g.conformanceDashboard},
+		{Name: "statistics", Run: func() (string, error) {
+			return g.conformanceEndpoint(&report, "stats", func() error {
+				_, err := g.client.GetStatistics(g.ctx)
+				return err
+			})
+		}},
+		{Name: "schedules", Run: func() (string, error) {
+			return g.conformanceEndpoint(&report, "scheduling", func() error {
+				_, err := g.client.FetchSchedule(g.ctx)
+				return err
+			})
+		}},
+	})
+
+	report.Model = g.client.GetStatus().Model
+	report.Widgets = g.client.DashboardWidgets()
+	report.UnknownWidgets = g.client.UnknownWidgets()
+	report.UnknownStates = g.client.UnknownStates()
+	return report
+}
+
+func (g *gateway) conformanceMachine() (string, error) {
+	if err := g.client.Connect(g.ctx); err != nil {
+		return "", err
+	}
+	status := g.client.GetStatus()
+	return fmt.Sprintf("%s reachable via %s, %d machines in the account", status.Model, status.Transport, len(g.client.Things())), nil
+}
+
+// conformanceDashboard reports how many widgets of the dashboard were read
+func (g *gateway) conformanceDashboard() (string, error) {
+	widgets := g.client.DashboardWidgets()
+	if len(widgets) == 0 {
+		return "", errors.New("the dashboard has no widgets")
+	}
+	unknown := g.client.UnknownWidgets()
+	return fmt.Sprintf("%d of %d widgets read", len(widgets)-len(unknown), len(widgets)), nil
+}
+
+// conformanceEndpoint runs a read-only request. An endpoint the cloud does
+// not offer for the machine is listed in the report instead of failing.
+func (g *gateway) conformanceEndpoint(report *conformanceReport, endpoint string, fetch func() error) (string, error) {
+	err := fetch()
+	var statusErr *lamarzocco.StatusError
+	switch {
+	case err == nil:
+		return "supported", nil
+	case errors.Is(err, lamarzocco.ErrNotSupported):
+		return "disabled by the machine capabilities", nil
+	case errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusMethodNotAllowed):
+		report.UnsupportedEndpoints = append(report.UnsupportedEndpoints, endpoint)
+		return fmt.Sprintf("not offered for this machine (%d)", statusErr.StatusCode), nil
+	}
+	return "", err
+}
@@ -0,0 +1,197 @@
+package export
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+)
+
+// StatisticRow is an hourly row as expected by Home Assistant's
+// recorder.import_statistics
+type StatisticRow struct {
+	Start time.Time `json:"start"`
+	Mean  *float64  `json:"mean,omitempty"`
+	Min   *float64  `json:"min,omitempty"`
+	Max   *float64  `json:"max,omitempty"`
+	State *float64  `json:"state,omitempty"`
+	Sum   *float64  `json:"sum,omitempty"`
+}
+
+// Statistic is the metadata and rows of one Home Assistant statistic
+type Statistic struct {
+	StatisticID       string         `json:"statistic_id"`
+	Source            string         `json:"source"`
+	Name              string         `json:"name"`
+	UnitOfMeasurement string         `json:"unit_of_measurement,omitempty"`
+	HasMean           bool           `json:"has_mean"`
+	HasSum            bool           `json:"has_sum"`
+	Stats             []StatisticRow `json:"stats"`
+}
+
+// EntityID builds the entity ID of a sensor of the given machine
+func EntityID(serial, sensor string) string {
+	return "sensor.lamarzocco_" + strings.ToLower(serial) + "_" + sensor
+}
+
+// Filter returns the records with a start time within [from, to), zero times are unbounded
+func Filter(records []state.BrewRecord, from, to time.Time) []state.BrewRecord {
+	var result []state.BrewRecord
+	for _, record := range records {
+		if !from.IsZero() && record.StartedAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !record.StartedAt.Before(to) {
+			continue
+		}
+		result = append(result, record)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt.Before(result[j].StartedAt)
+	})
+	return result
+}
+
+type hourBucket struct {
+	shots   float64
+	ratios  []float64
+	weights []float64
+	ratings []float64
+}
+
+// HomeAssistantStatistics aggregates brew records into hourly statistics for
+// shot count, brew ratio and target weight
+func HomeAssistantStatistics(serial string, records []state.BrewRecord) []Statistic {
+	buckets := make(map[time.Time]*hourBucket)
+	var hoursOrdered []time.Time
+	for _, record := range records {
+		hour := record.StartedAt.UTC().Truncate(time.Hour)
+		bucket, ok := buckets[hour]
+		if !ok {
+			bucket = &hourBucket{}
+			buckets[hour] = bucket
+			hoursOrdered = append(hoursOrdered, hour)
+		}
+		bucket.shots++
+		if record.Ratio > 0 {
+			bucket.ratios = append(bucket.ratios, record.Ratio)
+		}
+		if record.TargetWeight > 0 {
+			bucket.weights = append(bucket.weights, record.TargetWeight)
+		}
+		if record.Rating > 0 {
+			bucket.ratings = append(bucket.ratings, float64(record.Rating))
+		}
+	}
+	sort.Slice(hoursOrdered, func(i, j int) bool {
+		return hoursOrdered[i].Before(hoursOrdered[j])
+	})
+
+	shots := Statistic{
+		StatisticID:       EntityID(serial, "shots"),
+		Source:            "recorder",
+		Name:              "La Marzocco shots",
+		UnitOfMeasurement: "shots",
+		HasSum:            true,
+	}
+	ratio := Statistic{
+		StatisticID: EntityID(serial, "brew_ratio"),
+		Source:      "recorder",
+		Name:        "La Marzocco brew ratio",
+		HasMean:     true,
+	}
+	weight := Statistic{
+		StatisticID:       EntityID(serial, "target_weight"),
+		Source:            "recorder",
+		Name:              "La Marzocco target weight",
+		UnitOfMeasurement: "g",
+		HasMean:           true,
+	}
+	rating := Statistic{
+		StatisticID: EntityID(serial, "rating"),
+		Source:      "recorder",
+		Name:        "La Marzocco shot rating",
+		HasMean:     true,
+	}
+
+	total := 0.0
+	for _, hour := range hoursOrdered {
+		bucket := buckets[hour]
+		total += bucket.shots
+		shots.Stats = append(shots.Stats, StatisticRow{
+			Start: hour,
+			State: ptr(bucket.shots),
+			Sum:   ptr(total),
+		})
+		if row, ok := meanRow(hour, bucket.ratios); ok {
+			ratio.Stats = append(ratio.Stats, row)
+		}
+		if row, ok := meanRow(hour, bucket.weights); ok {
+			weight.Stats = append(weight.Stats, row)
+		}
+		if row, ok := meanRow(hour, bucket.ratings); ok {
+			rating.Stats = append(rating.Stats, row)
+		}
+	}
+
+	return []Statistic{shots, ratio, weight, rating}
+}
+
+// InfluxLines renders brew records in InfluxDB line protocol
+func InfluxLines(serial string, records []state.BrewRecord) string {
+	var sb strings.Builder
+	for _, record := range records {
+		sb.WriteString("lamarzocco_brew,entity_id=")
+		sb.WriteString(escapeTag(EntityID(serial, "shots")))
+		sb.WriteString(",mode=")
+		sb.WriteString(escapeTag(string(record.Mode)))
+		if record.Profile != "" {
+			sb.WriteString(",profile=")
+			sb.WriteString(escapeTag(record.Profile))
+		}
+		fmt.Fprintf(&sb, " duration=%g,target_weight=%g,dose=%g,ratio=%g",
+			record.Duration, record.TargetWeight, record.Dose, record.Ratio)
+		if record.Rating > 0 {
+			fmt.Fprintf(&sb, ",rating=%d", record.Rating)
+		}
+		if record.Note != "" {
+			sb.WriteString(",note=")
+			sb.WriteString(quoteField(record.Note))
+		}
+		fmt.Fprintf(&sb, " %d\n", record.StartedAt.UnixNano())
+	}
+	return sb.String()
+}
+
+func meanRow(hour time.Time, values []float64) (StatisticRow, bool) {
+	if len(values) == 0 {
+		return StatisticRow{}, false
+	}
+	sum, lo, hi := 0.0, math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		sum += v
+		lo = math.Min(lo, v)
+		hi = math.Max(hi, v)
+	}
+	return StatisticRow{
+		Start: hour,
+		Mean:  ptr(math.Round(sum/float64(len(values))*100) / 100),
+		Min:   ptr(lo),
+		Max:   ptr(hi),
+	}, true
+}
+
+func escapeTag(value string) string {
+	return strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ").Replace(value)
+}
+
+func quoteField(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
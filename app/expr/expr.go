@@ -0,0 +1,374 @@
+// Package expr evaluates small expressions for automation conditions, e.g.
+//
+//	payload.temperature < 18 && vars.presence == "home" && time.hour >= 6
+//
+// Values are JSON-like: numbers (float64), strings, booleans, null, lists and
+// objects. Members of missing values are null instead of an error, so
+// optional payload fields can be compared directly.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Expression is a parsed expression, safe for concurrent use
+type Expression struct {
+	source string
+	root   node
+}
+
+// Compile parses an expression, errors point at the offending position
+func Compile(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression with env as the top-level names
+func (e *Expression) Eval(env map[string]interface{}) (interface{}, error) {
+	return e.root.eval(env)
+}
+
+// Match evaluates the expression, which must result in a boolean
+func (e *Expression) Match(env map[string]interface{}) (bool, error) {
+	value, err := e.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s, expected a boolean", typeName(value))
+	}
+	return b, nil
+}
+
+type node interface {
+	eval(env map[string]interface{}) (interface{}, error)
+}
+
+type literal struct{ value interface{} }
+
+func (n literal) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type identifier struct{ name string }
+
+func (n identifier) eval(env map[string]interface{}) (interface{}, error) {
+	value, ok := env[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown name %q", n.name)
+	}
+	return value, nil
+}
+
+type member struct {
+	object node
+	key    node
+}
+
+func (n member) eval(env map[string]interface{}) (interface{}, error) {
+	object, err := n.object.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := object.(type) {
+	case map[string]interface{}:
+		k, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("object key must be a string, got %s", typeName(key))
+		}
+		return o[k], nil
+	case []interface{}:
+		i, ok := key.(float64)
+		if !ok || i != math.Trunc(i) {
+			return nil, fmt.Errorf("list index must be an integer, got %s", typeName(key))
+		}
+		if i < 0 || int(i) >= len(o) {
+			return nil, nil
+		}
+		return o[int(i)], nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("cannot access %v of %s", key, typeName(object))
+	}
+}
+
+type list struct{ items []node }
+
+func (n list) eval(env map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+type unary struct {
+	op      string
+	operand node
+}
+
+func (n unary) eval(env map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "!":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! expects a boolean, got %s", typeName(value))
+		}
+		return !b, nil
+	default: // "-"
+		f, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("- expects a number, got %s", typeName(value))
+		}
+		return -f, nil
+	}
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (n binary) eval(env map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit, the right side may rely on the left one (e.g. a != null && a.b)
+	if n.op == "&&" || n.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects booleans, got %s", n.op, typeName(left))
+		}
+		if l == (n.op == "||") {
+			return l, nil
+		}
+		right, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects booleans, got %s", n.op, typeName(right))
+		}
+		return r, nil
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return contains(right, left)
+	case "<", "<=", ">", ">=":
+		return compare(n.op, left, right)
+	case "+":
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		}
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("%s expects numbers, got %s and %s", n.op, typeName(left), typeName(right))
+	}
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	default: // "%"
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(l, r), nil
+	}
+}
+
+type call struct {
+	name string
+	args []node
+}
+
+func (n call) eval(env map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	return functions[n.name].call(args)
+}
+
+// equal compares lists element by element and objects key by key, values of
+// different types are never equal
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, found := b[key]
+			if !found || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		switch b.(type) {
+		case []interface{}, map[string]interface{}:
+			return false
+		}
+		return a == b
+	}
+}
+
+func compare(op string, left, right interface{}) (bool, error) {
+	var c int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false, fmt.Errorf("cannot compare number with %s", typeName(right))
+		}
+		switch {
+		case l < r:
+			c = -1
+		case l > r:
+			c = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare string with %s", typeName(right))
+		}
+		c = strings.Compare(l, r)
+	default:
+		return false, fmt.Errorf("%s expects numbers or strings, got %s", op, typeName(left))
+	}
+
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func contains(haystack, needle interface{}) (bool, error) {
+	switch h := haystack.(type) {
+	case string:
+		n, ok := needle.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot search %s in a string", typeName(needle))
+		}
+		return strings.Contains(h, n), nil
+	case []interface{}:
+		for _, item := range h {
+			if equal(item, needle) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		n, ok := needle.(string)
+		if !ok {
+			return false, fmt.Errorf("object keys are strings, got %s", typeName(needle))
+		}
+		_, found := h[n]
+		return found, nil
+	case nil:
+		return false, nil
+	default:
+		return false, fmt.Errorf("cannot search in %s", typeName(haystack))
+	}
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
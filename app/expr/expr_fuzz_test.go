@@ -0,0 +1,29 @@
+package expr
+
+import "testing"
+
+func FuzzCompile(f *testing.F) {
+	f.Add(`payload.temperature < 18 && vars.presence == "home"`)
+	f.Add(`time.weekday in ["sat", "sun"] || time.hour >= 9`)
+	f.Add(`!(payload.tags[0] == 'a') && len(payload.tags) > 1`)
+	f.Add(`-payload.temperature + 20 * 2 % 3 / 0`)
+	f.Add(`startsWith(lower(payload.name), "kit") && contains(payload, "name")`)
+	f.Add(`payload.missing.deep == null`)
+	f.Add(`"unterminated`)
+	f.Add(`((((`)
+
+	env := map[string]interface{}{
+		"payload": map[string]interface{}{"temperature": 17.5, "name": "Kitchen", "tags": []interface{}{"a", "b"}},
+		"vars":    map[string]interface{}{"presence": "home"},
+		"time":    map[string]interface{}{"hour": 7.0, "weekday": "fri"},
+	}
+
+	f.Fuzz(func(t *testing.T, source string) {
+		e, err := Compile(source)
+		if err != nil {
+			return
+		}
+		e.Eval(env)
+		e.Match(env)
+	})
+}
@@ -0,0 +1,116 @@
+package expr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testEnv() map[string]interface{} {
+	return map[string]interface{}{
+		"payload": map[string]interface{}{
+			"temperature": 17.5,
+			"name":        "Kitchen",
+			"tags":        []interface{}{"a", "b"},
+			"empty":       nil,
+			"nested":      map[string]interface{}{"level": 2.0, "list": []interface{}{1.0, "x"}},
+		},
+		"vars":  map[string]interface{}{"presence": "home"},
+		"grüße": 1.0,
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   interface{}
+	}{
+		// Precedence
+		{"product before sum", `1 + 2 * 3`, 7.0},
+		{"parentheses", `(1 + 2) * 3`, 9.0},
+		{"left associative", `10 - 4 - 3`, 3.0},
+		{"modulo with product", `7 % 4 * 2`, 6.0},
+		{"unary minus", `-2 * 3 + 1`, -5.0},
+		{"comparison before and", `1 < 2 && 3 > 2`, true},
+		{"and before or", `true || false && false`, true},
+		{"not binds tighter than and", `!false && false`, false},
+
+		// Short-circuit, the right side would fail
+		{"and stops at false", `false && unknown`, false},
+		{"or stops at true", `true || 1 / 0 == 1`, true},
+		{"guarded member", `payload.empty != null && payload.empty.x == 1`, false},
+
+		// Missing and null members
+		{"missing member", `payload.missing`, nil},
+		{"member of missing", `payload.missing.deep == null`, true},
+		{"member of null", `payload.empty.x`, nil},
+		{"index out of range", `payload.tags[5]`, nil},
+		{"null equals null", `null == null`, true},
+		{"null is not false", `payload.missing == false`, false},
+
+		// in
+		{"in list", `"a" in payload.tags`, true},
+		{"not in list", `"c" in payload.tags`, false},
+		{"in needs the same type", `"1" in [1]`, false},
+		{"in string", `"itch" in payload.name`, true},
+		{"key in object", `"name" in payload`, true},
+		{"in null", `"a" in payload.missing`, false},
+		{"list in list", `[1, "x"] in [[1, "x"]]`, true},
+
+		// List and object equality
+		{"equal lists", `payload.tags == ["a", "b"]`, true},
+		{"order matters", `payload.tags == ["b", "a"]`, false},
+		{"types matter in lists", `[1] == ["1"]`, false},
+		{"elements are not joined", `["a b"] == ["a", "b"]`, false},
+		{"nested lists", `payload.nested.list == [1, "x"]`, true},
+		{"list is not a string", `["a"] == "a"`, false},
+		{"equal objects", `payload.nested == payload.nested`, true},
+		{"different objects", `payload.nested == payload`, false},
+
+		{"non-ASCII name", `grüße == 1`, true},
+		{"functions", `startsWith(lower(payload.name), "kit") && len(payload.tags) == 2`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Compile(tt.source)
+			if err != nil {
+				t.Fatalf("Compile(%s) error = %v", tt.source, err)
+			}
+			got, err := e.Eval(testEnv())
+			if err != nil {
+				t.Fatalf("Eval(%s) error = %v", tt.source, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Eval(%s) = %v, want %v", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []string{
+		`unknown == 1`,
+		`1 / 0`,
+		`"a" < 1`,
+		`1 && true`,
+		`true && 1`,
+		`-"a"`,
+	}
+	for _, source := range tests {
+		e, err := Compile(source)
+		if err != nil {
+			t.Fatalf("Compile(%s) error = %v", source, err)
+		}
+		if got, err := e.Eval(testEnv()); err == nil {
+			t.Errorf("Eval(%s) = %v, want an error", source, got)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, source := range []string{`"unterminated`, `((1)`, `1 +`, `a.`, `nope(1)`, `len(1, 2)`, `1 # 2`} {
+		if _, err := Compile(source); err == nil {
+			t.Errorf("Compile(%s) succeeded, want an error", source)
+		}
+	}
+}
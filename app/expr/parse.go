@@ -0,0 +1,336 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{} // Parsed number or string
+	pos   int
+}
+
+// operators, longest first so "<=" wins over "<"
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ".", ","}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		ch, size := utf8.DecodeRuneInString(source[i:])
+		switch {
+		case unicode.IsSpace(ch):
+			i += size
+		case ch >= '0' && ch <= '9':
+			start := i
+			for i < len(source) && (source[i] >= '0' && source[i] <= '9' || source[i] == '.') {
+				i++
+			}
+			n, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", source[start:i], start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], value: n, pos: start})
+		case ch == '"' || ch == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for i < len(source) && rune(source[i]) != ch {
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+				}
+				sb.WriteByte(source[i])
+				i++
+			}
+			if i >= len(source) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: source[start:i], value: sb.String(), pos: start})
+		case ch == '_' || unicode.IsLetter(ch):
+			start := i
+			for i < len(source) {
+				r, size := utf8.DecodeRuneInString(source[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:i], pos: start})
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(source[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at position %d", ch, i)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, text: "end of expression", pos: len(source)}), nil
+}
+
+// parser is a recursive descent parser, from the lowest precedence:
+// ||, &&, comparisons and in, + -, * / %, unary ! -, member access and calls
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the operators or keywords
+func (p *parser) accept(texts ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokenOperator && tok.kind != tokenIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if tok.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		tok := p.peek()
+		return fmt.Errorf("expected %q at position %d, got %q", text, tok.pos, tok.text)
+	}
+	return nil
+}
+
+func (p *parser) expression() (node, error) {
+	return p.binary(0)
+}
+
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (node, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(precedence[level]...)
+		if !ok {
+			return left, nil
+		}
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unary{op: op, operand: operand}, nil
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (node, error) {
+	n, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("."); ok {
+			tok := p.next()
+			if tok.kind != tokenIdent {
+				return nil, fmt.Errorf("expected a name after . at position %d", tok.pos)
+			}
+			n = member{object: n, key: literal{tok.text}}
+			continue
+		}
+		if _, ok := p.accept("["); ok {
+			key, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = member{object: n, key: key}
+			continue
+		}
+		return n, nil
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenNumber, tokenString:
+		return literal{tok.value}, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.call(tok)
+		}
+		return identifier{tok.text}, nil
+	case tokenOperator:
+		switch tok.text {
+		case "(":
+			n, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			items, err := p.arguments("]")
+			if err != nil {
+				return nil, err
+			}
+			return list{items}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+func (p *parser) call(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos)
+	}
+	args, err := p.arguments(")")
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != fn.arity {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", name.text, fn.arity, len(args))
+	}
+	return call{name: name.text, args: args}, nil
+}
+
+// arguments parses a comma separated list up to the closing token
+func (p *parser) arguments(closing string) ([]node, error) {
+	var items []node
+	if _, ok := p.accept(closing); ok {
+		return items, nil
+	}
+	for {
+		item, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if _, ok := p.accept(closing); ok {
+			return items, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type function struct {
+	arity int
+	call  func(args []interface{}) (interface{}, error)
+}
+
+var functions = map[string]function{
+	"len": {1, func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v))), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		case nil:
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("len expects a string, list or object, got %s", typeName(args[0]))
+	}},
+	"lower": {1, stringFunc("lower", strings.ToLower)},
+	"upper": {1, stringFunc("upper", strings.ToUpper)},
+	"contains": {2, func(args []interface{}) (interface{}, error) {
+		return contains(args[0], args[1])
+	}},
+	"startsWith": {2, stringPredicate("startsWith", strings.HasPrefix)},
+	"endsWith":   {2, stringPredicate("endsWith", strings.HasSuffix)},
+	"abs": {1, func(args []interface{}) (interface{}, error) {
+		f, ok := args[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("abs expects a number, got %s", typeName(args[0]))
+		}
+		return math.Abs(f), nil
+	}},
+}
+
+func stringFunc(name string, fn func(string) string) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a string, got %s", name, typeName(args[0]))
+		}
+		return fn(s), nil
+	}
+}
+
+func stringPredicate(name string, fn func(s, affix string) bool) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		s, ok := args[0].(string)
+		affix, ok2 := args[1].(string)
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("%s expects strings, got %s and %s", name, typeName(args[0]), typeName(args[1]))
+		}
+		return fn(s, affix), nil
+	}
+}
@@ -0,0 +1,95 @@
+// Package flap damps connectivity events, so a short internet outage does not
+// flood consumers with offline/online pairs.
+package flap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+)
+
+// Stats counts the outages of a link, including the suppressed ones
+type Stats struct {
+	Outages    int `json:"outages"`
+	Suppressed int `json:"suppressed"` // Outages that ended within the window and were not reported
+}
+
+// Damper reports an outage only once it lasted the window, and its end only
+// if the outage was reported. A window of 0 reports every change.
+type Damper struct {
+	window   time.Duration
+	clock    clock.Clock
+	timer    clock.Timer // Pending report of the current outage
+	pending  int         // Generation of timer, a stale one that fired anyway is ignored
+	reported bool        // The current outage was reported
+	stats    Stats
+	mu       sync.Mutex
+}
+
+func New(window time.Duration) *Damper {
+	return &Damper{window: window, clock: clock.System}
+}
+
+func (d *Damper) SetClock(c clock.Clock) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clock = c
+}
+
+// Down starts an outage, report is called once it lasted the window.
+// Repeated calls during an outage are ignored.
+func (d *Damper) Down(report func()) {
+	d.mu.Lock()
+	if d.timer != nil || d.reported {
+		d.mu.Unlock()
+		return
+	}
+	d.stats.Outages++
+	if d.window <= 0 {
+		d.reported = true
+		d.mu.Unlock()
+		report()
+		return
+	}
+
+	d.pending++
+	generation := d.pending
+	d.timer = d.clock.AfterFunc(d.window, func() {
+		d.mu.Lock()
+		if d.timer == nil || d.pending != generation {
+			d.mu.Unlock()
+			return
+		}
+		d.timer = nil
+		d.reported = true
+		d.mu.Unlock()
+		report()
+	})
+	d.mu.Unlock()
+}
+
+// Up ends an outage, report is called if its start was reported
+func (d *Damper) Up(report func()) {
+	d.mu.Lock()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+		d.stats.Suppressed++
+		d.mu.Unlock()
+		return
+	}
+	if !d.reported {
+		d.mu.Unlock()
+		return
+	}
+	d.reported = false
+	d.mu.Unlock()
+	report()
+}
+
+func (d *Damper) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
@@ -0,0 +1,52 @@
+package flap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+)
+
+func TestDamper(t *testing.T) {
+	manual := clock.NewManual(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	d := New(30 * time.Second)
+	d.SetClock(manual)
+
+	var events []string
+	down := func() { events = append(events, "down") }
+	up := func() { events = append(events, "up") }
+
+	// A blip shorter than the window is not reported
+	d.Down(down)
+	manual.Advance(10 * time.Second)
+	d.Up(up)
+	manual.Advance(time.Minute)
+	if len(events) != 0 {
+		t.Errorf("events = %v, want none for a blip", events)
+	}
+
+	// A longer outage is reported once, and its end as well
+	d.Down(down)
+	manual.Advance(20 * time.Second)
+	d.Down(down)
+	manual.Advance(20 * time.Second)
+	d.Up(up)
+	d.Up(up)
+	if len(events) != 2 || events[0] != "down" || events[1] != "up" {
+		t.Errorf("events = %v, want down, up", events)
+	}
+
+	if stats := d.Stats(); stats.Outages != 2 || stats.Suppressed != 1 {
+		t.Errorf("stats = %+v, want 2 outages, 1 suppressed", stats)
+	}
+}
+
+func TestDamperWithoutWindow(t *testing.T) {
+	d := New(0)
+	var events []string
+	d.Down(func() { events = append(events, "down") })
+	d.Up(func() { events = append(events, "up") })
+	if len(events) != 2 {
+		t.Errorf("events = %v, want down, up", events)
+	}
+}
@@ -0,0 +1,827 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/automation"
+	"github.com/mqtt-home/mqtt-lamarzocco/backup"
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+	"github.com/mqtt-home/mqtt-lamarzocco/compat"
+	"github.com/mqtt-home/mqtt-lamarzocco/config"
+	"github.com/mqtt-home/mqtt-lamarzocco/expr"
+	"github.com/mqtt-home/mqtt-lamarzocco/flap"
+	"github.com/mqtt-home/mqtt-lamarzocco/grpcapi"
+	"github.com/mqtt-home/mqtt-lamarzocco/history"
+	"github.com/mqtt-home/mqtt-lamarzocco/i18n"
+	"github.com/mqtt-home/mqtt-lamarzocco/inventory"
+	"github.com/mqtt-home/mqtt-lamarzocco/jobs"
+	"github.com/mqtt-home/mqtt-lamarzocco/latency"
+	"github.com/mqtt-home/mqtt-lamarzocco/maintenance"
+	"github.com/mqtt-home/mqtt-lamarzocco/notify"
+	"github.com/mqtt-home/mqtt-lamarzocco/profiles"
+	"github.com/mqtt-home/mqtt-lamarzocco/scheduler"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/mqtt-home/mqtt-lamarzocco/warmup"
+	"github.com/mqtt-home/mqtt-lamarzocco/water"
+	"github.com/mqtt-home/mqtt-lamarzocco/web"
+	"github.com/philipparndt/go-logger"
+)
+
+// gateway connects the machine with MQTT, the APIs and the automations
+type gateway struct {
+	cfg      config.Config
+	clock    clock.Clock
+	messages *i18n.Translator
+
+	compat             *compat.Layer // Publishes the layout of compat_version as well
+	client             *lamarzocco.Client
+	store              *state.Store
+	sched              *scheduler.Scheduler
+	variables          *automation.Variables
+	automationStats    *automation.Stats
+	vacation           *automation.VacationDetector
+	brewHistory        *history.History
+	profileManager     *profiles.Manager
+	beans              *inventory.Inventory
+	waterTracker       *water.Tracker
+	maintenanceTracker *maintenance.Tracker
+	warmup             *warmup.Learner
+	jobs               *jobs.Manager
+	webServer          *web.WebServer
+	grpcServer         *grpcapi.Server
+	lastMachineOn      bool
+	lastWaterLevel     lamarzocco.WaterLevel
+	backflushDue       atomic.Bool  // backflush_recommended was published
+	cloudFlap          *flap.Damper // cloud_unavailable/cloud_recovered
+	pollingFlap        *flap.Damper // polling_failed/polling_recovered
+	latency            *latency.Recorder
+	lastScale          bool
+	lastCapabilities   lamarzocco.Capabilities
+
+	pingOnce sync.Once // Subscription for MQTT round trips
+	pingMu   sync.Mutex
+	pings    map[string]chan struct{}
+	mqttUp   lamarzocco.UpTracker
+
+	safeMode  bool       // Automations are disabled for debugging
+	baseTopic string     // mqtt.topic of the account, the machine topic moves below it with serial_topics
+	name      string     // Account name, empty for the main account
+	machine   string     // Serial of another machine of the account, empty for the first one
+	accounts  []*gateway // Additional accounts, served by the web server of the main account
+	machines  []*gateway // Other machines of the account, below <topic>/<serial>
+	account   *gateway   // Gateway of the first machine of the account, nil for that one
+
+	machinesMu sync.RWMutex        // Guards machines, which change with the things of the account
+	things     []lamarzocco.Thing  // Machines of the account at the last check
+	retained   map[string]struct{} // Retained topics, cleared when the machine is removed
+	retainedMu sync.Mutex
+
+	statusTopics   map[string]string // Values last published to <topic>/status/<path>
+	statusTopicsMu sync.Mutex
+
+	lastAggregate []byte // Last <topic>/all/status
+	aggregateMu   sync.Mutex
+	broadcastOnce sync.Once // Subscription to <topic>/all/set
+
+	lastCommand   *commandOrigin // Origin of the last command, published with the status
+	lastCommandMu sync.Mutex
+	lastShot      *lastShot // Published with the status and to <topic>/lastshot
+	lastShotMu    sync.Mutex
+
+	notifiers          []*notify.Notifier
+	triggerExpressions map[string]*expr.Expression // Compiled trigger expressions by source
+
+	stopCh     chan struct{}
+	ctx        context.Context // Cancelled when stopping, aborts in-flight client requests
+	cancel     context.CancelFunc
+	background sync.WaitGroup // Tasks that persist state when stopping
+}
+
+func newGateway(cfg config.Config, clientOpts ...lamarzocco.Option) (*gateway, error) {
+	g := &gateway{
+		cfg:             cfg,
+		baseTopic:       cfg.MQTT.Topic,
+		clock:           clock.System,
+		messages:        i18n.New(cfg.Language),
+		variables:       automation.NewVariables(),
+		automationStats: automation.NewStats(),
+		pings:           make(map[string]chan struct{}),
+		stopCh:          make(chan struct{}),
+		latency:         latency.New(),
+	}
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+	g.cloudFlap = flap.New(time.Duration(cfg.FlapWindow) * time.Second)
+	g.pollingFlap = flap.New(time.Duration(cfg.FlapWindow) * time.Second)
+	g.compat = compat.New(cfg.CompatVersion, g.migrations()...)
+
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		g.clock = clock.InLocation(clock.System, loc)
+	}
+	g.automationStats.SetClock(g.clock)
+	g.cloudFlap.SetClock(g.clock)
+	g.pollingFlap.SetClock(g.clock)
+	if cfg.AutomationStats {
+		g.automationStats.SetChangeCallback(g.publishAutomationStat)
+	}
+
+	notifiers, err := newNotifiers(cfg.Notifiers)
+	if err != nil {
+		return nil, err
+	}
+	g.notifiers = notifiers
+
+	store, err := state.OpenStorage(cfg.Storage.Backend, cfg.Storage.Path, cfg.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	g.store = store
+
+	key, err := state.LoadEncryptionKey(cfg.Storage.EncryptionKey, cfg.Storage.EncryptionKeyFile)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if key != nil {
+		if err := store.SetEncryptionKey(key); err != nil {
+			store.Close()
+			return nil, err
+		}
+		logger.Info("Stored credentials are encrypted")
+	}
+
+	// Initialize La Marzocco client
+	opts := []lamarzocco.Option{
+		lamarzocco.WithCredentials(cfg.LaMarzocco.Username, cfg.LaMarzocco.Password),
+		lamarzocco.WithStateStore(store),
+		lamarzocco.WithLogger(clientLogger{}),
+		lamarzocco.WithClock(g.clock),
+		lamarzocco.WithDoseBounds(lamarzocco.DoseBounds{Min: cfg.Brew.MinDose, Max: cfg.Brew.MaxDose}),
+		lamarzocco.WithTransports(transportSpecs(cfg.LaMarzocco.Transports)...),
+		lamarzocco.WithRetryPolicy(retryPolicy(cfg.LaMarzocco.Retry)),
+		lamarzocco.WithBreakerPolicy(breakerPolicy(cfg.LaMarzocco.CircuitBreaker)),
+		lamarzocco.WithRateLimitPolicy(rateLimitPolicy(cfg.LaMarzocco.RateLimit)),
+		lamarzocco.WithPollBudget(pollBudget(cfg.LaMarzocco.PollBudget)),
+		lamarzocco.WithAuthBackoffPolicy(authBackoffPolicy(cfg.LaMarzocco.AuthBackoff)),
+		lamarzocco.WithSerial(cfg.LaMarzocco.Serial),
+		lamarzocco.WithDoseDebounce(time.Duration(cfg.LaMarzocco.DoseDebounce * float64(time.Second))),
+		lamarzocco.WithPollFailureThreshold(cfg.LaMarzocco.PollFailures),
+	}
+	if cfg.LaMarzocco.RedactSerial {
+		opts = append(opts, lamarzocco.WithRedactedSerial())
+	}
+	if identity := cfg.LaMarzocco.Identity; identity != nil {
+		opts = append(opts, lamarzocco.WithIdentity(lamarzocco.Identity{UserAgent: identity.UserAgent, Headers: identity.Headers}))
+	}
+	g.client = lamarzocco.New(append(opts, clientOpts...)...)
+
+	g.brewHistory = history.New(store, cfg.Brew.DefaultDose)
+	g.brewHistory.SetClock(g.clock)
+	g.brewHistory.SetRetention(history.Retention{
+		Days:       cfg.Retention.Days,
+		MaxEntries: cfg.Retention.MaxEntries,
+	})
+	g.profileManager = profiles.New(store, g.client)
+
+	g.jobs = jobs.NewManager()
+	g.jobs.SetClock(g.clock)
+	g.jobs.SetFinishedCallback(g.onJobFinished)
+
+	if cfg.Inventory != nil {
+		g.beans = inventory.New(store, cfg.Inventory.BagSize, cfg.Inventory.LowThreshold)
+		g.beans.SetClock(g.clock)
+		g.beans.SetChangeCallback(g.publishInventory)
+		g.beans.SetLowCallback(g.onBeansLow)
+	}
+
+	g.maintenanceTracker = maintenance.New(store)
+	g.maintenanceTracker.SetClock(g.clock)
+	g.maintenanceTracker.SetBackflushShots(cfg.Maintenance.BackflushShots)
+
+	g.warmup = warmup.New(store)
+	g.warmup.SetClock(g.clock)
+	g.maintenanceTracker.SetChangeCallback(g.publishMaintenance)
+
+	if cfg.Water != nil {
+		g.waterTracker = water.New(store, water.Settings{
+			ShotOverhead:   cfg.Water.ShotOverheadMl,
+			DefaultShot:    cfg.Water.DefaultShotMl,
+			Backflush:      cfg.Water.BackflushMl,
+			FilterCapacity: cfg.Water.FilterCapacity,
+		})
+		g.waterTracker.SetClock(g.clock)
+		g.waterTracker.SetChangeCallback(g.publishWater)
+		g.waterTracker.SetFilterExhaustedCallback(g.onFilterExhausted)
+	}
+
+	if calibration := cfg.LaMarzocco.Calibration; calibration != nil {
+		g.client.SetCalibration(calibration.Dose1, calibration.Dose2)
+	}
+
+	// Set callbacks to publish status on change and track brews
+	g.client.SetStatusChangeCallback(g.onStatusChange)
+	g.client.SetBrewCallback(g.onBrew)
+	g.client.SetScaleWeightCallback(g.onScaleWeight)
+	g.client.SetDiscrepancyCallback(g.onDiscrepancy)
+	g.client.SetCommandCallback(g.onCommand)
+	g.client.SetScheduleCallback(g.publishSchedule)
+	g.client.SetUnknownStateCallback(g.onUnknownState)
+	g.client.SetCircuitCallback(g.onCircuitChange)
+	g.client.SetAuthCallback(g.onAuthChange)
+	g.client.SetDegradedCallback(g.onDegraded)
+
+	for _, account := range cfg.Accounts {
+		a, err := newGateway(cfg.ForAccount(account))
+		if err != nil {
+			g.closeStores()
+			return nil, fmt.Errorf("account %s: %w", account.Name, err)
+		}
+		a.name = account.Name
+		g.accounts = append(g.accounts, a)
+	}
+
+	return g, nil
+}
+
+func transportSpecs(transports []config.TransportConfig) []lamarzocco.TransportSpec {
+	specs := make([]lamarzocco.TransportSpec, 0, len(transports))
+	for _, t := range transports {
+		specs = append(specs, lamarzocco.TransportSpec{Type: t.Type, URL: t.URL, Token: t.Token})
+	}
+	return specs
+}
+
+func retryPolicy(retry *config.RetryConfig) lamarzocco.RetryPolicy {
+	if retry == nil {
+		return lamarzocco.DefaultRetryPolicy
+	}
+	return lamarzocco.RetryPolicy{
+		Attempts:  retry.Attempts,
+		BaseDelay: time.Duration(retry.BaseDelay * float64(time.Second)),
+		Jitter:    retry.Jitter,
+		Commands:  retry.Commands,
+	}
+}
+
+func breakerPolicy(breaker *config.CircuitBreakerConfig) lamarzocco.BreakerPolicy {
+	if breaker == nil {
+		return lamarzocco.DefaultBreakerPolicy
+	}
+	return lamarzocco.BreakerPolicy{
+		Failures:  breaker.Failures,
+		BaseDelay: time.Duration(breaker.BaseDelay) * time.Second,
+		MaxDelay:  time.Duration(breaker.MaxDelay) * time.Second,
+	}
+}
+
+func authBackoffPolicy(backoff *config.AuthBackoffConfig) lamarzocco.AuthBackoffPolicy {
+	if backoff == nil {
+		return lamarzocco.DefaultAuthBackoffPolicy
+	}
+	return lamarzocco.AuthBackoffPolicy{
+		BaseDelay: time.Duration(backoff.BaseDelay) * time.Second,
+		MaxDelay:  time.Duration(backoff.MaxDelay) * time.Second,
+	}
+}
+
+func rateLimitPolicy(limit *config.RateLimitConfig) lamarzocco.RateLimitPolicy {
+	if limit == nil {
+		return lamarzocco.DefaultRateLimitPolicy
+	}
+	return lamarzocco.RateLimitPolicy{
+		Rate:    limit.Rate,
+		Burst:   limit.Burst,
+		MaxWait: time.Duration(limit.MaxWait * float64(time.Second)),
+	}
+}
+
+func pollBudget(budget *config.PollBudgetConfig) lamarzocco.PollBudget {
+	if budget == nil {
+		return lamarzocco.DefaultPollBudget
+	}
+	return lamarzocco.PollBudget{Rate: budget.Rate, Burst: budget.Burst}
+}
+
+func (g *gateway) closeStores() {
+	for _, a := range append(g.accounts, g.machineList()...) {
+		a.closeStores()
+	}
+	if err := g.store.Close(); err != nil {
+		logger.Error("Failed to close state store", "error", err)
+	}
+}
+
+// startAccounts starts the additional accounts, one that fails to connect is skipped
+func (g *gateway) startAccounts() {
+	started := g.accounts[:0]
+	for _, a := range g.accounts {
+		a.safeMode = g.safeMode
+		if err := a.start(); err != nil {
+			logger.Error("Failed to connect account, skipping it", "account", a.name, "error", err)
+			a.closeStores()
+			continue
+		}
+		logger.Info("Account started", "account", a.name, "topic", a.cfg.MQTT.Topic)
+		started = append(started, a)
+	}
+	g.accounts = started
+}
+
+// startMachines serves the other machines of the account, each with its own
+// gateway below <topic>/<serial> and the sign-in of this one. One that fails
+// to start is skipped.
+func (g *gateway) startMachines() {
+	g.things = g.client.Things()
+	for _, thing := range g.things {
+		g.startMachine(thing)
+	}
+}
+
+// startMachine serves a machine of the account, nil if it is the machine of
+// this gateway or fails to start
+func (g *gateway) startMachine(thing lamarzocco.Thing) *gateway {
+	id := g.client.DeviceID(thing.SerialNumber)
+	if id == g.client.GetStatus().Serial {
+		return nil
+	}
+	account := g.cfg
+	account.MQTT.Topic = g.baseTopic
+
+	m, err := newGateway(account.ForMachine(thing.SerialNumber, id), lamarzocco.WithSharedSession(g.client))
+	if err != nil {
+		logger.Error("Failed to open state of machine, skipping it", "serial", id, "error", err)
+		return nil
+	}
+	m.name = g.name
+	m.machine = thing.SerialNumber
+	m.account = g
+	m.safeMode = g.safeMode
+	if err := m.start(); err != nil {
+		logger.Error("Failed to connect machine, skipping it", "serial", id, "error", err)
+		m.closeStores()
+		return nil
+	}
+
+	g.machinesMu.Lock()
+	select {
+	case <-g.stopCh:
+		// Stopped while the machine was starting
+		g.machinesMu.Unlock()
+		m.stop()
+		return nil
+	default:
+	}
+	g.machines = append(g.machines, m)
+	g.machinesMu.Unlock()
+
+	logger.Info("Machine started", "serial", id, "model", thing.ModelName, "topic", m.cfg.MQTT.Topic)
+	return m
+}
+
+// connect signs in and fetches the machine state. With serial_topics the
+// machine of the base topic moves below <topic>/<serial> like the others,
+// before anything is published.
+func (g *gateway) connect() error {
+	if g.machine != "" || !g.cfg.LaMarzocco.SerialTopics {
+		return g.client.Connect(g.ctx)
+	}
+
+	if err := g.client.Discover(g.ctx); err != nil {
+		return err
+	}
+	g.cfg.MQTT.Topic = g.cfg.MachineTopic(g.client.GetStatus().Serial)
+	return g.client.Refresh(g.ctx)
+}
+
+// start connects to the machine and starts the subscriptions, background tasks and servers
+func (g *gateway) start() error {
+	// Connect to La Marzocco API
+	logger.Info("Connecting to La Marzocco API...")
+	if err := g.connect(); err != nil {
+		return err
+	}
+	cfg := g.cfg
+	g.warnDeprecated()
+
+	// Publish initial status
+	g.lastMachineOn = g.client.GetStatus().MachineOn
+	g.lastWaterLevel = g.client.GetStatus().WaterLevel
+	g.warmup.OnStatus(g.client.GetStatus())
+	g.maintenanceTracker.SetMachineOn(g.lastMachineOn)
+	g.publishMaintenance(g.maintenanceTracker.Get())
+	g.publishStatus(g.client.GetStatus())
+	g.lastScale = scalePaired(g.client.GetStatus())
+	g.lastCapabilities = g.client.Capabilities()
+	g.publishCapabilities()
+	g.fetchSchedule()
+
+	if g.beans != nil {
+		g.publishInventory(g.beans.Get())
+	}
+	if g.waterTracker != nil {
+		g.publishWater(g.waterTracker.Get())
+	}
+
+	// Scheduler for deferred one-shot commands
+	g.sched = scheduler.New(g.executeScheduled)
+	g.sched.SetClock(g.clock)
+	g.sched.SetChangeCallback(g.publishPending)
+	g.sched.SetLocation(schedulerLocation(cfg))
+	g.sched.SetVariables(g.variables)
+	g.sched.SetStats(g.automationStats)
+	if g.safeMode {
+		logger.Warn("Safe mode, triggers, schedules and automations are disabled")
+	} else {
+		g.sched.SetEntries(g.loadSchedules())
+	}
+	for _, entry := range g.sched.Entries() {
+		g.automationStats.Register(automation.KindSchedule, entry.Name)
+	}
+	g.publishPending(g.sched.List())
+
+	if cfg.VacationDays > 0 && !g.safeMode {
+		g.vacation = automation.NewVacationDetector(cfg.VacationDays, g.store, g.clock)
+		g.vacation.SetChangeCallback(g.onVacationChange)
+		g.sched.SetAutoOnSuspended(g.vacation.Suspended())
+	}
+
+	// Subscribe to commands
+	g.subscribeToCommands()
+	g.subscribeToAnnotations()
+	g.subscribeToSchedule()
+
+	// Subscribe to automation inputs
+	g.variables.SetChangeCallback(func(name string, value interface{}) {
+		logger.Info("Automation variable changed", "name", name, "value", value)
+	})
+	g.subscribeToPresence()
+	g.subscribeToGrinder()
+	g.subscribeToAmbient()
+
+	// Subscribe to configured triggers
+	if !g.safeMode {
+		g.subscribeToTriggers()
+	}
+
+	// Start polling for status updates
+	go g.client.StartPolling(g.ctx, time.Duration(cfg.LaMarzocco.PollingInterval)*time.Second)
+	if cfg.LaMarzocco.StreamingEnabled() {
+		go g.client.StartStreaming(g.ctx)
+	}
+	if cfg.LaMarzocco.StatsInterval > 0 && g.client.Capabilities().Statistics {
+		go g.pollStatistics(time.Duration(cfg.LaMarzocco.StatsInterval) * time.Second)
+	}
+	go g.republishDaily()
+	if at, err := time.Parse("15:04", cfg.MorningReport); err == nil {
+		go g.runMorningReport(at)
+	}
+	go g.sched.Run(g.stopCh)
+	go g.monitorMQTT()
+	g.runBackground(g.maintenanceTracker.Run)
+	g.runBackground(g.brewHistory.Run)
+	if g.vacation != nil {
+		g.runBackground(g.vacation.Run)
+	}
+	if cfg.Backup != nil {
+		g.startBackup(*cfg.Backup)
+	}
+
+	g.startAccounts()
+	if g.machine == "" {
+		g.startMachines()
+		g.subscribeToBroadcast()
+		g.publishAggregate()
+	}
+
+	if len(cfg.OnStart) > 0 {
+		if g.safeMode {
+			logger.Warn("Safe mode, on_start actions are skipped")
+		} else {
+			go g.runOnStart()
+		}
+	}
+
+	// Start web server
+	if !cfg.Web.Enabled {
+		logger.Info("Web interface is disabled in the configuration")
+	} else {
+		logger.Info("Web interface enabled, starting web server")
+		g.webServer = web.NewWebServer(web.Options{
+			Client:           g.client,
+			Scheduler:        g.sched,
+			Profiles:         g.profileManager,
+			History:          g.brewHistory,
+			Inventory:        g.beans,
+			Water:            g.waterTracker,
+			Maintenance:      g.maintenanceTracker,
+			Warmup:           g.warmup,
+			GraphQL:          cfg.Web.GraphQL,
+			Resync:           g.resync,
+			Jobs:             g.jobs,
+			BackFlush:        g.startBackFlush,
+			SelfTest:         g.selfTest,
+			MQTTState:        g.mqttUp.State,
+			PollStats:        g.pollStats,
+			Outages:          g.outages,
+			Latency:          g.latency,
+			TrustedProxies:   cfg.Web.TrustedProxyPrefixes(),
+			AdminToken:       cfg.Web.AdminToken,
+			RawCommands:      cfg.Web.RawCommands,
+			Auth:             web.NewAuthProvider(cfg.Web.Auth),
+			TestNotification: g.testNotification,
+			AutomationStats:  g.automationStats,
+			CommandCallback: func(command, requester string) {
+				g.recordCommand(sourceWeb, command, requester)
+			},
+			CommandFailedCallback: func(requester string, err error) {
+				g.commandFailed(sourceWeb, requester, err)
+			},
+			Triggers:  cfg.Triggers,
+			Schedules: cfg.Schedules,
+		})
+		for _, a := range g.accounts {
+			if a.webServer != nil {
+				g.webServer.MountAccount(a.name, a.webServer)
+			}
+		}
+		for _, m := range g.machineList() {
+			if m.webServer != nil {
+				g.webServer.MountMachine(g.client.DeviceID(m.machine), m.webServer)
+			}
+		}
+		// Additional accounts and machines are served by the web server of the main account
+		if g.name == "" && g.machine == "" {
+			go func() {
+				err := g.webServer.Start(cfg.Web.Addresses()...)
+				if err != nil {
+					logger.Error("Failed to start web server", err)
+				}
+			}()
+			logger.Info("Application is now ready. Web interface available at " + strings.Join(cfg.Web.Addresses(), ", ") + ". Press Ctrl+C to quit.")
+		}
+	}
+
+	// After the web server, machines that are added later are served by it as well
+	if g.machine == "" && cfg.LaMarzocco.ThingsInterval > 0 {
+		go g.watchThings(time.Duration(cfg.LaMarzocco.ThingsInterval) * time.Second)
+	}
+
+	if cfg.GRPC.Enabled {
+		g.grpcServer = grpcapi.NewServer(g.client, g.brewHistory, func(payload []byte) error {
+			return g.handleCommand(sourceGRPC, payload)
+		})
+		go func() {
+			if err := g.grpcServer.Start(cfg.GRPC.Port); err != nil {
+				logger.Error("Failed to start gRPC server", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+func (g *gateway) stop() {
+	// Closed first, so no machine of the account is started anymore
+	close(g.stopCh)
+	for _, a := range append(g.accounts, g.machineList()...) {
+		a.stop()
+	}
+
+	g.cancel()
+	if g.client != nil {
+		g.client.Close()
+	}
+	g.sched.Stop()
+	if g.grpcServer != nil {
+		g.grpcServer.Stop()
+	}
+
+	g.background.Wait()
+	if err := g.store.Close(); err != nil {
+		logger.Error("Failed to close state store", "error", err)
+	}
+}
+
+func (g *gateway) startBackup(cfg config.BackupConfig) {
+	interval, _ := time.ParseDuration(cfg.Interval)
+	b := backup.New(g.store, backup.Options{
+		Interval: interval,
+		Dir:      cfg.Path,
+		Keep:     cfg.Keep,
+	})
+	b.SetClock(g.clock)
+	if cfg.Topic != "" {
+		b.SetPublisher(func(payload []byte) {
+			g.publish(cfg.Topic, payload, true)
+		})
+	}
+	go b.Run(g.stopCh)
+}
+
+// runBackground starts a task that is waited for when stopping
+func (g *gateway) runBackground(task func(stopCh <-chan struct{})) {
+	g.background.Add(1)
+	go func() {
+		defer g.background.Done()
+		task(g.stopCh)
+	}()
+}
+
+func (g *gateway) onStatusChange(status lamarzocco.MachineStatus) {
+	if status.ReportedAt != nil && !status.UpdateReceivedAt.IsZero() {
+		g.latency.Add("cloud", status.UpdateReceivedAt.Sub(*status.ReportedAt))
+	}
+	g.publishStatus(status)
+	g.latency.Observe("mqtt", status.UpdateReceivedAt)
+	if g.account != nil {
+		g.account.publishAggregate()
+	} else {
+		g.publishAggregate()
+	}
+
+	if g.webServer != nil {
+		g.webServer.OnStatusChange(status)
+	}
+	if g.grpcServer != nil {
+		g.grpcServer.OnStatusChange(status)
+	}
+
+	g.maintenanceTracker.SetMachineOn(status.MachineOn)
+	g.warmup.OnStatus(status)
+	if g.sched != nil && machineReady(status) {
+		go g.sched.SetReady()
+	}
+
+	if status.MachineOn && !g.lastMachineOn && g.vacation != nil {
+		g.vacation.OnPowerOn(g.powerOnSource())
+	}
+	g.lastMachineOn = status.MachineOn
+
+	if status.WaterLevel == lamarzocco.WaterLevelLow && g.lastWaterLevel != lamarzocco.WaterLevelLow {
+		g.publishEvent("water_tank_low", map[string]interface{}{"waterLevel": status.WaterLevel})
+	}
+	g.lastWaterLevel = status.WaterLevel
+
+	scale := scalePaired(status)
+	capabilities := g.client.Capabilities()
+	if scale != g.lastScale || capabilities != g.lastCapabilities {
+		g.lastScale = scale
+		g.lastCapabilities = capabilities
+		g.publishCapabilities()
+	}
+}
+
+// outages counts the outages per link of the account, including those the
+// flap_window suppressed
+func (g *gateway) outages() map[string]flap.Stats {
+	polling := flap.Stats{}
+	for _, m := range g.fleet() {
+		stats := m.pollingFlap.Stats()
+		polling.Outages += stats.Outages
+		polling.Suppressed += stats.Suppressed
+	}
+	return map[string]flap.Stats{"cloud": g.cloudFlap.Stats(), "polling": polling}
+}
+
+// pollStats returns the poll timings of the machines of the account
+func (g *gateway) pollStats() map[string]lamarzocco.PollStats {
+	stats := map[string]lamarzocco.PollStats{g.client.GetStatus().Serial: g.client.PollStats()}
+	for _, m := range g.machineList() {
+		stats[m.client.GetStatus().Serial] = m.client.PollStats()
+	}
+	return stats
+}
+
+func scalePaired(status lamarzocco.MachineStatus) bool {
+	return status.Scale != nil && status.Scale.Connected
+}
+
+// resync fetches the machine state from the cloud and republishes all retained topics
+func (g *gateway) resync() error {
+	if err := g.client.Resync(g.ctx); err != nil {
+		return err
+	}
+
+	g.publishCapabilities()
+	g.publishMaintenance(g.maintenanceTracker.Get())
+	g.publishPending(g.sched.List())
+	g.fetchSchedule()
+	if g.beans != nil {
+		g.publishInventory(g.beans.Get())
+	}
+	if g.waterTracker != nil {
+		g.publishWater(g.waterTracker.Get())
+	}
+
+	logger.Info("Resynchronized machine state")
+	return nil
+}
+
+func (g *gateway) onCommand(command string) {
+	if command == "CoffeeMachineBackFlushStartCleaning" {
+		g.maintenanceTracker.RecordBackflush()
+		if g.waterTracker != nil {
+			g.waterTracker.AddBackflush()
+		}
+	}
+}
+
+func (g *gateway) onBrew(event lamarzocco.BrewEvent) {
+	record := g.brewHistory.Add(event)
+	g.publishBrew(record)
+	g.onShotDetected(record)
+	g.maintenanceTracker.RecordShot()
+
+	if g.waterTracker != nil {
+		g.waterTracker.AddShot(event.TargetWeight)
+	}
+
+	if g.beans != nil {
+		g.beans.Consume(record.Dose)
+	}
+
+	if g.vacation != nil {
+		g.vacation.OnBrew(event.EndedAt)
+	}
+}
+
+func (g *gateway) onUnknownState(unknown lamarzocco.UnknownState) {
+	g.publishEvent("unknown_state", map[string]interface{}{
+		"field": unknown.Field,
+		"value": unknown.Value,
+	})
+}
+
+// onCircuitChange marks the bridge as degraded while the cloud is unavailable
+func (g *gateway) onCircuitChange(open bool) {
+	if !open {
+		g.publish(g.baseTopic+"/bridge/state", []byte("online"), true)
+		g.cloudFlap.Up(func() { g.publishEvent("cloud_recovered", nil) })
+		return
+	}
+	g.publish(g.baseTopic+"/bridge/state", []byte("degraded"), true)
+	g.cloudFlap.Down(func() { g.publishEvent("cloud_unavailable", nil) })
+}
+
+// onAuthChange marks the bridge with auth_error while sign-ins are rejected,
+// before repeated attempts get the account locked
+func (g *gateway) onAuthChange(err error) {
+	if err == nil {
+		g.publish(g.baseTopic+"/bridge/state", []byte("online"), true)
+		g.publishEvent("auth_recovered", nil)
+		return
+	}
+	g.publish(g.baseTopic+"/bridge/state", []byte("auth_error"), true)
+	g.publishEvent("auth_failed", map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// onDegraded reports polls that keep failing, the status already shows the
+// machine as disconnected with the reason
+func (g *gateway) onDegraded(reason string) {
+	if reason == "" {
+		g.pollingFlap.Up(func() { g.publishEvent("polling_recovered", nil) })
+		return
+	}
+	g.pollingFlap.Down(func() {
+		g.publishEvent("polling_failed", map[string]interface{}{
+			"error": reason,
+		})
+	})
+}
+
+func (g *gateway) onDiscrepancy(discrepancies []lamarzocco.Discrepancy) {
+	g.publishEvent("stream_discrepancy", map[string]interface{}{
+		"discrepancies": discrepancies,
+	})
+}
+
+func (g *gateway) onVacationChange(suspended bool, lastBrew time.Time) {
+	g.sched.SetAutoOnSuspended(suspended)
+
+	if suspended {
+		g.publishEvent("vacation_suspended", map[string]interface{}{
+			"lastBrew": lastBrew.UTC().Format(time.RFC3339),
+		})
+	} else {
+		g.publishEvent("vacation_resumed", nil)
+	}
+}
+
+// clientLogger forwards log messages of the La Marzocco client to the gateway log
+type clientLogger struct{}
+
+func (clientLogger) Debug(msg string, args ...any) { logger.Debug(msg, args...) }
+func (clientLogger) Info(msg string, args ...any)  { logger.Info(msg, args...) }
+func (clientLogger) Warn(msg string, args ...any)  { logger.Warn(msg, args...) }
+func (clientLogger) Error(msg string, args ...any) { logger.Error(msg, args...) }
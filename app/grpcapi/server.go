@@ -0,0 +1,162 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/history"
+	"github.com/philipparndt/go-logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const defaultHistoryLimit = 50
+
+// Server implements the LaMarzocco service defined in lamarzocco.proto
+type Server struct {
+	client        *lamarzocco.Client
+	history       *history.History
+	handleCommand func(payload []byte) error
+
+	subscribers   map[chan lamarzocco.MachineStatus]struct{}
+	subscribersMu sync.Mutex
+	grpcServer    *grpc.Server
+}
+
+// NewServer creates the gRPC server. Commands are passed to handleCommand as
+// JSON, the same way they arrive via MQTT.
+func NewServer(client *lamarzocco.Client, brewHistory *history.History, handleCommand func(payload []byte) error) *Server {
+	s := &Server{
+		client:        client,
+		history:       brewHistory,
+		handleCommand: handleCommand,
+		subscribers:   make(map[chan lamarzocco.MachineStatus]struct{}),
+		grpcServer:    grpc.NewServer(),
+	}
+	s.grpcServer.RegisterService(&serviceDesc, s)
+	return s
+}
+
+func (s *Server) Start(port int) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Starting gRPC server", "port", port)
+	return s.grpcServer.Serve(listener)
+}
+
+func (s *Server) Stop() {
+	s.grpcServer.GracefulStop()
+}
+
+// OnStatusChange forwards a status update to all streaming clients
+func (s *Server) OnStatusChange(machineStatus lamarzocco.MachineStatus) {
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- machineStatus:
+		default:
+			// Slow client, it will catch up with the next update
+		}
+	}
+}
+
+func (s *Server) getStatus(ctx context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	return toStruct(s.client.GetStatus())
+}
+
+func (s *Server) streamStatus(_ *emptypb.Empty, stream grpc.ServerStream) error {
+	updates := make(chan lamarzocco.MachineStatus, 10)
+	s.subscribersMu.Lock()
+	s.subscribers[updates] = struct{}{}
+	s.subscribersMu.Unlock()
+
+	defer func() {
+		s.subscribersMu.Lock()
+		delete(s.subscribers, updates)
+		s.subscribersMu.Unlock()
+	}()
+
+	send := func(machineStatus lamarzocco.MachineStatus) error {
+		message, err := toStruct(machineStatus)
+		if err != nil {
+			return err
+		}
+		return stream.SendMsg(message)
+	}
+
+	if err := send(s.client.GetStatus()); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case machineStatus := <-updates:
+			if err := send(machineStatus); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (s *Server) executeCommand(ctx context.Context, command *structpb.Struct) (*emptypb.Empty, error) {
+	payload, err := command.MarshalJSON()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := s.handleCommand(payload); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) queryHistory(ctx context.Context, query *structpb.Struct) (*structpb.ListValue, error) {
+	limit := defaultHistoryLimit
+	if value, ok := query.GetFields()["limit"]; ok {
+		limit = int(value.GetNumberValue())
+	}
+
+	data, err := json.Marshal(s.history.List(limit))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	var records []interface{}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	list, err := structpb.NewList(records)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return list, nil
+}
+
+// toStruct converts a value to a Struct using its JSON representation
+func toStruct(value interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	result := &structpb.Struct{}
+	if err := result.UnmarshalJSON(data); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return result, nil
+}
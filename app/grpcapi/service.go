@@ -0,0 +1,79 @@
+package grpcapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// The service only uses well-known protobuf types, so the descriptor is
+// written by hand instead of being generated from lamarzocco.proto. Keep both
+// in sync.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "lamarzocco.v1.LaMarzocco",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetStatus", Handler: getStatusHandler},
+		{MethodName: "ExecuteCommand", Handler: executeCommandHandler},
+		{MethodName: "QueryHistory", Handler: queryHistoryHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "StreamStatus", Handler: streamStatusHandler, ServerStreams: true},
+	},
+	Metadata: "lamarzocco.proto",
+}
+
+func getStatusHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(*Server).getStatus(ctx, req.(*emptypb.Empty))
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/lamarzocco.v1.LaMarzocco/GetStatus"}
+	return interceptor(ctx, in, info, handler)
+}
+
+func executeCommandHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(*Server).executeCommand(ctx, req.(*structpb.Struct))
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/lamarzocco.v1.LaMarzocco/ExecuteCommand"}
+	return interceptor(ctx, in, info, handler)
+}
+
+func queryHistoryHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(*Server).queryHistory(ctx, req.(*structpb.Struct))
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/lamarzocco.v1.LaMarzocco/QueryHistory"}
+	return interceptor(ctx, in, info, handler)
+}
+
+func streamStatusHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(emptypb.Empty)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(*Server).streamStatus(in, stream)
+}
@@ -0,0 +1,256 @@
+package hass
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Skipped is an automation that could not be converted
+type Skipped struct {
+	Automation string `json:"automation"`
+	Reason     string `json:"reason"`
+}
+
+// Result holds the converted triggers and the automations left in Home Assistant
+type Result struct {
+	Triggers []config.Trigger `json:"triggers"`
+	Skipped  []Skipped        `json:"skipped,omitempty"`
+}
+
+// Import converts Home Assistant automations (a list as in automations.yaml
+// or a single automation) into native triggers. Supported are MQTT triggers
+// with an optional payload and value_template and a single action setting the
+// dose mode, either mqtt.publish to <topic>/set or select.select_option.
+func Import(data []byte, topic string) (Result, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Result{}, fmt.Errorf("invalid YAML: %w", err)
+	}
+
+	var automations []interface{}
+	switch v := doc.(type) {
+	case []interface{}:
+		automations = v
+	case map[string]interface{}:
+		automations = []interface{}{v}
+	case nil:
+	default:
+		return Result{}, fmt.Errorf("expected a list of automations")
+	}
+
+	result := Result{Triggers: []config.Trigger{}}
+	for i, a := range automations {
+		automation, _ := a.(map[string]interface{})
+		name := automationName(automation, i)
+
+		triggers, err := convert(automation, name, topic)
+		if err != nil {
+			result.Skipped = append(result.Skipped, Skipped{Automation: name, Reason: err.Error()})
+			continue
+		}
+		result.Triggers = append(result.Triggers, triggers...)
+	}
+	return result, nil
+}
+
+func convert(automation map[string]interface{}, name, topic string) ([]config.Trigger, error) {
+	if automation == nil {
+		return nil, fmt.Errorf("not an automation")
+	}
+	if _, ok := automation["use_blueprint"]; ok {
+		return nil, fmt.Errorf("blueprint inputs are not supported, import the expanded automation")
+	}
+	if len(list(automation, "condition", "conditions")) > 0 {
+		return nil, fmt.Errorf("conditions are not supported")
+	}
+
+	actions := list(automation, "action", "actions")
+	if len(actions) != 1 {
+		return nil, fmt.Errorf("expected exactly one action, got %d", len(actions))
+	}
+	mode, err := convertAction(actions[0], topic)
+	if err != nil {
+		return nil, err
+	}
+
+	haTriggers := list(automation, "trigger", "triggers")
+	if len(haTriggers) == 0 {
+		return nil, fmt.Errorf("no trigger")
+	}
+
+	var triggers []config.Trigger
+	for i, t := range haTriggers {
+		trigger, err := convertTrigger(t)
+		if err != nil {
+			return nil, fmt.Errorf("trigger %d: %w", i, err)
+		}
+		trigger.Name = name
+		if len(haTriggers) > 1 {
+			trigger.Name = fmt.Sprintf("%s-%d", name, i+1)
+		}
+		trigger.Action = config.TriggerAction{Mode: mode}
+		triggers = append(triggers, trigger)
+	}
+	return triggers, nil
+}
+
+func convertTrigger(t interface{}) (config.Trigger, error) {
+	trigger, _ := t.(map[string]interface{})
+	platform := str(trigger, "platform", "trigger")
+	if platform != "mqtt" {
+		return config.Trigger{}, fmt.Errorf("only mqtt triggers are supported, got %q", platform)
+	}
+
+	result := config.Trigger{Topic: str(trigger, "topic"), Conditions: []config.TriggerCondition{}}
+	if result.Topic == "" {
+		return config.Trigger{}, fmt.Errorf("mqtt trigger without topic")
+	}
+
+	payload, hasPayload := trigger["payload"]
+	template := str(trigger, "value_template")
+	switch {
+	case template != "":
+		selector, err := templateSelector(template)
+		if err != nil {
+			return config.Trigger{}, err
+		}
+		if !hasPayload {
+			return config.Trigger{}, fmt.Errorf("value_template without payload")
+		}
+		result.Conditions = append(result.Conditions, config.TriggerCondition{Selector: selector, Value: scalar(payload)})
+	case hasPayload:
+		// Home Assistant compares the whole payload as text
+		result.Expression = "payload == " + strconv.Quote(fmt.Sprint(payload))
+	}
+	return result, nil
+}
+
+// valueJSON matches templates like {{ value_json.action }} or {{ value_json['a'].b }}
+var (
+	valueJSON    = regexp.MustCompile(`^\{\{\s*value_json((?:\.\w+|\[\s*'[^']*'\s*\]|\[\s*"[^"]*"\s*\]|\[\s*\d+\s*\])+)\s*\}\}$`)
+	valueJSONKey = regexp.MustCompile(`\.(\w+)|\[\s*'([^']*)'\s*\]|\[\s*"([^"]*)"\s*\]|\[\s*(\d+)\s*\]`)
+)
+
+// templateSelector turns a value_json template into a gjson selector
+func templateSelector(template string) (string, error) {
+	m := valueJSON.FindStringSubmatch(strings.TrimSpace(template))
+	if m == nil {
+		return "", fmt.Errorf("unsupported value_template %q, only value_json lookups are supported", template)
+	}
+
+	var keys []string
+	for _, key := range valueJSONKey.FindAllStringSubmatch(m[1], -1) {
+		k := key[1] + key[2] + key[3] + key[4]
+		keys = append(keys, strings.NewReplacer(".", `\.`, "*", `\*`, "?", `\?`).Replace(k))
+	}
+	return strings.Join(keys, "."), nil
+}
+
+func convertAction(a interface{}, topic string) (string, error) {
+	action, _ := a.(map[string]interface{})
+	service := str(action, "service", "action")
+	data := mapping(action, "data", "service_data")
+
+	switch service {
+	case "mqtt.publish":
+		if target := str(data, "topic"); target != topic+"/set" {
+			return "", fmt.Errorf("mqtt.publish to %q instead of %q", target, topic+"/set")
+		}
+		return payloadMode(data["payload"])
+	case "select.select_option":
+		return doseMode(str(data, "option"))
+	default:
+		return "", fmt.Errorf("unsupported action %q", service)
+	}
+}
+
+// payloadMode extracts the dose mode of a command that sets nothing else
+func payloadMode(payload interface{}) (string, error) {
+	command, ok := payload.(map[string]interface{})
+	if text, isText := payload.(string); isText {
+		if err := json.Unmarshal([]byte(text), &command); err != nil {
+			return "", fmt.Errorf("payload is not a JSON command")
+		}
+		ok = true
+	}
+	if !ok {
+		return "", fmt.Errorf("payload is not a JSON command")
+	}
+	mode, _ := command["mode"].(string)
+	if len(command) != 1 || mode == "" {
+		return "", fmt.Errorf("triggers can only set the dose mode")
+	}
+	return doseMode(mode)
+}
+
+func doseMode(mode string) (string, error) {
+	switch mode {
+	case "Dose1", "Dose2", "Continuous":
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown dose mode %q", mode)
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// automationName slugs the alias or id, the name is used in topics
+func automationName(automation map[string]interface{}, index int) string {
+	name := str(automation, "alias", "id")
+	slug := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if slug == "" {
+		return fmt.Sprintf("automation-%d", index)
+	}
+	return slug
+}
+
+// list returns the first of the keys, a single item counts as a list of one
+func list(m map[string]interface{}, keys ...string) []interface{} {
+	for _, key := range keys {
+		switch v := m[key].(type) {
+		case []interface{}:
+			return v
+		case nil:
+			continue
+		default:
+			return []interface{}{v}
+		}
+	}
+	return nil
+}
+
+func mapping(m map[string]interface{}, keys ...string) map[string]interface{} {
+	for _, key := range keys {
+		if v, ok := m[key].(map[string]interface{}); ok {
+			return v
+		}
+	}
+	return nil
+}
+
+func str(m map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if v, ok := m[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// scalar converts YAML numbers to the float64 used by trigger conditions
+func scalar(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	}
+	return v
+}
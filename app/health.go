@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/philipparndt/mqtt-gateway/mqtt"
+)
+
+const (
+	mqttPingInterval = 30 * time.Second
+	mqttPingTimeout  = 5 * time.Second
+)
+
+// mqttRoundTrip publishes a nonce to <topic>/ping and waits until the broker
+// delivers it back
+func (g *gateway) mqttRoundTrip() (time.Duration, error) {
+	topic := g.cfg.MQTT.Topic + "/ping"
+	g.pingOnce.Do(func() {
+		mqtt.Subscribe(topic, func(_ string, payload []byte) {
+			g.pingMu.Lock()
+			defer g.pingMu.Unlock()
+			if ch, ok := g.pings[string(payload)]; ok {
+				close(ch)
+				delete(g.pings, string(payload))
+			}
+		})
+	})
+
+	nonce := uuid.New().String()
+	received := make(chan struct{})
+	g.pingMu.Lock()
+	g.pings[nonce] = received
+	g.pingMu.Unlock()
+	defer func() {
+		g.pingMu.Lock()
+		delete(g.pings, nonce)
+		g.pingMu.Unlock()
+	}()
+
+	// The subscription may not be active yet, publish until the nonce arrives
+	started := time.Now()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	timeout := time.After(mqttPingTimeout)
+	for {
+		// Not compressed, the nonce is compared as it is
+		mqtt.PublishAbsolute(topic, nonce, false)
+		select {
+		case <-received:
+			return time.Since(started), nil
+		case <-ticker.C:
+		case <-timeout:
+			return 0, fmt.Errorf("no round trip via %s within %s", topic, mqttPingTimeout)
+		}
+	}
+}
+
+// monitorMQTT checks the broker connection with a round trip every mqttPingInterval
+func (g *gateway) monitorMQTT() {
+	ticker := time.NewTicker(mqttPingInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := g.mqttRoundTrip()
+		g.mqttUp.Set(err == nil, g.clock.Now())
+
+		select {
+		case <-ticker.C:
+		case <-g.stopCh:
+			return
+		}
+	}
+}
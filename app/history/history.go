@@ -0,0 +1,174 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/philipparndt/go-logger"
+)
+
+// groundWeightMaxAge is how long a grinder reading waits for the next shot
+const groundWeightMaxAge = 30 * time.Minute
+
+// AnnotationWindow is how long after a shot it can be rated
+const AnnotationWindow = 24 * time.Hour
+
+var (
+	ErrNotFound         = errors.New("brew not found")
+	ErrAnnotationClosed = errors.New("annotation window closed")
+)
+
+// History records observed brews in the persistent state
+type History struct {
+	store       *state.Store
+	defaultDose float64
+	clock       clock.Clock
+
+	groundWeight   float64
+	groundWeightAt time.Time
+	retention      Retention
+	mu             sync.Mutex
+
+	onAdd func(state.BrewRecord)
+}
+
+func New(store *state.Store, defaultDose float64) *History {
+	return &History{
+		store:       store,
+		defaultDose: defaultDose,
+		clock:       clock.System,
+		retention:   Retention{MaxEntries: DefaultMaxEntries},
+	}
+}
+
+func (h *History) SetAddCallback(callback func(state.BrewRecord)) {
+	h.onAdd = callback
+}
+
+// SetClock replaces the system clock, e.g. for tests
+func (h *History) SetClock(c clock.Clock) {
+	h.clock = c
+}
+
+// SetGroundWeight stores a grinder reading that is attached to the next brew
+func (h *History) SetGroundWeight(grams float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.groundWeight = grams
+	h.groundWeightAt = h.clock.Now()
+}
+
+// takeGroundWeight returns and clears a pending grinder reading
+func (h *History) takeGroundWeight() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	grams := h.groundWeight
+	if h.clock.Now().Sub(h.groundWeightAt) > groundWeightMaxAge {
+		grams = 0
+	}
+	h.groundWeight = 0
+	return grams
+}
+
+// Add records a brew tagged with the active profile and the pending grinder reading
+func (h *History) Add(event lamarzocco.BrewEvent) state.BrewRecord {
+	groundWeight := h.takeGroundWeight()
+
+	dose := groundWeight
+	if dose == 0 {
+		dose = h.defaultDose
+	}
+
+	var record state.BrewRecord
+	err := h.store.Update(func(s *state.State) {
+		record = state.BrewRecord{
+			ID:           uuid.New().String(),
+			BrewEvent:    event,
+			Profile:      s.ActiveProfile,
+			GroundWeight: groundWeight,
+			Dose:         dose,
+		}
+		if dose > 0 && event.TargetWeight > 0 {
+			record.Ratio = math.Round(event.TargetWeight/dose*100) / 100
+		}
+		s.History = append(s.History, record)
+		h.compact(s)
+	})
+	if err != nil {
+		logger.Error("Failed to persist brew history", "error", err)
+	}
+
+	if h.onAdd != nil {
+		h.onAdd(record)
+	}
+	return record
+}
+
+// List returns the most recent entries, newest first. limit <= 0 returns all.
+func (h *History) List(limit int) []state.BrewRecord {
+	entries := h.store.Get().History
+
+	count := len(entries)
+	if limit > 0 && limit < count {
+		count = limit
+	}
+
+	result := make([]state.BrewRecord, 0, count)
+	for i := len(entries) - 1; i >= 0 && len(result) < count; i-- {
+		result = append(result, entries[i])
+	}
+	return result
+}
+
+func (h *History) Get(id string) (state.BrewRecord, bool) {
+	for _, entry := range h.store.Get().History {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return state.BrewRecord{}, false
+}
+
+// Annotate attaches a rating (1-5, 0 keeps the current one) and a note to a
+// brew. An empty id annotates the latest brew.
+func (h *History) Annotate(id string, rating int, note string) (state.BrewRecord, error) {
+	if rating < 0 || rating > 5 {
+		return state.BrewRecord{}, fmt.Errorf("rating must be between 1 and 5, got %d", rating)
+	}
+
+	now := h.clock.Now()
+	var record state.BrewRecord
+	err := ErrNotFound
+	updateErr := h.store.Update(func(s *state.State) {
+		for i := len(s.History) - 1; i >= 0; i-- {
+			entry := &s.History[i]
+			if id != "" && entry.ID != id {
+				continue
+			}
+			if now.Sub(entry.EndedAt) > AnnotationWindow {
+				err = ErrAnnotationClosed
+				return
+			}
+			if rating > 0 {
+				entry.Rating = rating
+			}
+			entry.Note = note
+			entry.AnnotatedAt = now
+			record = *entry
+			err = nil
+			return
+		}
+	})
+	if updateErr != nil {
+		return state.BrewRecord{}, updateErr
+	}
+	return record, err
+}
@@ -0,0 +1,163 @@
+package history
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/philipparndt/go-logger"
+)
+
+// DefaultMaxEntries bounds the history kept in the state file
+const DefaultMaxEntries = 1000
+
+const (
+	dayFormat       = "2006-01-02"
+	compactInterval = time.Hour
+)
+
+// Retention limits the detailed history. Removed entries are aggregated into
+// daily rollups. Zero values disable the respective limit.
+type Retention struct {
+	Days       int
+	MaxEntries int
+}
+
+// DailySummary is a daily rollup with averages
+type DailySummary struct {
+	Day          string  `json:"day"`
+	Shots        int     `json:"shots"`
+	Dose         float64 `json:"dose"`
+	TargetWeight float64 `json:"targetWeight"`
+	Ratio        float64 `json:"ratio,omitempty"`
+	Rating       float64 `json:"rating,omitempty"`
+}
+
+func (h *History) SetRetention(retention Retention) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.retention = retention
+}
+
+// Compact moves entries beyond the retention into daily rollups
+func (h *History) Compact() {
+	err := h.store.Update(func(s *state.State) {
+		h.compact(s)
+	})
+	if err != nil {
+		logger.Error("Failed to compact brew history", "error", err)
+	}
+}
+
+// Run compacts the history periodically until stopCh is closed
+func (h *History) Run(stopCh <-chan struct{}) {
+	h.Compact()
+
+	ticker := time.NewTicker(compactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.Compact()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// Rollups returns the daily rollups of compacted entries, oldest first
+func (h *History) Rollups() []DailySummary {
+	rollups := h.store.Get().HistoryRollups
+
+	result := make([]DailySummary, 0, len(rollups))
+	for _, rollup := range rollups {
+		summary := DailySummary{
+			Day:          rollup.Day,
+			Shots:        rollup.Shots,
+			Dose:         rollup.Dose,
+			TargetWeight: rollup.TargetWeight,
+		}
+		if rollup.RatioShots > 0 {
+			summary.Ratio = math.Round(rollup.RatioSum/float64(rollup.RatioShots)*100) / 100
+		}
+		if rollup.RatedShots > 0 {
+			summary.Rating = math.Round(float64(rollup.RatingSum)/float64(rollup.RatedShots)*10) / 10
+		}
+		result = append(result, summary)
+	}
+	return result
+}
+
+// Shots counts the shots of the local day of t, including compacted ones
+func (h *History) Shots(t time.Time) int {
+	current := h.store.Get()
+	loc := h.clock.Now().Location()
+	day := t.In(loc).Format(dayFormat)
+
+	shots := 0
+	for _, record := range current.History {
+		if record.StartedAt.In(loc).Format(dayFormat) == day {
+			shots++
+		}
+	}
+	for _, rollup := range current.HistoryRollups {
+		if rollup.Day == day {
+			shots += rollup.Shots
+		}
+	}
+	return shots
+}
+
+// compact must be called within a store update
+func (h *History) compact(s *state.State) {
+	h.mu.Lock()
+	retention := h.retention
+	h.mu.Unlock()
+
+	keepFrom := 0
+	if retention.MaxEntries > 0 && len(s.History) > retention.MaxEntries {
+		keepFrom = len(s.History) - retention.MaxEntries
+	}
+	if retention.Days > 0 {
+		cutoff := h.clock.Now().AddDate(0, 0, -retention.Days)
+		for keepFrom < len(s.History) && s.History[keepFrom].StartedAt.Before(cutoff) {
+			keepFrom++
+		}
+	}
+	if keepFrom == 0 {
+		return
+	}
+
+	for _, record := range s.History[:keepFrom] {
+		s.HistoryRollups = addToRollup(s.HistoryRollups, record, h.clock.Now().Location())
+	}
+	s.History = append([]state.BrewRecord(nil), s.History[keepFrom:]...)
+	logger.Debug("Compacted brew history", "entries", keepFrom)
+}
+
+func addToRollup(rollups []state.DailyRollup, record state.BrewRecord, loc *time.Location) []state.DailyRollup {
+	day := record.StartedAt.In(loc).Format(dayFormat)
+
+	i := sort.Search(len(rollups), func(i int) bool { return rollups[i].Day >= day })
+	if i == len(rollups) || rollups[i].Day != day {
+		rollups = append(rollups, state.DailyRollup{})
+		copy(rollups[i+1:], rollups[i:])
+		rollups[i] = state.DailyRollup{Day: day}
+	}
+
+	rollup := &rollups[i]
+	rollup.Shots++
+	rollup.Dose += record.Dose
+	rollup.TargetWeight += record.TargetWeight
+	if record.Ratio > 0 {
+		rollup.RatioShots++
+		rollup.RatioSum += record.Ratio
+	}
+	if record.Rating > 0 {
+		rollup.RatedShots++
+		rollup.RatingSum += record.Rating
+	}
+	return rollups
+}
@@ -0,0 +1,143 @@
+// Package i18n translates the human-readable messages of published events.
+// Event types and other fields stay the same in every language.
+package i18n
+
+import "strings"
+
+const DefaultLanguage = "en"
+
+var languages = map[string]bool{"en": true, "de": true, "it": true}
+
+// messages maps event types to their message per language
+var messages = map[string]map[string]string{
+	"gateway_started": {
+		"en": "Gateway started",
+		"de": "Gateway gestartet",
+		"it": "Gateway avviato",
+	},
+	"beans_low": {
+		"en": "Beans running low",
+		"de": "Die Bohnen gehen zur Neige",
+		"it": "Il caffè in grani sta finendo",
+	},
+	"water_filter_exhausted": {
+		"en": "Water filter capacity reached",
+		"de": "Kapazität des Wasserfilters erreicht",
+		"it": "Capacità del filtro dell'acqua esaurita",
+	},
+	"backflush_recommended": {
+		"en": "Backflush recommended",
+		"de": "Rückspülen empfohlen",
+		"it": "Si consiglia il controlavaggio",
+	},
+	"morning_report": {
+		"en": "Good morning, here is the coffee report",
+		"de": "Guten Morgen, hier ist der Kaffeebericht",
+		"it": "Buongiorno, ecco il resoconto del caffè",
+	},
+	"machine_added": {
+		"en": "A machine was added to the account",
+		"de": "Eine Maschine wurde dem Konto hinzugefügt",
+		"it": "Una macchina è stata aggiunta all'account",
+	},
+	"machine_removed": {
+		"en": "A machine was removed from the account",
+		"de": "Eine Maschine wurde aus dem Konto entfernt",
+		"it": "Una macchina è stata rimossa dall'account",
+	},
+	"water_tank_low": {
+		"en": "Water tank low, refill it before the next shot",
+		"de": "Wassertank fast leer, vor dem nächsten Bezug auffüllen",
+		"it": "Serbatoio dell'acqua quasi vuoto, riempirlo prima del prossimo caffè",
+	},
+	"vacation_suspended": {
+		"en": "Machine unused, auto-on schedules suspended until the next manual power-on",
+		"de": "Maschine unbenutzt, automatisches Einschalten bis zum nächsten manuellen Einschalten ausgesetzt",
+		"it": "Macchina inutilizzata, accensioni programmate sospese fino alla prossima accensione manuale",
+	},
+	"vacation_resumed": {
+		"en": "Machine powered on, auto-on schedules resumed",
+		"de": "Maschine eingeschaltet, automatisches Einschalten wieder aktiv",
+		"it": "Macchina accesa, accensioni programmate riattivate",
+	},
+	"stream_discrepancy": {
+		"en": "Streamed state differed from the polled machine state and was corrected",
+		"de": "Der gestreamte Zustand wich vom abgefragten Maschinenzustand ab und wurde korrigiert",
+		"it": "Lo stato ricevuto in streaming differiva da quello letto dalla macchina ed è stato corretto",
+	},
+	"unknown_state": {
+		"en": "The machine reported a state the gateway does not recognize",
+		"de": "Die Maschine meldete einen Zustand, den das Gateway nicht kennt",
+		"it": "La macchina ha segnalato uno stato che il gateway non riconosce",
+	},
+	"cloud_unavailable": {
+		"en": "La Marzocco cloud unavailable, requests are suspended",
+		"de": "La-Marzocco-Cloud nicht erreichbar, Anfragen werden ausgesetzt",
+		"it": "Cloud La Marzocco non raggiungibile, richieste sospese",
+	},
+	"cloud_recovered": {
+		"en": "La Marzocco cloud available again",
+		"de": "La-Marzocco-Cloud wieder erreichbar",
+		"it": "Cloud La Marzocco di nuovo raggiungibile",
+	},
+	"auth_failed": {
+		"en": "La Marzocco sign-in rejected, check the credentials. Further attempts are delayed",
+		"de": "La-Marzocco-Anmeldung abgelehnt, bitte Zugangsdaten prüfen. Weitere Versuche werden verzögert",
+		"it": "Accesso a La Marzocco rifiutato, verificare le credenziali. I tentativi successivi vengono ritardati",
+	},
+	"auth_recovered": {
+		"en": "La Marzocco sign-in successful again",
+		"de": "La-Marzocco-Anmeldung wieder erfolgreich",
+		"it": "Accesso a La Marzocco di nuovo riuscito",
+	},
+	"command_failed": {
+		"en": "A command could not be applied to the machine",
+		"de": "Ein Befehl konnte nicht an die Maschine übertragen werden",
+		"it": "Non è stato possibile applicare un comando alla macchina",
+	},
+	"test": {
+		"en": "Test notification from the La Marzocco gateway",
+		"de": "Testbenachrichtigung vom La-Marzocco-Gateway",
+		"it": "Notifica di prova dal gateway La Marzocco",
+	},
+	"job_finished": {
+		"en": "A long-running operation finished",
+		"de": "Ein länger laufender Vorgang wurde abgeschlossen",
+		"it": "Un'operazione di lunga durata è terminata",
+	},
+}
+
+type Translator struct {
+	language string
+}
+
+// New returns a translator for the language (e.g. "de", "it-IT"). Unknown
+// languages fall back to English.
+func New(language string) *Translator {
+	language, _, _ = strings.Cut(strings.ToLower(language), "-")
+	if !Supported(language) {
+		language = DefaultLanguage
+	}
+	return &Translator{language: language}
+}
+
+// Supported reports whether messages are available in the language
+func Supported(language string) bool {
+	return languages[language]
+}
+
+func (t *Translator) Language() string {
+	return t.language
+}
+
+// Message returns the text for an event type, empty if there is none
+func (t *Translator) Message(eventType string) string {
+	translations, ok := messages[eventType]
+	if !ok {
+		return ""
+	}
+	if message, ok := translations[t.language]; ok {
+		return message
+	}
+	return translations[DefaultLanguage]
+}
@@ -0,0 +1,120 @@
+package inventory
+
+import (
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/philipparndt/go-logger"
+)
+
+// Inventory tracks the remaining grams of the active bean bag
+type Inventory struct {
+	store        *state.Store
+	defaultBag   float64
+	lowThreshold float64
+	clock        clock.Clock
+
+	onChange func(inventory state.BeanInventory)
+	onLow    func(inventory state.BeanInventory)
+}
+
+func New(store *state.Store, bagSize, lowThreshold float64) *Inventory {
+	return &Inventory{
+		store:        store,
+		defaultBag:   bagSize,
+		lowThreshold: lowThreshold,
+		clock:        clock.System,
+	}
+}
+
+// SetClock replaces the system clock, e.g. for tests
+func (i *Inventory) SetClock(c clock.Clock) {
+	i.clock = c
+}
+
+func (i *Inventory) SetChangeCallback(callback func(state.BeanInventory)) {
+	i.onChange = callback
+}
+
+// SetLowCallback registers a callback invoked when the remaining beans drop
+// below the configured threshold
+func (i *Inventory) SetLowCallback(callback func(state.BeanInventory)) {
+	i.onLow = callback
+}
+
+func (i *Inventory) Get() state.BeanInventory {
+	if inventory := i.store.Get().Inventory; inventory != nil {
+		return *inventory
+	}
+	return state.BeanInventory{BagSize: i.defaultBag}
+}
+
+// Low reports whether the remaining beans are below the threshold
+func (i *Inventory) Low() bool {
+	return i.Get().Remaining < i.lowThreshold
+}
+
+// Set replaces the inventory, e.g. to correct the remaining amount
+func (i *Inventory) Set(inventory state.BeanInventory) error {
+	if inventory.BagSize <= 0 {
+		inventory.BagSize = i.defaultBag
+	}
+	if err := i.update(func(current *state.BeanInventory) {
+		*current = inventory
+	}); err != nil {
+		return err
+	}
+	i.notifyChange()
+	return nil
+}
+
+// Refill starts a new bag, the bag size defaults to the configured one
+func (i *Inventory) Refill(bean string, bagSize float64) error {
+	if bagSize <= 0 {
+		bagSize = i.defaultBag
+	}
+	logger.Info("New bean bag opened", "bean", bean, "bag_size", bagSize)
+	return i.Set(state.BeanInventory{
+		Bean:      bean,
+		BagSize:   bagSize,
+		Remaining: bagSize,
+		OpenedAt:  i.clock.Now(),
+	})
+}
+
+// Consume subtracts the dose of a shot from the remaining beans
+func (i *Inventory) Consume(grams float64) {
+	wasLow := i.Low()
+
+	err := i.update(func(current *state.BeanInventory) {
+		current.Remaining -= grams
+		if current.Remaining < 0 {
+			current.Remaining = 0
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to persist bean inventory", "error", err)
+	}
+	i.notifyChange()
+
+	if !wasLow && i.Low() {
+		logger.Warn("Beans running low", "remaining", i.Get().Remaining)
+		if i.onLow != nil {
+			i.onLow(i.Get())
+		}
+	}
+}
+
+func (i *Inventory) update(fn func(*state.BeanInventory)) error {
+	return i.store.Update(func(s *state.State) {
+		if s.Inventory == nil {
+			s.Inventory = &state.BeanInventory{BagSize: i.defaultBag}
+		}
+		fn(s.Inventory)
+	})
+}
+
+func (i *Inventory) notifyChange() {
+	if i.onChange != nil {
+		i.onChange(i.Get())
+	}
+}
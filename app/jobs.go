@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/jobs"
+	"github.com/philipparndt/go-logger"
+)
+
+const (
+	backFlushTimeout  = 10 * time.Minute
+	backFlushEstimate = 2 * time.Minute // Typical cleaning cycle, used for the progress
+	jobPollInterval   = 5 * time.Second
+)
+
+// startBackFlush starts a back flush as a job, unsupported machines fail immediately
+func (g *gateway) startBackFlush() (jobs.Job, error) {
+	if !g.client.Capabilities().BackFlush {
+		return jobs.Job{}, fmt.Errorf("back flush: %w", lamarzocco.ErrNotSupported)
+	}
+
+	job := g.jobs.Start("backflush", g.runBackFlush)
+	logger.Info("Back flush started", "job", job.ID)
+	return job, nil
+}
+
+// runBackFlush sends the command and follows the CMBackFlush status until the
+// machine is done. Machines that do not report it finish after the estimate.
+func (g *gateway) runBackFlush(report jobs.Report) error {
+	report(0, "Starting back flush")
+	if err := g.client.StartBackFlush(g.ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	started := g.clock.Now()
+	var cleaningSince time.Time
+	seen := false
+	for {
+		select {
+		case <-ticker.C:
+		case <-g.stopCh:
+			return errors.New("gateway stopped")
+		}
+
+		if !g.client.StreamConnected() {
+			if err := g.client.Refresh(g.ctx); err != nil {
+				logger.Warn("Failed to refresh back flush status", "error", err)
+			}
+		}
+
+		now := g.clock.Now()
+		status := g.client.GetStatus().BackFlush
+		switch {
+		case status == nil:
+			elapsed := now.Sub(started)
+			if elapsed >= backFlushEstimate {
+				report(1, "Back flush finished (estimated, not reported by the machine)")
+				return nil
+			}
+			report(elapsed.Seconds()/backFlushEstimate.Seconds(), "Back flush running")
+		case status.Status == lamarzocco.BackFlushRequested:
+			seen = true
+			report(0.05, "Waiting for the back flush to be started on the machine")
+		case status.Status == lamarzocco.BackFlushCleaning:
+			seen = true
+			if cleaningSince.IsZero() {
+				cleaningSince = now
+			}
+			progress := 0.1 + 0.85*min(now.Sub(cleaningSince).Seconds()/backFlushEstimate.Seconds(), 1)
+			report(progress, "Cleaning")
+		case seen:
+			return nil
+		}
+
+		if now.Sub(started) > backFlushTimeout {
+			return fmt.Errorf("back flush did not finish within %s", backFlushTimeout)
+		}
+	}
+}
+
+func (g *gateway) onJobFinished(job jobs.Job) {
+	logger.Info("Job finished", "job", job.ID, "type", job.Type, "state", job.State, "error", job.Error)
+
+	data := map[string]interface{}{
+		"jobId": job.ID,
+		"job":   job.Type,
+		"state": job.State,
+	}
+	if job.Error != "" {
+		data["error"] = job.Error
+	}
+	g.publishEvent("job_finished", data)
+}
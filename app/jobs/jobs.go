@@ -0,0 +1,229 @@
+// Package jobs tracks long-running operations such as a back flush, so
+// callers get an ID to follow the progress instead of firing and forgetting.
+package jobs
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+)
+
+// maxFinished is the number of finished jobs kept for polling
+const maxFinished = 50
+
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+)
+
+type Job struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"` // e.g. "backflush"
+	State      State      `json:"state"`
+	Progress   float64    `json:"progress"` // 0 to 1
+	Message    string     `json:"message,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+func (j Job) Finished() bool {
+	return j.State != StateRunning
+}
+
+// Report updates the progress (0 to 1) and message of the running job
+type Report func(progress float64, message string)
+
+// Func runs the operation, the job fails if it returns an error
+type Func func(report Report) error
+
+type Manager struct {
+	jobs        map[string]*Job
+	subscribers map[string]map[chan Job]struct{}
+	clock       clock.Clock
+	mu          sync.Mutex
+	onFinish    func(Job)
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		jobs:        make(map[string]*Job),
+		subscribers: make(map[string]map[chan Job]struct{}),
+		clock:       clock.System,
+	}
+}
+
+// SetClock replaces the system clock, e.g. for tests
+func (m *Manager) SetClock(c clock.Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = c
+}
+
+// SetFinishedCallback is called once per job when it succeeded or failed
+func (m *Manager) SetFinishedCallback(callback func(Job)) {
+	m.onFinish = callback
+}
+
+// Start runs fn in the background and returns the job immediately
+func (m *Manager) Start(jobType string, fn Func) Job {
+	m.mu.Lock()
+	job := &Job{
+		ID:        uuid.New().String(),
+		Type:      jobType,
+		State:     StateRunning,
+		StartedAt: m.clock.Now(),
+	}
+	m.jobs[job.ID] = job
+	started := *job
+	m.mu.Unlock()
+
+	go func() {
+		err := fn(func(progress float64, message string) {
+			m.update(job.ID, func(j *Job) {
+				j.Progress = min(max(progress, 0), 1)
+				j.Message = message
+			})
+		})
+
+		finished := m.update(job.ID, func(j *Job) {
+			now := m.clock.Now()
+			j.FinishedAt = &now
+			if err != nil {
+				j.State = StateFailed
+				j.Error = err.Error()
+				return
+			}
+			j.State = StateSucceeded
+			j.Progress = 1
+		})
+		m.prune()
+
+		if m.onFinish != nil {
+			m.onFinish(finished)
+		}
+	}()
+
+	return started
+}
+
+// update changes a job and hands the new state to its subscribers
+func (m *Manager) update(id string, change func(*Job)) Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job := m.jobs[id]
+	change(job)
+
+	for ch := range m.subscribers[id] {
+		select {
+		case ch <- *job:
+		default:
+			// Slow subscriber, skip the update but make room for the final state
+			if job.Finished() {
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- *job
+			}
+		}
+		if job.Finished() {
+			close(ch)
+		}
+	}
+	if job.Finished() {
+		delete(m.subscribers, id)
+	}
+	return *job
+}
+
+// prune drops the oldest finished jobs beyond maxFinished
+func (m *Manager) prune() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var finished []*Job
+	for _, job := range m.jobs {
+		if job.Finished() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinished {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].FinishedAt.Before(*finished[j].FinishedAt)
+	})
+	for _, job := range finished[:len(finished)-maxFinished] {
+		delete(m.jobs, job.ID)
+	}
+}
+
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns all known jobs, newest first
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		list = append(list, *job)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.After(list[j].StartedAt)
+	})
+	return list
+}
+
+// Subscribe returns a channel receiving the current state and every update
+// of a job. It is closed once the job finished; cancel stops the updates
+// early. ok is false if the job is unknown.
+func (m *Manager) Subscribe(id string) (updates <-chan Job, cancel func(), ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, nil, false
+	}
+
+	ch := make(chan Job, 10)
+	ch <- *job
+	if job.Finished() {
+		close(ch)
+		return ch, func() {}, true
+	}
+
+	if m.subscribers[id] == nil {
+		m.subscribers[id] = make(map[chan Job]struct{})
+	}
+	m.subscribers[id][ch] = struct{}{}
+
+	cancel = func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.subscribers[id][ch]; ok {
+			delete(m.subscribers[id], ch)
+			close(ch)
+		}
+	}
+	return ch, cancel, true
+}
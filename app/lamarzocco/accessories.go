@@ -0,0 +1,76 @@
+package lamarzocco
+
+import (
+	"context"
+	"fmt"
+)
+
+// AccessoriesInfo is the state of the switchable accessories, nil if the
+// machine does not report one
+type AccessoriesInfo struct {
+	CupWarmer     *bool `json:"cupWarmer,omitempty"`
+	BaristaLights *bool `json:"baristaLights,omitempty"`
+}
+
+// SetCupWarmer switches the cup warmer on or off
+func (c *Client) SetCupWarmer(ctx context.Context, enabled bool) error {
+	if err := requireCapability(c.Capabilities().CupWarmer, "cup warmer"); err != nil {
+		return err
+	}
+	return c.setAccessory(ctx, "CoffeeMachineSettingCupWarmer", enabled, func(a *AccessoriesInfo) {
+		a.CupWarmer = &enabled
+	})
+}
+
+// SetBaristaLights switches the barista (cup) lights on or off
+func (c *Client) SetBaristaLights(ctx context.Context, enabled bool) error {
+	if err := requireCapability(c.Capabilities().BaristaLights, "barista lights"); err != nil {
+		return err
+	}
+	return c.setAccessory(ctx, "CoffeeMachineSettingBaristaLights", enabled, func(a *AccessoriesInfo) {
+		a.BaristaLights = &enabled
+	})
+}
+
+func (c *Client) setAccessory(ctx context.Context, command string, enabled bool, fn func(*AccessoriesInfo)) error {
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := c.postCommand(ctx, command, map[string]interface{}{"enabled": enabled}); err != nil {
+		return fmt.Errorf("failed to switch accessory: %w", err)
+	}
+
+	c.modeLock.Lock()
+	accessories := AccessoriesInfo{}
+	if c.accessories != nil {
+		accessories = *c.accessories
+	}
+	fn(&accessories)
+	c.accessories = &accessories
+	c.modeLock.Unlock()
+
+	c.notifyStatusChange()
+
+	c.log.Info("Accessory set successfully", "command", command, "enabled", enabled)
+	return nil
+}
+
+// accessoryOutput is the output of the CMCupWarmer and CMBaristaLights
+// widgets, e.g. {"enabled": true}
+type accessoryOutput struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func accessoriesChanged(old, new *AccessoriesInfo) bool {
+	if new == nil {
+		return false
+	}
+	if old == nil {
+		return true
+	}
+	return boolValue(old.CupWarmer) != boolValue(new.CupWarmer) || (old.CupWarmer == nil) != (new.CupWarmer == nil) ||
+		boolValue(old.BaristaLights) != boolValue(new.BaristaLights) || (old.BaristaLights == nil) != (new.BaristaLights == nil)
+}
@@ -7,6 +7,8 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
@@ -156,3 +158,47 @@ func encodeDERSignature(r, s *big.Int) []byte {
 	content := append(rPart, sPart...)
 	return append([]byte{0x30, byte(len(content))}, content...)
 }
+
+// defaultTokenLifetime is assumed for access tokens without a readable exp claim
+const defaultTokenLifetime = time.Hour
+
+// tokenExpiry reads the exp claim of a JWT access token. The signature is not
+// verified, the server does that; the claim only times the refresh.
+func tokenExpiry(accessToken string) (time.Time, error) {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("access token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode JWT payload: %w", err)
+	}
+
+	var claims struct {
+		Exp *json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse JWT claims: %w", err)
+	}
+	if claims.Exp == nil {
+		return time.Time{}, errors.New("JWT has no exp claim")
+	}
+
+	exp, err := claims.Exp.Float64()
+	if err != nil || exp <= 0 {
+		return time.Time{}, fmt.Errorf("invalid JWT exp claim %q", claims.Exp.String())
+	}
+	return time.Unix(0, int64(exp*float64(time.Second))), nil
+}
+
+// tokenExpiresAt returns the expiry of an access token, falling back to the
+// default lifetime if the token does not tell
+func (c *Client) tokenExpiresAt(accessToken string) time.Time {
+	expiresAt, err := tokenExpiry(accessToken)
+	if err != nil {
+		c.log.Debug("Assuming default token lifetime", "lifetime", defaultTokenLifetime, "error", err)
+		return c.clock.Now().Add(defaultTokenLifetime)
+	}
+	return expiresAt
+}
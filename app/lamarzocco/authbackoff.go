@@ -0,0 +1,92 @@
+package lamarzocco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrAuthSuspended is returned without contacting the cloud while sign-ins
+// are held back after rejected credentials. It also matches ErrUnauthorized.
+var ErrAuthSuspended = errors.New("sign-in suspended after rejected credentials")
+
+// AuthBackoffPolicy spaces out sign-ins after the credentials were rejected,
+// so wrong credentials or a temporarily locked account do not cause a sign-in
+// with every poll and 401
+type AuthBackoffPolicy struct {
+	BaseDelay time.Duration // Wait after the first rejected sign-in, doubled after each one
+	MaxDelay  time.Duration // Longest wait, i.e. the lowest sign-in rate
+}
+
+var DefaultAuthBackoffPolicy = AuthBackoffPolicy{
+	BaseDelay: time.Minute,
+	MaxDelay:  time.Hour,
+}
+
+// WithAuthBackoffPolicy overrides DefaultAuthBackoffPolicy for the session.
+// Clients created WithSharedSession afterwards share the backoff.
+func WithAuthBackoffPolicy(policy AuthBackoffPolicy) Option {
+	return func(c *Client) {
+		if policy.MaxDelay <= 0 {
+			policy.MaxDelay = DefaultAuthBackoffPolicy.MaxDelay
+		}
+		c.session.authBackoff.policy = policy
+	}
+}
+
+type authBackoff struct {
+	policy      AuthBackoffPolicy
+	failures    int
+	nextAttempt time.Time
+	lastErr     error
+	mu          sync.Mutex
+}
+
+// SetAuthCallback is called with the error when sign-ins start to be rejected
+// and with nil once one succeeds again
+func (c *Client) SetAuthCallback(callback func(err error)) {
+	c.onAuth = callback
+}
+
+// allowSignIn returns ErrAuthSuspended until the backoff delay passed
+func (c *Client) allowSignIn() error {
+	b := &c.session.authBackoff
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures == 0 || !c.clock.Now().Before(b.nextAttempt) {
+		return nil
+	}
+	return fmt.Errorf("%w until %s (%d rejected): %w", ErrAuthSuspended, b.nextAttempt.Format(time.RFC3339), b.failures, b.lastErr)
+}
+
+// recordSignIn counts rejected sign-ins, other failures (e.g. timeouts) leave
+// the backoff unchanged
+func (c *Client) recordSignIn(ctx context.Context, err error) {
+	b := &c.session.authBackoff
+	b.mu.Lock()
+	var changed bool
+	switch {
+	case err == nil:
+		changed = b.failures > 0
+		b.failures = 0
+		b.lastErr = nil
+	case errors.Is(err, ErrUnauthorized) && ctx.Err() == nil:
+		changed = b.failures == 0
+		delay := b.policy.BaseDelay << b.failures
+		if delay > b.policy.MaxDelay || delay <= 0 {
+			delay = b.policy.MaxDelay
+		}
+		b.failures++
+		b.lastErr = err
+		b.nextAttempt = c.clock.Now().Add(delay)
+		c.log.Warn("Sign-in rejected, waiting before the next attempt", "failures", b.failures, "delay", delay, "error", err)
+	}
+	b.mu.Unlock()
+
+	if changed && c.onAuth != nil {
+		c.onAuth(err)
+	}
+}
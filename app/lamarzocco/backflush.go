@@ -0,0 +1,37 @@
+package lamarzocco
+
+import "time"
+
+// Back flush states reported by the CMBackFlush widget
+const (
+	BackFlushOff       = "Off"
+	BackFlushRequested = "Requested" // Waiting for the user to start the cycle on the machine
+	BackFlushCleaning  = "Cleaning"
+)
+
+type BackFlushInfo struct {
+	Status            string     `json:"status"` // Off, Requested or Cleaning
+	LastCleaningStart *time.Time `json:"lastCleaningStart,omitempty"`
+}
+
+// Active reports whether a back flush is requested or running
+func (b *BackFlushInfo) Active() bool {
+	return b != nil && (b.Status == BackFlushRequested || b.Status == BackFlushCleaning)
+}
+
+// backFlushOutput is the output of the CMBackFlush widget
+type backFlushOutput struct {
+	Status                string      `json:"status"`
+	LastCleaningStartTime interface{} `json:"lastCleaningStartTime"` // ms or RFC 3339
+}
+
+func parseBackFlush(output backFlushOutput) *BackFlushInfo {
+	info := &BackFlushInfo{Status: BackFlushOff}
+	if output.Status != "" {
+		info.Status = output.Status
+	}
+	if start, ok := parseTimestamp(output.LastCleaningStartTime); ok {
+		info.LastCleaningStart = &start
+	}
+	return info
+}
@@ -0,0 +1,127 @@
+package lamarzocco
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the cloud while it is
+// considered down
+var ErrCircuitOpen = errors.New("cloud unavailable, circuit open")
+
+// BreakerPolicy stops requests to the cloud after consecutive transient
+// failures. While open, single probe requests are let through with
+// increasing delays until one succeeds.
+type BreakerPolicy struct {
+	Failures  int           // Consecutive failures that open the circuit, 0 disables the breaker
+	BaseDelay time.Duration // First probe after opening, doubled after each failed probe
+	MaxDelay  time.Duration
+}
+
+var DefaultBreakerPolicy = BreakerPolicy{
+	Failures:  5,
+	BaseDelay: 30 * time.Second,
+	MaxDelay:  10 * time.Minute,
+}
+
+// WithBreakerPolicy overrides DefaultBreakerPolicy
+func WithBreakerPolicy(policy BreakerPolicy) Option {
+	return func(c *Client) {
+		if policy.MaxDelay <= 0 {
+			policy.MaxDelay = DefaultBreakerPolicy.MaxDelay
+		}
+		c.breaker.policy = policy
+	}
+}
+
+type breaker struct {
+	policy    BreakerPolicy
+	failures  int
+	open      bool
+	probes    int // Failed probes since the circuit opened
+	nextProbe time.Time
+	probing   bool
+	mu        sync.Mutex
+}
+
+// allow returns ErrCircuitOpen unless the circuit is closed or a probe is due
+func (b *breaker) allow(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return nil
+	}
+	if b.probing || now.Before(b.nextProbe) {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+// record counts the outcome of a request and reports whether the circuit
+// opened or closed because of it
+func (b *breaker) record(failed bool, now time.Time) (changed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.policy.Failures <= 0 {
+		return false
+	}
+	b.probing = false
+
+	if !failed {
+		b.failures = 0
+		b.probes = 0
+		if b.open {
+			b.open = false
+			return true
+		}
+		return false
+	}
+
+	b.failures++
+	if b.open {
+		b.probes++
+		b.nextProbe = now.Add(b.delay())
+		return false
+	}
+	if b.failures >= b.policy.Failures {
+		b.open = true
+		b.nextProbe = now.Add(b.delay())
+		return true
+	}
+	return false
+}
+
+// release lets the next request probe again after one that ended without a result
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) delay() time.Duration {
+	delay := b.policy.BaseDelay << b.probes
+	if delay > b.policy.MaxDelay || delay <= 0 {
+		delay = b.policy.MaxDelay
+	}
+	return delay
+}
+
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// CircuitOpen reports whether cloud requests are currently suspended
+func (c *Client) CircuitOpen() bool {
+	return c.breaker.isOpen()
+}
+
+// SetCircuitCallback is called when the circuit opens (true) or closes again
+func (c *Client) SetCircuitCallback(callback func(open bool)) {
+	c.onCircuit = callback
+}
@@ -0,0 +1,116 @@
+package lamarzocco
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrNotSupported = errors.New("not supported by this machine")
+
+// Capabilities lists optional machine features. Those shown by a dashboard
+// widget are detected from the dashboard, the others are assumed to be
+// available. WithCapabilities disables features regardless of the detection.
+type Capabilities struct {
+	BrewByWeight      bool `json:"brewByWeight"` // Dose modes and targets, requires a scale
+	BackFlush         bool `json:"backFlush"`
+	CoffeeTemperature bool `json:"coffeeTemperature"`
+	SteamControl      bool `json:"steamControl"`   // Steam boiler on/off and target level
+	PreExtraction     bool `json:"preExtraction"`  // Pre-brewing and pre-infusion
+	WakeUpSchedule    bool `json:"wakeUpSchedule"` // Weekly power on/off schedule stored on the machine
+	Statistics        bool `json:"statistics"`     // Coffee and flush counters
+	HotWaterDose      bool `json:"hotWaterDose"`   // Hot water (tea) dose duration
+	FullOff           bool `json:"fullOff"`        // Fully off in addition to standby
+	CupWarmer         bool `json:"cupWarmer"`
+	BaristaLights     bool `json:"baristaLights"`
+	ScaleSupport      bool `json:"scaleSupport"` // A brew-by-weight scale can be paired
+}
+
+func allCapabilities() Capabilities {
+	return Capabilities{
+		BrewByWeight:      true,
+		BackFlush:         true,
+		CoffeeTemperature: true,
+		SteamControl:      true,
+		PreExtraction:     true,
+		WakeUpSchedule:    true,
+		Statistics:        true,
+		HotWaterDose:      true,
+		FullOff:           true,
+		CupWarmer:         true,
+		BaristaLights:     true,
+		ScaleSupport:      true,
+	}
+}
+
+// widgetCapabilities are the features a dashboard widget shows the machine has
+var widgetCapabilities = map[string]func(*Capabilities){
+	"CMBrewByWeightDoses": func(c *Capabilities) { c.BrewByWeight, c.ScaleSupport = true, true },
+	"BrewByWeightDoses":   func(c *Capabilities) { c.BrewByWeight, c.ScaleSupport = true, true },
+	"ThingScale":          func(c *Capabilities) { c.ScaleSupport = true },
+	"CMCoffeeBoiler":      func(c *Capabilities) { c.CoffeeTemperature = true },
+	"CMSteamBoilerLevel":  func(c *Capabilities) { c.SteamControl = true },
+	"CMSteamBoiler":       func(c *Capabilities) { c.SteamControl = true },
+	"CMPreBrewing":        func(c *Capabilities) { c.PreExtraction = true },
+	"CMPreExtraction":     func(c *Capabilities) { c.PreExtraction = true },
+	"CMHotWaterDose":      func(c *Capabilities) { c.HotWaterDose = true },
+	"CMCupWarmer":         func(c *Capabilities) { c.CupWarmer = true },
+	"CMBaristaLights":     func(c *Capabilities) { c.BaristaLights = true },
+	"CMBackFlush":         func(c *Capabilities) { c.BackFlush = true },
+}
+
+// detectCapabilities derives the features from the widget codes of a
+// dashboard. Features without a widget stay available. ok is false for a
+// dashboard without the machine status, which is no complete machine dashboard.
+func detectCapabilities(codes []string) (detected Capabilities, ok bool) {
+	if !slices.Contains(codes, "CMMachineStatus") {
+		return Capabilities{}, false
+	}
+	detected = Capabilities{WakeUpSchedule: true, Statistics: true, FullOff: true}
+	for _, code := range codes {
+		if set, ok := widgetCapabilities[code]; ok {
+			set(&detected)
+		}
+	}
+	return detected, true
+}
+
+// and returns the features available in both
+func (c Capabilities) and(other Capabilities) Capabilities {
+	return Capabilities{
+		BrewByWeight:      c.BrewByWeight && other.BrewByWeight,
+		BackFlush:         c.BackFlush && other.BackFlush,
+		CoffeeTemperature: c.CoffeeTemperature && other.CoffeeTemperature,
+		SteamControl:      c.SteamControl && other.SteamControl,
+		PreExtraction:     c.PreExtraction && other.PreExtraction,
+		WakeUpSchedule:    c.WakeUpSchedule && other.WakeUpSchedule,
+		Statistics:        c.Statistics && other.Statistics,
+		HotWaterDose:      c.HotWaterDose && other.HotWaterDose,
+		FullOff:           c.FullOff && other.FullOff,
+		CupWarmer:         c.CupWarmer && other.CupWarmer,
+		BaristaLights:     c.BaristaLights && other.BaristaLights,
+		ScaleSupport:      c.ScaleSupport && other.ScaleSupport,
+	}
+}
+
+// Capabilities returns the features of the machine, see Capabilities
+func (c *Client) Capabilities() Capabilities {
+	c.modeLock.RLock()
+	defer c.modeLock.RUnlock()
+	return c.effectiveCapabilities()
+}
+
+// effectiveCapabilities requires modeLock
+func (c *Client) effectiveCapabilities() Capabilities {
+	if c.detected == nil {
+		return c.capabilities
+	}
+	return c.capabilities.and(*c.detected)
+}
+
+func requireCapability(supported bool, feature string) error {
+	if !supported {
+		return fmt.Errorf("%s: %w", feature, ErrNotSupported)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package lamarzocco
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDetectedCapabilitiesRejectCommands(t *testing.T) {
+	var commands atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/things":
+			w.Write([]byte(`[{"serialNumber":"MI012345","modelName":"LINEA MINI"}]`))
+		case "/things/MI012345/dashboard":
+			w.Write([]byte(`{"connected":true,"widgets":[
+				{"code":"CMMachineStatus","output":{"status":"PoweredOn"}},
+				{"code":"CMCoffeeBoiler","output":{"status":"Ready","targetTemperature":93}}
+			]}`))
+		default:
+			commands.Add(1)
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	c := New(
+		WithBaseURL(server.URL),
+		WithToken(TokenInfo{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour)}),
+		WithCapabilities(Capabilities{CoffeeTemperature: true, SteamControl: true, Statistics: true}),
+	)
+	defer c.Close()
+
+	ctx := context.Background()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	capabilities := c.GetStatus().Capabilities
+	if capabilities == nil {
+		t.Fatal("status has no capabilities")
+	}
+	want := Capabilities{CoffeeTemperature: true, Statistics: true}
+	if *capabilities != want {
+		t.Errorf("capabilities = %+v, want %+v", *capabilities, want)
+	}
+
+	if err := c.SetSteamLevel(ctx, SteamLevel2); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("SetSteamLevel() error = %v, want ErrNotSupported", err)
+	}
+	if err := c.SetMode(ctx, DoseModeDose1); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("SetMode() error = %v, want ErrNotSupported", err)
+	}
+	if n := commands.Load(); n != 0 {
+		t.Errorf("server received %d commands, want none", n)
+	}
+}
+
+func TestDetectCapabilitiesNeedsMachineStatus(t *testing.T) {
+	if _, ok := detectCapabilities([]string{"CMCoffeeBoiler"}); ok {
+		t.Error("detected capabilities from a dashboard without machine status")
+	}
+}
@@ -2,14 +2,18 @@ package lamarzocco
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"reflect"
 	"sync"
 	"time"
 
-	"github.com/philipparndt/go-logger"
+	"github.com/tidwall/gjson"
 )
 
 const (
@@ -18,47 +22,187 @@ const (
 
 type Client struct {
 	httpClient *http.Client
-	username   string
-	password   string
+	baseURL    string
+	stateStore StateStore
+	readOnly   bool // Only GET requests are sent, see WithReadOnly
 
+	redactSerial bool // Report a pseudonym instead of the serial, see WithRedactedSerial
+	redaction    redaction
+	log          Logger
+	clock        Clock
+	username     string
+	password     string
+	identity     Identity // Sent with every request to the cloud
+
+	// Background work started by commands, cancelled by Close
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	*session // Shared by the clients of an account, see WithSharedSession
+
+	serial string
+	model  string
+	things []Thing // All machines of the account
+
+	currentMode      DoseMode
+	dose1            *DoseInfo
+	dose2            *DoseInfo
+	machineOn        bool
+	power            PowerState
+	boilers          *BoilersInfo
+	scale            *ScaleInfo
+	preExtraction    *PreExtractionInfo
+	hotWater         *HotWaterInfo
+	accessories      *AccessoriesInfo
+	backFlush        *BackFlushInfo
+	waterLevel       WaterLevel
+	scaleWeight      *float64 // Last weight on the scale, nil if not reported
+	cloudConnected   bool
+	lastSeen         time.Time          // Last dashboard with the machine connected to the cloud
+	powerCommandTime time.Time          // Time of last power command (to ignore polling for 10s)
+	brewingSince     time.Time          // Start of the current brew, zero if not brewing
+	reportedAt       time.Time          // Timestamp of the last dashboard according to the cloud, zero if unknown
+	receivedAt       time.Time          // When the gateway received the last dashboard
+	calibration      map[string]float64 // Offset in grams added to dose targets before sending them to the machine
+	capabilities     Capabilities       // Configured, see WithCapabilities
+	detected         *Capabilities      // From the last complete dashboard, nil before
+	doseBounds       DoseBounds
+	retry            RetryPolicy
+	breaker          breaker
+	limiter          rateLimiter
+	polls            pollTimings
+	pollThreshold    int
+	pollFailures     int          // Consecutive failed polls
+	pollError        string       // Reason while past pollThreshold
+	commands         commandQueue // Commands run one at a time
+	doseDebounce     doseDebounce
+	dashboard        []byte // Last complete dashboard, stream updates are merged into it
+	modeLock         sync.RWMutex
+
+	stream     streamState
+	unknown    unknownStates
+	widgets    dashboardWidgets
+	transports transportState
+	cloudUp    UpTracker
+	machineUp  UpTracker
+	streamUp   UpTracker
+
+	onStatusChange func(MachineStatus)
+	onBrew         func(BrewEvent)
+	onScaleWeight  func(ScaleReading)
+	onDiscrepancy  func([]Discrepancy)
+	onSchedule     func(MachineSchedule)
+	onUnknownState func(UnknownState)
+	onCommand      func(command string)
+	onCircuit      func(open bool)
+	onAuth         func(err error)
+	onDegraded     func(reason string)
+}
+
+// session is the sign-in of an account: the registered installation and its token
+type session struct {
 	installKey *InstallationKey
 	keyLock    sync.RWMutex
 
 	token     *TokenInfo
 	tokenLock sync.RWMutex
 
-	serial string
-	model  string
-
-	currentMode       DoseMode
-	dose1             *DoseInfo
-	dose2             *DoseInfo
-	machineOn         bool
-	boilers           *BoilersInfo
-	scale             *ScaleInfo
-	powerCommandTime  time.Time // Time of last power command (to ignore polling for 10s)
-	modeLock          sync.RWMutex
+	polls *rateLimiter // Budget of the status polls, nil for unlimited
 
-	onStatusChange func(MachineStatus)
+	authBackoff authBackoff  // Sign-ins are held back for all clients of the account
+	signIns     signInFlight // One sign-in or token refresh at a time
 }
 
-func NewClient(username, password string) *Client {
-	return &Client{
+// New creates a client, at least WithCredentials is required to connect
+func New(opts ...Option) *Client {
+	c := &Client{
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		username:    username,
-		password:    password,
-		currentMode: DoseModeContinuous,
-	}
+		baseURL:      BaseURL,
+		session:      &session{authBackoff: authBackoff{policy: DefaultAuthBackoffPolicy}},
+		log:          nopLogger{},
+		clock:        systemClock{},
+		capabilities: allCapabilities(),
+		doseBounds:   DefaultDoseBounds,
+		retry:        DefaultRetryPolicy,
+		breaker:      breaker{policy: DefaultBreakerPolicy},
+		limiter:      rateLimiter{policy: DefaultRateLimitPolicy},
+		currentMode:  DoseModeContinuous,
+		stream:       streamState{changed: make(chan struct{}, 1)},
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.pollThreshold = DefaultPollFailureThreshold
+	c.transports.list = defaultTransports(c)
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.redactSerial {
+		c.log = redactingLogger{log: c.log, client: c}
+		c.setRedactedSerials(c.serial)
+	}
+	return c
+}
+
+// NewClient creates a client for the given account.
+//
+// Deprecated: Use New with WithCredentials.
+func NewClient(username, password string, opts ...Option) *Client {
+	return New(append([]Option{WithCredentials(username, password)}, opts...)...)
+}
+
+// Close cancels the background work started by commands, e.g. the status
+// refreshes after a power change and debounced doses that were not sent yet
+func (c *Client) Close() {
+	c.cancel()
 }
 
 func (c *Client) SetStatusChangeCallback(callback func(MachineStatus)) {
 	c.onStatusChange = callback
 }
 
+// SetCalibration configures per-dose offsets (e.g. -1.5 if Dose1 consistently
+// lands 1.5g above its target). Doses are exposed with their nominal weight,
+// the machine is configured with the calibrated one.
+func (c *Client) SetCalibration(dose1Offset, dose2Offset float64) {
+	c.modeLock.Lock()
+	defer c.modeLock.Unlock()
+	c.calibration = map[string]float64{
+		"Dose1": dose1Offset,
+		"Dose2": dose2Offset,
+	}
+}
+
+// calibratedDose converts a dose reported by the machine into its nominal value
+func (c *Client) calibratedDose(doseId string, dose *DoseInfo) *DoseInfo {
+	offset := c.calibration[doseId]
+	if dose == nil || offset == 0 {
+		return dose
+	}
+	return &DoseInfo{
+		Weight:        RoundTenth(dose.Weight - offset),
+		MachineWeight: dose.Weight,
+	}
+}
+
+// SetCommandCallback registers a callback invoked after each successful machine command
+func (c *Client) SetCommandCallback(callback func(command string)) {
+	c.onCommand = callback
+}
+
+func (c *Client) notifyCommand(command string) {
+	if c.onCommand != nil {
+		c.onCommand(command)
+	}
+}
+
+// SetBrewCallback registers a callback invoked after each observed shot
+func (c *Client) SetBrewCallback(callback func(BrewEvent)) {
+	c.onBrew = callback
+}
+
 // registerClient performs the initial registration with /auth/init
-func (c *Client) registerClient() error {
+func (c *Client) registerClient(ctx context.Context) error {
 	// Generate new installation key
 	installKey, err := GenerateInstallationKey()
 	if err != nil {
@@ -71,7 +215,7 @@ func (c *Client) registerClient() error {
 		return fmt.Errorf("failed to get public key: %w", err)
 	}
 
-	url := BaseURL + "/auth/init"
+	url := c.baseURL + "/auth/init"
 
 	payload := map[string]string{
 		"pk": pubKeyB64,
@@ -82,11 +226,12 @@ func (c *Client) registerClient() error {
 		return fmt.Errorf("failed to marshal init payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create init request: %w", err)
 	}
 
+	c.identify(req.Header)
 	req.Header.Set("Content-Type", "application/json")
 
 	// Generate request proof
@@ -98,31 +243,37 @@ func (c *Client) registerClient() error {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("init request failed: %w", err)
+		return fmt.Errorf("init request failed: %w", transient(err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("init failed with status %d: %s", resp.StatusCode, string(body))
+		return &StatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("init failed with status %d: %s", resp.StatusCode, string(body))}
 	}
 
 	c.keyLock.Lock()
 	c.installKey = installKey
 	c.keyLock.Unlock()
 
-	logger.Info("Client registered successfully", "installation_id", installKey.InstallationID)
+	c.log.Info("Client registered successfully", "installation_id", installKey.InstallationID)
 	return nil
 }
 
-func (c *Client) authenticate() error {
+// authenticate signs in, held back by the auth backoff after rejected credentials
+func (c *Client) authenticate(ctx context.Context) (err error) {
+	if err := c.allowSignIn(); err != nil {
+		return err
+	}
+	defer func() { c.recordSignIn(ctx, err) }()
+
 	// Ensure we have an installation key
 	c.keyLock.RLock()
 	installKey := c.installKey
 	c.keyLock.RUnlock()
 
 	if installKey == nil {
-		if err := c.registerClient(); err != nil {
+		if err := c.registerClient(ctx); err != nil {
 			return err
 		}
 		c.keyLock.RLock()
@@ -130,7 +281,7 @@ func (c *Client) authenticate() error {
 		c.keyLock.RUnlock()
 	}
 
-	url := BaseURL + "/auth/signin"
+	url := c.baseURL + "/auth/signin"
 
 	payload := map[string]string{
 		"username": c.username,
@@ -142,11 +293,12 @@ func (c *Client) authenticate() error {
 		return fmt.Errorf("failed to marshal auth payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create auth request: %w", err)
 	}
 
+	c.identify(req.Header)
 	req.Header.Set("Content-Type", "application/json")
 
 	// Add authentication headers (only the extra headers for signin)
@@ -160,13 +312,13 @@ func (c *Client) authenticate() error {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("auth request failed: %w", err)
+		return fmt.Errorf("auth request failed: %w", transient(err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("auth failed with status %d: %s", resp.StatusCode, string(body))
+		return &StatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("auth failed with status %d: %s", resp.StatusCode, string(body))}
 	}
 
 	var authResp AuthResponse
@@ -174,8 +326,7 @@ func (c *Client) authenticate() error {
 		return fmt.Errorf("failed to decode auth response: %w", err)
 	}
 
-	// Token expires in 1 hour based on JWT exp claim
-	expiresAt := time.Now().Add(1 * time.Hour)
+	expiresAt := c.tokenExpiresAt(authResp.AccessToken)
 	c.tokenLock.Lock()
 	c.token = &TokenInfo{
 		AccessToken:  authResp.AccessToken,
@@ -184,11 +335,12 @@ func (c *Client) authenticate() error {
 	}
 	c.tokenLock.Unlock()
 
-	logger.Info("Successfully authenticated with La Marzocco API", "expires_at", expiresAt)
+	c.log.Info("Successfully authenticated with La Marzocco API", "expires_at", expiresAt)
+	c.persistCredentials()
 	return nil
 }
 
-func (c *Client) refreshToken() error {
+func (c *Client) refreshToken(ctx context.Context) error {
 	c.tokenLock.RLock()
 	refreshToken := ""
 	if c.token != nil {
@@ -197,7 +349,7 @@ func (c *Client) refreshToken() error {
 	c.tokenLock.RUnlock()
 
 	if refreshToken == "" {
-		return c.authenticate()
+		return c.authenticate(ctx)
 	}
 
 	c.keyLock.RLock()
@@ -205,10 +357,10 @@ func (c *Client) refreshToken() error {
 	c.keyLock.RUnlock()
 
 	if installKey == nil {
-		return c.authenticate()
+		return c.authenticate(ctx)
 	}
 
-	url := BaseURL + "/auth/refreshtoken"
+	url := c.baseURL + "/auth/refreshtoken"
 
 	payload := map[string]string{
 		"username":      c.username,
@@ -220,11 +372,12 @@ func (c *Client) refreshToken() error {
 		return fmt.Errorf("failed to marshal refresh payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create refresh request: %w", err)
 	}
 
+	c.identify(req.Header)
 	req.Header.Set("Content-Type", "application/json")
 
 	// Add authentication headers (only the extra headers for refresh)
@@ -238,13 +391,13 @@ func (c *Client) refreshToken() error {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("refresh request failed: %w", err)
+		return fmt.Errorf("refresh request failed: %w", transient(err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		logger.Warn("Token refresh failed, re-authenticating")
-		return c.authenticate()
+		c.log.Warn("Token refresh failed, re-authenticating")
+		return c.authenticate(ctx)
 	}
 
 	var authResp AuthResponse
@@ -252,8 +405,7 @@ func (c *Client) refreshToken() error {
 		return fmt.Errorf("failed to decode refresh response: %w", err)
 	}
 
-	// Token expires in 1 hour based on JWT exp claim
-	expiresAt := time.Now().Add(1 * time.Hour)
+	expiresAt := c.tokenExpiresAt(authResp.AccessToken)
 	c.tokenLock.Lock()
 	c.token = &TokenInfo{
 		AccessToken:  authResp.AccessToken,
@@ -262,34 +414,44 @@ func (c *Client) refreshToken() error {
 	}
 	c.tokenLock.Unlock()
 
-	logger.Debug("Token refreshed successfully", "expires_at", expiresAt)
+	c.log.Debug("Token refreshed successfully", "expires_at", expiresAt)
+	c.persistCredentials()
 	return nil
 }
 
-func (c *Client) ensureValidToken() error {
-	c.tokenLock.RLock()
-	token := c.token
-	c.tokenLock.RUnlock()
-
-	if token == nil {
-		return c.authenticate()
+func (c *Client) ensureValidToken(ctx context.Context) error {
+	if token := c.currentToken(); token != nil && !c.tokenExpiring(token) {
+		return nil
 	}
 
-	// Refresh 5 minutes before expiry
-	if time.Now().Add(5 * time.Minute).After(token.ExpiresAt) {
-		logger.Debug("Token expiring soon, refreshing", "expires_at", token.ExpiresAt)
-		return c.refreshToken()
-	}
+	return c.shareSignIn(ctx, func(ctx context.Context) error {
+		// Another client of the session may have renewed it in the meantime
+		token := c.currentToken()
+		if token == nil {
+			return c.authenticate(ctx)
+		}
+		if c.tokenExpiring(token) {
+			c.log.Debug("Token expiring soon, refreshing", "expires_at", token.ExpiresAt)
+			return c.refreshToken(ctx)
+		}
+		return nil
+	})
+}
 
-	return nil
+func (c *Client) currentToken() *TokenInfo {
+	c.tokenLock.RLock()
+	defer c.tokenLock.RUnlock()
+	return c.token
 }
 
-func (c *Client) doAuthenticatedRequest(method, url string, body interface{}) (*http.Response, error) {
-	return c.doAuthenticatedRequestWithRetry(method, url, body, true)
+// tokenExpiring reports whether the token is due for a refresh, 5 minutes
+// before expiry
+func (c *Client) tokenExpiring(token *TokenInfo) bool {
+	return c.clock.Now().Add(5 * time.Minute).After(token.ExpiresAt)
 }
 
-func (c *Client) doAuthenticatedRequestWithRetry(method, url string, body interface{}, allowRetry bool) (*http.Response, error) {
-	if err := c.ensureValidToken(); err != nil {
+func (c *Client) doAuthenticatedRequestWithRetry(ctx context.Context, method, url string, body interface{}, allowRetry bool) (*http.Response, error) {
+	if err := c.ensureValidToken(ctx); err != nil {
 		return nil, err
 	}
 
@@ -304,7 +466,7 @@ func (c *Client) doAuthenticatedRequestWithRetry(method, url string, body interf
 		reqBody = bytes.NewBuffer(bodyBytes)
 	}
 
-	req, err := http.NewRequest(method, url, reqBody)
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -313,6 +475,7 @@ func (c *Client) doAuthenticatedRequestWithRetry(method, url string, body interf
 	accessToken := c.token.AccessToken
 	c.tokenLock.RUnlock()
 
+	c.identify(req.Header)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
@@ -338,115 +501,287 @@ func (c *Client) doAuthenticatedRequestWithRetry(method, url string, body interf
 	// Handle 401 by re-authenticating and retrying once
 	if resp.StatusCode == http.StatusUnauthorized && allowRetry {
 		resp.Body.Close()
-		logger.Info("Received 401, re-authenticating")
-		if err := c.authenticate(); err != nil {
+		c.log.Info("Received 401, re-authenticating")
+		err := c.shareSignIn(ctx, func(ctx context.Context) error {
+			if token := c.currentToken(); token != nil && token.AccessToken != accessToken {
+				return nil // Already replaced by another client of the session
+			}
+			return c.authenticate(ctx)
+		})
+		if err != nil {
 			return nil, fmt.Errorf("re-authentication failed: %w", err)
 		}
-		return c.doAuthenticatedRequestWithRetry(method, url, body, false)
+		return c.doAuthenticatedRequestWithRetry(ctx, method, url, body, false)
 	}
 
 	return resp, nil
 }
 
-func (c *Client) Connect() error {
-	if err := c.authenticate(); err != nil {
-		return err
+// persistCredentials saves the credentials, failures only cost a new sign-in on the next start
+func (c *Client) persistCredentials() {
+	if err := c.saveCredentials(); err != nil {
+		c.log.Warn("Failed to save credentials", "error", err)
 	}
+}
 
-	// Fetch machine info
-	if err := c.fetchMachineInfo(); err != nil {
+// Connect signs in, selects the machine and fetches its state
+func (c *Client) Connect(ctx context.Context) error {
+	if err := c.Discover(ctx); err != nil {
 		return err
 	}
 
 	// Get initial status
-	if err := c.fetchCurrentMode(); err != nil {
+	return c.fetchCurrentMode(ctx)
+}
+
+// Discover signs in and selects the machine without fetching its state, so
+// the serial is known before the first status change is reported
+func (c *Client) Discover(ctx context.Context) error {
+	c.keyLock.RLock()
+	preloaded := c.installKey != nil
+	c.keyLock.RUnlock()
+
+	if !preloaded {
+		if err := c.loadCredentials(); err != nil {
+			c.log.Warn("Ignoring stored credentials", "error", err)
+		}
+	}
+
+	// Reuses a stored token, an expired or revoked one is replaced on the first request
+	if err := c.ensureValidToken(ctx); err != nil {
 		return err
 	}
 
-	return nil
+	return c.fetchMachineInfo(ctx)
 }
 
-func (c *Client) fetchMachineInfo() error {
-	url := BaseURL + "/things"
+// fetchThings returns the machines of the account, an account without
+// machines is an error
+func (c *Client) fetchThings(ctx context.Context) ([]Thing, error) {
+	url := c.baseURL + "/things"
 
-	resp, err := c.doAuthenticatedRequest("GET", url, nil)
+	resp, err := c.doAuthenticatedRequest(ctx, "GET", url, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to fetch things: %d - %s", resp.StatusCode, string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("failed to fetch things: %d - %s", resp.StatusCode, string(body))}
 	}
 
 	// API returns an array directly, not wrapped in an object
 	var things []Thing
 	if err := json.NewDecoder(resp.Body).Decode(&things); err != nil {
-		return fmt.Errorf("failed to decode things response: %w", err)
+		return nil, fmt.Errorf("failed to decode things response: %w", err)
 	}
 
 	if len(things) == 0 {
-		return fmt.Errorf("no machines found in account")
+		return nil, fmt.Errorf("no machines found in account")
+	}
+	return things, nil
+}
+
+func (c *Client) fetchMachineInfo(ctx context.Context) error {
+	things, err := c.fetchThings(ctx)
+	if err != nil {
+		return err
 	}
 
-	c.serial = things[0].SerialNumber
-	c.model = things[0].ModelName
+	// The first machine unless one was selected with WithSerial
+	thing := things[0]
+	if serial := c.machineSerial(); serial != "" {
+		found := false
+		for _, t := range things {
+			if t.SerialNumber == serial {
+				thing, found = t, true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("machine %s not found in account", c.DeviceID(serial))
+		}
+	}
 
-	logger.Info("Found machine", "serial", c.serial, "model", c.model)
+	serials := []string{}
+	for _, t := range things {
+		serials = append(serials, t.SerialNumber)
+	}
+	c.setRedactedSerials(serials...)
+
+	c.modeLock.Lock()
+	c.things = things
+	c.serial = thing.SerialNumber
+	c.model = thing.ModelName
+	c.modeLock.Unlock()
+
+	c.log.Info("Found machine", "serial", thing.SerialNumber, "model", thing.ModelName, "machines", len(things))
 	return nil
 }
 
-func (c *Client) fetchCurrentMode() error {
-	url := fmt.Sprintf("%s/things/%s/dashboard", BaseURL, c.serial)
+// machineSerial is the serial number of the served machine, Resync may
+// change it while requests are running
+func (c *Client) machineSerial() string {
+	c.modeLock.RLock()
+	defer c.modeLock.RUnlock()
+	return c.serial
+}
+
+// hasToken reports whether the client signed in
+func (c *Client) hasToken() bool {
+	c.tokenLock.RLock()
+	defer c.tokenLock.RUnlock()
+	return c.token != nil
+}
 
-	resp, err := c.doAuthenticatedRequest("GET", url, nil)
+// Things returns all machines of the account, known after Connect
+func (c *Client) Things() []Thing {
+	c.modeLock.RLock()
+	defer c.modeLock.RUnlock()
+	return append([]Thing(nil), c.things...)
+}
+
+// RefreshThings re-fetches the machines of the account, e.g. to notice one
+// that was added or removed after Connect. The served machine stays the same,
+// even if it is no longer in the account. Removed serials stay redacted.
+func (c *Client) RefreshThings(ctx context.Context) ([]Thing, error) {
+	things, err := c.fetchThings(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to fetch dashboard: %d - %s", resp.StatusCode, string(body))
+	c.modeLock.Lock()
+	serials := []string{}
+	for _, t := range append(c.things, things...) {
+		serials = append(serials, t.SerialNumber)
 	}
+	c.things = things
+	c.modeLock.Unlock()
 
-	body, err := io.ReadAll(resp.Body)
+	c.setRedactedSerials(serials...)
+	return append([]Thing(nil), things...), nil
+}
+
+func (c *Client) fetchCurrentMode(ctx context.Context) error {
+	body, err := c.fetchDashboard(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to read dashboard response: %w", err)
+		return err
 	}
 
-	logger.Debug("Dashboard response", "body", string(body))
+	c.modeLock.Lock()
+	c.dashboard = body
+	c.modeLock.Unlock()
+
+	c.applyDashboard(body)
+	return nil
+}
 
+func (c *Client) fetchDashboard(ctx context.Context) ([]byte, error) {
+	var body []byte
+	err := c.viaTransport(ctx, func(t Transport) error {
+		var err error
+		body, err = t.Dashboard(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.log.Debug("Dashboard response", "body", string(body))
+	return body, nil
+}
+
+// applyDashboard updates the machine state from a dashboard and notifies about changes
+func (c *Client) applyDashboard(body []byte) {
 	// Extract mode and dose info from dashboard
 	data := c.extractDataFromDashboard(body)
 
+	// Debounced dose targets stay as set until they were sent
+	for doseId, weight := range c.pendingDoses() {
+		if doseId == "Dose1" {
+			data.dose1 = &DoseInfo{Weight: weight}
+		} else {
+			data.dose2 = &DoseInfo{Weight: weight}
+		}
+	}
+
 	c.modeLock.Lock()
 	oldMode := c.currentMode
 	oldDose1 := c.dose1
 	oldDose2 := c.dose2
 	oldMachineOn := c.machineOn
+	oldPower := c.power
 	oldBoilers := c.boilers
 	oldScale := c.scale
+	oldPreExtraction := c.preExtraction
+	oldHotWater := c.hotWater
+	oldAccessories := c.accessories
+	oldBackFlush := c.backFlush
+	oldWaterLevel := c.waterLevel
+	oldCloudConnected := c.cloudConnected
+	oldScaleWeight := c.scaleWeight
+	oldBrewingSince := c.brewingSince
+	oldCapabilities := c.effectiveCapabilities()
 
 	// Check if we should ignore machineOn from API (within 10s of power command)
-	ignoreMachineOn := time.Since(c.powerCommandTime) < 10*time.Second
+	ignoreMachineOn := c.clock.Now().Sub(c.powerCommandTime) < 10*time.Second
 
 	c.currentMode = data.mode
 	c.dose1 = data.dose1
 	c.dose2 = data.dose2
 	if !ignoreMachineOn {
 		c.machineOn = data.machineOn
+		c.power = data.power
 	} else {
 		// Keep the optimistic value, but use it for change detection
 		data.machineOn = c.machineOn
+		data.power = c.power
 	}
 	c.boilers = data.boilers
 	c.scale = data.scale
+	c.preExtraction = data.preExtraction
+	c.hotWater = data.hotWater
+	c.accessories = data.accessories
+	c.backFlush = data.backFlush
+	c.waterLevel = data.waterLevel
+	c.scaleWeight = data.scaleWeight
+	c.cloudConnected = data.connected
+	if data.connected {
+		c.lastSeen = c.clock.Now()
+	}
+	c.brewingSince = data.brewingSince
+	c.reportedAt = data.reportedAt
+	c.receivedAt = c.clock.Now()
+	receivedAt := c.receivedAt
+	if detected, ok := detectCapabilities(data.codes); ok {
+		c.detected = &detected
+	}
+	capabilities := c.effectiveCapabilities()
 	c.modeLock.Unlock()
 
+	if capabilities != oldCapabilities {
+		c.log.Info("Machine capabilities detected", "capabilities", capabilities)
+	}
+
+	c.machineUp.Set(data.connected, c.clock.Now())
+
+	if len(data.unknown) > 0 {
+		c.recordUnknownStates(data.unknown)
+	}
+	c.recordWidgets(data.codes, data.raw)
+
+	// A brew ended, or a new one started before we observed the end of the previous one
+	if !oldBrewingSince.IsZero() && !oldBrewingSince.Equal(data.brewingSince) {
+		c.notifyBrew(oldBrewingSince, data)
+	}
+
+	if weight := data.scaleWeight; weight != nil && (oldScaleWeight == nil || *oldScaleWeight != *weight) {
+		c.notifyScaleWeight(*weight, data.brewingSince)
+	}
+
 	// Check if anything changed
-	changed := oldMode != data.mode || oldMachineOn != data.machineOn
+	changed := capabilities != oldCapabilities || oldCloudConnected != data.connected || oldWaterLevel != data.waterLevel || oldMode != data.mode || oldMachineOn != data.machineOn || oldPower != data.power || oldBrewingSince.IsZero() != data.brewingSince.IsZero()
 	if !changed && data.dose1 != nil && (oldDose1 == nil || oldDose1.Weight != data.dose1.Weight) {
 		changed = true
 	}
@@ -460,192 +795,179 @@ func (c *Client) fetchCurrentMode() error {
 			if data.boilers.Coffee != nil && (oldBoilers.Coffee == nil || oldBoilers.Coffee.Ready != data.boilers.Coffee.Ready) {
 				changed = true
 			}
-			if data.boilers.Steam != nil && (oldBoilers.Steam == nil || oldBoilers.Steam.Ready != data.boilers.Steam.Ready) {
+			if data.boilers.Steam != nil && (oldBoilers.Steam == nil || oldBoilers.Steam.Ready != data.boilers.Steam.Ready ||
+				oldBoilers.Steam.Level != data.boilers.Steam.Level || boolValue(oldBoilers.Steam.Enabled) != boolValue(data.boilers.Steam.Enabled)) {
 				changed = true
 			}
 		}
 	}
-	if !changed && data.scale != nil && (oldScale == nil || oldScale.Connected != data.scale.Connected || oldScale.BatteryLevel != data.scale.BatteryLevel) {
+	if !changed && data.scale != nil && (oldScale == nil || *oldScale != *data.scale) {
+		changed = true
+	}
+
+	if !changed && preExtractionChanged(oldPreExtraction, data.preExtraction) {
+		changed = true
+	}
+	if !changed && data.hotWater != nil && (oldHotWater == nil || !reflect.DeepEqual(*oldHotWater, *data.hotWater)) {
+		changed = true
+	}
+	if !changed && accessoriesChanged(oldAccessories, data.accessories) {
+		changed = true
+	}
+	if !changed && data.backFlush != nil && (oldBackFlush == nil || oldBackFlush.Status != data.backFlush.Status) {
 		changed = true
 	}
 
 	if changed {
-		c.notifyStatusChange()
+		c.notifyStatus(receivedAt)
 	}
 
-	logger.Debug("Current mode", "mode", data.mode, "dose1", data.dose1, "dose2", data.dose2, "machineOn", data.machineOn, "boilers", data.boilers, "scale", data.scale)
-	return nil
+	c.log.Debug("Current mode", "mode", data.mode, "dose1", data.dose1, "dose2", data.dose2, "machineOn", data.machineOn, "boilers", data.boilers, "scale", data.scale)
 }
 
 type dashboardData struct {
-	mode      DoseMode
-	dose1     *DoseInfo
-	dose2     *DoseInfo
-	machineOn bool
-	boilers   *BoilersInfo
-	scale     *ScaleInfo
+	mode          DoseMode
+	dose1         *DoseInfo
+	dose2         *DoseInfo
+	machineOn     bool
+	connected     bool       // The machine is connected to the cloud
+	power         PowerState // Empty if the dashboard has no machine status
+	brewingSince  time.Time
+	boilers       *BoilersInfo
+	scale         *ScaleInfo
+	scaleWeight   *float64 // Grams on the scale, if the scale widget reports it
+	preExtraction *PreExtractionInfo
+	hotWater      *HotWaterInfo
+	accessories   *AccessoriesInfo
+	backFlush     *BackFlushInfo
+	waterLevel    WaterLevel // Empty if the machine reports no reservoir
+	reportedAt    time.Time
+	unknown       []UnknownState // Status strings not in the known sets
+	codes         []string       // Codes of all widgets
+	raw           []RawWidget    // Widgets that could not be read
 }
 
-func (c *Client) extractDataFromDashboard(body []byte) dashboardData {
-	result := dashboardData{mode: DoseModeContinuous}
-
-	// Parse JSON to find the mode and dose info
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return result
+func (c *Client) notifyBrew(startedAt time.Time, data dashboardData) {
+	if c.onBrew == nil {
+		return
 	}
 
-	// Check top-level connected field
-	if connected, ok := data["connected"].(bool); ok && connected {
-		result.machineOn = true
+	endedAt := c.clock.Now()
+	if !data.brewingSince.IsZero() {
+		endedAt = data.brewingSince
 	}
 
-	// Try to find mode, doses, and machine status in widgets
-	if widgets, ok := data["widgets"].([]interface{}); ok {
-		for _, w := range widgets {
-			widget, ok := w.(map[string]interface{})
-			if !ok {
-				continue
-			}
+	event := BrewEvent{
+		StartedAt:  startedAt,
+		EndedAt:    endedAt,
+		Duration:   endedAt.Sub(startedAt).Seconds(),
+		Mode:       data.mode,
+		ReportedAt: optionalTime(data.reportedAt),
+		ReceivedAt: c.clock.Now(),
+	}
+	switch data.mode {
+	case DoseModeDose1:
+		if dose := c.calibratedDose("Dose1", data.dose1); dose != nil {
+			event.TargetWeight = dose.Weight
+		}
+	case DoseModeDose2:
+		if dose := c.calibratedDose("Dose2", data.dose2); dose != nil {
+			event.TargetWeight = dose.Weight
+		}
+	}
 
-			// Widget uses "code" field, not "type"
-			widgetCode, _ := widget["code"].(string)
+	c.log.Info("Brew finished", "started_at", event.StartedAt, "duration", event.Duration, "mode", event.Mode)
+	c.onBrew(event)
+}
 
-			// Extract machine power status from CMMachineStatus widget
-			if widgetCode == "CMMachineStatus" {
-				if output, ok := widget["output"].(map[string]interface{}); ok {
-					if status, ok := output["status"].(string); ok {
-						result.machineOn = status == "PoweredOn"
-					}
-				}
-			}
+// extractDataFromDashboard reads the dashboard with the parser registered for
+// each widget code, see widgetParsers
+func (c *Client) extractDataFromDashboard(body []byte) dashboardData {
+	result := dashboardData{mode: DoseModeContinuous}
 
-			// Extract brew by weight mode and doses
-			if widgetCode == "CMBrewByWeightDoses" || widgetCode == "BrewByWeightDoses" {
-				if output, ok := widget["output"].(map[string]interface{}); ok {
-					// Extract mode
-					if mode, ok := output["mode"].(string); ok {
-						result.mode = ParseDoseMode(mode)
-					}
-
-					// Extract doses object (e.g., {"Dose1": {"dose": 15.00}, "Dose2": {"dose": 34.00}})
-					if doses, ok := output["doses"].(map[string]interface{}); ok {
-						if dose1Data, ok := doses["Dose1"].(map[string]interface{}); ok {
-							if weight, ok := dose1Data["dose"].(float64); ok && weight > 0 {
-								result.dose1 = &DoseInfo{Weight: weight}
-							}
-						}
-						if dose2Data, ok := doses["Dose2"].(map[string]interface{}); ok {
-							if weight, ok := dose2Data["dose"].(float64); ok && weight > 0 {
-								result.dose2 = &DoseInfo{Weight: weight}
-							}
-						}
-					}
-				}
-			}
+	dashboard, widgets, err := decodeWidgets(body)
+	if err != nil {
+		return result
+	}
 
-			// Extract coffee boiler status from CMCoffeeBoiler widget
-			if widgetCode == "CMCoffeeBoiler" {
-				if output, ok := widget["output"].(map[string]interface{}); ok {
-					boiler := &BoilerInfo{}
-					// Check status string (Ready, HeatingUp, etc.)
-					if status, ok := output["status"].(string); ok {
-						boiler.Ready = status == "Ready"
-					}
-					// Get target temperature
-					if temp, ok := output["targetTemperature"].(float64); ok {
-						boiler.Temperature = temp
-					}
-					// Calculate remaining seconds from readyStartTime (future timestamp in ms)
-					if readyTime, ok := output["readyStartTime"].(float64); ok && readyTime > 0 {
-						now := float64(time.Now().UnixMilli())
-						if readyTime > now {
-							boiler.RemainingSeconds = int((readyTime - now) / 1000)
-							logger.Debug("Coffee boiler heating", "readyStartTime", readyTime, "now", now, "remainingSeconds", boiler.RemainingSeconds)
-						}
-					}
-					if result.boilers == nil {
-						result.boilers = &BoilersInfo{}
-					}
-					result.boilers.Coffee = boiler
-				}
-			}
+	// The machine is connected to the cloud, even in standby. Whether it is on
+	// comes from the machine status widget only.
+	result.connected = dashboard.Get("connected").Type == gjson.True
 
-			// Extract steam boiler status from CMSteamBoilerLevel widget
-			if widgetCode == "CMSteamBoilerLevel" || widgetCode == "CMSteamBoiler" {
-				if output, ok := widget["output"].(map[string]interface{}); ok {
-					boiler := &BoilerInfo{}
-					// Check status string (Ready, HeatingUp, etc.)
-					if status, ok := output["status"].(string); ok {
-						boiler.Ready = status == "Ready"
-					}
-					// Check if enabled
-					if enabled, ok := output["enabled"].(bool); ok && !enabled {
-						boiler.Ready = false
-					}
-					// Get target level (Level1, Level2, etc.)
-					if level, ok := output["targetLevel"].(string); ok {
-						boiler.Level = level
-					}
-					// Calculate remaining seconds from readyStartTime (future timestamp in ms)
-					if readyTime, ok := output["readyStartTime"].(float64); ok && readyTime > 0 {
-						now := float64(time.Now().UnixMilli())
-						if readyTime > now {
-							boiler.RemainingSeconds = int((readyTime - now) / 1000)
-							logger.Debug("Steam boiler heating", "readyStartTime", readyTime, "now", now, "remainingSeconds", boiler.RemainingSeconds)
-						}
-					}
-					if result.boilers == nil {
-						result.boilers = &BoilersInfo{}
-					}
-					result.boilers.Steam = boiler
-				}
-			}
+	// Time the cloud produced the payload, if it carries one
+	for _, key := range []string{"timestamp", "updatedAt"} {
+		if reportedAt, ok := parseTimestamp(dashboard.Get(key).Value()); ok {
+			result.reportedAt = reportedAt
+			break
+		}
+	}
 
-			// Extract scale info from ThingScale widget
-			if widgetCode == "ThingScale" {
-				if output, ok := widget["output"].(map[string]interface{}); ok {
-					scale := &ScaleInfo{}
-					// Check connected status
-					if connected, ok := output["connected"].(bool); ok {
-						scale.Connected = connected
-					}
-					// Get battery level
-					if battery, ok := output["batteryLevel"].(float64); ok {
-						scale.BatteryLevel = int(battery)
-					}
-					result.scale = scale
-				}
-			}
+	for _, w := range widgets {
+		result.codes = append(result.codes, w.Code)
+		if raw := c.parseWidget(w, &result); raw != nil {
+			result.raw = append(result.raw, *raw)
 		}
 	}
 
 	// Try direct mode field as fallback
 	if result.mode == DoseModeContinuous {
-		if mode, ok := data["mode"].(string); ok {
-			result.mode = ParseDoseMode(mode)
+		if mode := dashboard.Get("mode"); mode.Type == gjson.String {
+			result.mode = ParseDoseMode(mode.Str)
 		}
 	}
 
 	return result
 }
 
-func (c *Client) SetMode(mode DoseMode) error {
-	url := fmt.Sprintf("%s/things/%s/command/CoffeeMachineBrewByWeightChangeMode", BaseURL, c.serial)
+// parseTimestamp accepts milliseconds since the epoch or RFC 3339 strings
+func parseTimestamp(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case float64:
+		if v > 0 && v < math.MaxInt64 {
+			return time.UnixMilli(int64(v)), true
+		}
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
 
-	payload := SetModeRequest{
-		Mode: string(mode),
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// remainingSeconds converts a ready timestamp (ms) into seconds from now,
+// bogus timestamps far in the future are capped instead of overflowing
+func (c *Client) remainingSeconds(readyTime float64) int {
+	remaining := (readyTime - float64(c.clock.Now().UnixMilli())) / 1000
+	if remaining <= 0 {
+		return 0
+	}
+	return int(math.Min(remaining, math.MaxInt32))
+}
+
+func (c *Client) SetMode(ctx context.Context, mode DoseMode) error {
+	if err := requireCapability(c.Capabilities().BrewByWeight, "brew by weight"); err != nil {
+		return err
 	}
 
-	resp, err := c.doAuthenticatedRequest("POST", url, payload)
+	done, err := c.enqueue(ctx)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	defer done()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to set mode: %d - %s", resp.StatusCode, string(body))
+	payload := SetModeRequest{
+		Mode: string(mode),
+	}
+
+	if err := c.postCommand(ctx, "CoffeeMachineBrewByWeightChangeMode", payload); err != nil {
+		return fmt.Errorf("failed to set mode: %w", err)
 	}
 
 	c.modeLock.Lock()
@@ -654,13 +976,29 @@ func (c *Client) SetMode(mode DoseMode) error {
 
 	c.notifyStatusChange()
 
-	logger.Info("Mode set successfully", "mode", mode)
+	c.log.Info("Mode set successfully", "mode", mode)
 	return nil
 }
 
-func (c *Client) SetDose(doseId string, weight float64) error {
-	// Use CoffeeMachineBrewByWeightSettingDoses command (from pylamarzocco)
-	url := fmt.Sprintf("%s/things/%s/command/CoffeeMachineBrewByWeightSettingDoses", BaseURL, c.serial)
+func (c *Client) SetDose(ctx context.Context, doseId string, weight float64) error {
+	if err := requireCapability(c.Capabilities().BrewByWeight, "brew by weight"); err != nil {
+		return err
+	}
+
+	requested := weight
+	weight, err := c.doseBounds.Normalize(weight)
+	if err != nil {
+		return err
+	}
+	if weight != RoundTenth(requested) {
+		c.log.Warn("Dose clamped to bounds", "doseId", doseId, "requested", requested, "weight", weight)
+	}
+
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
 
 	// Get current dose values
 	c.modeLock.RLock()
@@ -672,10 +1010,15 @@ func (c *Client) SetDose(doseId string, weight float64) error {
 	if c.dose2 != nil {
 		dose2Val = c.dose2.Weight
 	}
+	offset := c.calibration[doseId]
 	c.modeLock.RUnlock()
 
-	// Update the target dose, rounded to 1 decimal
-	roundedWeight := float64(int(weight*10)) / 10
+	// Update the target dose with the calibration offset, rounded to 1 decimal
+	roundedWeight := RoundTenth(weight + offset)
+	if c.doseDebounce.quiet > 0 {
+		c.debounceDose(doseId, roundedWeight)
+		return nil
+	}
 	if doseId == "Dose1" {
 		dose1Val = roundedWeight
 	} else if doseId == "Dose2" {
@@ -690,143 +1033,386 @@ func (c *Client) SetDose(doseId string, weight float64) error {
 		},
 	}
 
-	resp, err := c.doAuthenticatedRequest("POST", url, payload)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to set dose: %d - %s", resp.StatusCode, string(body))
+	// Use CoffeeMachineBrewByWeightSettingDoses command (from pylamarzocco)
+	if err := c.postCommand(ctx, "CoffeeMachineBrewByWeightSettingDoses", payload); err != nil {
+		return fmt.Errorf("failed to set dose: %w", err)
 	}
 
 	// Update local state
 	c.modeLock.Lock()
-	if doseId == "Dose1" {
-		c.dose1 = &DoseInfo{Weight: roundedWeight}
-	} else if doseId == "Dose2" {
-		c.dose2 = &DoseInfo{Weight: roundedWeight}
-	}
+	c.setDoseInfo(doseId, roundedWeight)
 	c.modeLock.Unlock()
 
 	c.notifyStatusChange()
 
-	logger.Info("Dose set successfully", "doseId", doseId, "weight", weight)
+	c.log.Info("Dose set successfully", "doseId", doseId, "weight", weight, "machineWeight", roundedWeight)
 	return nil
 }
 
-func (c *Client) SetPower(on bool) error {
-	url := fmt.Sprintf("%s/things/%s/command/CoffeeMachineChangeMode", BaseURL, c.serial)
+// setDoseInfo stores a machine dose target, modeLock must be held
+func (c *Client) setDoseInfo(doseId string, machineWeight float64) {
+	if doseId == "Dose1" {
+		c.dose1 = &DoseInfo{Weight: machineWeight}
+	} else if doseId == "Dose2" {
+		c.dose2 = &DoseInfo{Weight: machineWeight}
+	}
+}
+
+func (c *Client) StartBackFlush(ctx context.Context) error {
+	if err := requireCapability(c.Capabilities().BackFlush, "back flush"); err != nil {
+		return err
+	}
 
-	mode := "StandBy"
-	if on {
-		mode = "BrewingMode"
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return err
 	}
+	defer done()
 
+	// Use CoffeeMachineBackFlushStartCleaning command (from pylamarzocco)
+	// Payload format: {"enabled": true}
 	payload := map[string]interface{}{
-		"mode": mode,
+		"enabled": true,
+	}
+
+	if err := c.postCommand(ctx, "CoffeeMachineBackFlushStartCleaning", payload); err != nil {
+		return fmt.Errorf("failed to start back flush: %w", err)
+	}
+
+	c.log.Info("Back flush started successfully")
+	return nil
+}
+
+// postCommand sends a machine command over the first available transport,
+// delayed by the rate limit. Failures while the machine is known to be
+// disconnected are ErrMachineOffline.
+func (c *Client) postCommand(ctx context.Context, command string, payload interface{}) error {
+	if err := c.waitForCommand(ctx, command); err != nil {
+		return err
 	}
 
-	resp, err := c.doAuthenticatedRequest("POST", url, payload)
+	err := c.viaTransport(ctx, func(t Transport) error {
+		return t.Command(ctx, command, payload)
+	})
 	if err != nil {
+		if machine := c.machineUp.State(); !machine.Up && !machine.LastTransition.IsZero() {
+			return fmt.Errorf("%w: %w", ErrMachineOffline, err)
+		}
 		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to set power: %d - %s", resp.StatusCode, string(body))
+	c.notifyCommand(command)
+	return nil
+}
+
+func (c *Client) SetCoffeeTemperature(ctx context.Context, temperature float64) error {
+	if err := requireCapability(c.Capabilities().CoffeeTemperature, "coffee temperature"); err != nil {
+		return err
+	}
+
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	temperature = RoundTenth(temperature)
+	payload := map[string]interface{}{
+		"boilerIndex":       1,
+		"targetTemperature": temperature,
+	}
+
+	if err := c.postCommand(ctx, "CoffeeMachineSettingCoffeeBoilerTargetTemperature", payload); err != nil {
+		return err
 	}
 
-	// Update local state optimistically and set power command time
 	c.modeLock.Lock()
-	c.machineOn = on
-	c.powerCommandTime = time.Now()
+	if c.boilers == nil {
+		c.boilers = &BoilersInfo{}
+	}
+	if c.boilers.Coffee == nil {
+		c.boilers.Coffee = &BoilerInfo{}
+	}
+	coffee := *c.boilers.Coffee
+	coffee.Temperature = temperature
+	c.boilers = &BoilersInfo{Coffee: &coffee, Steam: c.boilers.Steam}
 	c.modeLock.Unlock()
+
 	c.notifyStatusChange()
 
-	logger.Info("Power set successfully", "on", on)
+	c.log.Info("Coffee temperature set successfully", "temperature", temperature)
+	return nil
+}
+
+// SetSteamBoiler switches the steam boiler on or off, the coffee boiler keeps heating
+func (c *Client) SetSteamBoiler(ctx context.Context, enabled bool) error {
+	if err := requireCapability(c.Capabilities().SteamControl, "steam control"); err != nil {
+		return err
+	}
 
-	// Refresh status from dashboard multiple times to catch the actual state
-	go func() {
-		delays := []time.Duration{2 * time.Second, 5 * time.Second, 10 * time.Second}
-		for _, delay := range delays {
-			time.Sleep(delay)
-			if err := c.fetchCurrentMode(); err != nil {
-				logger.Error("Failed to refresh status after power change", "error", err)
-			}
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	payload := map[string]interface{}{
+		"boilerIndex": 1,
+		"enabled":     enabled,
+	}
+
+	if err := c.postCommand(ctx, "CoffeeMachineSettingSteamBoilerEnabled", payload); err != nil {
+		return err
+	}
+
+	c.updateSteamBoiler(func(steam *BoilerInfo) {
+		steam.Enabled = &enabled
+		if !enabled {
+			steam.Ready = false
 		}
-	}()
+	})
 
+	c.log.Info("Steam boiler set successfully", "enabled", enabled)
 	return nil
 }
 
-func (c *Client) StartBackFlush() error {
-	// Use CoffeeMachineBackFlushStartCleaning command (from pylamarzocco)
-	url := fmt.Sprintf("%s/things/%s/command/CoffeeMachineBackFlushStartCleaning", BaseURL, c.serial)
-
-	// Payload format: {"enabled": true}
-	payload := map[string]interface{}{
-		"enabled": true,
+// SetSteamLevel sets the steam boiler target level (Level1 to Level3)
+func (c *Client) SetSteamLevel(ctx context.Context, level SteamLevel) error {
+	if err := requireCapability(c.Capabilities().SteamControl, "steam control"); err != nil {
+		return err
+	}
+	if !level.Valid() {
+		return fmt.Errorf("invalid steam level %q, must be Level1, Level2 or Level3", level)
 	}
 
-	resp, err := c.doAuthenticatedRequest("POST", url, payload)
+	done, err := c.enqueue(ctx)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	defer done()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to start back flush: %d - %s", resp.StatusCode, string(body))
+	payload := map[string]interface{}{
+		"boilerIndex": 1,
+		"targetLevel": string(level),
+	}
+
+	if err := c.postCommand(ctx, "CoffeeMachineSettingSteamBoilerTargetLevel", payload); err != nil {
+		return err
 	}
 
-	logger.Info("Back flush started successfully")
+	c.updateSteamBoiler(func(steam *BoilerInfo) {
+		steam.Level = string(level)
+	})
+
+	c.log.Info("Steam level set successfully", "level", level)
 	return nil
 }
 
+// updateSteamBoiler applies an optimistic change to a copy of the steam boiler state
+func (c *Client) updateSteamBoiler(fn func(*BoilerInfo)) {
+	c.modeLock.Lock()
+	boilers := BoilersInfo{}
+	if c.boilers != nil {
+		boilers = *c.boilers
+	}
+	steam := BoilerInfo{}
+	if boilers.Steam != nil {
+		steam = *boilers.Steam
+	}
+	fn(&steam)
+	boilers.Steam = &steam
+	c.boilers = &boilers
+	c.modeLock.Unlock()
+
+	c.notifyStatusChange()
+}
+
+func boolValue(b *bool) bool {
+	return b != nil && *b
+}
+
 func (c *Client) GetStatus() MachineStatus {
 	c.modeLock.RLock()
 	mode := c.currentMode
-	dose1 := c.dose1
-	dose2 := c.dose2
+	dose1 := c.calibratedDose("Dose1", c.dose1)
+	dose2 := c.calibratedDose("Dose2", c.dose2)
 	machineOn := c.machineOn
+	power := c.power
 	boilers := c.boilers
 	scale := c.scale
+	preExtraction := c.preExtraction
+	hotWater := c.hotWater
+	accessories := c.accessories
+	backFlush := c.backFlush
+	waterLevel := c.waterLevel
+	cloudConnected := c.cloudConnected
+	lastSeen := optionalTime(c.lastSeen)
+	brewing := !c.brewingSince.IsZero()
+	brewingSince := optionalTime(c.brewingSince)
+	reportedAt := optionalTime(c.reportedAt)
+	receivedAt := optionalTime(c.receivedAt)
+	pollError := c.pollError
+	serial := c.serial
+	model := c.model
+	capabilities := c.effectiveCapabilities()
 	c.modeLock.RUnlock()
 
-	return MachineStatus{
-		Mode:      mode,
-		Connected: c.token != nil,
-		Serial:    c.serial,
-		Model:     c.model,
-		Dose1:     dose1,
-		Dose2:     dose2,
-		MachineOn: machineOn,
-		Boilers:   boilers,
-		Scale:     scale,
+	status := MachineStatus{
+		Mode:           mode,
+		Connected:      c.hasToken() && pollError == "",
+		PollError:      pollError,
+		Serial:         c.DeviceID(serial),
+		Model:          model,
+		Dose1:          dose1,
+		Dose2:          dose2,
+		MachineOn:      machineOn,
+		CloudConnected: cloudConnected,
+		LastSeen:       lastSeen,
+		Power:          power,
+		Transport:      c.ActiveTransport(),
+		Brewing:        brewing,
+		BrewingSince:   brewingSince,
+		Boilers:        boilers,
+		Scale:          scale,
+		ReportedAt:     reportedAt,
+		ReceivedAt:     receivedAt,
+
+		PreExtraction: preExtraction,
+		HotWater:      hotWater,
+		Accessories:   accessories,
+		BackFlush:     backFlush,
+		Capabilities:  &capabilities,
+	}
+	if waterLevel != "" {
+		low := waterLevel == WaterLevelLow
+		status.WaterTankLow = &low
+		status.WaterLevel = waterLevel
+	}
+	return status
+}
+
+// CheckAuth verifies the credentials, refreshing or requesting a token if needed
+func (c *Client) CheckAuth(ctx context.Context) error {
+	return c.ensureValidToken(ctx)
+}
+
+// ServerTime returns the time of the API server from the Date header
+func (c *Client) ServerTime(ctx context.Context) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", c.baseURL, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp.Body.Close()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("no usable Date header: %w", err)
 	}
+	return date, nil
+}
+
+// Refresh fetches the dashboard now instead of waiting for the next poll
+func (c *Client) Refresh(ctx context.Context) error {
+	return c.fetchCurrentMode(ctx)
+}
+
+// Resync drops the cached machine state and fetches it again. The status
+// change callback is invoked even if nothing changed.
+func (c *Client) Resync(ctx context.Context) error {
+	if err := c.fetchMachineInfo(ctx); err != nil {
+		return err
+	}
+
+	c.modeLock.Lock()
+	c.dashboard = nil
+	c.powerCommandTime = time.Time{}
+	c.modeLock.Unlock()
+
+	if err := c.fetchCurrentMode(ctx); err != nil {
+		return err
+	}
+
+	c.notifyStatusChange()
+	return nil
 }
 
 func (c *Client) notifyStatusChange() {
+	c.notifyStatus(time.Time{})
+}
+
+// notifyStatus reports a status change caused by the dashboard received at
+// receivedAt, zero for changes made by the gateway itself
+func (c *Client) notifyStatus(receivedAt time.Time) {
 	if c.onStatusChange != nil {
-		c.onStatusChange(c.GetStatus())
+		status := c.GetStatus()
+		status.UpdateReceivedAt = receivedAt
+		c.onStatusChange(status)
 	}
 }
 
-func (c *Client) StartPolling(interval time.Duration, stopCh <-chan struct{}) {
+// StartPolling fetches the dashboard every interval, and every
+// BrewPollInterval during a brew with a connected scale. While the stream is
+// connected only a sanity check runs every SanityCheckInterval. A dropped
+// stream is polled immediately, a (re)connected one is reconciled to catch
+// up on updates missed in between. Polling stops when ctx is done.
+func (c *Client) StartPolling(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	brewTicker := time.NewTicker(BrewPollInterval)
+	defer brewTicker.Stop()
 
+	lastPoll := c.clock.Now()
 	for {
 		select {
 		case <-ticker.C:
-			if err := c.fetchCurrentMode(); err != nil {
-				logger.Error("Failed to poll status", "error", err)
+			if !c.StreamConnected() {
+				c.pollResult("Failed to poll status", c.timedPoll(ctx, c.fetchCurrentMode))
+				lastPoll = c.clock.Now()
+				continue
 			}
-		case <-stopCh:
+
+			if c.clock.Now().Sub(lastPoll) < SanityCheckInterval {
+				continue
+			}
+			c.pollResult("Failed to run sanity check", c.timedPoll(ctx, c.reconcile))
+			lastPoll = c.clock.Now()
+		case <-brewTicker.C:
+			// The stream delivers the weight by itself
+			if c.StreamConnected() || !c.liveWeightWanted() {
+				continue
+			}
+			c.pollResult("Failed to poll status", c.timedPoll(ctx, c.fetchCurrentMode))
+			lastPoll = c.clock.Now()
+		case <-c.stream.changed:
+			poll := c.fetchCurrentMode
+			if c.StreamConnected() {
+				poll = c.reconcile
+			}
+			c.pollResult("Failed to poll status", c.timedPoll(ctx, poll))
+			lastPoll = c.clock.Now()
+		case <-ctx.Done():
 			return
 		}
 	}
 }
+
+// pollResult counts a poll for the degraded state and logs failures, quietly
+// while the circuit breaker is open
+func (c *Client) pollResult(msg string, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	c.recordPoll(err)
+	if err == nil {
+		return
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrAuthSuspended) {
+		c.log.Debug(msg, "error", err)
+		return
+	}
+	c.log.Error(msg, "error", err)
+}
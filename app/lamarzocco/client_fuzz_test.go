@@ -0,0 +1,43 @@
+package lamarzocco
+
+import (
+	"testing"
+	"time"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func FuzzExtractDataFromDashboard(f *testing.F) {
+	f.Add([]byte(`{"connected":true,"widgets":[{"code":"CMMachineStatus","output":{"status":"PoweredOn","brewingStartTime":null}}]}`))
+	f.Add([]byte(`{"widgets":[{"code":"CMBrewByWeightDoses","output":{"mode":"Dose1","doses":{"Dose1":{"dose":36.5},"Dose2":{"dose":40}}}}]}`))
+	f.Add([]byte(`{"widgets":[{"code":"CMCoffeeBoiler","output":{"status":"HeatingUp","targetTemperature":93.5,"readyStartTime":1760000060000}}]}`))
+	f.Add([]byte(`{"widgets":[{"code":"CMHotWaterDose","output":{"enabled":true,"doses":[{"doseIndex":"DoseA","dose":8}]}}]}`))
+	f.Add([]byte(`{"widgets":[{"code":"CMPreBrewing","output":{"mode":"PreInfusion","doseIndexSupported":true,"times":{"PreInfusion":[{"doseIndex":"DoseA","seconds":{"In":0,"Out":4}}]}}}]}`))
+	f.Add([]byte(`{"widgets":[{"code":"CMSteamBoilerLevel","output":{"status":"Ready","enabled":false,"targetLevel":"Level2","readyStartTime":1e300}}]}`))
+	f.Add([]byte(`{"widgets":[{"code":"ThingScale","output":{"connected":true,"batteryLevel":87}}]}`))
+	f.Add([]byte(`{"widgets":[null,1,"x",{"code":5,"output":[]}],"mode":"Dose2"}`))
+
+	client := New(WithClock(fixedClock(time.UnixMilli(1760000000000))))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		data := client.extractDataFromDashboard(body)
+
+		switch data.mode {
+		case DoseModeDose1, DoseModeDose2, DoseModeContinuous:
+		default:
+			t.Fatalf("unexpected mode %q", data.mode)
+		}
+
+		if data.boilers != nil {
+			for _, boiler := range []*BoilerInfo{data.boilers.Coffee, data.boilers.Steam} {
+				if boiler != nil && boiler.RemainingSeconds < 0 {
+					t.Fatalf("negative remaining seconds %d", boiler.RemainingSeconds)
+				}
+			}
+		}
+	})
+}
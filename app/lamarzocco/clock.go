@@ -0,0 +1,14 @@
+package lamarzocco
+
+import "time"
+
+// Clock provides the current time
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
@@ -3,14 +3,99 @@ package lamarzocco
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 )
 
 type Command struct {
-	Mode      string   `json:"mode,omitempty"`
-	Dose1     *float64 `json:"dose1,omitempty"`     // Weight in grams for Dose1
-	Dose2     *float64 `json:"dose2,omitempty"`     // Weight in grams for Dose2
-	BackFlush *bool    `json:"backflush,omitempty"` // Start back flush cycle
-	Power     *bool    `json:"power,omitempty"`     // Turn machine on (true) or standby (false)
+	Mode       string     `json:"mode,omitempty"`
+	Dose1      *float64   `json:"dose1,omitempty"`       // Weight in grams for Dose1
+	Dose2      *float64   `json:"dose2,omitempty"`       // Weight in grams for Dose2
+	BackFlush  *bool      `json:"backflush,omitempty"`   // Start back flush cycle
+	Power      PowerState `json:"power,omitempty"`       // on (true), standby (false) or off
+	Steam      *bool      `json:"steam,omitempty"`       // Turn the steam boiler on or off
+	SteamLevel SteamLevel `json:"steam_level,omitempty"` // Steam boiler target level: 1-3 or Level1-Level3
+	Profile    string     `json:"profile,omitempty"`     // Apply a stored profile by name
+
+	PreExtraction *PreExtractionCommand `json:"pre_extraction,omitempty"` // Pre-brewing / pre-infusion settings
+	HotWater      *HotWaterDose         `json:"hot_water,omitempty"`      // Hot water dose duration
+	CupWarmer     *bool                 `json:"cupwarmer,omitempty"`      // Turn the cup warmer on or off
+	BaristaLights *bool                 `json:"baristalights,omitempty"`  // Turn the barista lights on or off
+	Scale         *ScaleCommand         `json:"scale,omitempty"`          // Pair, unpair or rename the scale
+
+	Ratio   *float64 `json:"ratio,omitempty"`    // Target brew ratio, dose targets are derived from it
+	In      string   `json:"in,omitempty"`       // Defer execution by a duration (e.g. "45m")
+	ReadyBy string   `json:"ready_by,omitempty"` // Power on early enough to be warm at "HH:MM"
+	Cancel  string   `json:"cancel,omitempty"`   // Cancel a pending command by ID, or "all"
+	// Wait until the machine is on and the coffee boiler ready
+	WhenReady bool `json:"when_ready,omitempty"`
+
+	Requester string `json:"requester,omitempty"` // Who sent the command, reported in lastCommand
+}
+
+// PreExtractionCommand changes the mode and/or the times of the active mode
+type PreExtractionCommand struct {
+	Mode string   `json:"mode,omitempty"` // PreBrewing, PreInfusion or Disabled
+	Dose string   `json:"dose,omitempty"` // Dose1 or Dose2 for per-dose times, empty for all doses
+	In   *float64 `json:"in,omitempty"`   // Seconds the pump runs (default: 0)
+	Out  *float64 `json:"out,omitempty"`  // Seconds of pause or soaking, required to set times
+}
+
+func (p *PreExtractionCommand) HasTimes() bool {
+	return p.Out != nil
+}
+
+func (p *PreExtractionCommand) GetIn() float64 {
+	if p.In != nil {
+		return *p.In
+	}
+	return 0
+}
+
+func (p *PreExtractionCommand) GetOut() float64 {
+	if p.Out != nil {
+		return *p.Out
+	}
+	return 0
+}
+
+// Validate checks the values without contacting the machine
+func (p *PreExtractionCommand) Validate() error {
+	if p.Mode == "" && p.Out == nil {
+		return fmt.Errorf("pre_extraction requires mode or out")
+	}
+	if p.Mode != "" && !PreExtractionMode(p.Mode).Valid() {
+		return fmt.Errorf("invalid pre_extraction mode %q, must be PreBrewing, PreInfusion or Disabled", p.Mode)
+	}
+	if p.In != nil && p.Out == nil {
+		return fmt.Errorf("pre_extraction in requires out")
+	}
+	if p.Dose != "" && p.Out == nil {
+		return fmt.Errorf("pre_extraction dose requires out")
+	}
+	if _, err := preExtractionDoseIndex(p.Dose); err != nil {
+		return err
+	}
+	if in, out := p.GetIn(), p.GetOut(); in < 0 || in > maxPreExtractionSeconds || out < 0 || out > maxPreExtractionSeconds {
+		return fmt.Errorf("pre_extraction times must be between 0 and %.0f seconds", maxPreExtractionSeconds)
+	}
+	return nil
+}
+
+// UnmarshalJSON accepts steamLevel as well, like the status and the web API
+func (c *Command) UnmarshalJSON(data []byte) error {
+	type plain Command
+	aux := struct {
+		*plain
+		SteamLevel SteamLevel `json:"steamLevel"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if c.SteamLevel == "" {
+		c.SteamLevel = aux.SteamLevel
+	}
+	return nil
 }
 
 func ParseCommand(payload []byte) (*Command, error) {
@@ -19,14 +104,105 @@ func ParseCommand(payload []byte) (*Command, error) {
 		return nil, fmt.Errorf("failed to parse command: %w", err)
 	}
 
+	if cmd.Cancel != "" {
+		return &cmd, nil
+	}
+
 	// At least one field must be set
-	if cmd.Mode == "" && cmd.Dose1 == nil && cmd.Dose2 == nil && cmd.BackFlush == nil && cmd.Power == nil {
-		return nil, fmt.Errorf("mode, dose1, dose2, backflush, or power is required")
+	if cmd.Mode == "" && cmd.Dose1 == nil && cmd.Dose2 == nil && cmd.BackFlush == nil && cmd.Power == "" &&
+		cmd.Steam == nil && cmd.SteamLevel == "" && cmd.PreExtraction == nil && cmd.HotWater == nil && cmd.CupWarmer == nil && cmd.BaristaLights == nil &&
+		cmd.Scale == nil && cmd.Profile == "" && cmd.Ratio == nil {
+		return nil, fmt.Errorf("mode, dose1, dose2, backflush, power, steam, steam_level, pre_extraction, hot_water, cupwarmer, baristalights, scale, profile, ratio, or cancel is required")
+	}
+
+	for _, dose := range []*float64{cmd.Dose1, cmd.Dose2} {
+		if dose != nil {
+			if err := CheckDose(*dose); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cmd.SteamLevel != "" && !cmd.SteamLevel.Valid() {
+		return nil, fmt.Errorf("invalid steam_level %q, must be 1-3 or Level1-Level3", cmd.SteamLevel)
+	}
+
+	if cmd.PreExtraction != nil {
+		if err := cmd.PreExtraction.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if cmd.HotWater != nil {
+		if err := cmd.HotWater.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if cmd.Scale != nil {
+		if err := cmd.Scale.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if cmd.Ratio != nil && *cmd.Ratio < 0 {
+		return nil, fmt.Errorf("ratio must not be negative")
+	}
+
+	if cmd.ReadyBy != "" {
+		if !cmd.Power.On() {
+			return nil, fmt.Errorf("ready_by requires power on")
+		}
+		if cmd.In != "" {
+			return nil, fmt.Errorf("ready_by and in cannot be combined")
+		}
+		if _, err := time.Parse("15:04", cmd.ReadyBy); err != nil {
+			return nil, fmt.Errorf("invalid ready_by %q, expected HH:MM", cmd.ReadyBy)
+		}
+	}
+
+	if cmd.WhenReady && cmd.Power != "" && !cmd.Power.On() {
+		return nil, fmt.Errorf("when_ready can only be combined with power on")
+	}
+
+	if cmd.In != "" {
+		delay, err := time.ParseDuration(cmd.In)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delay %q: %w", cmd.In, err)
+		}
+		if delay <= 0 {
+			return nil, fmt.Errorf("delay must be positive, got %q", cmd.In)
+		}
 	}
 
 	return &cmd, nil
 }
 
+// Kinds lists the settings the command changes, e.g. "dose1,mode"
+func (c *Command) Kinds() string {
+	var kinds []string
+	add := func(set bool, kind string) {
+		if set {
+			kinds = append(kinds, kind)
+		}
+	}
+	add(c.Profile != "", "profile")
+	add(c.Ratio != nil, "ratio")
+	add(c.Dose1 != nil, "dose1")
+	add(c.Dose2 != nil, "dose2")
+	add(c.Mode != "", "mode")
+	add(c.BackFlush != nil, "backflush")
+	add(c.Power != "", "power")
+	add(c.Steam != nil, "steam")
+	add(c.SteamLevel != "", "steam_level")
+	add(c.PreExtraction != nil, "pre_extraction")
+	add(c.HotWater != nil, "hot_water")
+	add(c.CupWarmer != nil, "cupwarmer")
+	add(c.BaristaLights != nil, "baristalights")
+	add(c.Scale != nil, "scale")
+	return strings.Join(kinds, ",")
+}
+
 func (c *Command) GetDoseMode() DoseMode {
 	return ParseDoseMode(c.Mode)
 }
@@ -62,12 +238,94 @@ func (c *Command) HasBackFlush() bool {
 }
 
 func (c *Command) HasPower() bool {
-	return c.Power != nil
+	return c.Power != ""
 }
 
+// GetPower reports whether the command turns the machine on
 func (c *Command) GetPower() bool {
-	if c.Power != nil {
-		return *c.Power
+	return c.Power.On()
+}
+
+func (c *Command) HasSteam() bool {
+	return c.Steam != nil
+}
+
+func (c *Command) GetSteam() bool {
+	return c.Steam != nil && *c.Steam
+}
+
+func (c *Command) HasSteamLevel() bool {
+	return c.SteamLevel != ""
+}
+
+func (c *Command) HasScale() bool {
+	return c.Scale != nil
+}
+
+func (c *Command) HasCupWarmer() bool {
+	return c.CupWarmer != nil
+}
+
+func (c *Command) HasBaristaLights() bool {
+	return c.BaristaLights != nil
+}
+
+func (c *Command) HasPreExtraction() bool {
+	return c.PreExtraction != nil
+}
+
+func (c *Command) HasHotWater() bool {
+	return c.HotWater != nil
+}
+
+func (c *Command) HasProfile() bool {
+	return c.Profile != ""
+}
+
+func (c *Command) HasRatio() bool {
+	return c.Ratio != nil
+}
+
+func (c *Command) GetRatio() float64 {
+	if c.Ratio != nil {
+		return *c.Ratio
 	}
-	return false
+	return 0
+}
+
+func (c *Command) HasDelay() bool {
+	return c.In != ""
+}
+
+// GetDelay returns the parsed execution delay, or 0 if none is set
+func (c *Command) GetDelay() time.Duration {
+	delay, err := time.ParseDuration(c.In)
+	if err != nil {
+		return 0
+	}
+	return delay
+}
+
+func (c *Command) HasReadyBy() bool {
+	return c.ReadyBy != ""
+}
+
+// GetReadyBy returns the next occurrence of the ready_by time after now, in
+// the location of now
+func (c *Command) GetReadyBy(now time.Time) time.Time {
+	clock, err := time.Parse("15:04", c.ReadyBy)
+	if err != nil {
+		return now
+	}
+
+	y, m, d := now.Date()
+	readyAt := time.Date(y, m, d, clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !readyAt.After(now) {
+		readyAt = readyAt.AddDate(0, 0, 1)
+	}
+	return readyAt
+}
+
+func (c *Command) HasCancel() bool {
+	return c.Cancel != ""
 }
@@ -0,0 +1,53 @@
+package lamarzocco
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func FuzzParseCommand(f *testing.F) {
+	f.Add([]byte(`{"mode":"Dose1"}`))
+	f.Add([]byte(`{"dose1":18.5,"dose2":36}`))
+	f.Add([]byte(`{"power":true,"in":"10m"}`))
+	f.Add([]byte(`{"power":"off"}`))
+	f.Add([]byte(`{"ratio":2.1,"profile":"espresso"}`))
+	f.Add([]byte(`{"cancel":"all"}`))
+	f.Add([]byte(`{"steam":false,"steam_level":"Level2"}`))
+	f.Add([]byte(`{"backflush":true,"in":"-1s"}`))
+	f.Add([]byte(`{"steam_level":3}`))
+	f.Add([]byte(`{"steamLevel":null,"steam":true}`))
+	f.Add([]byte(`{"hot_water":{"dose":"Dose2","seconds":12}}`))
+	f.Add([]byte(`{"pre_extraction":{"mode":"PreBrewing","dose":"Dose1","in":0.5,"out":1.5}}`))
+	f.Add([]byte(`{"mode":null}`))
+	f.Add([]byte(`[]`))
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		cmd, err := ParseCommand(payload)
+		if err != nil {
+			if cmd != nil {
+				t.Fatalf("command returned together with error %v", err)
+			}
+			return
+		}
+
+		if cmd.HasDelay() && cmd.GetDelay() <= 0 {
+			t.Fatalf("accepted non-positive delay %q", cmd.In)
+		}
+		if cmd.HasRatio() && cmd.GetRatio() < 0 {
+			t.Fatalf("accepted negative ratio %v", cmd.GetRatio())
+		}
+		cmd.GetDoseMode()
+		cmd.GetDose1()
+		cmd.GetDose2()
+		cmd.GetPower()
+
+		// A parsed command must survive being stored and parsed again (scheduler, state file)
+		data, err := json.Marshal(cmd)
+		if err != nil {
+			t.Fatalf("failed to marshal parsed command: %v", err)
+		}
+		if _, err := ParseCommand(data); err != nil {
+			t.Fatalf("failed to parse marshaled command %s: %v", data, err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package lamarzocco
+
+import "testing"
+
+func TestParseCommandSteamLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    SteamLevel
+		wantErr bool
+	}{
+		{"number", `{"steam_level":2}`, SteamLevel2, false},
+		{"name", `{"steam_level":"Level3"}`, SteamLevel3, false},
+		{"camel case", `{"steamLevel":1}`, SteamLevel1, false},
+		{"snake case wins", `{"steam_level":2,"steamLevel":3}`, SteamLevel2, false},
+		{"null is ignored", `{"steam":true,"steam_level":null}`, "", false},
+		{"null camel case is ignored", `{"steam":true,"steamLevel":null}`, "", false},
+		{"only null", `{"steam_level":null}`, "", true},
+		{"out of range", `{"steamLevel":4}`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := ParseCommand([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCommand(%s) error = %v, wantErr %v", tt.payload, err, tt.wantErr)
+			}
+			if err == nil && cmd.SteamLevel != tt.want {
+				t.Errorf("SteamLevel = %q, want %q", cmd.SteamLevel, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCommandScale(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr bool
+	}{
+		{"pair", `{"scale":{"pair":"aa:bb:cc:dd:ee:ff","name":"Kitchen"}}`, false},
+		{"unpair", `{"scale":{"unpair":true}}`, false},
+		{"rename", `{"scale":{"name":"Kitchen"}}`, false},
+		{"empty", `{"scale":{}}`, true},
+		{"invalid address", `{"scale":{"pair":"kitchen"}}`, true},
+		{"pair and unpair", `{"scale":{"pair":"aa:bb:cc:dd:ee:ff","unpair":true}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := ParseCommand([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCommand(%s) error = %v, wantErr %v", tt.payload, err, tt.wantErr)
+			}
+			if err == nil && cmd.Kinds() != "scale" {
+				t.Errorf("Kinds() = %q, want scale", cmd.Kinds())
+			}
+		})
+	}
+}
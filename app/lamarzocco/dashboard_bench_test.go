@@ -0,0 +1,33 @@
+package lamarzocco
+
+import (
+	"testing"
+	"time"
+)
+
+// benchmarkDashboard is shaped like the dashboard of a GS3 with a scale
+var benchmarkDashboard = []byte(`{"serialNumber":"GS012345","type":"CoffeeMachine","name":"GS3","location":null,
+"modelCode":"GS3AV","modelName":"GS3 AV","connected":true,"connectionDate":1760000000000,"offlineMode":false,
+"requireFirmwareUpdate":false,"availableFirmwareUpdate":false,"coffeeStation":null,"imageUrl":"https://example.com/gs3.png",
+"bleAuthToken":null,"timestamp":1760000000000,"widgets":[
+{"code":"CMMachineStatus","index":1,"output":{"status":"PoweredOn","availableModes":["BrewingMode","StandBy"],"mode":"BrewingMode","nextStatus":null,"brewingStartTime":null}},
+{"code":"CMCoffeeBoiler","index":1,"output":{"status":"Ready","enabled":true,"enabledSupported":false,"targetTemperature":93.5,"targetTemperatureMin":80,"targetTemperatureMax":100,"targetTemperatureStep":0.1,"readyStartTime":null}},
+{"code":"CMSteamBoilerLevel","index":1,"output":{"status":"Ready","enabled":true,"enabledSupported":true,"targetLevel":"Level2","targetLevelSupported":true,"readyStartTime":null}},
+{"code":"CMPreBrewing","index":1,"output":{"availableModes":["PreBrewing","PreInfusion","Disabled"],"mode":"PreInfusion","times":{"PreInfusion":[{"doseIndex":"ByGroup","seconds":{"In":0,"Out":4},"secondsMin":{"In":0,"Out":0},"secondsMax":{"In":0,"Out":9},"secondsStep":{"In":0.1,"Out":0.1}}],"PreBrewing":[{"doseIndex":"ByGroup","seconds":{"In":0.5,"Out":1},"secondsMin":{"In":0,"Out":0},"secondsMax":{"In":9,"Out":9},"secondsStep":{"In":0.1,"Out":0.1}}]},"doseIndexSupported":false}},
+{"code":"CMBrewByWeightDoses","index":1,"output":{"scaleConnected":true,"availableModes":["Dose1","Dose2","Continuous"],"mode":"Dose1","doses":{"Dose1":{"dose":36.5,"doseMin":5,"doseMax":100,"doseStep":0.1},"Dose2":{"dose":40,"doseMin":5,"doseMax":100,"doseStep":0.1}}}},
+{"code":"CMBackFlush","index":1,"output":{"lastCleaningStartTime":1759900000000,"status":"Off"}},
+{"code":"CMHotWaterDose","index":1,"output":{"enabled":true,"enabledSupported":false,"doses":[{"doseIndex":"DoseA","dose":8,"doseMin":0,"doseMax":90,"doseStep":1}]}},
+{"code":"CMCupWarmer","index":1,"output":{"enabled":false}},
+{"code":"CMBaristaLights","index":1,"output":{"enabled":true}},
+{"code":"ThingScale","index":2,"output":{"name":"LMZ-123A45","connected":true,"batteryLevel":87,"calibrationRequired":false}},
+{"code":"CMGroupDoses","index":1,"output":{"mirrorWithGroup1Supported":false,"mirrorWithGroup1":null,"availableModes":["PulsesType"],"mode":"PulsesType","profile":null}}
+],"invalidWidgets":[],"runningCommands":[]}`)
+
+func BenchmarkExtractDataFromDashboard(b *testing.B) {
+	client := New(WithClock(fixedClock(time.UnixMilli(1760000000000))))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.extractDataFromDashboard(benchmarkDashboard)
+	}
+}
@@ -0,0 +1,108 @@
+package lamarzocco
+
+import (
+	"sync"
+	"time"
+)
+
+// WithDoseDebounce delays dose commands until no new target arrived for the
+// quiet period, e.g. while a slider is dragged, and then sends only the final
+// values. The status shows each new target immediately. 0 sends every change.
+func WithDoseDebounce(quiet time.Duration) Option {
+	return func(c *Client) {
+		c.doseDebounce.quiet = quiet
+	}
+}
+
+type doseDebounce struct {
+	quiet   time.Duration
+	pending map[string]float64 // Machine weights by dose ID, not sent yet
+	timer   *time.Timer
+	mu      sync.Mutex
+}
+
+// debounceDose applies a dose target optimistically and (re)starts the quiet period
+func (c *Client) debounceDose(doseId string, machineWeight float64) {
+	d := &c.doseDebounce
+	d.mu.Lock()
+	if d.pending == nil {
+		d.pending = make(map[string]float64)
+	}
+	d.pending[doseId] = machineWeight
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(d.quiet, c.flushDoses)
+	d.mu.Unlock()
+
+	c.modeLock.Lock()
+	c.setDoseInfo(doseId, machineWeight)
+	c.modeLock.Unlock()
+
+	c.notifyStatusChange()
+	c.log.Debug("Dose target debounced", "doseId", doseId, "machineWeight", machineWeight, "quiet", d.quiet)
+}
+
+// pendingDoses returns the debounced targets that were not sent yet
+func (c *Client) pendingDoses() map[string]float64 {
+	d := &c.doseDebounce
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pending := make(map[string]float64, len(d.pending))
+	for doseId, weight := range d.pending {
+		pending[doseId] = weight
+	}
+	return pending
+}
+
+// flushDoses sends the debounced targets in one command. A failure restores
+// the state of the machine.
+func (c *Client) flushDoses() {
+	// The caller of SetDose already returned, only Close cancels the flush
+	ctx := c.ctx
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return
+	}
+	defer done()
+
+	pending := c.pendingDoses()
+	if len(pending) == 0 {
+		return
+	}
+
+	c.modeLock.RLock()
+	doses := map[string]interface{}{}
+	for doseId, info := range map[string]*DoseInfo{"Dose1": c.dose1, "Dose2": c.dose2} {
+		doses[doseId] = 0.0
+		if info != nil {
+			doses[doseId] = info.Weight
+		}
+	}
+	c.modeLock.RUnlock()
+	for doseId, weight := range pending {
+		doses[doseId] = weight
+	}
+
+	err = c.postCommand(ctx, "CoffeeMachineBrewByWeightSettingDoses", map[string]interface{}{"doses": doses})
+
+	// Targets set while the command was sent stay pending
+	d := &c.doseDebounce
+	d.mu.Lock()
+	for doseId, weight := range pending {
+		if d.pending[doseId] == weight {
+			delete(d.pending, doseId)
+		}
+	}
+	d.mu.Unlock()
+
+	if err != nil {
+		c.log.Error("Failed to set debounced doses", "doses", doses, "error", err)
+		if err := c.fetchCurrentMode(ctx); err != nil {
+			c.log.Error("Failed to restore dose targets", "error", err)
+		}
+		return
+	}
+	c.log.Info("Doses set successfully", "doses", doses)
+}
@@ -0,0 +1,52 @@
+package lamarzocco
+
+// DefaultPollFailureThreshold is the number of consecutive failed polls after
+// which the status reports the machine as disconnected
+const DefaultPollFailureThreshold = 3
+
+// WithPollFailureThreshold overrides DefaultPollFailureThreshold, 0 or less
+// never reports failed polls in the status
+func WithPollFailureThreshold(failures int) Option {
+	return func(c *Client) {
+		c.pollThreshold = failures
+	}
+}
+
+// SetDegradedCallback is called with the reason when polls keep failing and
+// with an empty reason once a poll succeeds again
+func (c *Client) SetDegradedCallback(callback func(reason string)) {
+	c.onDegraded = callback
+}
+
+// recordPoll counts consecutive failed polls. Past the threshold the status
+// is not connected and carries the reason, until a poll succeeds.
+func (c *Client) recordPoll(err error) {
+	c.modeLock.Lock()
+	wasDegraded := c.pollError != ""
+	if err == nil {
+		c.pollFailures = 0
+		c.pollError = ""
+	} else {
+		c.pollFailures++
+		if c.pollThreshold > 0 && c.pollFailures >= c.pollThreshold {
+			c.pollError = err.Error()
+		}
+	}
+	reason := c.pollError
+	failures := c.pollFailures
+	c.modeLock.Unlock()
+
+	switch {
+	case reason != "" && !wasDegraded:
+		c.log.Warn("Polling keeps failing, reporting the machine as disconnected", "failures", failures, "error", err)
+	case reason == "" && wasDegraded:
+		c.log.Info("Polling succeeded again")
+	default:
+		return
+	}
+
+	c.notifyStatusChange()
+	if c.onDegraded != nil {
+		c.onDegraded(reason)
+	}
+}
@@ -0,0 +1,56 @@
+package lamarzocco
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRecordPollThreshold(t *testing.T) {
+	c := New(WithPollFailureThreshold(3))
+	c.token = &TokenInfo{}
+
+	var reasons []string
+	c.SetDegradedCallback(func(reason string) {
+		reasons = append(reasons, reason)
+	})
+
+	failure := errors.New("cloud unreachable")
+	for i := 1; i <= 2; i++ {
+		c.recordPoll(failure)
+		if status := c.GetStatus(); !status.Connected || status.PollError != "" {
+			t.Fatalf("after %d failures: connected = %v, pollError = %q, want connected", i, status.Connected, status.PollError)
+		}
+	}
+
+	c.recordPoll(failure)
+	status := c.GetStatus()
+	if status.Connected || status.PollError != failure.Error() {
+		t.Fatalf("past threshold: connected = %v, pollError = %q", status.Connected, status.PollError)
+	}
+
+	c.recordPoll(failure)
+	if len(reasons) != 1 || reasons[0] != failure.Error() {
+		t.Fatalf("callback reasons = %q, want one failure", reasons)
+	}
+
+	c.recordPoll(nil)
+	status = c.GetStatus()
+	if !status.Connected || status.PollError != "" {
+		t.Fatalf("after recovery: connected = %v, pollError = %q", status.Connected, status.PollError)
+	}
+	if len(reasons) != 2 || reasons[1] != "" {
+		t.Fatalf("callback reasons = %q, want failure then recovery", reasons)
+	}
+}
+
+func TestRecordPollDisabled(t *testing.T) {
+	c := New(WithPollFailureThreshold(-1))
+	c.token = &TokenInfo{}
+
+	for i := 0; i < 10; i++ {
+		c.recordPoll(errors.New("cloud unreachable"))
+	}
+	if status := c.GetStatus(); !status.Connected || status.PollError != "" {
+		t.Fatalf("connected = %v, pollError = %q, want polls ignored", status.Connected, status.PollError)
+	}
+}
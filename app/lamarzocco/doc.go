@@ -0,0 +1,21 @@
+// Package lamarzocco is a client for the La Marzocco customer app API.
+//
+// It handles installation registration and request signing, token refresh,
+// machine status polling and commands. Commands are safe for concurrent use,
+// they run one after another in the order they were called. The package is a
+// module of its own without dependencies on the MQTT gateway. Requests take a
+// context for cancellation and per-call timeouts, Close cancels the background
+// work started by commands. Log messages are discarded unless a logger is set,
+// e.g. WithLogger(slog.Default()):
+//
+//	client := lamarzocco.New(
+//		lamarzocco.WithCredentials(username, password),
+//		lamarzocco.WithHTTPClient(httpClient),
+//		lamarzocco.WithStateStore(store),
+//	)
+//	defer client.Close()
+//	if err := client.Connect(ctx); err != nil {
+//		...
+//	}
+//	status := client.GetStatus()
+package lamarzocco
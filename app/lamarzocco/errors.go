@@ -0,0 +1,76 @@
+package lamarzocco
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error classes of failed requests and commands, test with errors.Is.
+// ErrNotSupported and ErrCircuitOpen are returned as well where they apply.
+var (
+	// ErrUnauthorized means the credentials or the token were rejected, repeating does not help
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrMachineOffline means a command failed while the machine is not connected to the cloud
+	ErrMachineOffline = errors.New("machine offline")
+	// ErrRateLimited means the cloud asked to slow down, or a command exceeded
+	// the client-side limit (see RateLimitPolicy)
+	ErrRateLimited = errors.New("rate limited")
+	// ErrTransient covers server errors, timeouts, dropped connections and an
+	// open circuit, the request may succeed later
+	ErrTransient = errors.New("temporary failure")
+	// ErrReadOnly means a command was rejected by a client created WithReadOnly
+	ErrReadOnly = errors.New("read-only client")
+)
+
+// StatusError is an unsuccessful HTTP response, it matches the error class of
+// its status code
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrTransient:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// transient marks network failures that may succeed when repeated
+func transient(err error) error {
+	if err == nil || !transientFailure(nil, err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrTransient, err)
+}
+
+// ErrorClass names the class of an error for events and logs: unauthorized,
+// machine_offline, rate_limited, transient, not_supported, read_only or
+// unknown
+func ErrorClass(err error) string {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, ErrMachineOffline):
+		return "machine_offline"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrTransient):
+		return "transient"
+	case errors.Is(err, ErrNotSupported):
+		return "not_supported"
+	case errors.Is(err, ErrReadOnly):
+		return "read_only"
+	}
+	return "unknown"
+}
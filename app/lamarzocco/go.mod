@@ -0,0 +1,14 @@
+module github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco
+
+go 1.24.2
+
+require (
+	github.com/google/uuid v1.6.0
+	github.com/gorilla/websocket v1.5.0
+	github.com/tidwall/gjson v1.18.0
+)
+
+require (
+	github.com/tidwall/match v1.1.1 // indirect
+	github.com/tidwall/pretty v1.2.0 // indirect
+)
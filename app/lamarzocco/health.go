@@ -0,0 +1,47 @@
+package lamarzocco
+
+import (
+	"sync"
+	"time"
+)
+
+// UpState is the state of a connection and when it last changed
+type UpState struct {
+	Up             bool      `json:"up"`
+	LastTransition time.Time `json:"lastTransition,omitempty"` // Zero until the state is first known
+}
+
+// UpTracker records the transitions of an up/down state
+type UpTracker struct {
+	state UpState
+	mu    sync.Mutex
+}
+
+func (t *UpTracker) Set(up bool, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state.Up != up || t.state.LastTransition.IsZero() {
+		t.state = UpState{Up: up, LastTransition: now}
+	}
+}
+
+func (t *UpTracker) State() UpState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// Health is the state of each connection between the gateway and the machine
+type Health struct {
+	Cloud   UpState `json:"cloud"`   // Cloud API requests succeed
+	Machine UpState `json:"machine"` // The machine is connected to the cloud
+	Stream  UpState `json:"stream"`  // Live updates are received
+}
+
+func (c *Client) Health() Health {
+	return Health{
+		Cloud:   c.cloudUp.State(),
+		Machine: c.machineUp.State(),
+		Stream:  c.streamUp.State(),
+	}
+}
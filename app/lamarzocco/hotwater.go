@@ -0,0 +1,125 @@
+package lamarzocco
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxHotWaterSeconds is the longest hot water dose the machines accept
+const maxHotWaterSeconds = 90.0
+
+// HotWaterDose is a hot water (tea) dose by duration
+type HotWaterDose struct {
+	Dose    string  `json:"dose,omitempty"` // Dose1 or Dose2, empty selects Dose1 when setting
+	Seconds float64 `json:"seconds"`
+}
+
+type HotWaterInfo struct {
+	Enabled bool           `json:"enabled"`
+	Doses   []HotWaterDose `json:"doses,omitempty"`
+}
+
+// SetHotWaterDose sets the duration of a hot water dose. dose is Dose1 or
+// Dose2, empty selects Dose1.
+func (c *Client) SetHotWaterDose(ctx context.Context, dose string, seconds float64) error {
+	if err := requireCapability(c.Capabilities().HotWaterDose, "hot water dose"); err != nil {
+		return err
+	}
+	if dose == "" {
+		dose = "Dose1"
+	}
+	if err := (&HotWaterDose{Dose: dose, Seconds: seconds}).Validate(); err != nil {
+		return err
+	}
+	doseIndex, _ := hotWaterDoseIndex(dose)
+
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	payload := map[string]interface{}{
+		"doseIndex": doseIndex,
+		"dose":      seconds,
+	}
+
+	if err := c.postCommand(ctx, "CoffeeMachineSettingHotWaterDose", payload); err != nil {
+		return err
+	}
+
+	c.modeLock.Lock()
+	info := HotWaterInfo{Enabled: true}
+	if c.hotWater != nil {
+		info = *c.hotWater
+	}
+	doses := make([]HotWaterDose, 0, len(info.Doses)+1)
+	replaced := false
+	for _, d := range info.Doses {
+		if d.Dose == dose {
+			d.Seconds = seconds
+			replaced = true
+		}
+		doses = append(doses, d)
+	}
+	if !replaced {
+		doses = append(doses, HotWaterDose{Dose: dose, Seconds: seconds})
+	}
+	info.Doses = doses
+	c.hotWater = &info
+	c.modeLock.Unlock()
+
+	c.notifyStatusChange()
+
+	c.log.Info("Hot water dose set successfully", "dose", dose, "seconds", seconds)
+	return nil
+}
+
+// Validate checks the values without contacting the machine
+func (d *HotWaterDose) Validate() error {
+	if d.Dose != "" {
+		if _, err := hotWaterDoseIndex(d.Dose); err != nil {
+			return err
+		}
+	}
+	if d.Seconds <= 0 || d.Seconds > maxHotWaterSeconds {
+		return fmt.Errorf("hot water dose must be between 0 and %.0f seconds", maxHotWaterSeconds)
+	}
+	return nil
+}
+
+func hotWaterDoseIndex(dose string) (string, error) {
+	switch dose {
+	case "Dose1":
+		return "DoseA", nil
+	case "Dose2":
+		return "DoseB", nil
+	}
+	return "", fmt.Errorf("invalid dose %q, must be Dose1 or Dose2", dose)
+}
+
+// hotWaterOutput is the output of the CMHotWaterDose widget, e.g.
+// {"enabled": true, "doses": [{"doseIndex": "DoseA", "dose": 8}]}
+type hotWaterOutput struct {
+	Enabled bool `json:"enabled"`
+	Doses   []struct {
+		DoseIndex string   `json:"doseIndex"`
+		Dose      *float64 `json:"dose"` // Seconds
+	} `json:"doses"`
+}
+
+func parseHotWater(output hotWaterOutput) *HotWaterInfo {
+	info := &HotWaterInfo{Enabled: output.Enabled}
+	for _, entry := range output.Doses {
+		if entry.Dose == nil {
+			continue
+		}
+
+		dose := "Dose1"
+		if entry.DoseIndex == "DoseB" {
+			dose = "Dose2"
+		}
+		info.Doses = append(info.Doses, HotWaterDose{Dose: dose, Seconds: *entry.Dose})
+	}
+	return info
+}
@@ -0,0 +1,30 @@
+package lamarzocco
+
+import "net/http"
+
+// Identity is how the client introduces itself to the cloud with every
+// request, including the registration at /auth/init. Should the cloud start to
+// require a minimum app version, the values can be updated without a new
+// release of the client.
+type Identity struct {
+	UserAgent string            // Empty keeps the default of net/http
+	Headers   map[string]string // e.g. the app version and platform, the signing headers cannot be replaced
+}
+
+// WithIdentity sets the identification sent with every request to the cloud
+func WithIdentity(identity Identity) Option {
+	return func(c *Client) {
+		c.identity = identity
+	}
+}
+
+// identify adds the identification to a request, before the client sets its
+// own headers, so those cannot be replaced
+func (c *Client) identify(header http.Header) {
+	for key, value := range c.identity.Headers {
+		header.Set(key, value)
+	}
+	if c.identity.UserAgent != "" {
+		header.Set("User-Agent", c.identity.UserAgent)
+	}
+}
@@ -0,0 +1,61 @@
+package lamarzocco
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdentity(t *testing.T) {
+	var mu sync.Mutex
+	headers := map[string]http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers[r.URL.Path] = r.Header.Clone()
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/auth/init":
+			w.Write([]byte(`{}`))
+		case "/things":
+			w.Write([]byte(`[{"serialNumber":"GS012345","modelName":"GS3"}]`))
+		default:
+			w.Write([]byte(`{"widgets":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	c := New(
+		WithBaseURL(server.URL),
+		WithToken(TokenInfo{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour)}),
+		WithIdentity(Identity{
+			UserAgent: "LaMarzoccoHome/5.2.0",
+			Headers:   map[string]string{"X-App-Version": "5.2.0", "Authorization": "forged"},
+		}),
+	)
+	defer c.Close()
+
+	ctx := context.Background()
+	if err := c.registerClient(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range []string{"/auth/init", "/things"} {
+		h := headers[path]
+		if h.Get("User-Agent") != "LaMarzoccoHome/5.2.0" || h.Get("X-App-Version") != "5.2.0" {
+			t.Errorf("%s: User-Agent = %q, X-App-Version = %q, want the identity", path, h.Get("User-Agent"), h.Get("X-App-Version"))
+		}
+	}
+	if auth := headers["/things"].Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("Authorization = %q, the identity must not replace it", auth)
+	}
+}
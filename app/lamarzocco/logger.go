@@ -0,0 +1,17 @@
+package lamarzocco
+
+// Logger receives log messages with key/value pairs, *slog.Logger implements it
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// nopLogger discards all messages, it is used unless WithLogger is set
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
@@ -0,0 +1,47 @@
+package lamarzocco
+
+import (
+	"fmt"
+	"math"
+)
+
+// DoseBounds limits brew-by-weight targets in grams
+type DoseBounds struct {
+	Min float64
+	Max float64
+}
+
+// DefaultDoseBounds are used unless overridden with WithDoseBounds
+var DefaultDoseBounds = DoseBounds{Min: 5, Max: 100}
+
+// RoundTenth rounds half-up to one decimal, the resolution of the machine.
+// The epsilon keeps values like 18.15, stored as 18.1499..., from rounding down.
+func RoundTenth(value float64) float64 {
+	return math.Floor(value*10+0.5+1e-9) / 10
+}
+
+// CheckDose rejects dose targets that are not a positive number of grams,
+// the bounds are applied later by Normalize
+func CheckDose(weight float64) error {
+	if math.IsNaN(weight) || math.IsInf(weight, 0) || weight <= 0 {
+		return fmt.Errorf("invalid dose %v, must be a positive number of grams", weight)
+	}
+	return nil
+}
+
+// Normalize rounds a dose target to 0.1g and clamps it to the bounds. Values
+// that are not a positive number are rejected.
+func (b DoseBounds) Normalize(weight float64) (float64, error) {
+	if err := CheckDose(weight); err != nil {
+		return 0, err
+	}
+
+	weight = RoundTenth(weight)
+	if weight < b.Min {
+		return b.Min, nil
+	}
+	if weight > b.Max {
+		return b.Max, nil
+	}
+	return weight, nil
+}
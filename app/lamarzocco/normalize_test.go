@@ -0,0 +1,65 @@
+package lamarzocco
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRoundTenth(t *testing.T) {
+	tests := []struct {
+		name  string
+		value float64
+		want  float64
+	}{
+		{"exact", 18.5, 18.5},
+		{"rounds down", 18.14, 18.1},
+		{"half rounds up", 18.15, 18.2},
+		{"half rounds up with binary error", 36.05, 36.1},
+		{"rounds up instead of truncating", 18.19, 18.2},
+		{"integer", 36, 36},
+		{"negative offset", -1.25, -1.2},
+		{"zero", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RoundTenth(tt.value); got != tt.want {
+				t.Errorf("RoundTenth(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoseBoundsNormalize(t *testing.T) {
+	bounds := DoseBounds{Min: 5, Max: 100}
+
+	tests := []struct {
+		name    string
+		weight  float64
+		want    float64
+		wantErr bool
+	}{
+		{"within bounds", 36, 36, false},
+		{"rounded", 36.06, 36.1, false},
+		{"clamped to min", 2.5, 5, false},
+		{"clamped to max", 150, 100, false},
+		{"rounded onto max", 100.04, 100, false},
+		{"rounded above max", 100.05, 100, false},
+		{"zero", 0, 0, true},
+		{"negative", -18, 0, true},
+		{"not a number", math.NaN(), 0, true},
+		{"infinite", math.Inf(1), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bounds.Normalize(tt.weight)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Normalize(%v) error = %v, wantErr %v", tt.weight, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%v) = %v, want %v", tt.weight, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package lamarzocco
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Option configures optional Client behavior
+type Option func(*Client)
+
+// WithCredentials sets the La Marzocco account used to sign in
+func WithCredentials(username, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithSharedSession signs in with the account, identity, installation and
+// token of another client, e.g. for the other machines of the account. A token
+// refreshed by one client is used by all of them.
+func WithSharedSession(other *Client) Option {
+	return func(c *Client) {
+		c.username = other.username
+		c.password = other.password
+		c.identity = other.identity
+		c.session = other.session
+	}
+}
+
+// WithInstallationKey reuses a registered installation instead of registering a new one
+func WithInstallationKey(key *InstallationKey) Option {
+	return func(c *Client) {
+		c.installKey = key
+	}
+}
+
+// WithToken reuses a token, it is refreshed when it expires
+func WithToken(token TokenInfo) Option {
+	return func(c *Client) {
+		c.token = &token
+	}
+}
+
+// WithCapabilities overrides the available machine features
+func WithCapabilities(capabilities Capabilities) Option {
+	return func(c *Client) {
+		c.capabilities = capabilities
+	}
+}
+
+// WithDoseBounds overrides the range dose targets are clamped to (default: 5-100g)
+func WithDoseBounds(bounds DoseBounds) Option {
+	return func(c *Client) {
+		c.doseBounds = bounds
+	}
+}
+
+// WithClock replaces the system clock, e.g. to test token expiry
+func WithClock(clock Clock) Option {
+	return func(c *Client) {
+		c.clock = clock
+	}
+}
+
+// WithHTTPClient replaces the default HTTP client (30s timeout)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithSerial selects a machine of the account, the default is the first one
+func WithSerial(serial string) Option {
+	return func(c *Client) {
+		c.serial = serial
+	}
+}
+
+// WithBaseURL points the client to a different API endpoint (e.g. a mock server)
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithStateStore persists the installation key and tokens between restarts
+func WithStateStore(store StateStore) Option {
+	return func(c *Client) {
+		c.stateStore = store
+	}
+}
+
+// WithLogger sets the destination of log messages, they are discarded by default
+func WithLogger(log Logger) Option {
+	return func(c *Client) {
+		c.log = log
+	}
+}
+
+// WithRedactedSerial reports the machine under a Pseudonym instead of its
+// serial, in the status and in the log messages and errors of the client. The
+// serials are still used to talk to the cloud and listed by Things.
+func WithRedactedSerial() Option {
+	return func(c *Client) {
+		c.redactSerial = true
+	}
+}
+
+// WithReadOnly rejects every request that could change the machine or the
+// account with ErrReadOnly, e.g. to check a machine without touching it.
+// Signing in and token refreshes still work.
+func WithReadOnly() Option {
+	return func(c *Client) {
+		c.readOnly = true
+	}
+}
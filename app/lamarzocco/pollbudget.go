@@ -0,0 +1,92 @@
+package lamarzocco
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PollBudget limits the status polls of all clients sharing a session (see
+// WithSharedSession), so the machines of an account poll concurrently without
+// multiplying the load on the cloud. Waiting polls get the next free slot in
+// the order they arrived, each client polls one at a time, so no machine
+// starves the others.
+type PollBudget struct {
+	Rate  float64 // Polls per minute of all machines, 0 disables the budget
+	Burst int     // Polls sent without delay after a quiet period
+}
+
+// DefaultPollBudget leaves room for ten machines polled every 30 seconds
+var DefaultPollBudget = PollBudget{Rate: 20, Burst: 4}
+
+// WithPollBudget sets the budget of the session. Clients created
+// WithSharedSession afterwards share it.
+func WithPollBudget(budget PollBudget) Option {
+	return func(c *Client) {
+		if budget.Rate <= 0 {
+			c.session.polls = nil
+			return
+		}
+		if budget.Burst < 1 {
+			budget.Burst = 1
+		}
+		c.session.polls = &rateLimiter{policy: RateLimitPolicy{Rate: budget.Rate, Burst: budget.Burst}}
+	}
+}
+
+// PollStats are the timings of the status polls of one machine
+type PollStats struct {
+	Polls         int        `json:"polls"`
+	Failures      int        `json:"failures"`
+	LastDuration  float64    `json:"lastDuration"`  // Seconds the last poll took
+	TotalDuration float64    `json:"totalDuration"` // Seconds of all polls
+	LastWait      float64    `json:"lastWait"`      // Seconds the last poll waited for the budget
+	TotalWait     float64    `json:"totalWait"`     // Seconds all polls waited for the budget
+	LastPoll      *time.Time `json:"lastPoll,omitempty"`
+}
+
+type pollTimings struct {
+	stats PollStats
+	mu    sync.Mutex
+}
+
+// PollStats returns the timings of the status polls since the start
+func (c *Client) PollStats() PollStats {
+	c.polls.mu.Lock()
+	defer c.polls.mu.Unlock()
+	return c.polls.stats
+}
+
+// timedPoll runs a status poll once the budget of the session allows it
+func (c *Client) timedPoll(ctx context.Context, poll func(context.Context) error) error {
+	var wait time.Duration
+	if budget := c.session.polls; budget != nil {
+		if wait, _ = budget.reserve(c.clock.Now()); wait > 0 {
+			c.log.Debug("Delaying poll, poll budget of the account reached", "delay", wait)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				budget.release()
+				return ctx.Err()
+			}
+		}
+	}
+
+	polled := c.clock.Now()
+	err := poll(ctx)
+	done := c.clock.Now()
+
+	c.polls.mu.Lock()
+	defer c.polls.mu.Unlock()
+	s := &c.polls.stats
+	s.Polls++
+	if err != nil {
+		s.Failures++
+	}
+	s.LastDuration = done.Sub(polled).Seconds()
+	s.TotalDuration += s.LastDuration
+	s.LastWait = wait.Seconds()
+	s.TotalWait += s.LastWait
+	s.LastPoll = &done
+	return err
+}
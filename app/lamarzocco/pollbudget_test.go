@@ -0,0 +1,32 @@
+package lamarzocco
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPollBudgetIsShared(t *testing.T) {
+	first := New(WithPollBudget(PollBudget{Rate: 600, Burst: 1}))
+	second := New(WithSharedSession(first))
+	defer first.Close()
+	defer second.Close()
+
+	ctx := context.Background()
+	ok := func(context.Context) error { return nil }
+	if err := first.timedPoll(ctx, ok); err != nil {
+		t.Fatalf("timedPoll() error = %v", err)
+	}
+	failed := errors.New("poll failed")
+	if err := second.timedPoll(ctx, func(context.Context) error { return failed }); !errors.Is(err, failed) {
+		t.Fatalf("timedPoll() error = %v, want the poll error", err)
+	}
+
+	if s := first.PollStats(); s.Polls != 1 || s.LastWait != 0 || s.LastPoll == nil {
+		t.Errorf("first PollStats = %+v, want one poll without waiting", s)
+	}
+	// The burst was used by the first machine, the second waits for the next slot
+	if s := second.PollStats(); s.Polls != 1 || s.Failures != 1 || s.LastWait < 0.05 {
+		t.Errorf("second PollStats = %+v, want one failed poll that waited about 0.1s", s)
+	}
+}
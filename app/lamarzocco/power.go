@@ -0,0 +1,149 @@
+package lamarzocco
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PowerState is the power mode of the machine. Simple models only know on
+// and standby, others can also be switched fully off.
+type PowerState string
+
+const (
+	PowerOn      PowerState = "on"
+	PowerStandby PowerState = "standby"
+	PowerOff     PowerState = "off"
+)
+
+// ParsePowerState accepts on, standby and off in any case
+func ParsePowerState(s string) (PowerState, error) {
+	state := PowerState(strings.ToLower(strings.TrimSpace(s)))
+	if !state.Valid() {
+		return "", fmt.Errorf("invalid power %q, must be on, standby or off", s)
+	}
+	return state, nil
+}
+
+func (p PowerState) Valid() bool {
+	return p == PowerOn || p == PowerStandby || p == PowerOff
+}
+
+// On reports whether the machine is (or should be) powered on
+func (p PowerState) On() bool {
+	return p == PowerOn
+}
+
+// UnmarshalJSON accepts the boolean form (true is on, false is standby)
+// as well as "on", "standby" and "off"
+func (p *PowerState) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var on bool
+	if err := json.Unmarshal(data, &on); err == nil {
+		*p = powerStateFromBool(on)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("power must be a boolean or on, standby, off")
+	}
+	state, err := ParsePowerState(s)
+	if err != nil {
+		return err
+	}
+	*p = state
+	return nil
+}
+
+func powerStateFromBool(on bool) PowerState {
+	if on {
+		return PowerOn
+	}
+	return PowerStandby
+}
+
+// powerStateFromStatus maps the CMMachineStatus status, empty if unknown
+func powerStateFromStatus(status string) PowerState {
+	switch status {
+	case "PoweredOn", "Brewing":
+		return PowerOn
+	case "StandBy":
+		return PowerStandby
+	case "Off":
+		return PowerOff
+	}
+	return ""
+}
+
+// powerModes are the CoffeeMachineChangeMode values per power state
+var powerModes = map[PowerState]string{
+	PowerOn:      "BrewingMode",
+	PowerStandby: "StandBy",
+	PowerOff:     "Off",
+}
+
+// SetPower turns the machine on (true) or puts it into standby (false)
+func (c *Client) SetPower(ctx context.Context, on bool) error {
+	return c.SetPowerState(ctx, powerStateFromBool(on))
+}
+
+// SetPowerState switches between on, standby and, where the machine
+// supports it, fully off
+func (c *Client) SetPowerState(ctx context.Context, state PowerState) error {
+	mode, ok := powerModes[state]
+	if !ok {
+		return fmt.Errorf("invalid power state %q", state)
+	}
+	if state == PowerOff {
+		if err := requireCapability(c.Capabilities().FullOff, "full off"); err != nil {
+			return err
+		}
+	}
+
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	payload := map[string]interface{}{
+		"mode": mode,
+	}
+
+	if err := c.postCommand(ctx, "CoffeeMachineChangeMode", payload); err != nil {
+		return fmt.Errorf("failed to set power: %w", err)
+	}
+
+	// Update local state optimistically and set power command time
+	c.modeLock.Lock()
+	c.machineOn = state.On()
+	c.power = state
+	c.powerCommandTime = c.clock.Now()
+	c.modeLock.Unlock()
+	c.notifyStatusChange()
+
+	c.log.Info("Power set successfully", "power", state)
+
+	// Refresh status from dashboard multiple times to catch the actual state
+	go func() {
+		delays := []time.Duration{2 * time.Second, 5 * time.Second, 10 * time.Second}
+		for _, delay := range delays {
+			select {
+			case <-time.After(delay):
+			case <-c.ctx.Done():
+				return
+			}
+			if err := c.fetchCurrentMode(c.ctx); err != nil {
+				c.log.Error("Failed to refresh status after power change", "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
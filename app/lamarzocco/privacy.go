@@ -0,0 +1,111 @@
+package lamarzocco
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+)
+
+// Pseudonym returns a stable ID standing in for the serial of a machine. It
+// is derived from the account as well, so it cannot be traced back to the
+// machine by hashing known serials.
+func Pseudonym(account, serial string) string {
+	mac := hmac.New(sha256.New, []byte(strings.ToLower(account)))
+	mac.Write([]byte(serial))
+	return "lm-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// redaction replaces the serials of the account with their pseudonyms
+type redaction struct {
+	replacer atomic.Pointer[strings.Replacer] // nil until the serials are known
+}
+
+// DeviceID returns the ID the machine with serial is reported as: the serial,
+// or its Pseudonym WithRedactedSerial
+func (c *Client) DeviceID(serial string) string {
+	if !c.redactSerial || serial == "" {
+		return serial
+	}
+	return Pseudonym(c.username, serial)
+}
+
+// setRedactedSerials prepares the redaction of serials in logs and errors
+func (c *Client) setRedactedSerials(serials ...string) {
+	if !c.redactSerial {
+		return
+	}
+	var pairs []string
+	for _, serial := range serials {
+		if serial != "" {
+			pairs = append(pairs, serial, c.DeviceID(serial))
+		}
+	}
+	c.redaction.replacer.Store(strings.NewReplacer(pairs...))
+}
+
+// redact replaces the serials in s
+func (c *Client) redact(s string) string {
+	if r := c.redaction.replacer.Load(); r != nil {
+		return r.Replace(s)
+	}
+	return s
+}
+
+// redactedError hides the serials in the message of err, e.g. in the URL of a
+// failed request, and keeps err for errors.Is
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+func (c *Client) redactError(err error) error {
+	if err == nil || c.redaction.replacer.Load() == nil {
+		return err
+	}
+	if msg := c.redact(err.Error()); msg != err.Error() {
+		return &redactedError{err: err, msg: msg}
+	}
+	return err
+}
+
+// redactingLogger hides the serials in messages and string or error values
+type redactingLogger struct {
+	log    Logger
+	client *Client
+}
+
+func (l redactingLogger) args(args []any) []any {
+	result := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			result[i] = l.client.redact(v)
+		case error:
+			result[i] = l.client.redactError(v)
+		default:
+			result[i] = arg
+		}
+	}
+	return result
+}
+
+func (l redactingLogger) Debug(msg string, args ...any) {
+	l.log.Debug(l.client.redact(msg), l.args(args)...)
+}
+
+func (l redactingLogger) Info(msg string, args ...any) {
+	l.log.Info(l.client.redact(msg), l.args(args)...)
+}
+
+func (l redactingLogger) Warn(msg string, args ...any) {
+	l.log.Warn(l.client.redact(msg), l.args(args)...)
+}
+
+func (l redactingLogger) Error(msg string, args ...any) {
+	l.log.Error(l.client.redact(msg), l.args(args)...)
+}
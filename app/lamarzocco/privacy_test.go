@@ -0,0 +1,79 @@
+package lamarzocco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingLogger keeps the formatted log lines
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) record(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprint(append([]any{msg}, args...)...))
+}
+
+func (l *recordingLogger) Debug(msg string, args ...any) { l.record(msg, args...) }
+func (l *recordingLogger) Info(msg string, args ...any)  { l.record(msg, args...) }
+func (l *recordingLogger) Warn(msg string, args ...any)  { l.record(msg, args...) }
+func (l *recordingLogger) Error(msg string, args ...any) { l.record(msg, args...) }
+
+func TestRedactedSerial(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/things":
+			w.Write([]byte(`[{"serialNumber":"GS012345","modelName":"GS3"}]`))
+		default:
+			w.Write([]byte(`{"widgets":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	log := &recordingLogger{}
+	c := New(
+		WithCredentials("anna@example.com", "secret"),
+		WithBaseURL(server.URL),
+		WithToken(TokenInfo{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour)}),
+		WithLogger(log),
+		WithReadOnly(),
+		WithRedactedSerial(),
+	)
+	defer c.Close()
+
+	ctx := context.Background()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	want := Pseudonym("anna@example.com", "GS012345")
+	if got := c.GetStatus().Serial; got != want {
+		t.Errorf("Serial = %q, want %q", got, want)
+	}
+	if want == Pseudonym("bob@example.com", "GS012345") {
+		t.Error("pseudonym does not depend on the account")
+	}
+
+	err := c.SetPower(ctx, true)
+	if !errors.Is(err, ErrReadOnly) || strings.Contains(err.Error(), "GS012345") {
+		t.Errorf("SetPower() error = %v, want ErrReadOnly without the serial", err)
+	}
+	c.log.Info("Request failed", "error", err, "url", server.URL+"/things/GS012345/dashboard")
+
+	for _, line := range log.lines {
+		if strings.Contains(line, "GS012345") {
+			t.Errorf("log line contains the serial: %s", line)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package lamarzocco
+
+import (
+	"context"
+	"sync"
+)
+
+// commandQueue runs machine commands one after another in arrival order.
+// Commands from MQTT, triggers and the web UI would otherwise interleave and
+// build payloads from stale local state (e.g. SetDose sends both doses).
+type commandQueue struct {
+	requests chan queuedCommand
+	once     sync.Once
+}
+
+type queuedCommand struct {
+	start chan struct{} // Closed when it is the command's turn
+	done  chan struct{} // Closed by the command when it finished
+}
+
+// enqueue blocks until all earlier commands finished or ctx is done. The
+// returned func must be called once the command and its optimistic state
+// update are done.
+func (c *Client) enqueue(ctx context.Context) (func(), error) {
+	q := &c.commands
+	q.once.Do(func() {
+		q.requests = make(chan queuedCommand, 64)
+		go q.run()
+	})
+
+	cmd := queuedCommand{start: make(chan struct{}), done: make(chan struct{})}
+	select {
+	case q.requests <- cmd:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case <-cmd.start:
+		return func() { close(cmd.done) }, nil
+	case <-ctx.Done():
+		// Give up the turn as soon as it comes
+		go func() {
+			<-cmd.start
+			close(cmd.done)
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (q *commandQueue) run() {
+	for cmd := range q.requests {
+		close(cmd.start)
+		<-cmd.done
+	}
+}
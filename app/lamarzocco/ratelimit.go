@@ -0,0 +1,99 @@
+package lamarzocco
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy limits outgoing machine commands with a token bucket, so a
+// replayed retained message or a looping automation cannot get the account
+// throttled by the cloud. Polling is not limited.
+type RateLimitPolicy struct {
+	Rate    float64       // Commands per minute, 0 disables the limit
+	Burst   int           // Commands sent without delay after a quiet period
+	MaxWait time.Duration // Longest a command is delayed, commands that would wait longer fail with ErrRateLimited
+}
+
+var DefaultRateLimitPolicy = RateLimitPolicy{
+	Rate:    20,
+	Burst:   10,
+	MaxWait: 30 * time.Second,
+}
+
+// WithRateLimitPolicy overrides DefaultRateLimitPolicy
+func WithRateLimitPolicy(policy RateLimitPolicy) Option {
+	return func(c *Client) {
+		if policy.Burst < 1 {
+			policy.Burst = 1
+		}
+		c.limiter.policy = policy
+	}
+}
+
+type rateLimiter struct {
+	policy RateLimitPolicy
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// reserve takes a token and returns the delay until it is available. It
+// reports false without taking one if the delay would exceed MaxWait.
+func (l *rateLimiter) reserve(now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.policy.Rate <= 0 {
+		return 0, true
+	}
+
+	burst := float64(l.policy.Burst)
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else {
+		l.tokens = min(burst, l.tokens+now.Sub(l.last).Minutes()*l.policy.Rate)
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+
+	wait := time.Duration((1 - l.tokens) / l.policy.Rate * float64(time.Minute))
+	if l.policy.MaxWait > 0 && wait > l.policy.MaxWait {
+		return wait, false
+	}
+	l.tokens--
+	return wait, true
+}
+
+// release returns a reserved token of a command that was not sent
+func (l *rateLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = min(float64(l.policy.Burst), l.tokens+1)
+}
+
+// waitForCommand delays a command until the rate limit allows it
+func (c *Client) waitForCommand(ctx context.Context, command string) error {
+	wait, ok := c.limiter.reserve(c.clock.Now())
+	if !ok {
+		c.log.Warn("Command rejected, rate limit reached", "command", command, "rate", c.limiter.policy.Rate)
+		return fmt.Errorf("%w: more than %g commands per minute", ErrRateLimited, c.limiter.policy.Rate)
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	c.log.Debug("Delaying command, rate limit reached", "command", command, "delay", wait)
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		c.limiter.release()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,51 @@
+package lamarzocco
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+var commandNamePattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// RawCommand sends a command the client does not wrap to the cloud and
+// returns the response as it is. It runs through the command queue and the
+// rate limit like any other command, the state is picked up by the next poll.
+func (c *Client) RawCommand(ctx context.Context, command string, payload json.RawMessage) (int, []byte, error) {
+	if !commandNamePattern.MatchString(command) {
+		return 0, nil, fmt.Errorf("invalid command name %q", command)
+	}
+	var body interface{}
+	if len(payload) > 0 {
+		body = payload
+	}
+
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer done()
+
+	if err := c.waitForCommand(ctx, command); err != nil {
+		return 0, nil, err
+	}
+
+	resp, err := c.doAuthenticatedRequest(ctx, "POST", fmt.Sprintf("%s/things/%s/command/%s", c.baseURL, c.machineSerial(), command), body)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %w", transient(err))
+	}
+
+	c.log.Info("Raw command sent", "command", command, "status", resp.StatusCode)
+	if resp.StatusCode < 300 {
+		c.notifyCommand(command)
+	}
+	return resp.StatusCode, data, nil
+}
@@ -0,0 +1,52 @@
+package lamarzocco
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadOnlyRejectsCommands(t *testing.T) {
+	var writes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writes.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/things":
+			w.Write([]byte(`[{"serialNumber":"GS012345","modelName":"GS3"}]`))
+		case "/things/GS012345/dashboard":
+			w.Write([]byte(`{"widgets":[]}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	c := New(
+		WithBaseURL(server.URL),
+		WithToken(TokenInfo{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour)}),
+		WithReadOnly(),
+	)
+	defer c.Close()
+
+	ctx := context.Background()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	if err := c.SetPower(ctx, true); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SetPower() error = %v, want ErrReadOnly", err)
+	}
+	if _, _, err := c.RawCommand(ctx, "CoffeeMachineChangeMode", nil); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("RawCommand() error = %v, want ErrReadOnly", err)
+	}
+	if n := writes.Load(); n != 0 {
+		t.Errorf("server received %d write requests, want none", n)
+	}
+}
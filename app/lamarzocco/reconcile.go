@@ -0,0 +1,111 @@
+package lamarzocco
+
+import (
+	"context"
+	"time"
+)
+
+// SanityCheckInterval is how often the dashboard is polled while the stream
+// is connected, to detect updates the stream missed
+const SanityCheckInterval = 15 * time.Minute
+
+// Discrepancy is a value that differs between the streamed and the polled state
+type Discrepancy struct {
+	Field    string      `json:"field"`
+	Streamed interface{} `json:"streamed"`
+	Polled   interface{} `json:"polled"`
+}
+
+// SetDiscrepancyCallback is called when a sanity check finds that the
+// streamed state drifted from the machine state. The polled state is applied
+// before the callback is invoked.
+func (c *Client) SetDiscrepancyCallback(callback func([]Discrepancy)) {
+	c.onDiscrepancy = callback
+}
+
+// reconcile polls the dashboard and replaces the streamed state with it
+func (c *Client) reconcile(ctx context.Context) error {
+	body, err := c.fetchDashboard(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.modeLock.Lock()
+	streamed := c.dashboard
+	c.dashboard = body
+	c.modeLock.Unlock()
+
+	var discrepancies []Discrepancy
+	if len(streamed) > 0 {
+		discrepancies = compareDashboards(c.extractDataFromDashboard(streamed), c.extractDataFromDashboard(body))
+	}
+
+	c.applyDashboard(body)
+
+	if len(discrepancies) > 0 {
+		c.log.Warn("Streamed state drifted from machine state", "discrepancies", len(discrepancies))
+		if c.onDiscrepancy != nil {
+			c.onDiscrepancy(discrepancies)
+		}
+	}
+	return nil
+}
+
+// compareDashboards lists the differences between two dashboards. Values
+// derived from the current time (e.g. remaining heat-up time) are ignored.
+func compareDashboards(streamed, polled dashboardData) []Discrepancy {
+	var result []Discrepancy
+	add := func(field string, a, b interface{}) {
+		if a != b {
+			result = append(result, Discrepancy{Field: field, Streamed: a, Polled: b})
+		}
+	}
+
+	add("mode", streamed.mode, polled.mode)
+	add("machineOn", streamed.machineOn, polled.machineOn)
+	add("cloudConnected", streamed.connected, polled.connected)
+	add("brewing", !streamed.brewingSince.IsZero(), !polled.brewingSince.IsZero())
+	add("dose1", doseWeight(streamed.dose1), doseWeight(polled.dose1))
+	add("dose2", doseWeight(streamed.dose2), doseWeight(polled.dose2))
+
+	streamedCoffee, streamedSteam := boilerValues(streamed.boilers)
+	polledCoffee, polledSteam := boilerValues(polled.boilers)
+	add("boilers.coffee.ready", streamedCoffee.Ready, polledCoffee.Ready)
+	add("boilers.coffee.temperature", streamedCoffee.Temperature, polledCoffee.Temperature)
+	add("boilers.steam.ready", streamedSteam.Ready, polledSteam.Ready)
+	add("boilers.steam.level", streamedSteam.Level, polledSteam.Level)
+	add("boilers.steam.enabled", boolValue(streamedSteam.Enabled), boolValue(polledSteam.Enabled))
+
+	add("preExtraction.mode", preExtractionMode(streamed.preExtraction), preExtractionMode(polled.preExtraction))
+
+	add("scale.connected", streamed.scale != nil && streamed.scale.Connected, polled.scale != nil && polled.scale.Connected)
+
+	return result
+}
+
+func doseWeight(dose *DoseInfo) float64 {
+	if dose == nil {
+		return 0
+	}
+	return dose.Weight
+}
+
+func boilerValues(boilers *BoilersInfo) (coffee, steam BoilerInfo) {
+	if boilers == nil {
+		return
+	}
+	if boilers.Coffee != nil {
+		coffee = *boilers.Coffee
+	}
+	if boilers.Steam != nil {
+		steam = *boilers.Steam
+	}
+	return
+}
+
+func preExtractionMode(p *PreExtractionInfo) PreExtractionMode {
+	if p == nil {
+		return ""
+	}
+	return p.Mode
+}
@@ -0,0 +1,55 @@
+package lamarzocco
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResyncWhileReadingStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/things":
+			w.Write([]byte(`[{"serialNumber":"GS012345","modelName":"GS3"}]`))
+		case "/things/GS012345/dashboard":
+			w.Write([]byte(`{"widgets":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := New(
+		WithBaseURL(server.URL),
+		WithToken(TokenInfo{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour)}),
+	)
+	defer c.Close()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := c.Resync(ctx); err != nil {
+				t.Errorf("Resync() error = %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.GetStatus()
+			}
+		}()
+	}
+	wg.Wait()
+
+	status := c.GetStatus()
+	if status.Serial != "GS012345" || status.Model != "GS3" {
+		t.Errorf("status = %s %s, want GS012345 GS3", status.Serial, status.Model)
+	}
+}
@@ -0,0 +1,158 @@
+package lamarzocco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy retries cloud requests after transient failures: server errors
+// (5xx), timeouts and dropped connections. Commands are only retried if they
+// never reached the cloud, a lost response does not tell whether they ran.
+type RetryPolicy struct {
+	Attempts  int           // Total attempts, 1 disables retries
+	BaseDelay time.Duration // Delay before the second attempt, doubled after each one
+	MaxDelay  time.Duration
+	Jitter    float64 // Random share of each delay (0 to 1), spreads out retries of several clients
+	Commands  bool    // Retry commands after any transient failure, they may run twice
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  3,
+	BaseDelay: 500 * time.Millisecond,
+	MaxDelay:  10 * time.Second,
+	Jitter:    0.2,
+}
+
+// WithRetryPolicy overrides DefaultRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		if policy.MaxDelay <= 0 {
+			policy.MaxDelay = DefaultRetryPolicy.MaxDelay
+		}
+		c.retry = policy
+	}
+}
+
+// delay returns the wait before the attempt following the given one
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// transientFailure reports whether a request may succeed when repeated
+func transientFailure(resp *http.Response, err error) bool {
+	if err == nil {
+		return resp.StatusCode >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// undelivered reports whether a failed request never reached the cloud: the
+// connection could not be set up, or the cloud answered 503 without handling it
+func undelivered(resp *http.Response, err error) bool {
+	if err == nil {
+		return resp.StatusCode == http.StatusServiceUnavailable
+	}
+
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.As(err, &dnsErr) ||
+		errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryable reports whether a failed request is sent again. Requests other
+// than GET are only repeated if they never arrived, unless the retry policy
+// opts in to retrying commands.
+func (c *Client) retryable(method string, resp *http.Response, err error) bool {
+	if !transientFailure(resp, err) {
+		return false
+	}
+	return method == http.MethodGet || c.retry.Commands || undelivered(resp, err)
+}
+
+// checkWritable rejects requests other than GET of a read-only client
+func (c *Client) checkWritable(method, url string) error {
+	if c.readOnly && method != http.MethodGet {
+		return c.redactError(fmt.Errorf("%s %s: %w", method, url, ErrReadOnly))
+	}
+	return nil
+}
+
+// doAuthenticatedRequest sends a request to the cloud, retrying transient
+// failures according to the retry policy, see retryable. Requests fail with ErrCircuitOpen
+// while the circuit breaker is open, a cancelled ctx is not retried.
+func (c *Client) doAuthenticatedRequest(ctx context.Context, method, url string, body interface{}) (*http.Response, error) {
+	if err := c.checkWritable(method, url); err != nil {
+		return nil, err
+	}
+	if err := c.breaker.allow(c.clock.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTransient, err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.doAuthenticatedRequestWithRetry(ctx, method, url, body, true)
+		if err != nil && ctx.Err() != nil {
+			// Says nothing about the cloud
+			c.breaker.release()
+			return nil, err
+		}
+		if attempt >= c.retry.Attempts || !c.retryable(method, resp, err) {
+			c.recordCloudResult(transientFailure(resp, err))
+			return resp, c.redactError(transient(err))
+		}
+
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			resp.Body.Close()
+		}
+		delay := c.retry.delay(attempt)
+		c.log.Debug("Retrying cloud request", "method", method, "url", url, "attempt", attempt, "reason", reason, "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			c.breaker.release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) recordCloudResult(failed bool) {
+	if !c.breaker.record(failed, c.clock.Now()) {
+		return
+	}
+
+	open := c.breaker.isOpen()
+	if open {
+		c.log.Warn("Cloud unavailable, suspending requests", "failures", c.breaker.policy.Failures)
+	} else {
+		c.log.Info("Cloud available again, resuming requests")
+	}
+	if c.onCircuit != nil {
+		c.onCircuit(open)
+	}
+}
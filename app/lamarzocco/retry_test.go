@@ -0,0 +1,57 @@
+package lamarzocco
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		status   int
+		commands bool
+		want     int32
+	}{
+		{"poll after server error", http.MethodGet, http.StatusBadGateway, false, 3},
+		{"command after server error", http.MethodPost, http.StatusBadGateway, false, 1},
+		{"command never handled", http.MethodPost, http.StatusServiceUnavailable, false, 3},
+		{"command retries opted in", http.MethodPost, http.StatusBadGateway, true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			c := New(
+				WithBaseURL(server.URL),
+				WithToken(TokenInfo{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour)}),
+				WithRetryPolicy(RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, Commands: tt.commands}),
+			)
+			defer c.Close()
+
+			resp, err := c.doAuthenticatedRequest(context.Background(), tt.method, server.URL+"/things/GS012345/command", nil)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if n := requests.Load(); n != tt.want {
+				t.Errorf("requests = %d, want %d", n, tt.want)
+			}
+		})
+	}
+
+	// A refused connection never reached the cloud
+	if !undelivered(nil, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}) {
+		t.Error("undelivered(refused) = false, want true")
+	}
+}
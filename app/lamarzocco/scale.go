@@ -0,0 +1,139 @@
+package lamarzocco
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// BrewPollInterval is how often the dashboard is polled during a brew with a
+// connected scale while the stream is down, for live weight readings. The
+// polls count against the poll budget of the account.
+const BrewPollInterval = 2 * time.Second
+
+// ScaleReading is a weight the brew-by-weight scale reported
+type ScaleReading struct {
+	Weight  float64   `json:"weight"` // Grams on the scale
+	Brewing bool      `json:"brewing"`
+	Elapsed float64   `json:"elapsed,omitempty"` // Seconds since the brew started
+	Time    time.Time `json:"time"`
+}
+
+// SetScaleWeightCallback registers a callback invoked whenever the weight on
+// the scale changes
+func (c *Client) SetScaleWeightCallback(callback func(ScaleReading)) {
+	c.onScaleWeight = callback
+}
+
+func (c *Client) notifyScaleWeight(weight float64, brewingSince time.Time) {
+	if c.onScaleWeight == nil {
+		return
+	}
+	now := c.clock.Now()
+	reading := ScaleReading{Weight: weight, Brewing: !brewingSince.IsZero(), Time: now}
+	if reading.Brewing {
+		reading.Elapsed = RoundTenth(now.Sub(brewingSince).Seconds())
+	}
+	c.onScaleWeight(reading)
+}
+
+// liveWeightWanted reports whether a brew runs with a connected scale, whose
+// weight is worth polling for
+func (c *Client) liveWeightWanted() bool {
+	c.modeLock.RLock()
+	defer c.modeLock.RUnlock()
+	return !c.brewingSince.IsZero() && c.scale != nil && c.scale.Connected
+}
+
+// ScaleCommand pairs, unpairs or renames the brew-by-weight scale, e.g.
+// {"pair": "AA:BB:CC:DD:EE:FF", "name": "Kitchen"}, {"unpair": true} or
+// {"name": "Kitchen"}
+type ScaleCommand struct {
+	Pair   string `json:"pair,omitempty"` // Bluetooth address of the scale to pair
+	Unpair bool   `json:"unpair,omitempty"`
+	Name   string `json:"name,omitempty"` // Name of the paired scale, or of the one to pair
+}
+
+// Validate checks the values without contacting the machine
+func (s *ScaleCommand) Validate() error {
+	switch {
+	case s.Pair != "" && s.Unpair:
+		return fmt.Errorf("scale pair and unpair cannot be combined")
+	case s.Unpair && s.Name != "":
+		return fmt.Errorf("scale unpair and name cannot be combined")
+	case s.Pair == "" && !s.Unpair && s.Name == "":
+		return fmt.Errorf("scale requires pair, unpair or name")
+	case s.Pair != "":
+		if _, err := net.ParseMAC(s.Pair); err != nil {
+			return fmt.Errorf("invalid scale address %q: %w", s.Pair, err)
+		}
+	}
+	return nil
+}
+
+// PairScale pairs the scale with the Bluetooth address, name is optional
+func (c *Client) PairScale(ctx context.Context, address, name string) error {
+	if _, err := net.ParseMAC(address); err != nil {
+		return fmt.Errorf("invalid scale address %q: %w", address, err)
+	}
+	payload := map[string]interface{}{"mac": strings.ToUpper(address)}
+	if name != "" {
+		payload["name"] = name
+	}
+	return c.scaleCommand(ctx, "CoffeeMachineBluetoothScaleConnect", payload, func(scale *ScaleInfo) *ScaleInfo {
+		return &ScaleInfo{Name: name, Address: strings.ToUpper(address)}
+	})
+}
+
+// UnpairScale removes the paired scale
+func (c *Client) UnpairScale(ctx context.Context) error {
+	return c.scaleCommand(ctx, "CoffeeMachineBluetoothScaleDisconnect", map[string]interface{}{}, func(*ScaleInfo) *ScaleInfo {
+		return nil
+	})
+}
+
+// RenameScale changes the name of the paired scale
+func (c *Client) RenameScale(ctx context.Context, name string) error {
+	if name == "" {
+		return fmt.Errorf("scale name must not be empty")
+	}
+	return c.scaleCommand(ctx, "CoffeeMachineBluetoothScaleRename", map[string]interface{}{"name": name}, func(scale *ScaleInfo) *ScaleInfo {
+		if scale == nil {
+			return nil
+		}
+		renamed := *scale
+		renamed.Name = name
+		return &renamed
+	})
+}
+
+// scaleCommand sends a scale command and applies update to the scale state
+func (c *Client) scaleCommand(ctx context.Context, command string, payload map[string]interface{}, update func(*ScaleInfo) *ScaleInfo) error {
+	if err := requireCapability(c.Capabilities().ScaleSupport, "scale"); err != nil {
+		return err
+	}
+
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := c.postCommand(ctx, command, payload); err != nil {
+		return fmt.Errorf("failed to change scale: %w", err)
+	}
+
+	c.modeLock.Lock()
+	c.scale = update(c.scale)
+	if c.scale == nil {
+		c.scaleWeight = nil
+	}
+	c.modeLock.Unlock()
+
+	c.notifyStatusChange()
+
+	c.log.Info("Scale changed successfully", "command", command)
+	return nil
+}
@@ -0,0 +1,213 @@
+package lamarzocco
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var weekdays = map[string]bool{
+	"Monday": true, "Tuesday": true, "Wednesday": true, "Thursday": true,
+	"Friday": true, "Saturday": true, "Sunday": true,
+}
+
+// WakeUpSchedule powers the machine on and off on the given weekdays
+type WakeUpSchedule struct {
+	ID          string   `json:"id,omitempty"` // Assigned when empty
+	Enabled     bool     `json:"enabled"`
+	On          string   `json:"on"`   // Power-on time "HH:MM"
+	Off         string   `json:"off"`  // Auto-off time "HH:MM"
+	Days        []string `json:"days"` // Monday to Sunday
+	SteamBoiler bool     `json:"steamBoiler"`
+}
+
+// Validate checks the values without contacting the machine
+func (s *WakeUpSchedule) Validate() error {
+	on, err := minutesOfDay(s.On)
+	if err != nil {
+		return fmt.Errorf("invalid on time: %w", err)
+	}
+	off, err := minutesOfDay(s.Off)
+	if err != nil {
+		return fmt.Errorf("invalid off time: %w", err)
+	}
+	if on == off {
+		return fmt.Errorf("on and off time must differ")
+	}
+	if len(s.Days) == 0 {
+		return fmt.Errorf("at least one day is required")
+	}
+	for _, day := range s.Days {
+		if !weekdays[day] {
+			return fmt.Errorf("invalid day %q, must be Monday to Sunday", day)
+		}
+	}
+	return nil
+}
+
+// SmartStandby switches the machine off after a period without use
+type SmartStandby struct {
+	Enabled bool   `json:"enabled"`
+	Minutes int    `json:"minutes"`
+	After   string `json:"after,omitempty"` // PowerOn or LastBrewing
+}
+
+// MachineSchedule is the schedule stored on the machine, it applies even
+// while the gateway is offline
+type MachineSchedule struct {
+	WakeUps      []WakeUpSchedule `json:"wakeUps"`
+	SmartStandby *SmartStandby    `json:"smartStandby,omitempty"`
+}
+
+// SetScheduleCallback is called whenever the machine schedule was fetched or changed
+func (c *Client) SetScheduleCallback(callback func(MachineSchedule)) {
+	c.onSchedule = callback
+}
+
+// FetchSchedule reads the weekly wake-up schedule from the machine
+func (c *Client) FetchSchedule(ctx context.Context) (MachineSchedule, error) {
+	if err := requireCapability(c.Capabilities().WakeUpSchedule, "wake-up schedule"); err != nil {
+		return MachineSchedule{}, err
+	}
+
+	url := fmt.Sprintf("%s/things/%s/scheduling", c.baseURL, c.machineSerial())
+	resp, err := c.doAuthenticatedRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return MachineSchedule{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return MachineSchedule{}, &StatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("failed to fetch schedule: %d - %s", resp.StatusCode, string(body))}
+	}
+
+	var response schedulingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return MachineSchedule{}, fmt.Errorf("failed to decode schedule response: %w", err)
+	}
+
+	schedule := response.toSchedule()
+	if c.onSchedule != nil {
+		c.onSchedule(schedule)
+	}
+	return schedule, nil
+}
+
+// SetWakeUpSchedule creates or, if the ID exists, replaces a wake-up schedule
+// and returns the updated machine schedule
+func (c *Client) SetWakeUpSchedule(ctx context.Context, schedule WakeUpSchedule) (MachineSchedule, error) {
+	if err := requireCapability(c.Capabilities().WakeUpSchedule, "wake-up schedule"); err != nil {
+		return MachineSchedule{}, err
+	}
+	if err := schedule.Validate(); err != nil {
+		return MachineSchedule{}, err
+	}
+	if schedule.ID == "" {
+		schedule.ID = uuid.New().String()
+	}
+
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return MachineSchedule{}, err
+	}
+	defer done()
+
+	on, _ := minutesOfDay(schedule.On)
+	off, _ := minutesOfDay(schedule.Off)
+	payload := recurringSchedule{
+		ID:             schedule.ID,
+		Enabled:        schedule.Enabled,
+		OnTimeMinutes:  on,
+		OffTimeMinutes: off,
+		SteamBoiler:    schedule.SteamBoiler,
+		Days:           schedule.Days,
+	}
+
+	if err := c.postCommand(ctx, "CoffeeMachineSetWakeUpSchedule", payload); err != nil {
+		return MachineSchedule{}, err
+	}
+	c.log.Info("Wake-up schedule set successfully", "id", schedule.ID, "on", schedule.On, "off", schedule.Off)
+
+	return c.FetchSchedule(ctx)
+}
+
+// DeleteWakeUpSchedule removes a wake-up schedule and returns the updated machine schedule
+func (c *Client) DeleteWakeUpSchedule(ctx context.Context, id string) (MachineSchedule, error) {
+	if err := requireCapability(c.Capabilities().WakeUpSchedule, "wake-up schedule"); err != nil {
+		return MachineSchedule{}, err
+	}
+	if id == "" {
+		return MachineSchedule{}, fmt.Errorf("schedule id is required")
+	}
+
+	done, err := c.enqueue(ctx)
+	if err != nil {
+		return MachineSchedule{}, err
+	}
+	defer done()
+
+	if err := c.postCommand(ctx, "CoffeeMachineDeleteWakeUpSchedule", map[string]string{"id": id}); err != nil {
+		return MachineSchedule{}, err
+	}
+	c.log.Info("Wake-up schedule deleted successfully", "id", id)
+
+	return c.FetchSchedule(ctx)
+}
+
+type recurringSchedule struct {
+	ID             string   `json:"id"`
+	Enabled        bool     `json:"enabled"`
+	OnTimeMinutes  int      `json:"onTimeMinutes"`
+	OffTimeMinutes int      `json:"offTimeMinutes"`
+	SteamBoiler    bool     `json:"steamBoiler"`
+	Days           []string `json:"days"`
+}
+
+type schedulingResponse struct {
+	SmartWakeUpSleep *struct {
+		SmartStandByEnabled bool   `json:"smartStandByEnabled"`
+		SmartStandByMinutes int    `json:"smartStandByMinutes"`
+		SmartStandByAfter   string `json:"smartStandByAfter"`
+	} `json:"smartWakeUpSleep"`
+	RecurringSchedules []recurringSchedule `json:"recurringSchedules"`
+}
+
+func (r schedulingResponse) toSchedule() MachineSchedule {
+	schedule := MachineSchedule{WakeUps: []WakeUpSchedule{}}
+	for _, s := range r.RecurringSchedules {
+		schedule.WakeUps = append(schedule.WakeUps, WakeUpSchedule{
+			ID:          s.ID,
+			Enabled:     s.Enabled,
+			On:          formatMinutes(s.OnTimeMinutes),
+			Off:         formatMinutes(s.OffTimeMinutes),
+			Days:        s.Days,
+			SteamBoiler: s.SteamBoiler,
+		})
+	}
+	if standby := r.SmartWakeUpSleep; standby != nil {
+		schedule.SmartStandby = &SmartStandby{
+			Enabled: standby.SmartStandByEnabled,
+			Minutes: standby.SmartStandByMinutes,
+			After:   standby.SmartStandByAfter,
+		}
+	}
+	return schedule
+}
+
+func minutesOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func formatMinutes(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60%24, minutes%60)
+}
@@ -0,0 +1,125 @@
+package lamarzocco
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSharedSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer shared" {
+			http.Error(w, "unexpected token", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/things":
+			w.Write([]byte(`[{"serialNumber":"GS1","modelName":"GS3"},{"serialNumber":"MR2","modelName":"Micra"}]`))
+		default:
+			w.Write([]byte(`{"widgets":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	first := New(
+		WithBaseURL(server.URL),
+		WithCredentials("user", "secret"),
+		WithToken(TokenInfo{AccessToken: "shared", ExpiresAt: time.Now().Add(time.Hour)}),
+	)
+	defer first.Close()
+	second := New(WithBaseURL(server.URL), WithSharedSession(first), WithSerial("MR2"))
+	defer second.Close()
+
+	if err := second.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if status := second.GetStatus(); status.Serial != "MR2" || !status.Connected {
+		t.Errorf("status = %s connected %v, want MR2 connected", status.Serial, status.Connected)
+	}
+	if second.username != "user" {
+		t.Errorf("username = %q, want the shared account", second.username)
+	}
+
+	// A token refreshed by one client is used by the other
+	first.tokenLock.Lock()
+	first.token = &TokenInfo{AccessToken: "refreshed", ExpiresAt: time.Now().Add(time.Hour)}
+	first.tokenLock.Unlock()
+	second.tokenLock.RLock()
+	token := second.token.AccessToken
+	second.tokenLock.RUnlock()
+	if token != "refreshed" {
+		t.Errorf("token = %q, want the refreshed one", token)
+	}
+}
+
+func TestSharedSignIn(t *testing.T) {
+	var signIns, refreshes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/signin":
+			signIns.Add(1)
+			http.Error(w, "locked", http.StatusUnauthorized)
+		case "/auth/refreshtoken":
+			refreshes.Add(1)
+			time.Sleep(50 * time.Millisecond)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"accessToken":"refreshed","refreshToken":"next"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	key, err := GenerateInstallationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := New(
+		WithBaseURL(server.URL),
+		WithCredentials("user", "secret"),
+		WithInstallationKey(key),
+		WithToken(TokenInfo{AccessToken: "expiring", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Minute)}),
+	)
+	defer first.Close()
+	second := New(WithBaseURL(server.URL), WithSharedSession(first))
+	defer second.Close()
+
+	// Both clients need a new token, only one refreshes it
+	var wg sync.WaitGroup
+	for _, c := range []*Client{first, second, first, second} {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			if err := c.ensureValidToken(context.Background()); err != nil {
+				t.Errorf("ensureValidToken() error = %v", err)
+			}
+		}(c)
+	}
+	wg.Wait()
+	if n := refreshes.Load(); n != 1 {
+		t.Errorf("refreshes = %d, want 1", n)
+	}
+	if token := second.currentToken(); token.AccessToken != "refreshed" {
+		t.Errorf("token = %q, want the refreshed one", token.AccessToken)
+	}
+
+	// A sign-in rejected for one client holds back the others
+	first.tokenLock.Lock()
+	first.token = nil
+	first.tokenLock.Unlock()
+	if err := first.ensureValidToken(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("ensureValidToken() error = %v, want ErrUnauthorized", err)
+	}
+	if err := second.ensureValidToken(context.Background()); !errors.Is(err, ErrAuthSuspended) {
+		t.Errorf("ensureValidToken() error = %v, want ErrAuthSuspended", err)
+	}
+	if n := signIns.Load(); n != 1 {
+		t.Errorf("sign-ins = %d, want 1", n)
+	}
+}
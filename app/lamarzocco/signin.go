@@ -0,0 +1,52 @@
+package lamarzocco
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// signInFlight lets the clients of a session share a sign-in or token
+// refresh instead of each one replacing the token of the others
+type signInFlight struct {
+	mu   sync.Mutex
+	call *signInCall // Running sign-in, nil if none
+}
+
+type signInCall struct {
+	done chan struct{}
+	err  error
+}
+
+// shareSignIn runs signIn unless one is already running for the session, in
+// which case it waits for that result. A sign-in cancelled with the context of
+// the client running it is started again by the waiting clients.
+func (c *Client) shareSignIn(ctx context.Context, signIn func(context.Context) error) error {
+	f := &c.session.signIns
+	for {
+		f.mu.Lock()
+		call := f.call
+		if call == nil {
+			call = &signInCall{done: make(chan struct{})}
+			f.call = call
+			f.mu.Unlock()
+
+			call.err = signIn(ctx)
+			f.mu.Lock()
+			f.call = nil
+			f.mu.Unlock()
+			close(call.done)
+			return call.err
+		}
+		f.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !errors.Is(call.err, context.Canceled) && !errors.Is(call.err, context.DeadlineExceeded) {
+			return call.err
+		}
+	}
+}
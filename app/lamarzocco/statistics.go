@@ -0,0 +1,171 @@
+package lamarzocco
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Statistics are the lifetime counters reported by the machine
+type Statistics struct {
+	TotalCoffees   int            `json:"totalCoffees"`
+	TotalFlushes   int            `json:"totalFlushes"`
+	Backflushes    int            `json:"backflushes,omitempty"`
+	CoffeesPerDose map[string]int `json:"coffeesPerDose,omitempty"` // Dose1/Dose2, only if the cloud reports them
+	Keys           []KeyCounter   `json:"keys,omitempty"`           // Multi-key machines only
+	LastShot       *Shot          `json:"lastShot,omitempty"`       // Most recent shot, only if the cloud reports it
+	FetchedAt      time.Time      `json:"fetchedAt"`
+}
+
+// Shot is a finished shot as recorded by the machine
+type Shot struct {
+	Time     time.Time `json:"time"`
+	Duration float64   `json:"duration"`         // Extraction time in seconds
+	Mode     DoseMode  `json:"mode,omitempty"`   // Dose mode of brew-by-weight machines
+	Dose     string    `json:"dose,omitempty"`   // Dose1/Dose2, the key of the dose used
+	Weight   float64   `json:"weight,omitempty"` // Final weight in grams (brew-by-weight)
+}
+
+// KeyCounter counts the shots and flushes started with one group key
+type KeyCounter struct {
+	Key     string `json:"key"` // e.g. Key1 (single), Key2 (double), Continuous
+	Coffees int    `json:"coffees"`
+	Flushes int    `json:"flushes"`
+}
+
+// GetStatistics fetches the coffee and flush counters from the cloud
+func (c *Client) GetStatistics(ctx context.Context) (Statistics, error) {
+	if err := requireCapability(c.Capabilities().Statistics, "statistics"); err != nil {
+		return Statistics{}, err
+	}
+
+	url := fmt.Sprintf("%s/things/%s/stats", c.baseURL, c.machineSerial())
+	resp, err := c.doAuthenticatedRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return Statistics{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Statistics{}, fmt.Errorf("failed to read statistics response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Statistics{}, &StatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("failed to fetch statistics: %d - %s", resp.StatusCode, string(body))}
+	}
+
+	stats, err := parseStatistics(body)
+	if err != nil {
+		return Statistics{}, err
+	}
+	stats.FetchedAt = c.clock.Now()
+	return stats, nil
+}
+
+// counterOutput is the output of the COFFEE_AND_FLUSH_COUNTER widget
+type counterOutput struct {
+	TotalCoffee    float64            `json:"totalCoffee"`
+	TotalFlush     float64            `json:"totalFlush"`
+	TotalBackFlush float64            `json:"totalBackFlush"`
+	Doses          map[string]float64 `json:"doses"` // Keyed DoseA/DoseB like the other cloud settings
+	Keys           []struct {
+		Key     string  `json:"key"`
+		Coffees float64 `json:"coffees"`
+		Flushes float64 `json:"flushes"`
+	} `json:"keys"` // e.g. [{"key": "Key1", "coffees": 812, "flushes": 40}]
+}
+
+// lastCoffeeOutput is the output of the LAST_COFFEE widget, newest shot first
+type lastCoffeeOutput struct {
+	LastCoffees []struct {
+		Time              float64  `json:"time"` // End of the shot (ms)
+		ExtractionSeconds float64  `json:"extractionSeconds"`
+		DoseMode          string   `json:"doseMode"`
+		DoseIndex         string   `json:"doseIndex"`
+		DoseValue         *float64 `json:"doseValue"`
+	} `json:"lastCoffees"`
+}
+
+func parseLastShot(output lastCoffeeOutput) *Shot {
+	var last *Shot
+	for _, coffee := range output.LastCoffees {
+		if coffee.Time <= 0 {
+			continue
+		}
+		shot := &Shot{
+			Time:     time.UnixMilli(int64(coffee.Time)),
+			Duration: coffee.ExtractionSeconds,
+			Dose:     coffee.DoseIndex,
+		}
+		switch coffee.DoseMode {
+		case "Dose1", "Dose2", "Continuous":
+			shot.Mode = ParseDoseMode(coffee.DoseMode)
+		}
+		switch coffee.DoseIndex {
+		case "DoseA":
+			shot.Dose = "Dose1"
+		case "DoseB":
+			shot.Dose = "Dose2"
+		}
+		if coffee.DoseValue != nil {
+			shot.Weight = *coffee.DoseValue
+		}
+		if last == nil || shot.Time.After(last.Time) {
+			last = shot
+		}
+	}
+	return last
+}
+
+func parseStatistics(body []byte) (Statistics, error) {
+	_, widgets, err := decodeWidgets(body)
+	if err != nil {
+		return Statistics{}, fmt.Errorf("failed to decode statistics response: %w", err)
+	}
+
+	var stats Statistics
+	for _, widget := range widgets {
+		if widget.Code == "LAST_COFFEE" {
+			var output lastCoffeeOutput
+			if err := json.Unmarshal(widget.Output, &output); err == nil {
+				stats.LastShot = parseLastShot(output)
+			}
+			continue
+		}
+		if widget.Code != "COFFEE_AND_FLUSH_COUNTER" {
+			continue
+		}
+		var output counterOutput
+		if err := json.Unmarshal(widget.Output, &output); err != nil {
+			continue
+		}
+
+		stats.TotalCoffees = int(output.TotalCoffee)
+		stats.TotalFlushes = int(output.TotalFlush)
+		stats.Backflushes = int(output.TotalBackFlush)
+
+		if output.Doses != nil {
+			stats.CoffeesPerDose = make(map[string]int, len(output.Doses))
+			for key, value := range output.Doses {
+				switch key {
+				case "DoseA":
+					key = "Dose1"
+				case "DoseB":
+					key = "Dose2"
+				}
+				stats.CoffeesPerDose[key] = int(value)
+			}
+		}
+
+		for _, k := range output.Keys {
+			if k.Key == "" {
+				continue
+			}
+			stats.Keys = append(stats.Keys, KeyCounter{Key: k.Key, Coffees: int(k.Coffees), Flushes: int(k.Flushes)})
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,27 @@
+package lamarzocco
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStatisticsLastShot(t *testing.T) {
+	stats, err := parseStatistics([]byte(`{"widgets":[
+		{"code":"COFFEE_AND_FLUSH_COUNTER","output":{"totalCoffee":1520,"totalFlush":310}},
+		{"code":"LAST_COFFEE","output":{"lastCoffees":[
+			{"time":1760000000000,"extractionSeconds":27.4,"doseMode":"Dose1","doseIndex":"DoseA","doseValue":36.2},
+			{"time":1759990000000,"extractionSeconds":30.1,"doseMode":"Continuous","doseIndex":"Continuous","doseValue":null}
+		]}}
+	]}`))
+	if err != nil {
+		t.Fatalf("parseStatistics() error = %v", err)
+	}
+	if stats.TotalCoffees != 1520 {
+		t.Errorf("TotalCoffees = %d, want 1520", stats.TotalCoffees)
+	}
+
+	want := Shot{Time: time.UnixMilli(1760000000000), Duration: 27.4, Mode: DoseModeDose1, Dose: "Dose1", Weight: 36.2}
+	if stats.LastShot == nil || *stats.LastShot != want {
+		t.Errorf("LastShot = %+v, want %+v", stats.LastShot, want)
+	}
+}
@@ -0,0 +1,184 @@
+package lamarzocco
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CredentialsVersion is the format of stored credentials. Credentials of
+// another format are discarded and the client signs in as a new installation.
+const CredentialsVersion = 1
+
+// Credentials is the authentication state of a client
+type Credentials struct {
+	Version        int       `json:"version,omitempty"` // Format, see CredentialsVersion; 0 before it was stored
+	Account        string    `json:"account,omitempty"` // Hash of the username the credentials belong to
+	InstallationID string    `json:"installationId"`
+	Secret         []byte    `json:"secret"`
+	PrivateKey     []byte    `json:"privateKey"` // PKCS#8 DER
+	AccessToken    string    `json:"accessToken,omitempty"`
+	RefreshToken   string    `json:"refreshToken,omitempty"`
+	ExpiresAt      time.Time `json:"expiresAt,omitempty"`
+	Checksum       string    `json:"checksum,omitempty"` // Over the other fields, detects edited or corrupted state
+}
+
+// StateStore persists credentials, so the client is not registered as a new
+// installation on every start
+type StateStore interface {
+	// LoadCredentials returns nil if no credentials are stored
+	LoadCredentials() (*Credentials, error)
+	SaveCredentials(credentials *Credentials) error
+}
+
+// accountHash identifies the account without storing its username
+func accountHash(username string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(username))))
+	return hex.EncodeToString(sum[:])
+}
+
+func (cr Credentials) checksum() string {
+	cr.Checksum = ""
+	data, err := json.Marshal(cr)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// validate rejects credentials of another format, with a wrong checksum or of
+// another account than username. Credentials stored before the format was
+// versioned (version 0) are accepted.
+func (cr *Credentials) validate(username string) error {
+	if cr.Version == 0 {
+		return nil
+	}
+	if cr.Version != CredentialsVersion {
+		return fmt.Errorf("stored credentials have format %d, expected %d", cr.Version, CredentialsVersion)
+	}
+	if cr.Checksum != cr.checksum() {
+		return fmt.Errorf("stored credentials are corrupted (checksum mismatch)")
+	}
+	if username != "" && cr.Account != accountHash(username) {
+		return fmt.Errorf("stored credentials belong to another account")
+	}
+	return nil
+}
+
+func newCredentials(key *InstallationKey, token *TokenInfo, username string) (*Credentials, error) {
+	privateKey, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	credentials := &Credentials{
+		Version:        CredentialsVersion,
+		InstallationID: key.InstallationID,
+		Secret:         key.Secret,
+		PrivateKey:     privateKey,
+	}
+	if token != nil {
+		credentials.AccessToken = token.AccessToken
+		credentials.RefreshToken = token.RefreshToken
+		credentials.ExpiresAt = token.ExpiresAt
+	}
+	if username != "" {
+		credentials.Account = accountHash(username)
+	}
+	credentials.Checksum = credentials.checksum()
+	return credentials, nil
+}
+
+func (cr *Credentials) installationKey() (*InstallationKey, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(cr.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	privateKey, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unexpected private key type %T", parsed)
+	}
+
+	return &InstallationKey{
+		InstallationID: cr.InstallationID,
+		Secret:         cr.Secret,
+		PrivateKey:     privateKey,
+	}, nil
+}
+
+func (cr *Credentials) token() *TokenInfo {
+	if cr.AccessToken == "" {
+		return nil
+	}
+	return &TokenInfo{
+		AccessToken:  cr.AccessToken,
+		RefreshToken: cr.RefreshToken,
+		ExpiresAt:    cr.ExpiresAt,
+	}
+}
+
+// loadCredentials restores the installation key and token from the state store
+func (c *Client) loadCredentials() error {
+	if c.stateStore == nil {
+		return nil
+	}
+
+	credentials, err := c.stateStore.LoadCredentials()
+	if err != nil {
+		return fmt.Errorf("failed to load credentials: %w", err)
+	}
+	if credentials == nil {
+		return nil
+	}
+	if err := credentials.validate(c.username); err != nil {
+		return err
+	}
+
+	key, err := credentials.installationKey()
+	if err != nil {
+		return err
+	}
+
+	c.keyLock.Lock()
+	c.installKey = key
+	c.keyLock.Unlock()
+
+	c.tokenLock.Lock()
+	c.token = credentials.token()
+	c.tokenLock.Unlock()
+
+	if credentials.Version == 0 {
+		// Store them in the current format
+		c.persistCredentials()
+	}
+	return nil
+}
+
+func (c *Client) saveCredentials() error {
+	if c.stateStore == nil {
+		return nil
+	}
+
+	c.keyLock.RLock()
+	key := c.installKey
+	c.keyLock.RUnlock()
+	if key == nil {
+		return nil
+	}
+
+	c.tokenLock.RLock()
+	token := c.token
+	c.tokenLock.RUnlock()
+
+	credentials, err := newCredentials(key, token, c.username)
+	if err != nil {
+		return err
+	}
+	return c.stateStore.SaveCredentials(credentials)
+}
@@ -0,0 +1,65 @@
+package lamarzocco
+
+import (
+	"testing"
+)
+
+type memoryStore struct {
+	credentials *Credentials
+}
+
+func (s *memoryStore) LoadCredentials() (*Credentials, error) {
+	return s.credentials, nil
+}
+
+func (s *memoryStore) SaveCredentials(credentials *Credentials) error {
+	s.credentials = credentials
+	return nil
+}
+
+func TestStoredCredentialsValidation(t *testing.T) {
+	key, err := GenerateInstallationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := newCredentials(key, &TokenInfo{AccessToken: "token"}, "Anna@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		modify   func(cr *Credentials)
+		wantErr  bool
+	}{
+		{"valid", "anna@example.com", func(cr *Credentials) {}, false},
+		{"legacy", "anna@example.com", func(cr *Credentials) { cr.Version, cr.Account, cr.Checksum = 0, "", "" }, false},
+		{"other account", "ben@example.com", func(cr *Credentials) {}, true},
+		{"newer format", "anna@example.com", func(cr *Credentials) { cr.Version = CredentialsVersion + 1 }, true},
+		{"corrupted", "anna@example.com", func(cr *Credentials) { cr.AccessToken = "edited" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credentials := *stored
+			tt.modify(&credentials)
+			store := &memoryStore{credentials: &credentials}
+			client := New(WithCredentials(tt.username, "secret"), WithStateStore(store))
+
+			err := client.loadCredentials()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if client.installKey == nil || client.installKey.InstallationID != key.InstallationID {
+				t.Errorf("installation = %+v, want the stored one", client.installKey)
+			}
+			// Legacy credentials are stored in the current format
+			if store.credentials.Version != CredentialsVersion || store.credentials.validate(tt.username) != nil {
+				t.Errorf("stored credentials = %+v, want the current format", store.credentials)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package lamarzocco
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamPingInterval   = 20 * time.Second
+	streamReadTimeout    = 60 * time.Second // No frame or pong within this time means the connection is dead
+	streamConnectTimeout = 30 * time.Second
+	minReconnectDelay    = time.Second
+	maxReconnectDelay    = 5 * time.Minute
+)
+
+// StreamInfo describes the cloud stream connection
+type StreamInfo struct {
+	Enabled        bool      `json:"enabled"`
+	Connected      bool      `json:"connected"`
+	ConnectedSince time.Time `json:"connectedSince,omitempty"`
+	Uptime         float64   `json:"uptime"` // Seconds since the current connection was established
+	Reconnects     int       `json:"reconnects"`
+	LastMessage    time.Time `json:"lastMessage,omitempty"`
+}
+
+type streamState struct {
+	enabled        bool
+	connectedSince time.Time
+	reconnects     int
+	lastMessage    time.Time
+	changed        chan struct{} // Wakes the polling loop when the connection comes up or drops
+	mu             sync.Mutex
+}
+
+// signalStreamChange lets the polling loop react without waiting for the next tick
+func (c *Client) signalStreamChange() {
+	select {
+	case c.stream.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Client) StreamInfo() StreamInfo {
+	c.stream.mu.Lock()
+	defer c.stream.mu.Unlock()
+
+	info := StreamInfo{
+		Enabled:        c.stream.enabled,
+		Connected:      !c.stream.connectedSince.IsZero(),
+		ConnectedSince: c.stream.connectedSince,
+		Reconnects:     c.stream.reconnects,
+		LastMessage:    c.stream.lastMessage,
+	}
+	if info.Connected {
+		info.Uptime = c.clock.Now().Sub(info.ConnectedSince).Seconds()
+	}
+	return info
+}
+
+// StreamConnected reports whether live updates are currently received
+func (c *Client) StreamConnected() bool {
+	c.stream.mu.Lock()
+	defer c.stream.mu.Unlock()
+	return !c.stream.connectedSince.IsZero()
+}
+
+// StartStreaming receives live dashboard updates over the cloud websocket
+// until ctx is done. Dropped connections are re-established with
+// exponential backoff. Connect must have been called before.
+func (c *Client) StartStreaming(ctx context.Context) {
+	c.stream.mu.Lock()
+	c.stream.enabled = true
+	c.stream.mu.Unlock()
+
+	delay := minReconnectDelay
+	for {
+		started := c.clock.Now()
+		err := c.runStream(ctx)
+
+		c.stream.mu.Lock()
+		wasConnected := !c.stream.connectedSince.IsZero()
+		c.stream.connectedSince = time.Time{}
+		c.stream.mu.Unlock()
+		c.streamUp.Set(false, c.clock.Now())
+		if wasConnected {
+			c.signalStreamChange()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		// A connection that was up for a while starts over with a short delay
+		if c.clock.Now().Sub(started) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+
+		c.log.Warn("Stream disconnected, reconnecting", "error", err, "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+
+		c.stream.mu.Lock()
+		c.stream.reconnects++
+		c.stream.mu.Unlock()
+	}
+}
+
+// streamURL derives the websocket endpoint from the API base URL
+func (c *Client) streamURL() (string, error) {
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	scheme := "wss"
+	if base.Scheme == "http" {
+		scheme = "ws"
+	}
+	return (&url.URL{Scheme: scheme, Host: base.Host, Path: "/ws/connect"}).String(), nil
+}
+
+func (c *Client) runStream(ctx context.Context) error {
+	if err := c.ensureValidToken(ctx); err != nil {
+		return err
+	}
+
+	endpoint, err := c.streamURL()
+	if err != nil {
+		return fmt.Errorf("invalid stream url: %w", err)
+	}
+
+	c.tokenLock.RLock()
+	accessToken := c.token.AccessToken
+	c.tokenLock.RUnlock()
+
+	header := http.Header{}
+	c.identify(header)
+	c.keyLock.RLock()
+	installKey := c.installKey
+	c.keyLock.RUnlock()
+	if installKey != nil {
+		if extraHeaders, err := installKey.GenerateExtraHeaders(); err == nil {
+			for key, value := range extraHeaders {
+				header.Set(key, value)
+			}
+		}
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: streamConnectTimeout,
+	}
+	conn, _, err := dialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	// Unblock the read loop when stopping
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	host, _ := url.Parse(endpoint)
+	if err := writeStompFrame(conn, "CONNECT", map[string]string{
+		"host":           host.Hostname(),
+		"accept-version": "1.2,1.1,1.0",
+		"heart-beat":     "0,0",
+		"Authorization":  "Bearer " + accessToken,
+	}); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(streamConnectTimeout))
+	frame, err := readStompFrame(conn)
+	if err != nil {
+		return err
+	}
+	if frame.command != "CONNECTED" {
+		return fmt.Errorf("unexpected %s frame: %s", frame.command, frame.body)
+	}
+
+	if err := writeStompFrame(conn, "SUBSCRIBE", map[string]string{
+		"destination":    fmt.Sprintf("/ws/sn/%s/dashboard", c.machineSerial()),
+		"ack":            "auto",
+		"id":             uuid.New().String(),
+		"content-length": "0",
+	}); err != nil {
+		return err
+	}
+
+	c.stream.mu.Lock()
+	c.stream.connectedSince = c.clock.Now()
+	c.stream.mu.Unlock()
+	c.streamUp.Set(true, c.clock.Now())
+	c.log.Info("Stream connected", "serial", c.machineSerial())
+	c.signalStreamChange()
+
+	// Pongs prove the connection is alive even if the machine is idle
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(streamReadTimeout))
+	})
+	go c.pingStream(conn, done)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(streamReadTimeout))
+		frame, err := readStompFrame(conn)
+		if err != nil {
+			return err
+		}
+
+		switch frame.command {
+		case "MESSAGE":
+			c.stream.mu.Lock()
+			c.stream.lastMessage = c.clock.Now()
+			c.stream.mu.Unlock()
+			c.applyStreamUpdate(frame.body)
+		case "ERROR":
+			return fmt.Errorf("stream error: %s %s", frame.headers["message"], frame.body)
+		}
+	}
+}
+
+func (c *Client) pingStream(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				conn.Close()
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// applyStreamUpdate merges the widgets of a stream message into the last
+// dashboard, so partial updates do not reset the other values
+func (c *Client) applyStreamUpdate(body []byte) {
+	c.modeLock.Lock()
+	merged, err := mergeDashboard(c.dashboard, body)
+	if err == nil {
+		c.dashboard = merged
+	}
+	c.modeLock.Unlock()
+
+	if err != nil {
+		c.log.Warn("Ignoring invalid stream message", "error", err)
+		return
+	}
+
+	c.log.Debug("Stream update", "body", string(body))
+	c.applyDashboard(merged)
+}
+
+func mergeDashboard(base, update []byte) ([]byte, error) {
+	var updated map[string]interface{}
+	if err := json.Unmarshal(update, &updated); err != nil {
+		return nil, err
+	}
+	if len(base) == 0 {
+		return update, nil
+	}
+
+	var current map[string]interface{}
+	if err := json.Unmarshal(base, &current); err != nil {
+		return update, nil
+	}
+
+	widgets, _ := current["widgets"].([]interface{})
+	index := make(map[string]int, len(widgets))
+	for i, w := range widgets {
+		if widget, ok := w.(map[string]interface{}); ok {
+			if code, ok := widget["code"].(string); ok {
+				index[code] = i
+			}
+		}
+	}
+
+	newWidgets, _ := updated["widgets"].([]interface{})
+	for _, w := range newWidgets {
+		widget, ok := w.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		code, _ := widget["code"].(string)
+		if i, ok := index[code]; ok {
+			widgets[i] = widget
+		} else {
+			index[code] = len(widgets)
+			widgets = append(widgets, widget)
+		}
+	}
+
+	for key, value := range updated {
+		if key != "widgets" {
+			current[key] = value
+		}
+	}
+	current["widgets"] = widgets
+
+	return json.Marshal(current)
+}
+
+type stompFrame struct {
+	command string
+	headers map[string]string
+	body    []byte
+}
+
+func writeStompFrame(conn *websocket.Conn, command string, headers map[string]string) error {
+	var buf bytes.Buffer
+	buf.WriteString(command)
+	buf.WriteByte('\n')
+	for key, value := range headers {
+		buf.WriteString(key)
+		buf.WriteByte(':')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("\n\x00")
+
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return conn.WriteMessage(websocket.TextMessage, buf.Bytes())
+}
+
+// readStompFrame reads the next frame, skipping heart-beats (empty lines)
+func readStompFrame(conn *websocket.Conn) (stompFrame, error) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return stompFrame{}, err
+		}
+
+		frame, err := parseStompFrame(data)
+		if errors.Is(err, errHeartbeat) {
+			continue
+		}
+		return frame, err
+	}
+}
+
+var errHeartbeat = errors.New("heart-beat")
+
+func parseStompFrame(data []byte) (stompFrame, error) {
+	text := strings.TrimLeft(string(data), "\r\n")
+	if text == "" || text == "\x00" {
+		return stompFrame{}, errHeartbeat
+	}
+
+	head, body, found := strings.Cut(text, "\n\n")
+	if !found {
+		return stompFrame{}, fmt.Errorf("invalid stomp frame")
+	}
+
+	lines := strings.Split(strings.ReplaceAll(head, "\r\n", "\n"), "\n")
+	frame := stompFrame{
+		command: lines[0],
+		headers: make(map[string]string, len(lines)-1),
+		body:    []byte(strings.TrimRight(body, "\x00\r\n")),
+	}
+	for _, line := range lines[1:] {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			frame.headers[key] = value
+		}
+	}
+	return frame, nil
+}
@@ -0,0 +1,60 @@
+package lamarzocco
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefreshThings(t *testing.T) {
+	var things atomic.Value
+	things.Store(`[{"serialNumber":"GS012345","modelName":"GS3"}]`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/things":
+			w.Write([]byte(things.Load().(string)))
+		case "/things/GS012345/dashboard":
+			w.Write([]byte(`{"widgets":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := New(
+		WithBaseURL(server.URL),
+		WithToken(TokenInfo{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour)}),
+	)
+	defer c.Close()
+
+	ctx := context.Background()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second machine was bought, the first one sold
+	things.Store(`[{"serialNumber":"MR054321","modelName":"Linea Micra"}]`)
+	got, err := c.RefreshThings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].SerialNumber != "MR054321" || len(c.Things()) != 1 {
+		t.Errorf("RefreshThings() = %+v, want MR054321", got)
+	}
+	if serial := c.GetStatus().Serial; serial != "GS012345" {
+		t.Errorf("served machine = %s, want it unchanged", serial)
+	}
+
+	// An empty answer keeps the known machines
+	things.Store(`[]`)
+	if _, err := c.RefreshThings(ctx); err == nil {
+		t.Error("RefreshThings() without machines succeeded")
+	}
+	if len(c.Things()) != 1 {
+		t.Errorf("Things() = %+v after a failed refresh", c.Things())
+	}
+}
@@ -0,0 +1,250 @@
+package lamarzocco
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport names
+const (
+	TransportCloud = "cloud"
+	TransportLocal = "local"
+	TransportBLE   = "ble"
+)
+
+const (
+	// transportRetryAfter keeps a failed transport out of the rotation before
+	// a higher priority one is tried again
+	transportRetryAfter = time.Minute
+	localRequestTimeout = 5 * time.Second
+)
+
+// ErrTransportUnavailable marks errors after which the next transport is tried.
+// Commands the machine rejected are returned as they are.
+var ErrTransportUnavailable = errors.New("transport unavailable")
+
+// Transport is a path to the machine. Dashboards are in the cloud format.
+type Transport interface {
+	Name() string
+	Dashboard(ctx context.Context) ([]byte, error)
+	Command(ctx context.Context, command string, payload interface{}) error
+}
+
+// TransportSpec configures a transport, the order of the specs is the priority
+type TransportSpec struct {
+	Type  string // cloud or local
+	URL   string // Base URL of a local endpoint serving the cloud API format
+	Token string // Bearer token of the local endpoint
+}
+
+type transportState struct {
+	list     []Transport
+	active   string
+	failedAt map[Transport]time.Time
+	mu       sync.Mutex
+}
+
+// WithTransports sets the transports in priority order, the default is the cloud only
+func WithTransports(specs ...TransportSpec) Option {
+	return func(c *Client) {
+		var list []Transport
+		for _, spec := range specs {
+			switch spec.Type {
+			case TransportCloud:
+				list = append(list, &apiTransport{name: TransportCloud, client: c})
+			case TransportLocal:
+				list = append(list, &apiTransport{
+					name:       TransportLocal,
+					client:     c,
+					baseURL:    strings.TrimSuffix(spec.URL, "/"),
+					token:      spec.Token,
+					httpClient: &http.Client{Timeout: localRequestTimeout},
+				})
+			}
+			// Other types (e.g. ble) are rejected by the configuration
+		}
+		if len(list) > 0 {
+			c.transports.list = list
+		}
+	}
+}
+
+func defaultTransports(c *Client) []Transport {
+	return []Transport{&apiTransport{name: TransportCloud, client: c}}
+}
+
+// ActiveTransport returns the transport of the last successful request,
+// empty before the first one
+func (c *Client) ActiveTransport() string {
+	c.transports.mu.Lock()
+	defer c.transports.mu.Unlock()
+	return c.transports.active
+}
+
+// candidates returns the transports in priority order, recently failed ones
+// are skipped unless all of them failed
+func (c *Client) candidates() []Transport {
+	c.transports.mu.Lock()
+	defer c.transports.mu.Unlock()
+
+	now := c.clock.Now()
+	var list []Transport
+	for _, t := range c.transports.list {
+		if failedAt, ok := c.transports.failedAt[t]; ok && now.Sub(failedAt) < transportRetryAfter {
+			continue
+		}
+		list = append(list, t)
+	}
+	if len(list) == 0 {
+		return c.transports.list
+	}
+	return list
+}
+
+// viaTransport runs op on the first transport that is available. A cancelled
+// ctx ends the attempt without blaming the transport.
+func (c *Client) viaTransport(ctx context.Context, op func(Transport) error) error {
+	var errs []error
+	for _, t := range c.candidates() {
+		err := op(t)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+		unavailable := errors.Is(err, ErrTransportUnavailable)
+		if t.Name() == TransportCloud {
+			c.cloudUp.Set(!unavailable, c.clock.Now())
+		}
+		if err == nil {
+			c.transportSucceeded(t)
+			return nil
+		}
+		if !unavailable {
+			return err
+		}
+
+		c.log.Warn("Transport failed, trying the next one", "transport", t.Name(), "error", err)
+		c.transports.mu.Lock()
+		if c.transports.failedAt == nil {
+			c.transports.failedAt = make(map[Transport]time.Time)
+		}
+		c.transports.failedAt[t] = c.clock.Now()
+		c.transports.mu.Unlock()
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Client) transportSucceeded(t Transport) {
+	name := t.Name()
+	c.transports.mu.Lock()
+	delete(c.transports.failedAt, t)
+	previous := c.transports.active
+	c.transports.active = name
+	c.transports.mu.Unlock()
+
+	if previous != "" && previous != name {
+		c.log.Info("Switched transport", "from", previous, "to", name)
+		c.notifyStatusChange()
+	}
+}
+
+// apiTransport talks to an endpoint serving the cloud API, either the cloud
+// itself or a local one
+type apiTransport struct {
+	name       string
+	client     *Client
+	baseURL    string // Empty uses the cloud
+	token      string
+	httpClient *http.Client
+}
+
+func (t *apiTransport) Name() string {
+	return t.name
+}
+
+func (t *apiTransport) Dashboard(ctx context.Context) ([]byte, error) {
+	resp, err := t.do(ctx, "GET", fmt.Sprintf("/things/%s/dashboard", t.client.machineSerial()), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, t.statusError(resp.StatusCode, fmt.Sprintf("failed to fetch dashboard: %d - %s", resp.StatusCode, string(body)))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read dashboard response: %w", ErrTransportUnavailable, transient(err))
+	}
+	return body, nil
+}
+
+func (t *apiTransport) Command(ctx context.Context, command string, payload interface{}) error {
+	resp, err := t.do(ctx, "POST", fmt.Sprintf("/things/%s/command/%s", t.client.machineSerial(), command), payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return t.statusError(resp.StatusCode, fmt.Sprintf("command %s failed: %d - %s", command, resp.StatusCode, string(body)))
+	}
+	return nil
+}
+
+// statusError lets server errors fail over, the others are answers of the machine
+func (t *apiTransport) statusError(status int, message string) error {
+	err := &StatusError{StatusCode: status, Message: message}
+	if status >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: %w", ErrTransportUnavailable, err)
+	}
+	return err
+}
+
+func (t *apiTransport) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	if err := t.client.checkWritable(method, path); err != nil {
+		return nil, err
+	}
+	if t.baseURL == "" {
+		resp, err := t.client.doAuthenticatedRequest(ctx, method, t.client.baseURL+path, body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrTransportUnavailable, err)
+		}
+		return resp, nil
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, t.baseURL+path, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTransportUnavailable, transient(err))
+	}
+	return resp, nil
+}
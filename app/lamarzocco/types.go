@@ -1,6 +1,10 @@
 package lamarzocco
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 type DoseMode string
 
@@ -37,7 +41,8 @@ func ParseDoseMode(s string) DoseMode {
 }
 
 type DoseInfo struct {
-	Weight float64 `json:"weight"` // Weight in grams
+	Weight        float64 `json:"weight"`                  // Weight in grams
+	MachineWeight float64 `json:"machineWeight,omitempty"` // Calibrated weight configured on the machine (only if an offset is set)
 }
 
 type BoilerInfo struct {
@@ -45,6 +50,45 @@ type BoilerInfo struct {
 	RemainingSeconds int     `json:"remainingSeconds,omitempty"` // Seconds until ready (0 if ready)
 	Temperature      float64 `json:"temperature,omitempty"`      // Current target temperature (coffee)
 	Level            string  `json:"level,omitempty"`            // Target level (steam): Level1, Level2, etc.
+	Enabled          *bool   `json:"enabled,omitempty"`          // Whether the boiler heats (steam), unset if unknown
+}
+
+type SteamLevel string
+
+const (
+	SteamLevel1 SteamLevel = "Level1"
+	SteamLevel2 SteamLevel = "Level2"
+	SteamLevel3 SteamLevel = "Level3"
+)
+
+func (l SteamLevel) Valid() bool {
+	return l == SteamLevel1 || l == SteamLevel2 || l == SteamLevel3
+}
+
+// SteamLevelFromInt converts 1 to 3 into Level1 to Level3, other values are invalid
+func SteamLevelFromInt(level int) SteamLevel {
+	return SteamLevel(fmt.Sprintf("Level%d", level))
+}
+
+// UnmarshalJSON accepts the level name ("Level2") or its number (2), null
+// leaves the level unset
+func (l *SteamLevel) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var level int
+	if err := json.Unmarshal(data, &level); err == nil {
+		*l = SteamLevelFromInt(level)
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("steam level must be a number or a name like Level2")
+	}
+	*l = SteamLevel(name)
+	return nil
 }
 
 type BoilersInfo struct {
@@ -53,20 +97,67 @@ type BoilersInfo struct {
 }
 
 type ScaleInfo struct {
-	Connected    bool `json:"connected"`
-	BatteryLevel int  `json:"batteryLevel,omitempty"` // Battery percentage 0-100
+	Connected    bool   `json:"connected"`
+	BatteryLevel int    `json:"batteryLevel,omitempty"` // Battery percentage 0-100
+	Name         string `json:"name,omitempty"`         // Name of the paired scale, e.g. LMZ-123A45
+	Address      string `json:"address,omitempty"`      // Bluetooth address, if reported
 }
 
+// WaterLevel is the state of the water reservoir. Machines only report the
+// low-water alarm of the level sensor so far.
+type WaterLevel string
+
+const (
+	WaterLevelOK  WaterLevel = "ok"
+	WaterLevelLow WaterLevel = "low"
+)
+
 type MachineStatus struct {
-	Mode      DoseMode     `json:"mode"`
-	Connected bool         `json:"connected"`
-	Serial    string       `json:"serial,omitempty"`
-	Model     string       `json:"model,omitempty"`
-	Dose1     *DoseInfo    `json:"dose1,omitempty"`
-	Dose2     *DoseInfo    `json:"dose2,omitempty"`
-	MachineOn bool         `json:"machineOn"`
-	Boilers   *BoilersInfo `json:"boilers,omitempty"`
-	Scale     *ScaleInfo   `json:"scale,omitempty"`
+	Mode      DoseMode  `json:"mode"`
+	Connected bool      `json:"connected"`
+	PollError string    `json:"pollError,omitempty"` // Reason while polls keep failing, connected is false meanwhile
+	Transport string    `json:"transport,omitempty"` // Path of the last successful request: cloud or local
+	Serial    string    `json:"serial,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Dose1     *DoseInfo `json:"dose1,omitempty"`
+	Dose2     *DoseInfo `json:"dose2,omitempty"`
+	MachineOn bool      `json:"machineOn"`
+	// The machine is connected to the cloud, also in standby. Unlike connected,
+	// which is the connection of the gateway to the cloud.
+	CloudConnected bool       `json:"cloudConnected"`
+	LastSeen       *time.Time `json:"lastSeen,omitempty"` // Last time the machine was connected to the cloud
+	Power          PowerState `json:"power,omitempty"`    // on, standby or off
+	Brewing        bool       `json:"brewing"`
+	// Start of the running shot, for a brew timer
+	BrewingSince *time.Time   `json:"brewingSince,omitempty"`
+	Boilers      *BoilersInfo `json:"boilers,omitempty"`
+	Scale        *ScaleInfo   `json:"scale,omitempty"`
+
+	PreExtraction *PreExtractionInfo `json:"preExtraction,omitempty"`
+	HotWater      *HotWaterInfo      `json:"hotWater,omitempty"`
+	Accessories   *AccessoriesInfo   `json:"accessories,omitempty"`
+	BackFlush     *BackFlushInfo     `json:"backFlush,omitempty"`
+	Capabilities  *Capabilities      `json:"capabilities,omitempty"` // Features of the machine, unsupported commands are rejected
+	WaterTankLow  *bool              `json:"waterTankLow,omitempty"` // The reservoir needs a refill, nil without reservoir sensor
+	WaterLevel    WaterLevel         `json:"waterLevel,omitempty"`
+
+	ReportedAt *time.Time `json:"reportedAt,omitempty"` // Time of the machine data according to the cloud
+	ReceivedAt *time.Time `json:"receivedAt,omitempty"` // When the gateway received it
+
+	// Receipt of the cloud update that caused this status change, zero for
+	// changes made by commands. For latency measurements, not published.
+	UpdateReceivedAt time.Time `json:"-"`
+}
+
+// BrewEvent describes a shot observed on the machine
+type BrewEvent struct {
+	StartedAt    time.Time  `json:"startedAt"`
+	EndedAt      time.Time  `json:"endedAt"`
+	Duration     float64    `json:"duration"` // Seconds, limited by the polling resolution
+	Mode         DoseMode   `json:"mode"`
+	TargetWeight float64    `json:"targetWeight,omitempty"` // Dose target in grams (brew-by-weight modes)
+	ReportedAt   *time.Time `json:"reportedAt,omitempty"`   // Time of the cloud data the brew end was detected in
+	ReceivedAt   time.Time  `json:"receivedAt"`             // When the gateway detected the brew end
 }
 
 type AuthResponse struct {
@@ -94,11 +185,6 @@ type DashboardResponse struct {
 	Widgets []Widget `json:"widgets"`
 }
 
-type Widget struct {
-	Type   string      `json:"type"`
-	Output interface{} `json:"output"`
-}
-
 type BrewByWeightOutput struct {
 	Mode string `json:"mode"`
 }
@@ -0,0 +1,73 @@
+package lamarzocco
+
+import (
+	"sort"
+	"sync"
+)
+
+// Status strings the gateway understands, others come from newer firmware
+var (
+	knownMachineStatus = map[string]bool{"PoweredOn": true, "Brewing": true, "StandBy": true, "Off": true}
+	knownBoilerStatus  = map[string]bool{"Ready": true, "HeatingUp": true, "StandBy": true, "Off": true, "NoWater": true}
+)
+
+// UnknownState is a status string the gateway does not recognize. It is
+// still mapped to off or not ready.
+type UnknownState struct {
+	Field string `json:"field"` // e.g. machine.status, boilers.coffee.status
+	Value string `json:"value"` // Raw value reported by the machine
+	Count int    `json:"count"` // Dashboards it was seen in
+}
+
+type unknownStates struct {
+	seen map[UnknownState]int // Keyed by field and value, Count unset
+	mu   sync.Mutex
+}
+
+// SetUnknownStateCallback is called the first time a field reports a value
+// the gateway does not recognize
+func (c *Client) SetUnknownStateCallback(callback func(UnknownState)) {
+	c.onUnknownState = callback
+}
+
+// UnknownStates lists the unrecognized values seen since the start
+func (c *Client) UnknownStates() []UnknownState {
+	c.unknown.mu.Lock()
+	defer c.unknown.mu.Unlock()
+
+	result := make([]UnknownState, 0, len(c.unknown.seen))
+	for state, count := range c.unknown.seen {
+		state.Count = count
+		result = append(result, state)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Field != result[j].Field {
+			return result[i].Field < result[j].Field
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
+
+func (c *Client) recordUnknownStates(states []UnknownState) {
+	var first []UnknownState
+
+	c.unknown.mu.Lock()
+	if c.unknown.seen == nil {
+		c.unknown.seen = make(map[UnknownState]int)
+	}
+	for _, state := range states {
+		c.unknown.seen[state]++
+		if c.unknown.seen[state] == 1 {
+			first = append(first, UnknownState{Field: state.Field, Value: state.Value, Count: 1})
+		}
+	}
+	c.unknown.mu.Unlock()
+
+	for _, state := range first {
+		c.log.Warn("Machine reported an unknown state", "field", state.Field, "value", state.Value)
+		if c.onUnknownState != nil {
+			c.onUnknownState(state)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package lamarzocco
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// widgetParser reads the output of a widget into the dashboard data
+type widgetParser func(c *Client, output json.RawMessage, result *dashboardData) error
+
+// widgetParsers are keyed by the widget code. Widgets without a parser are
+// kept raw for diagnostics, see UnknownWidgets.
+var widgetParsers = map[string]widgetParser{
+	"CMMachineStatus":     typedWidget(parseMachineStatusWidget),
+	"CMBrewByWeightDoses": typedWidget(parseBrewByWeightWidget),
+	"BrewByWeightDoses":   typedWidget(parseBrewByWeightWidget),
+	"CMCoffeeBoiler":      typedWidget(parseCoffeeBoilerWidget),
+	"CMSteamBoilerLevel":  typedWidget(parseSteamBoilerWidget),
+	"CMSteamBoiler":       typedWidget(parseSteamBoilerWidget),
+	"CMPreBrewing":        typedWidget(parsePreExtractionWidget),
+	"CMPreExtraction":     typedWidget(parsePreExtractionWidget),
+	"CMHotWaterDose":      typedWidget(parseHotWaterWidget),
+	"CMCupWarmer":         typedWidget(parseCupWarmerWidget),
+	"CMBaristaLights":     typedWidget(parseBaristaLightsWidget),
+	"CMBackFlush":         typedWidget(parseBackFlushWidget),
+	"ThingScale":          typedWidget(parseScaleWidget),
+	"CMNoWater":           typedWidget(parseNoWaterWidget),
+}
+
+// typedWidget decodes the output into T before handing it to parse
+func typedWidget[T any](parse func(c *Client, output T, result *dashboardData)) widgetParser {
+	return func(c *Client, raw json.RawMessage, result *dashboardData) error {
+		var output T
+		if err := json.Unmarshal(raw, &output); err != nil {
+			return err
+		}
+		parse(c, output, result)
+		return nil
+	}
+}
+
+// Widget is an entry of the dashboard, the state of one machine feature
+type Widget struct {
+	Code   string          `json:"code"`
+	Output json.RawMessage `json:"output"`
+}
+
+// RawWidget is a widget the client could not read, e.g. one of a newer
+// machine or firmware
+type RawWidget struct {
+	Code   string          `json:"code"`
+	Output json.RawMessage `json:"output,omitempty"`
+	Reason string          `json:"reason"` // Why it was not read: unknown code or the decode error
+}
+
+// decodeWidgets returns a dashboard for path queries and its widgets, without
+// decoding anything else. Dashboards are several KB and arrive with every
+// poll, only the outputs of known widgets are decoded later. The outputs point
+// into body. Entries that are no widget are skipped.
+func decodeWidgets(body []byte) (gjson.Result, []Widget, error) {
+	if !gjson.ValidBytes(body) {
+		return gjson.Result{}, nil, errors.New("invalid JSON")
+	}
+
+	root := gjson.Parse(string(body))
+	var widgets []Widget
+	root.Get("widgets").ForEach(func(_, entry gjson.Result) bool {
+		code := entry.Get("code")
+		if code.Type != gjson.String || code.Str == "" {
+			return true
+		}
+		w := Widget{Code: code.Str}
+		if output := entry.Get("output"); output.Exists() {
+			w.Output = body[output.Index : output.Index+len(output.Raw)]
+		}
+		widgets = append(widgets, w)
+		return true
+	})
+	return root, widgets, nil
+}
+
+// isNull reports whether a JSON value is missing or null
+func isNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// parseWidget reads one widget into result, widgets it cannot read are
+// returned raw
+func (c *Client) parseWidget(w Widget, result *dashboardData) *RawWidget {
+	parse, ok := widgetParsers[w.Code]
+	if !ok {
+		return &RawWidget{Code: w.Code, Output: w.Output, Reason: "unknown widget"}
+	}
+	if isNull(w.Output) {
+		return nil
+	}
+	if err := parse(c, w.Output, result); err != nil {
+		return &RawWidget{Code: w.Code, Output: w.Output, Reason: err.Error()}
+	}
+	return nil
+}
+
+// dashboardWidgets are the widgets of the last dashboard
+type dashboardWidgets struct {
+	codes []string
+	raw   []RawWidget // Could not be read
+	mu    sync.Mutex
+}
+
+// DashboardWidgets lists the codes of the widgets in the last dashboard,
+// sorted
+func (c *Client) DashboardWidgets() []string {
+	c.widgets.mu.Lock()
+	defer c.widgets.mu.Unlock()
+	return append([]string{}, c.widgets.codes...)
+}
+
+// UnknownWidgets lists the widgets of the last dashboard the client could not
+// read, sorted by code
+func (c *Client) UnknownWidgets() []RawWidget {
+	c.widgets.mu.Lock()
+	defer c.widgets.mu.Unlock()
+	return append([]RawWidget{}, c.widgets.raw...)
+}
+
+func (c *Client) recordWidgets(codes []string, raw []RawWidget) {
+	sort.Strings(codes)
+	sort.Slice(raw, func(i, j int) bool { return raw[i].Code < raw[j].Code })
+
+	c.widgets.mu.Lock()
+	c.widgets.codes = codes
+	c.widgets.raw = raw
+	c.widgets.mu.Unlock()
+}
+
+// machineStatusOutput is the output of the CMMachineStatus widget
+type machineStatusOutput struct {
+	Status           *string  `json:"status"`
+	BrewingStartTime *float64 `json:"brewingStartTime"` // Start of the running brew (ms), null when idle
+}
+
+func parseMachineStatusWidget(_ *Client, output machineStatusOutput, result *dashboardData) {
+	if output.Status != nil {
+		status := *output.Status
+		result.machineOn = status == "PoweredOn" || status == "Brewing"
+		result.power = powerStateFromStatus(status)
+		if !knownMachineStatus[status] {
+			result.unknown = append(result.unknown, UnknownState{Field: "machine.status", Value: status})
+		}
+	}
+	if start := output.BrewingStartTime; start != nil && *start > 0 {
+		result.brewingSince = time.UnixMilli(int64(*start))
+	}
+}
+
+// brewByWeightOutput is the output of the CMBrewByWeightDoses widget, e.g.
+// {"mode": "Dose1", "doses": {"Dose1": {"dose": 15.00}, "Dose2": {"dose": 34.00}}}
+type brewByWeightOutput struct {
+	Mode  *string `json:"mode"`
+	Doses map[string]struct {
+		Dose float64 `json:"dose"`
+	} `json:"doses"`
+}
+
+func parseBrewByWeightWidget(_ *Client, output brewByWeightOutput, result *dashboardData) {
+	if output.Mode != nil {
+		result.mode = ParseDoseMode(*output.Mode)
+	}
+	if dose, ok := output.Doses["Dose1"]; ok && dose.Dose > 0 {
+		result.dose1 = &DoseInfo{Weight: dose.Dose}
+	}
+	if dose, ok := output.Doses["Dose2"]; ok && dose.Dose > 0 {
+		result.dose2 = &DoseInfo{Weight: dose.Dose}
+	}
+}
+
+// boilerOutput is the output of the CMCoffeeBoiler and CMSteamBoilerLevel widgets
+type boilerOutput struct {
+	Status            *string  `json:"status"` // Ready, HeatingUp, etc.
+	Enabled           *bool    `json:"enabled"`
+	TargetTemperature *float64 `json:"targetTemperature"`
+	TargetLevel       *string  `json:"targetLevel"`    // Level1, Level2, etc.
+	ReadyStartTime    *float64 `json:"readyStartTime"` // Future timestamp (ms) the boiler is ready at
+}
+
+// boiler converts the output, field names the boiler in unknown states
+func (c *Client) boiler(output boilerOutput, field string, result *dashboardData) *BoilerInfo {
+	boiler := &BoilerInfo{}
+	if output.Status != nil {
+		boiler.Ready = *output.Status == "Ready"
+		if !knownBoilerStatus[*output.Status] {
+			result.unknown = append(result.unknown, UnknownState{Field: field, Value: *output.Status})
+		}
+	}
+	if readyTime := output.ReadyStartTime; readyTime != nil && *readyTime > 0 {
+		boiler.RemainingSeconds = c.remainingSeconds(*readyTime)
+		if boiler.RemainingSeconds > 0 {
+			c.log.Debug("Boiler heating", "boiler", field, "readyStartTime", *readyTime, "remainingSeconds", boiler.RemainingSeconds)
+		}
+	}
+	if result.boilers == nil {
+		result.boilers = &BoilersInfo{}
+	}
+	return boiler
+}
+
+func parseCoffeeBoilerWidget(c *Client, output boilerOutput, result *dashboardData) {
+	boiler := c.boiler(output, "boilers.coffee.status", result)
+	if output.TargetTemperature != nil {
+		boiler.Temperature = *output.TargetTemperature
+	}
+	result.boilers.Coffee = boiler
+}
+
+func parseSteamBoilerWidget(c *Client, output boilerOutput, result *dashboardData) {
+	boiler := c.boiler(output, "boilers.steam.status", result)
+	if output.Enabled != nil {
+		enabled := *output.Enabled
+		boiler.Enabled = &enabled
+		if !enabled {
+			boiler.Ready = false
+		}
+	}
+	if output.TargetLevel != nil {
+		boiler.Level = *output.TargetLevel
+	}
+	result.boilers.Steam = boiler
+}
+
+func parsePreExtractionWidget(_ *Client, output preExtractionOutput, result *dashboardData) {
+	result.preExtraction = parsePreExtraction(output)
+}
+
+func parseHotWaterWidget(_ *Client, output hotWaterOutput, result *dashboardData) {
+	result.hotWater = parseHotWater(output)
+}
+
+func parseCupWarmerWidget(_ *Client, output accessoryOutput, result *dashboardData) {
+	if result.accessories == nil {
+		result.accessories = &AccessoriesInfo{}
+	}
+	result.accessories.CupWarmer = output.Enabled
+}
+
+func parseBaristaLightsWidget(_ *Client, output accessoryOutput, result *dashboardData) {
+	if result.accessories == nil {
+		result.accessories = &AccessoriesInfo{}
+	}
+	result.accessories.BaristaLights = output.Enabled
+}
+
+func parseBackFlushWidget(_ *Client, output backFlushOutput, result *dashboardData) {
+	result.backFlush = parseBackFlush(output)
+}
+
+// scaleOutput is the output of the ThingScale widget
+type scaleOutput struct {
+	Connected    bool     `json:"connected"`
+	BatteryLevel float64  `json:"batteryLevel"` // Percentage 0-100
+	Weight       *float64 `json:"weight"`       // Grams on the scale, only reported while connected
+	Name         string   `json:"name"`
+	Address      string   `json:"address"`
+}
+
+func parseScaleWidget(_ *Client, output scaleOutput, result *dashboardData) {
+	result.scale = &ScaleInfo{Connected: output.Connected, BatteryLevel: int(output.BatteryLevel), Name: output.Name, Address: output.Address}
+	if output.Connected {
+		result.scaleWeight = output.Weight
+	}
+}
+
+// noWaterOutput is the output of the CMNoWater widget, the alarm of the water
+// reservoir level sensor
+type noWaterOutput struct {
+	Alarm *bool `json:"allarm"` // Spelled this way by the cloud
+}
+
+func parseNoWaterWidget(_ *Client, output noWaterOutput, result *dashboardData) {
+	if output.Alarm == nil {
+		return
+	}
+	result.waterLevel = WaterLevelOK
+	if *output.Alarm {
+		result.waterLevel = WaterLevelLow
+	}
+}
@@ -0,0 +1,119 @@
+package lamarzocco
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExtractDataFromDashboardWidgets(t *testing.T) {
+	client := New(WithClock(fixedClock(time.UnixMilli(1760000000000))))
+
+	data := client.extractDataFromDashboard([]byte(`{"connected":true,"widgets":[
+		{"code":"CMMachineStatus","output":{"status":"PoweredOn","brewingStartTime":null}},
+		{"code":"CMBrewByWeightDoses","output":{"mode":"Dose2","doses":{"Dose1":{"dose":36.5},"Dose2":{"dose":40}}}},
+		{"code":"CMSteamBoilerLevel","output":{"status":"Ready","enabled":false,"targetLevel":"Level2"}},
+		{"code":"CMCupWarmer","output":{"enabled":true}},
+		{"code":"CMGroupDoses","output":{"doses":[]}},
+		{"code":"ThingScale","output":"connected"},
+		{"code":"CMCoffeeBoiler","output":null}
+	]}`))
+
+	if !data.machineOn || data.mode != DoseModeDose2 {
+		t.Errorf("machineOn = %v, mode = %s, want true, Dose2", data.machineOn, data.mode)
+	}
+	if data.dose1 == nil || data.dose1.Weight != 36.5 || data.dose2 == nil || data.dose2.Weight != 40 {
+		t.Errorf("doses = %+v %+v, want 36.5 and 40", data.dose1, data.dose2)
+	}
+	if data.boilers == nil || data.boilers.Coffee != nil || data.boilers.Steam == nil {
+		t.Fatalf("boilers = %+v, want the steam boiler only", data.boilers)
+	}
+	if steam := data.boilers.Steam; steam.Ready || steam.Level != "Level2" || steam.Enabled == nil || *steam.Enabled {
+		t.Errorf("steam boiler = %+v, want disabled and not ready at Level2", steam)
+	}
+	if data.accessories == nil || !boolValue(data.accessories.CupWarmer) {
+		t.Errorf("accessories = %+v, want the cup warmer on", data.accessories)
+	}
+	if data.scale != nil {
+		t.Errorf("scale = %+v, want none for an unreadable widget", data.scale)
+	}
+
+	if len(data.raw) != 2 {
+		t.Fatalf("raw widgets = %+v, want the unknown and the unreadable one", data.raw)
+	}
+	if data.raw[0].Code != "CMGroupDoses" || data.raw[0].Reason != "unknown widget" {
+		t.Errorf("raw[0] = %+v, want the unknown CMGroupDoses", data.raw[0])
+	}
+	if data.raw[1].Code != "ThingScale" || data.raw[1].Reason == "" {
+		t.Errorf("raw[1] = %+v, want ThingScale with the decode error", data.raw[1])
+	}
+}
+
+func TestWaterTankLevel(t *testing.T) {
+	client := New()
+
+	client.applyDashboard([]byte(`{"widgets":[
+		{"code":"CMMachineStatus","output":{"status":"PoweredOn"}},
+		{"code":"CMNoWater","output":{"allarm":true}}
+	]}`))
+	status := client.GetStatus()
+	if status.WaterTankLow == nil || !*status.WaterTankLow || status.WaterLevel != WaterLevelLow {
+		t.Errorf("waterTankLow = %v, waterLevel = %q, want true, low", status.WaterTankLow, status.WaterLevel)
+	}
+
+	client.applyDashboard([]byte(`{"widgets":[
+		{"code":"CMMachineStatus","output":{"status":"PoweredOn"}}
+	]}`))
+	if status := client.GetStatus(); status.WaterTankLow != nil || status.WaterLevel != "" {
+		t.Errorf("waterTankLow = %v, waterLevel = %q, want unset without the widget", status.WaterTankLow, status.WaterLevel)
+	}
+}
+
+func TestCloudConnectedAndMachineOn(t *testing.T) {
+	seen := time.UnixMilli(1760000000000)
+	client := New(WithClock(fixedClock(seen)))
+
+	// Standby: connected to the cloud, but not on
+	client.applyDashboard([]byte(`{"connected":true,"widgets":[
+		{"code":"CMMachineStatus","output":{"status":"StandBy"}}
+	]}`))
+	status := client.GetStatus()
+	if status.MachineOn || !status.CloudConnected || status.LastSeen == nil || !status.LastSeen.Equal(seen) {
+		t.Errorf("machineOn = %v, cloudConnected = %v, lastSeen = %v, want false, true, now", status.MachineOn, status.CloudConnected, status.LastSeen)
+	}
+
+	// Lost Wi-Fi: the last seen time stays
+	client.clock = fixedClock(seen.Add(time.Hour))
+	client.applyDashboard([]byte(`{"connected":false,"widgets":[
+		{"code":"CMMachineStatus","output":{"status":"StandBy"}}
+	]}`))
+	status = client.GetStatus()
+	if status.CloudConnected || status.LastSeen == nil || !status.LastSeen.Equal(seen) {
+		t.Errorf("cloudConnected = %v, lastSeen = %v, want false, %v", status.CloudConnected, status.LastSeen, seen)
+	}
+}
+
+func TestScaleWeightReadings(t *testing.T) {
+	start := time.UnixMilli(1760000000000)
+	client := New(WithClock(fixedClock(start.Add(12 * time.Second))))
+	var readings []ScaleReading
+	client.SetScaleWeightCallback(func(reading ScaleReading) {
+		readings = append(readings, reading)
+	})
+
+	brewing := []byte(`{"widgets":[
+		{"code":"CMMachineStatus","output":{"status":"Brewing","brewingStartTime":1760000000000}},
+		{"code":"ThingScale","output":{"connected":true,"batteryLevel":80,"weight":18.4}}
+	]}`)
+	client.applyDashboard(brewing)
+	client.applyDashboard(brewing)
+	if !client.liveWeightWanted() {
+		t.Error("liveWeightWanted() = false during a brew with a connected scale")
+	}
+
+	if len(readings) != 1 {
+		t.Fatalf("readings = %+v, want one for an unchanged weight", readings)
+	}
+	if r := readings[0]; r.Weight != 18.4 || !r.Brewing || r.Elapsed != 12 {
+		t.Errorf("reading = %+v, want 18.4g brewing for 12s", r)
+	}
+}
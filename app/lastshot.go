@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/philipparndt/go-logger"
+)
+
+// lastShotMatch is how far the end of a detected shot and the one the machine
+// recorded may be apart to be the same shot. Detection is limited by the
+// polling interval.
+const lastShotMatch = 2 * time.Minute
+
+// lastShot is the most recent shot, published retained to <topic>/lastshot
+// and with the status
+type lastShot struct {
+	Time     time.Time           `json:"time"`     // End of the shot
+	Duration float64             `json:"duration"` // Seconds
+	Mode     lamarzocco.DoseMode `json:"mode,omitempty"`
+	Weight   float64             `json:"weight,omitempty"` // Final weight in grams, the dose target unless the machine reported it
+	Dose     float64             `json:"dose,omitempty"`   // Ground coffee in grams
+	Ratio    float64             `json:"ratio,omitempty"`  // Weight / dose
+	Source   string              `json:"source"`           // detected (by polling) or machine (recorded by the machine)
+}
+
+func (g *gateway) getLastShot() *lastShot {
+	g.lastShotMu.Lock()
+	defer g.lastShotMu.Unlock()
+	return g.lastShot
+}
+
+// onShotDetected records a brew the gateway observed
+func (g *gateway) onShotDetected(record state.BrewRecord) {
+	g.setLastShot(&lastShot{
+		Time:     record.EndedAt,
+		Duration: record.Duration,
+		Mode:     record.Mode,
+		Weight:   record.TargetWeight,
+		Dose:     record.Dose,
+		Ratio:    record.Ratio,
+		Source:   "detected",
+	})
+}
+
+// onShotRecorded takes the duration and weight of the last shot recorded by
+// the machine, which are more precise than the detected ones. A shot the
+// gateway did not detect, e.g. while it was offline, replaces the last one.
+func (g *gateway) onShotRecorded(shot lamarzocco.Shot) {
+	g.lastShotMu.Lock()
+	current := g.lastShot
+	g.lastShotMu.Unlock()
+
+	if current != nil && current.Source == "machine" && !shot.Time.After(current.Time) {
+		return
+	}
+
+	next := &lastShot{Time: shot.Time, Duration: shot.Duration, Mode: shot.Mode, Weight: shot.Weight, Source: "machine"}
+	if current != nil {
+		gap := shot.Time.Sub(current.Time)
+		if gap < -lastShotMatch {
+			return // Older than the detected shot
+		}
+		if gap <= lastShotMatch {
+			// The detected shot: keep what the machine does not know
+			next.Dose = current.Dose
+			if next.Mode == "" {
+				next.Mode = current.Mode
+			}
+			if next.Weight == 0 {
+				next.Weight = current.Weight
+			}
+		}
+	}
+	if next.Dose > 0 && next.Weight > 0 {
+		next.Ratio = next.Weight / next.Dose
+	}
+	g.setLastShot(next)
+}
+
+func (g *gateway) setLastShot(shot *lastShot) {
+	g.lastShotMu.Lock()
+	g.lastShot = shot
+	g.lastShotMu.Unlock()
+
+	data, err := json.Marshal(shot)
+	if err != nil {
+		logger.Error("Failed to marshal last shot", err)
+		return
+	}
+	g.publish(g.cfg.MQTT.Topic+"/lastshot", data, true)
+	g.publishStatus(g.client.GetStatus())
+}
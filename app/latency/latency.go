@@ -0,0 +1,119 @@
+// Package latency measures how long machine updates take from their receipt
+// to their delivery, per delivery path (e.g. MQTT or SSE).
+package latency
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// window is how many recent samples the percentiles are computed from
+const window = 512
+
+// Summary describes the samples of a stage, durations in milliseconds
+type Summary struct {
+	Count int     `json:"count"`
+	Sum   float64 `json:"sum"`
+	Last  float64 `json:"last"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"` // Of the recent samples
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+type stage struct {
+	count  int
+	sum    float64
+	last   float64
+	max    float64
+	recent []float64 // Ring buffer of the last window samples
+	next   int
+}
+
+// Recorder collects latency samples per stage, it is safe for concurrent use
+type Recorder struct {
+	stages map[string]*stage
+	mu     sync.Mutex
+}
+
+func New() *Recorder {
+	return &Recorder{stages: make(map[string]*stage)}
+}
+
+// Observe records the time from the receipt of an update until now. A nil
+// recorder or a zero receipt time (e.g. a change made by a command) records
+// nothing.
+func (r *Recorder) Observe(name string, receivedAt time.Time) {
+	if r == nil || receivedAt.IsZero() {
+		return
+	}
+	r.Add(name, time.Since(receivedAt))
+}
+
+// Add records a sample
+func (r *Recorder) Add(name string, d time.Duration) {
+	if r == nil || d < 0 {
+		return
+	}
+	ms := float64(d) / float64(time.Millisecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.stages[name]
+	if !ok {
+		s = &stage{}
+		r.stages[name] = s
+	}
+	s.count++
+	s.sum += ms
+	s.last = ms
+	s.max = math.Max(s.max, ms)
+	if len(s.recent) < window {
+		s.recent = append(s.recent, ms)
+	} else {
+		s.recent[s.next] = ms
+		s.next = (s.next + 1) % window
+	}
+}
+
+// Snapshot summarizes the samples of every stage
+func (r *Recorder) Snapshot() map[string]Summary {
+	result := make(map[string]Summary)
+	if r == nil {
+		return result
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, s := range r.stages {
+		sorted := slices.Clone(s.recent)
+		slices.Sort(sorted)
+		result[name] = Summary{
+			Count: s.count,
+			Sum:   round(s.sum),
+			Last:  round(s.last),
+			Mean:  round(s.sum / float64(s.count)),
+			P50:   round(percentile(sorted, 0.5)),
+			P95:   round(percentile(sorted, 0.95)),
+			P99:   round(percentile(sorted, 0.99)),
+			Max:   round(s.max),
+		}
+	}
+	return result
+}
+
+// percentile of sorted samples, nearest rank
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+func round(ms float64) float64 {
+	return math.Round(ms*1000) / 1000
+}
@@ -0,0 +1,30 @@
+package latency
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	r := New()
+	for i := 1; i <= 100; i++ {
+		r.Add("mqtt", time.Duration(i)*time.Millisecond)
+	}
+	r.Observe("sse", time.Time{})
+
+	snapshot := r.Snapshot()
+	if _, ok := snapshot["sse"]; ok {
+		t.Error("a zero receipt time was recorded")
+	}
+	got := snapshot["mqtt"]
+	want := Summary{Count: 100, Sum: 5050, Last: 100, Mean: 50.5, P50: 50, P95: 95, P99: 99, Max: 100}
+	if got != want {
+		t.Errorf("Snapshot() = %+v, want %+v", got, want)
+	}
+
+	var none *Recorder
+	none.Observe("mqtt", time.Now())
+	if len(none.Snapshot()) != 0 {
+		t.Error("nil recorder has samples")
+	}
+}
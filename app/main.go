@@ -4,265 +4,176 @@ import (
 	"encoding/json"
 	"os"
 	"os/signal"
-	"strconv"
+	"strings"
 	"syscall"
-	"time"
+	_ "time/tzdata" // Time zone names resolve in images without zoneinfo
 
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
 	"github.com/mqtt-home/mqtt-lamarzocco/config"
-	"github.com/mqtt-home/mqtt-lamarzocco/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/hass"
 	"github.com/mqtt-home/mqtt-lamarzocco/version"
-	"github.com/mqtt-home/mqtt-lamarzocco/web"
 	"github.com/philipparndt/go-logger"
 	"github.com/philipparndt/mqtt-gateway/mqtt"
-	"github.com/tidwall/gjson"
 )
 
-var client *lamarzocco.Client
+func main() {
+	logger.Info("mqtt-lamarzocco", version.Info())
+
+	// Usage: mqtt-lamarzocco [--selftest] [--safe-mode] <config file>
+	//        mqtt-lamarzocco --import-hass <config file> <automations.yaml>
+	//        mqtt-lamarzocco --conformance <config file>
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "--import-hass" {
+		os.Exit(runImportHass(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "--conformance" {
+		os.Exit(runConformance(args[1:]))
+	}
+	selfTestMode, safeMode := false, false
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		switch args[0] {
+		case "--selftest":
+			selfTestMode = true
+		case "--safe-mode":
+			safeMode = true
+		default:
+			logger.Error("Unknown option", args[0])
+			os.Exit(1)
+		}
+		args = args[1:]
+	}
+	if len(args) < 1 {
+		logger.Error("No configuration file specified")
+		os.Exit(1)
+	}
 
-func publishStatus(status lamarzocco.MachineStatus) {
-	cfg := config.Get()
-	topic := cfg.MQTT.Topic + "/status"
+	configFile := args[0]
+	logger.Info("Configuration file:", configFile)
 
-	data, err := json.Marshal(status)
+	cfg, err := config.LoadConfig(configFile)
 	if err != nil {
-		logger.Error("Failed to marshal status", err)
+		logger.Error("Failed to load configuration", err)
+		if selfTestMode {
+			os.Exit(1)
+		}
 		return
 	}
 
-	mqtt.PublishAbsolute(topic, string(data), cfg.MQTT.Retain)
-	logger.Debug("Published status", "topic", topic, "status", string(data))
-}
-
-func subscribeToCommands() {
-	cfg := config.Get()
-	topic := cfg.MQTT.Topic + "/set"
-
-	logger.Info("Subscribing to MQTT commands", "topic", topic)
+	logger.SetLevel(cfg.LogLevel)
 
-	mqtt.Subscribe(topic, func(topic string, payload []byte) {
-		logger.Debug("Received MQTT command", "topic", topic, "payload", string(payload))
+	// Start MQTT first (needed for status callback)
+	mqtt.Start(cfg.MQTT, "lamarzocco_mqtt")
 
-		cmd, err := lamarzocco.ParseCommand(payload)
-		if err != nil {
-			logger.Error("Failed to parse command", "error", err)
-			return
+	g, err := newGateway(cfg)
+	if err != nil {
+		logger.Error("Failed to open state", err)
+		if selfTestMode {
+			os.Exit(1)
 		}
-
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error("Panic in command processing", "panic", r)
-				}
-			}()
-
-			// Handle dose1 command
-			if cmd.HasDose1() {
-				logger.Info("Setting dose1 weight", "weight", cmd.GetDose1())
-				if err := client.SetDose("Dose1", cmd.GetDose1()); err != nil {
-					logger.Error("Failed to set dose1", "error", err)
-				}
-			}
-
-			// Handle dose2 command
-			if cmd.HasDose2() {
-				logger.Info("Setting dose2 weight", "weight", cmd.GetDose2())
-				if err := client.SetDose("Dose2", cmd.GetDose2()); err != nil {
-					logger.Error("Failed to set dose2", "error", err)
-				}
-			}
-
-			// Handle mode command
-			if cmd.HasMode() {
-				mode := cmd.GetDoseMode()
-				logger.Info("Setting dose mode", "mode", mode)
-				if err := client.SetMode(mode); err != nil {
-					logger.Error("Failed to set mode", "error", err)
-				}
-			}
-
-			// Handle back flush command
-			if cmd.HasBackFlush() {
-				logger.Info("Starting back flush")
-				if err := client.StartBackFlush(); err != nil {
-					logger.Error("Failed to start back flush", "error", err)
-				}
-			}
-
-			// Handle power command
-			if cmd.HasPower() {
-				on := cmd.GetPower()
-				logger.Info("Setting power", "on", on)
-				if err := client.SetPower(on); err != nil {
-					logger.Error("Failed to set power", "error", err)
-				}
-			}
-		}()
-	})
-}
-
-func matchValue(actual gjson.Result, expected interface{}) bool {
-	if !actual.Exists() {
-		return false
+		return
 	}
 
-	switch v := expected.(type) {
-	case float64:
-		return actual.Num == v
-	case string:
-		return actual.Str == v
-	case bool:
-		return actual.Bool() == v
-	default:
-		return actual.String() == v
+	if selfTestMode {
+		os.Exit(runSelfTest(g))
 	}
-}
 
-func subscribeToTriggers() {
-	cfg := config.Get()
+	// Triggers, schedules and other automations stay off, commands still work
+	g.safeMode = safeMode
 
-	if len(cfg.Triggers) == 0 {
-		logger.Debug("No triggers configured")
+	if err := g.start(); err != nil {
+		logger.Error("Failed to connect to La Marzocco API", err)
 		return
 	}
 
-	// Group triggers by topic
-	triggersByTopic := make(map[string][]config.Trigger)
-	for _, trigger := range cfg.Triggers {
-		triggersByTopic[trigger.Topic] = append(triggersByTopic[trigger.Topic], trigger)
-	}
-
-	// Subscribe to each unique topic
-	for topic, triggers := range triggersByTopic {
-		subscribeTopic := topic    // capture topic for closure
-		topicTriggers := triggers  // capture triggers for closure
-		logger.Info("Subscribing to trigger topic", "topic", subscribeTopic, "triggers", len(topicTriggers))
-
-		mqtt.Subscribe(subscribeTopic, func(msgTopic string, payload []byte) {
-			logger.Info("Received trigger message", "topic", msgTopic, "payload_len", len(payload))
-
-			payloadStr := string(payload)
-
-			// Check each trigger for this topic
-			for i, trigger := range topicTriggers {
-				allMatch := true
-
-				// Check all conditions
-				for _, condition := range trigger.Conditions {
-					result := gjson.Get(payloadStr, condition.Selector)
-					logger.Debug("Checking condition",
-						"selector", condition.Selector,
-						"expected", condition.Value,
-						"actual", result.Value(),
-						"exists", result.Exists())
-					if !matchValue(result, condition.Value) {
-						allMatch = false
-						break
-					}
-				}
-
-				if allMatch {
-					mode := lamarzocco.ParseDoseMode(trigger.Action.Mode)
-					logger.Info("Trigger matched, setting dose mode",
-						"trigger_index", i,
-						"topic", msgTopic,
-						"mode", mode)
+	quitChannel := make(chan os.Signal, 1)
+	signal.Notify(quitChannel, syscall.SIGINT, syscall.SIGTERM)
+	<-quitChannel
 
-					go func(m lamarzocco.DoseMode) {
-						defer func() {
-							if r := recover(); r != nil {
-								logger.Error("Panic in trigger processing", "panic", r)
-							}
-						}()
+	g.stop()
+	logger.Info("Received quit signal")
+}
 
-						if err := client.SetMode(m); err != nil {
-							logger.Error("Failed to set mode from trigger", "error", err)
-						}
-					}(mode)
+// runSelfTest checks the deployment without starting the gateway, prints the
+// report and returns the exit code
+func runSelfTest(g *gateway) int {
+	report := g.selfTest()
+	g.closeStores()
 
-					// Stop after first matching trigger
-					return
-				} else {
-					logger.Debug("Trigger did not match", "trigger_index", i)
-				}
-			}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
 
-			logger.Debug("No trigger matched for message", "topic", msgTopic)
-		})
+	if !report.Passed {
+		return 1
 	}
-
-	logger.Info("Trigger subscriptions active", "topics", len(triggersByTopic), "triggers", len(cfg.Triggers))
+	return 0
 }
 
-func main() {
-	logger.Info("mqtt-lamarzocco", version.Info())
-
-	if len(os.Args) < 2 {
-		logger.Error("No configuration file specified")
-		os.Exit(1)
+// runConformance prints the conformance report of the machine and returns the
+// exit code. The client is read-only and MQTT is not used.
+func runConformance(args []string) int {
+	if len(args) < 1 {
+		logger.Error("Usage: --conformance <config file>")
+		return 1
 	}
 
-	configFile := os.Args[1]
-	logger.Info("Configuration file:", configFile)
-
-	cfg, err := config.LoadConfig(configFile)
+	cfg, err := config.LoadConfig(args[0])
 	if err != nil {
 		logger.Error("Failed to load configuration", err)
-		return
+		return 1
 	}
+	cfg.Accounts = nil
 
-	logger.SetLevel(cfg.LogLevel)
-
-	// Start MQTT first (needed for status callback)
-	mqtt.Start(cfg.MQTT, "lamarzocco_mqtt")
-
-	// Initialize La Marzocco client
-	client = lamarzocco.NewClient(
-		cfg.LaMarzocco.Username,
-		cfg.LaMarzocco.Password,
-	)
-
-	// Set callback to publish status on change
-	client.SetStatusChangeCallback(publishStatus)
-
-	// Connect to La Marzocco API
-	logger.Info("Connecting to La Marzocco API...")
-	if err := client.Connect(); err != nil {
-		logger.Error("Failed to connect to La Marzocco API", err)
-		return
+	g, err := newGateway(cfg, lamarzocco.WithReadOnly())
+	if err != nil {
+		logger.Error("Failed to open state", err)
+		return 1
 	}
+	report := g.conformance()
+	g.client.Close()
+	g.closeStores()
 
-	// Publish initial status
-	publishStatus(client.GetStatus())
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
 
-	// Subscribe to commands
-	subscribeToCommands()
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
 
-	// Subscribe to configured triggers
-	subscribeToTriggers()
+// runImportHass prints the triggers converted from Home Assistant automations
+// and returns the exit code
+func runImportHass(args []string) int {
+	if len(args) < 2 {
+		logger.Error("Usage: --import-hass <config file> <automations.yaml>")
+		return 1
+	}
 
-	// Start polling for status updates
-	stopPolling := make(chan struct{})
-	go client.StartPolling(time.Duration(cfg.LaMarzocco.PollingInterval)*time.Second, stopPolling)
+	cfg, err := config.LoadConfig(args[0])
+	if err != nil {
+		logger.Error("Failed to load configuration", err)
+		return 1
+	}
 
-	// Start web server
-	if !cfg.Web.Enabled {
-		logger.Info("Web interface is disabled in the configuration")
-	} else {
-		logger.Info("Web interface enabled, starting web server")
-		webServer := web.NewWebServer(client)
-		go func() {
-			err := webServer.Start(cfg.Web.Port)
-			if err != nil {
-				logger.Error("Failed to start web server", err)
-			}
-		}()
-		logger.Info("Application is now ready. Web interface available at http://localhost:" + strconv.Itoa(cfg.Web.Port) + ". Press Ctrl+C to quit.")
+	data, err := os.ReadFile(args[1])
+	if err != nil {
+		logger.Error("Failed to read automations", err)
+		return 1
 	}
 
-	quitChannel := make(chan os.Signal, 1)
-	signal.Notify(quitChannel, syscall.SIGINT, syscall.SIGTERM)
-	<-quitChannel
+	result, err := hass.Import(data, cfg.MQTT.Topic)
+	if err != nil {
+		logger.Error("Failed to import automations", err)
+		return 1
+	}
+	for _, skipped := range result.Skipped {
+		logger.Warn("Skipped automation", "automation", skipped.Automation, "reason", skipped.Reason)
+	}
 
-	close(stopPolling)
-	logger.Info("Received quit signal")
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+	return 0
 }
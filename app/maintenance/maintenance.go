@@ -0,0 +1,252 @@
+package maintenance
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/philipparndt/go-logger"
+)
+
+const (
+	dayFormat      = "2006-01-02"
+	keepDays       = 31
+	accountingTick = time.Minute
+)
+
+// Report is the published maintenance block, durations in hours
+type Report struct {
+	OnTimeToday         float64   `json:"onTimeToday"`
+	OnTimeTotal         float64   `json:"onTimeTotal"`
+	LastBackflush       time.Time `json:"lastBackflush,omitempty"`
+	HoursSinceBackflush float64   `json:"hoursSinceBackflush"`
+	LastDescale         time.Time `json:"lastDescale,omitempty"`
+	HoursSinceDescale   float64   `json:"hoursSinceDescale"`
+
+	ShotsSinceBackflush  int  `json:"shotsSinceBackflush"`
+	BackflushRecommended bool `json:"backflushRecommended"` // The shots since the last backflush reached the interval
+}
+
+// DefaultBackflushShots is the backflush interval unless set with SetBackflushShots
+const DefaultBackflushShots = 100
+
+// Tracker accounts powered-on time so service intervals can be based on runtime
+type Tracker struct {
+	store *state.Store
+	clock clock.Clock
+
+	machineOn      bool
+	lastTick       time.Time
+	backflushShots int
+	mu             sync.Mutex
+
+	onChange func(Report)
+}
+
+func New(store *state.Store) *Tracker {
+	return &Tracker{
+		store:          store,
+		clock:          clock.System,
+		lastTick:       time.Now(),
+		backflushShots: DefaultBackflushShots,
+	}
+}
+
+// SetClock replaces the system clock, e.g. for tests
+func (t *Tracker) SetClock(c clock.Clock) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clock = c
+	t.lastTick = c.Now()
+}
+
+// SetBackflushShots sets the shots after which a backflush is recommended
+func (t *Tracker) SetBackflushShots(shots int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.backflushShots = shots
+}
+
+func (t *Tracker) SetChangeCallback(callback func(Report)) {
+	t.onChange = callback
+}
+
+// SetMachineOn accounts the time up to now and switches the power state
+func (t *Tracker) SetMachineOn(on bool) {
+	t.mu.Lock()
+	if on == t.machineOn {
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+
+	t.account()
+
+	t.mu.Lock()
+	t.machineOn = on
+	t.mu.Unlock()
+}
+
+// RecordBackflush records a backflush started by the gateway
+func (t *Tracker) RecordBackflush() {
+	t.update(func(m *state.Maintenance) {
+		recordBackflush(m, t.clock.Now())
+		if m.MachineBackflushes > 0 {
+			// Expected in the next statistics, not another backflush
+			m.MachineBackflushes++
+		}
+	})
+	t.notifyChange()
+}
+
+func recordBackflush(m *state.Maintenance, now time.Time) {
+	m.LastBackflush = now
+	m.OnTimeAtBackflush = m.OnTime
+	m.ShotsSinceBackflush = 0
+	m.CoffeesAtBackflush = m.MachineCoffees
+}
+
+// RecordShot counts a shot the gateway detected
+func (t *Tracker) RecordShot() {
+	t.update(func(m *state.Maintenance) {
+		m.ShotsSinceBackflush++
+	})
+	t.notifyChange()
+}
+
+// SetMachineCounters takes the counters of the machine statistics. A grown
+// backflush counter is a backflush started on the machine itself. The coffee
+// counter also covers shots the gateway did not detect, e.g. while offline.
+func (t *Tracker) SetMachineCounters(coffees, backflushes int) {
+	changed := false
+	t.update(func(m *state.Maintenance) {
+		if m.MachineBackflushes > 0 && backflushes > m.MachineBackflushes {
+			m.MachineCoffees = coffees
+			recordBackflush(m, t.clock.Now())
+			changed = true
+		}
+		m.MachineCoffees = coffees
+		m.MachineBackflushes = backflushes
+
+		if m.CoffeesAtBackflush > 0 && coffees-m.CoffeesAtBackflush > m.ShotsSinceBackflush {
+			m.ShotsSinceBackflush = coffees - m.CoffeesAtBackflush
+			changed = true
+		}
+	})
+	if changed {
+		t.notifyChange()
+	}
+}
+
+func (t *Tracker) RecordDescale() {
+	t.update(func(m *state.Maintenance) {
+		m.LastDescale = t.clock.Now()
+		m.OnTimeAtDescale = m.OnTime
+	})
+	t.notifyChange()
+}
+
+func (t *Tracker) Get() Report {
+	m := t.store.Get().Maintenance
+	if m == nil {
+		m = &state.Maintenance{}
+	}
+
+	t.mu.Lock()
+	backflushShots := t.backflushShots
+	t.mu.Unlock()
+
+	return Report{
+		OnTimeToday:         hours(m.DailyOnTime[t.clock.Now().Format(dayFormat)]),
+		OnTimeTotal:         hours(m.OnTime),
+		LastBackflush:       m.LastBackflush,
+		HoursSinceBackflush: hours(m.OnTime - m.OnTimeAtBackflush),
+		LastDescale:         m.LastDescale,
+		HoursSinceDescale:   hours(m.OnTime - m.OnTimeAtDescale),
+
+		ShotsSinceBackflush:  m.ShotsSinceBackflush,
+		BackflushRecommended: backflushShots > 0 && m.ShotsSinceBackflush >= backflushShots,
+	}
+}
+
+// Run accounts powered-on time periodically until stopCh is closed
+func (t *Tracker) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(accountingTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if t.account() {
+				t.notifyChange()
+			}
+		case <-stopCh:
+			t.account()
+			return
+		}
+	}
+}
+
+// account adds the time since the last tick if the machine is on
+func (t *Tracker) account() bool {
+	t.mu.Lock()
+	now := t.clock.Now()
+	elapsed := now.Sub(t.lastTick).Seconds()
+	t.lastTick = now
+	on := t.machineOn
+	t.mu.Unlock()
+
+	if !on || elapsed <= 0 {
+		return false
+	}
+
+	today := now.Format(dayFormat)
+	t.update(func(m *state.Maintenance) {
+		m.OnTime += elapsed
+		if m.DailyOnTime == nil {
+			m.DailyOnTime = make(map[string]float64)
+		}
+		m.DailyOnTime[today] += elapsed
+		pruneDays(m.DailyOnTime)
+	})
+	return true
+}
+
+func (t *Tracker) update(fn func(*state.Maintenance)) {
+	err := t.store.Update(func(s *state.State) {
+		if s.Maintenance == nil {
+			s.Maintenance = &state.Maintenance{}
+		}
+		fn(s.Maintenance)
+	})
+	if err != nil {
+		logger.Error("Failed to persist maintenance state", "error", err)
+	}
+}
+
+func (t *Tracker) notifyChange() {
+	if t.onChange != nil {
+		t.onChange(t.Get())
+	}
+}
+
+func hours(seconds float64) float64 {
+	return math.Round(seconds/3600*100) / 100
+}
+
+func pruneDays(daily map[string]float64) {
+	if len(daily) <= keepDays {
+		return
+	}
+	days := make([]string, 0, len(daily))
+	for day := range daily {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	for _, day := range days[:len(days)-keepDays] {
+		delete(daily, day)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/philipparndt/go-logger"
+)
+
+// readyPrediction is when the machine is expected to be ready, and why
+type readyPrediction struct {
+	At     time.Time
+	Source string // on, schedule:<name> or pending
+}
+
+// predictReady returns the earliest time the machine is ready within the next
+// day: now if it is ready, otherwise the next power-on of a schedule or
+// deferred command plus the learned warm-up time
+func (g *gateway) predictReady() (readyPrediction, bool) {
+	now := g.clock.Now()
+	status := g.client.GetStatus()
+	if status.MachineOn {
+		at := now
+		if status.Boilers != nil && status.Boilers.Coffee != nil {
+			at = now.Add(time.Duration(status.Boilers.Coffee.RemainingSeconds) * time.Second)
+		}
+		return readyPrediction{At: at, Source: "on"}, true
+	}
+
+	warmup := g.warmup.Estimate()
+	var best readyPrediction
+	consider := func(powerOn time.Time, source string) {
+		if powerOn.Sub(now) > 24*time.Hour {
+			return
+		}
+		if at := powerOn.Add(warmup); best.At.IsZero() || at.Before(best.At) {
+			best = readyPrediction{At: at, Source: source}
+		}
+	}
+
+	if g.vacation == nil || !g.vacation.Suspended() {
+		for _, entry := range g.sched.Entries() {
+			if !entry.Command.Power.On() {
+				continue
+			}
+			if at, ok := g.sched.NextRun(entry); ok {
+				consider(at, "schedule:"+entry.Name)
+			}
+		}
+	}
+	for _, pending := range g.sched.List() {
+		if pending.Command.Power.On() && !pending.WhenReady {
+			consider(pending.ExecuteAt, "pending")
+		}
+	}
+	return best, !best.At.IsZero()
+}
+
+// pendingMaintenance lists what needs attention: backflush, water_filter and
+// beans
+func (g *gateway) pendingMaintenance() []string {
+	due := []string{}
+	if g.maintenanceTracker.Get().BackflushRecommended {
+		due = append(due, "backflush")
+	}
+	if g.waterTracker != nil && g.waterTracker.Get().FilterExhausted {
+		due = append(due, "water_filter")
+	}
+	if g.beans != nil && g.beans.Low() {
+		due = append(due, "beans")
+	}
+	if status := g.client.GetStatus(); status.WaterLevel == lamarzocco.WaterLevelLow {
+		due = append(due, "water_tank")
+	}
+	return due
+}
+
+// publishMorningReport publishes a morning_report event, e.g. for a kitchen
+// display
+func (g *gateway) publishMorningReport() {
+	now := g.clock.Now()
+	report := map[string]interface{}{
+		"shotsYesterday": g.brewHistory.Shots(now.AddDate(0, 0, -1)),
+		"warmupMinutes":  g.warmup.Estimate().Round(time.Minute).Minutes(),
+		"maintenance":    g.pendingMaintenance(),
+	}
+	if ready, ok := g.predictReady(); ok {
+		report["readyAt"] = ready.At.UTC().Format(time.RFC3339)
+		report["readySource"] = ready.Source
+	}
+	g.publishEvent("morning_report", report)
+}
+
+// runMorningReport publishes the morning report daily at morning_report
+func (g *gateway) runMorningReport(at time.Time) {
+	for {
+		now := g.clock.Now()
+		y, m, d := now.Date()
+		next := time.Date(y, m, d, at.Hour(), at.Minute(), 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C:
+		case <-g.stopCh:
+			timer.Stop()
+			return
+		}
+		if g.clock.Now().Before(next) {
+			continue
+		}
+
+		logger.Debug("Publishing the morning report")
+		g.publishMorningReport()
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/config"
+	"github.com/mqtt-home/mqtt-lamarzocco/notify"
+	"github.com/philipparndt/go-logger"
+)
+
+// eventSeverity classifies events for notifiers, e.g. to pick an ntfy priority.
+// Events not listed are "info".
+var eventSeverity = map[string]string{
+	"beans_low":              "warning",
+	"water_filter_exhausted": "warning",
+	"water_tank_low":         "warning",
+	"backflush_recommended":  "warning",
+	"unknown_state":          "warning",
+	"command_failed":         "error",
+	"auth_failed":            "error",
+}
+
+func severity(eventType string, event map[string]interface{}) string {
+	if eventType == "job_finished" && event["state"] == "failed" {
+		return "error"
+	}
+	if s, ok := eventSeverity[eventType]; ok {
+		return s
+	}
+	return "info"
+}
+
+func newNotifiers(cfgs []config.NotifierConfig) ([]*notify.Notifier, error) {
+	var notifiers []*notify.Notifier
+	for _, c := range cfgs {
+		n, err := notify.New(notify.Options{
+			Name:    c.Name,
+			URL:     c.URL,
+			Method:  c.Method,
+			Headers: c.Headers,
+			Body:    c.Body,
+			Events:  c.Events,
+		})
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
+
+func (g *gateway) notifyData(event map[string]interface{}) notify.Data {
+	eventType, _ := event["type"].(string)
+	return notify.Data{
+		Event:    event,
+		Severity: severity(eventType, event),
+		Status:   g.client.GetStatus(),
+		Topic:    g.cfg.MQTT.Topic,
+	}
+}
+
+// notify hands an event to the interested notifiers in the background
+func (g *gateway) notify(event map[string]interface{}) {
+	eventType, _ := event["type"].(string)
+	for _, n := range g.notifiers {
+		if !n.Wants(eventType) {
+			continue
+		}
+		data := g.notifyData(event)
+		go func() {
+			req, err := n.Render(data)
+			if err != nil {
+				logger.Error("Failed to render notification", "notifier", n.Name(), "error", err)
+				return
+			}
+			if err := n.Send(req); err != nil {
+				logger.Warn("Failed to send notification", "error", err)
+			}
+		}()
+	}
+}
+
+// testNotification renders an event for the named notifier, or all of them if
+// the name is empty, and sends it if requested
+func (g *gateway) testNotification(name, eventType string, data map[string]interface{}, send bool) ([]notify.Result, error) {
+	event := g.newEvent(eventType, data)
+
+	results := []notify.Result{}
+	for _, n := range g.notifiers {
+		if name != "" && n.Name() != name {
+			continue
+		}
+
+		result := notify.Result{Notifier: n.Name()}
+		req, err := n.Render(g.notifyData(event))
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.Request = &req
+		if send {
+			if err := n.Send(req); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Sent = true
+			}
+		}
+		results = append(results, result)
+	}
+
+	if name != "" && len(results) == 0 {
+		return nil, fmt.Errorf("%w: %s", notify.ErrUnknownNotifier, name)
+	}
+	return results, nil
+}
@@ -0,0 +1,183 @@
+// Package notify delivers events to webhooks and notification services such
+// as Slack or ntfy. URL, headers and body are Go templates over the event and
+// the machine status.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+)
+
+const requestTimeout = 10 * time.Second
+
+// ErrUnknownNotifier is returned when previewing a notifier that is not configured
+var ErrUnknownNotifier = errors.New("unknown notifier")
+
+type Options struct {
+	Name    string
+	URL     string            // Template
+	Method  string            // Default: POST
+	Headers map[string]string // Values are templates
+	Body    string            // Template, empty sends the event as JSON
+	Events  []string          // Event types, empty for all
+}
+
+// Data is available in the templates, e.g. {{.Event.type}} or {{.Status.Mode}}
+type Data struct {
+	Event    map[string]interface{}
+	Severity string // info, warning or error
+	Status   lamarzocco.MachineStatus
+	Topic    string // Base topic of the gateway that published the event
+}
+
+// Request is a rendered notification
+type Request struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+// Result of a test notification
+type Result struct {
+	Notifier string   `json:"notifier"`
+	Request  *Request `json:"request,omitempty"`
+	Sent     bool     `json:"sent"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type Notifier struct {
+	opts       Options
+	url        *template.Template
+	body       *template.Template
+	headers    map[string]*template.Template
+	httpClient *http.Client
+}
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// New parses the templates, errors name the notifier and the broken template
+func New(opts Options) (*Notifier, error) {
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	if opts.Body == "" {
+		opts.Body = "{{json .Event}}"
+	}
+
+	n := &Notifier{
+		opts:       opts,
+		headers:    make(map[string]*template.Template),
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}
+
+	var err error
+	if n.url, err = parse(opts.Name, "url", opts.URL); err != nil {
+		return nil, err
+	}
+	if n.body, err = parse(opts.Name, "body", opts.Body); err != nil {
+		return nil, err
+	}
+	for name, value := range opts.Headers {
+		if n.headers[name], err = parse(opts.Name, "header "+name, value); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func parse(notifier, field, text string) (*template.Template, error) {
+	tmpl, err := template.New(field).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("notifier %s: invalid %s template: %w", notifier, field, err)
+	}
+	return tmpl, nil
+}
+
+func (n *Notifier) Name() string {
+	return n.opts.Name
+}
+
+// Wants reports whether the notifier is interested in an event type
+func (n *Notifier) Wants(eventType string) bool {
+	return len(n.opts.Events) == 0 || slices.Contains(n.opts.Events, eventType)
+}
+
+// Render executes the templates without sending anything
+func (n *Notifier) Render(data Data) (Request, error) {
+	req := Request{
+		Method:  n.opts.Method,
+		Headers: make(map[string]string),
+	}
+
+	var err error
+	if req.URL, err = execute(n.url, data); err != nil {
+		return Request{}, err
+	}
+	if req.Body, err = execute(n.body, data); err != nil {
+		return Request{}, err
+	}
+	for name, tmpl := range n.headers {
+		if req.Headers[name], err = execute(tmpl, data); err != nil {
+			return Request{}, err
+		}
+	}
+	return req, nil
+}
+
+func execute(tmpl *template.Template, data Data) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Send delivers a rendered notification, non-2xx responses are errors
+func (n *Notifier) Send(req Request) error {
+	httpReq, err := http.NewRequest(req.Method, req.URL, strings.NewReader(req.Body))
+	if err != nil {
+		return fmt.Errorf("notifier %s: %w", n.opts.Name, err)
+	}
+	if strings.HasPrefix(strings.TrimSpace(req.Body), "{") {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := n.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("notifier %s: %w", n.opts.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notifier %s: %d - %s", n.opts.Name, resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Package payload shrinks JSON payloads for constrained brokers and links
+package payload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+)
+
+const (
+	// ModeGzip compresses the payload. Consumers recognize it by the gzip
+	// magic bytes 0x1f 0x8b, JSON never starts with them.
+	ModeGzip = "gzip"
+	// ModeCompact drops null and empty values, the payload stays JSON
+	ModeCompact = "compact"
+
+	DefaultMinSize = 512
+)
+
+func Valid(mode string) bool {
+	return mode == ModeGzip || mode == ModeCompact
+}
+
+// Encode applies mode to data. Gzip is only used for payloads of at least
+// minSize bytes, smaller ones would grow. Data is returned unchanged on errors.
+func Encode(mode string, minSize int, data []byte) []byte {
+	var (
+		encoded []byte
+		err     error
+	)
+	switch mode {
+	case ModeGzip:
+		if len(data) < minSize {
+			return data
+		}
+		encoded, err = Gzip(data)
+	case ModeCompact:
+		encoded, err = Compact(data)
+	default:
+		return data
+	}
+	if err != nil {
+		return data
+	}
+	return encoded
+}
+
+func Gzip(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Compact removes null values, empty strings, arrays and objects. False and
+// zero are kept, they carry information.
+func Compact(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(compact(value))
+}
+
+func compact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			item = compact(item)
+			if empty(item) {
+				delete(v, key)
+			} else {
+				v[key] = item
+			}
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = compact(item)
+		}
+		return v
+	}
+	return value
+}
+
+func empty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package profiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/philipparndt/go-logger"
+)
+
+var ErrNotFound = errors.New("profile not found")
+
+// Manager stores bean/recipe profiles and applies them to the machine
+type Manager struct {
+	store  *state.Store
+	client *lamarzocco.Client
+}
+
+func New(store *state.Store, client *lamarzocco.Client) *Manager {
+	return &Manager{
+		store:  store,
+		client: client,
+	}
+}
+
+func (m *Manager) List() []state.Profile {
+	return m.store.Get().Profiles
+}
+
+func (m *Manager) Get(name string) (state.Profile, bool) {
+	for _, profile := range m.store.Get().Profiles {
+		if strings.EqualFold(profile.Name, name) {
+			return profile, true
+		}
+	}
+	return state.Profile{}, false
+}
+
+// Active returns the name of the last applied profile
+func (m *Manager) Active() string {
+	return m.store.Get().ActiveProfile
+}
+
+// Save creates or replaces a profile with the same name
+func (m *Manager) Save(profile state.Profile) error {
+	if strings.TrimSpace(profile.Name) == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	for _, dose := range []*float64{profile.Dose1, profile.Dose2} {
+		if dose != nil {
+			if err := lamarzocco.CheckDose(*dose); err != nil {
+				return err
+			}
+		}
+	}
+
+	return m.store.Update(func(s *state.State) {
+		for i, existing := range s.Profiles {
+			if strings.EqualFold(existing.Name, profile.Name) {
+				s.Profiles[i] = profile
+				return
+			}
+		}
+		s.Profiles = append(s.Profiles, profile)
+	})
+}
+
+func (m *Manager) Delete(name string) error {
+	found := false
+	err := m.store.Update(func(s *state.State) {
+		for i, existing := range s.Profiles {
+			if strings.EqualFold(existing.Name, name) {
+				s.Profiles = append(s.Profiles[:i], s.Profiles[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if found && strings.EqualFold(s.ActiveProfile, name) {
+			s.ActiveProfile = ""
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Apply sends all settings of the profile to the machine and marks it active,
+// subsequent brews are tagged with its name
+func (m *Manager) Apply(ctx context.Context, name string) error {
+	profile, ok := m.Get(name)
+	if !ok {
+		return ErrNotFound
+	}
+
+	logger.Info("Applying profile", "name", profile.Name)
+
+	if profile.Dose1 != nil {
+		if err := m.client.SetDose(ctx, "Dose1", *profile.Dose1); err != nil {
+			return fmt.Errorf("failed to set dose1: %w", err)
+		}
+	}
+	if profile.Dose2 != nil {
+		if err := m.client.SetDose(ctx, "Dose2", *profile.Dose2); err != nil {
+			return fmt.Errorf("failed to set dose2: %w", err)
+		}
+	}
+	if profile.CoffeeTemperature != nil {
+		if err := m.client.SetCoffeeTemperature(ctx, *profile.CoffeeTemperature); err != nil {
+			return fmt.Errorf("failed to set coffee temperature: %w", err)
+		}
+	}
+
+	return m.store.Update(func(s *state.State) {
+		s.ActiveProfile = profile.Name
+	})
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/automation"
+	"github.com/mqtt-home/mqtt-lamarzocco/compat"
+	"github.com/mqtt-home/mqtt-lamarzocco/maintenance"
+	"github.com/mqtt-home/mqtt-lamarzocco/payload"
+	"github.com/mqtt-home/mqtt-lamarzocco/scheduler"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/mqtt-home/mqtt-lamarzocco/version"
+	"github.com/mqtt-home/mqtt-lamarzocco/water"
+	"github.com/philipparndt/go-logger"
+	"github.com/philipparndt/mqtt-gateway/mqtt"
+)
+
+// publish sends a payload, compressed if the topic is configured for it, and
+// in the layout of compat_version as well
+func (g *gateway) publish(topic string, data []byte, retained bool) {
+	for _, p := range g.compat.Publications(topic, data) {
+		data := p.Data
+		if c := g.cfg.Compression; c != nil && g.compressTopic(p.Topic) {
+			data = payload.Encode(c.Mode, c.MinSize, data)
+		}
+		mqtt.PublishAbsolute(p.Topic, string(data), retained)
+		if retained {
+			g.retainedMu.Lock()
+			if g.retained == nil {
+				g.retained = make(map[string]struct{})
+			}
+			g.retained[p.Topic] = struct{}{}
+			g.retainedMu.Unlock()
+		}
+	}
+}
+
+// unpublish removes retained topics from the broker. Without topics it removes
+// all retained topics the gateway published.
+func (g *gateway) unpublish(topics ...string) {
+	g.retainedMu.Lock()
+	if len(topics) == 0 {
+		topics = slices.Collect(maps.Keys(g.retained))
+	}
+	for _, topic := range topics {
+		delete(g.retained, topic)
+	}
+	g.retainedMu.Unlock()
+
+	for _, topic := range topics {
+		mqtt.PublishAbsolute(topic, "", true)
+	}
+}
+
+func (g *gateway) compressTopic(topic string) bool {
+	relative := strings.TrimPrefix(topic, g.cfg.MQTT.Topic+"/")
+	// Consumers learn about the compression from the capabilities
+	if relative == "capabilities" {
+		return false
+	}
+	for _, t := range g.cfg.Compression.Topics {
+		if t == topic || t == relative {
+			return true
+		}
+	}
+	return false
+}
+
+// statusMessage is the machine status with the origin of the last command
+type statusMessage struct {
+	lamarzocco.MachineStatus
+	LastCommand *commandOrigin `json:"lastCommand,omitempty"`
+	LastShot    *lastShot      `json:"lastShot,omitempty"`
+}
+
+func (g *gateway) publishStatus(status lamarzocco.MachineStatus) {
+	topic := g.cfg.MQTT.Topic + "/status"
+
+	data, err := json.Marshal(statusMessage{MachineStatus: status, LastCommand: g.getLastCommand(), LastShot: g.getLastShot()})
+	if err != nil {
+		logger.Error("Failed to marshal status", err)
+		return
+	}
+
+	g.publish(topic, data, g.cfg.MQTT.Retain)
+	logger.Debug("Published status", "topic", topic, "status", string(data))
+	if g.cfg.StatusTopics {
+		g.publishStatusTopics(data)
+	}
+}
+
+// capabilityReport tells integrations which features the machine and the
+// gateway support
+type capabilityReport struct {
+	Model          string `json:"model"`
+	Serial         string `json:"serial"`
+	GatewayVersion string `json:"gatewayVersion"`
+	lamarzocco.Capabilities
+	Scale          bool `json:"scale"`                   // A scale is paired
+	Schedules      bool `json:"schedules"`               // Gateway side schedules and deferred commands
+	Streaming      bool `json:"streaming"`               // Live updates over the cloud websocket
+	LocalTransport bool `json:"localTransport"`          // A local transport is configured
+	SafeMode       bool `json:"safeMode"`                // Automations are disabled (--safe-mode)
+	LayoutVersion  int  `json:"layoutVersion"`           // Version of the topics and payloads
+	CompatVersion  int  `json:"compatVersion,omitempty"` // Earlier layout published as well
+
+	Compression *compressionInfo `json:"compression,omitempty"`
+}
+
+type compressionInfo struct {
+	Mode   string   `json:"mode"`
+	Topics []string `json:"topics"`
+}
+
+// publishCapabilities publishes the retained capability report to <topic>/capabilities
+func (g *gateway) publishCapabilities() {
+	topic := g.cfg.MQTT.Topic + "/capabilities"
+
+	status := g.client.GetStatus()
+	report := capabilityReport{
+		Model:          status.Model,
+		Serial:         status.Serial,
+		GatewayVersion: version.Version,
+		Capabilities:   g.client.Capabilities(),
+		Scale:          scalePaired(status),
+		Schedules:      true,
+		Streaming:      g.cfg.LaMarzocco.StreamingEnabled(),
+		LocalTransport: g.cfg.LaMarzocco.HasTransport("local"),
+		SafeMode:       g.safeMode,
+		LayoutVersion:  compat.Current,
+	}
+	if g.compat.Active() {
+		report.CompatVersion = g.cfg.CompatVersion
+	}
+	if c := g.cfg.Compression; c != nil {
+		report.Compression = &compressionInfo{Mode: c.Mode, Topics: c.Topics}
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		logger.Error("Failed to marshal capabilities", err)
+		return
+	}
+
+	g.publish(topic, data, true)
+}
+
+// publishEvent publishes a non-retained event to <topic>/events
+func (g *gateway) publishEvent(eventType string, data map[string]interface{}) {
+	topic := g.cfg.MQTT.Topic + "/events"
+	event := g.newEvent(eventType, data)
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Failed to marshal event", err)
+		return
+	}
+
+	g.publish(topic, payload, false)
+	logger.Debug("Published event", "topic", topic, "event", string(payload))
+	g.notify(event)
+}
+
+// newEvent adds the type, timestamp and localized message to the event data
+func (g *gateway) newEvent(eventType string, data map[string]interface{}) map[string]interface{} {
+	event := map[string]interface{}{
+		"type":      eventType,
+		"timestamp": g.clock.Now().UTC().Format(time.RFC3339),
+	}
+	if message := g.messages.Message(eventType); message != "" {
+		event["message"] = message
+	}
+	for key, value := range data {
+		event[key] = value
+	}
+	return event
+}
+
+func (g *gateway) publishInventory(beanInventory state.BeanInventory) {
+	topic := g.cfg.MQTT.Topic + "/inventory"
+
+	data, err := json.Marshal(map[string]interface{}{
+		"bean":      beanInventory.Bean,
+		"bagSize":   beanInventory.BagSize,
+		"remaining": beanInventory.Remaining,
+		"openedAt":  beanInventory.OpenedAt,
+		"low":       g.beans.Low(),
+	})
+	if err != nil {
+		logger.Error("Failed to marshal inventory", err)
+		return
+	}
+
+	g.publish(topic, data, true)
+}
+
+func (g *gateway) onBeansLow(beanInventory state.BeanInventory) {
+	g.publishEvent("beans_low", map[string]interface{}{
+		"bean":      beanInventory.Bean,
+		"remaining": beanInventory.Remaining,
+	})
+}
+
+func (g *gateway) publishBrew(record state.BrewRecord) {
+	topic := g.cfg.MQTT.Topic + "/brew"
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		logger.Error("Failed to marshal brew", err)
+		return
+	}
+
+	g.publish(topic, data, false)
+}
+
+// onScaleWeight streams the weight on the scale to <topic>/scale/weight and
+// the web clients, e.g. for a live shot graph
+func (g *gateway) onScaleWeight(reading lamarzocco.ScaleReading) {
+	data, err := json.Marshal(reading)
+	if err != nil {
+		logger.Error("Failed to marshal scale reading", err)
+		return
+	}
+
+	g.publish(g.cfg.MQTT.Topic+"/scale/weight", data, false)
+	if g.webServer != nil {
+		g.webServer.OnScaleWeight(reading)
+	}
+}
+
+func (g *gateway) publishWater(usage water.Usage) {
+	topic := g.cfg.MQTT.Topic + "/water"
+
+	data, err := json.Marshal(usage)
+	if err != nil {
+		logger.Error("Failed to marshal water usage", err)
+		return
+	}
+
+	g.publish(topic, data, true)
+}
+
+func (g *gateway) onFilterExhausted(usage water.Usage) {
+	g.publishEvent("water_filter_exhausted", map[string]interface{}{
+		"liters":         usage.SinceFilter,
+		"filterCapacity": usage.FilterCapacity,
+	})
+}
+
+func (g *gateway) publishMaintenance(report maintenance.Report) {
+	topic := g.cfg.MQTT.Topic + "/maintenance"
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		logger.Error("Failed to marshal maintenance report", err)
+		return
+	}
+
+	g.publish(topic, data, true)
+
+	if !report.BackflushRecommended {
+		g.backflushDue.Store(false)
+	} else if g.backflushDue.CompareAndSwap(false, true) {
+		g.publishEvent("backflush_recommended", map[string]interface{}{
+			"shotsSinceBackflush": report.ShotsSinceBackflush,
+		})
+	}
+}
+
+func (g *gateway) publishSchedule(schedule lamarzocco.MachineSchedule) {
+	topic := g.cfg.MQTT.Topic + "/schedule"
+
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		logger.Error("Failed to marshal schedule", err)
+		return
+	}
+
+	g.publish(topic, data, true)
+	logger.Debug("Published schedule", "topic", topic, "wake_ups", len(schedule.WakeUps))
+}
+
+// pollStatistics publishes the machine counters now and then every interval
+func (g *gateway) pollStatistics(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if stats, err := g.client.GetStatistics(g.ctx); err != nil {
+			logger.Warn("Failed to fetch statistics", "error", err)
+		} else {
+			g.publishStatistics(stats)
+			g.maintenanceTracker.SetMachineCounters(stats.TotalCoffees, stats.Backflushes)
+			if stats.LastShot != nil {
+				g.onShotRecorded(*stats.LastShot)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-g.stopCh:
+			return
+		}
+	}
+}
+
+// republishDaily republishes the retained topics with daily values at
+// midnight in the configured time zone, so counters of the day reset when the
+// household's day changes instead of with the next update
+func (g *gateway) republishDaily() {
+	for {
+		now := g.clock.Now()
+		y, m, d := now.Date()
+		midnight := time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+		timer := time.NewTimer(midnight.Sub(now))
+		select {
+		case <-timer.C:
+		case <-g.stopCh:
+			timer.Stop()
+			return
+		}
+		if g.clock.Now().Before(midnight) {
+			continue
+		}
+
+		logger.Debug("Day changed, republishing daily values", "day", midnight.Format(time.DateOnly))
+		g.publishMaintenance(g.maintenanceTracker.Get())
+		if g.waterTracker != nil {
+			g.publishWater(g.waterTracker.Get())
+		}
+		if g.cfg.LaMarzocco.StatsInterval > 0 && g.client.Capabilities().Statistics {
+			if stats, err := g.client.GetStatistics(g.ctx); err != nil {
+				logger.Warn("Failed to fetch statistics", "error", err)
+			} else {
+				g.publishStatistics(stats)
+			}
+		}
+	}
+}
+
+func (g *gateway) publishStatistics(stats lamarzocco.Statistics) {
+	topic := g.cfg.MQTT.Topic + "/statistics"
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		logger.Error("Failed to marshal statistics", err)
+		return
+	}
+
+	g.publish(topic, data, true)
+	logger.Debug("Published statistics", "topic", topic, "total_coffees", stats.TotalCoffees)
+
+	// Each key on its own topic, e.g. <topic>/statistics/key1
+	for _, key := range stats.Keys {
+		data, err := json.Marshal(key)
+		if err != nil {
+			continue
+		}
+		g.publish(topic+"/"+strings.ToLower(key.Key), data, true)
+	}
+}
+
+// publishAutomationStat publishes the stats of one automation retained to
+// <topic>/automation/<kind>/<name>
+func (g *gateway) publishAutomationStat(stat automation.Stat) {
+	topic := g.cfg.MQTT.Topic + "/automation/" + stat.Kind + "/" + stat.Name
+
+	data, err := json.Marshal(stat)
+	if err != nil {
+		logger.Error("Failed to marshal automation stats", err)
+		return
+	}
+
+	g.publish(topic, data, true)
+}
+
+func (g *gateway) publishPending(pending []scheduler.PendingCommand) {
+	topic := g.cfg.MQTT.Topic + "/pending"
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		logger.Error("Failed to marshal pending commands", err)
+		return
+	}
+
+	g.publish(topic, data, true)
+	logger.Debug("Published pending commands", "topic", topic, "count", len(pending))
+}
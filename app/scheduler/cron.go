@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSpec is a standard five-field cron expression: minute, hour, day of
+// month, month and day of week. Fields support *, lists, ranges and steps
+// (e.g. "*/15 6-9 * * mon-fri"); days of the week are 0-7 (0 and 7 are
+// Sunday) or mon..sun.
+type CronSpec struct {
+	minute, hour, dom, month, dow uint64 // Bit sets of the allowed values
+	domAny, dowAny                bool
+}
+
+var cronDays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+func ParseCron(s string) (CronSpec, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) != 5 {
+		return CronSpec{}, fmt.Errorf("invalid cron expression %q, expected 5 fields", s)
+	}
+
+	var spec CronSpec
+	var err error
+	if spec.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return CronSpec{}, fmt.Errorf("invalid minute in %q: %w", s, err)
+	}
+	if spec.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return CronSpec{}, fmt.Errorf("invalid hour in %q: %w", s, err)
+	}
+	if spec.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return CronSpec{}, fmt.Errorf("invalid day of month in %q: %w", s, err)
+	}
+	if spec.month, err = parseCronField(fields[3], 1, 12, nil); err != nil {
+		return CronSpec{}, fmt.Errorf("invalid month in %q: %w", s, err)
+	}
+	if spec.dow, err = parseCronField(fields[4], 0, 7, cronDays); err != nil {
+		return CronSpec{}, fmt.Errorf("invalid day of week in %q: %w", s, err)
+	}
+	if spec.dow&(1<<7) != 0 {
+		spec.dow |= 1 // 7 is Sunday as well
+	}
+	spec.domAny = fields[2] == "*"
+	spec.dowAny = fields[4] == "*"
+	return spec, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if before, after, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(after)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", after)
+			}
+			rangePart, step = before, n
+		}
+
+		from, to := min, max
+		if rangePart != "*" {
+			lo, hi, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = cronValue(lo, min, max, names); err != nil {
+				return 0, err
+			}
+			to = from
+			if isRange {
+				if to, err = cronValue(hi, min, max, names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				to = max // "5/10" means from 5 in steps of 10
+			}
+			if to < from {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(s string, min, max int, names map[string]int) (int, error) {
+	if v, ok := names[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("value %q out of range %d-%d", s, min, max)
+	}
+	return v, nil
+}
+
+// Matches reports whether the spec fires in the minute of t. As in cron, a
+// restricted day of month and day of week match if either does.
+func (c CronSpec) Matches(t time.Time) bool {
+	if c.minute&(1<<t.Minute()) == 0 || c.hour&(1<<t.Hour()) == 0 || c.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
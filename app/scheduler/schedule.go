@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/automation"
+	"github.com/philipparndt/go-logger"
+)
+
+const checkInterval = 30 * time.Second
+
+// ScheduleEntry is a recurring command executed at a time of day
+type ScheduleEntry struct {
+	Name    string
+	Time    TimeSpec
+	Days    map[time.Weekday]bool // Empty for every day
+	Command lamarzocco.Command
+	When    map[string]interface{} // Required automation variables
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseWeekdays converts day names ("mon", "Tuesday", ...) into a weekday set.
+// The shortcuts "weekdays" and "weekends" are supported as well.
+func ParseWeekdays(days []string) (map[time.Weekday]bool, error) {
+	result := make(map[time.Weekday]bool)
+	for _, day := range days {
+		name := strings.ToLower(strings.TrimSpace(day))
+		switch name {
+		case "weekdays":
+			for d := time.Monday; d <= time.Friday; d++ {
+				result[d] = true
+			}
+			continue
+		case "weekends":
+			result[time.Saturday] = true
+			result[time.Sunday] = true
+			continue
+		}
+		if len(name) >= 3 {
+			if weekday, ok := weekdays[name[:3]]; ok {
+				result[weekday] = true
+				continue
+			}
+		}
+		return nil, fmt.Errorf("invalid day %q", day)
+	}
+	return result, nil
+}
+
+func (e ScheduleEntry) activeOn(day time.Time) bool {
+	return len(e.Days) == 0 || e.Days[day.Weekday()]
+}
+
+// dueBetween reports whether the entry fires in the interval (from, to]
+func (e ScheduleEntry) dueBetween(from, to time.Time, loc Location) bool {
+	// Check both calendar days in case the interval crosses midnight
+	for _, day := range []time.Time{from, to} {
+		if !e.activeOn(day) {
+			continue
+		}
+		at, ok := e.Time.On(day, loc)
+		if ok && at.After(from) && !at.After(to) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scheduler) SetLocation(loc Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.location = loc
+}
+
+func (s *Scheduler) SetVariables(variables *automation.Variables) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.variables = variables
+}
+
+// SetStats records fired and suppressed schedule entries
+func (s *Scheduler) SetStats(stats *automation.Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = stats
+}
+
+// SetAutoOnSuspended skips entries that power the machine on while set
+func (s *Scheduler) SetAutoOnSuspended(suspended bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autoOnSuspended = suspended
+}
+
+func (s *Scheduler) SetEntries(entries []ScheduleEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = entries
+}
+
+func (s *Scheduler) Entries() []ScheduleEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ScheduleEntry(nil), s.entries...)
+}
+
+// NextRun returns the next execution time of the entry within the next week
+func (s *Scheduler) NextRun(entry ScheduleEntry) (time.Time, bool) {
+	s.mu.Lock()
+	loc := s.location
+	now := s.clock.Now()
+	s.mu.Unlock()
+
+	for i := 0; i < 8; i++ {
+		day := now.AddDate(0, 0, i)
+		if !entry.activeOn(day) {
+			continue
+		}
+		at, ok := entry.Time.On(day, loc)
+		if ok && at.After(now) {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Run checks the recurring schedule entries until stopCh is closed
+func (s *Scheduler) Run(stopCh <-chan struct{}) {
+	last := s.now()
+	s.mu.Lock()
+	ticker := s.clock.NewTicker(checkInterval)
+	s.mu.Unlock()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			now := s.now()
+			s.runDue(last, now)
+			last = now
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (s *Scheduler) runDue(from, to time.Time) {
+	s.mu.Lock()
+	entries := s.entries
+	loc := s.location
+	variables := s.variables
+	autoOnSuspended := s.autoOnSuspended
+	stats := s.stats
+	s.mu.Unlock()
+
+	for _, entry := range entries {
+		if entry.dueBetween(from, to, loc) {
+			if autoOnSuspended && entry.Command.HasPower() && entry.Command.GetPower() {
+				logger.Info("Skipping schedule entry, auto-on is suspended", "name", entry.Name)
+				stats.Suppressed(automation.KindSchedule, entry.Name, automation.SuppressedAutoOnSuspended)
+				continue
+			}
+			if !variables.Matches(entry.When) {
+				logger.Info("Skipping schedule entry, conditions not met", "name", entry.Name, "when", entry.When)
+				stats.Suppressed(automation.KindSchedule, entry.Name, automation.SuppressedVariables)
+				continue
+			}
+			logger.Info("Executing schedule entry", "name", entry.Name)
+			stats.Fired(automation.KindSchedule, entry.Name)
+			go func(entry ScheduleEntry) {
+				stats.Result(automation.KindSchedule, entry.Name, s.execute("", entry.Command))
+			}(entry)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+)
+
+func TestRunFiresScheduleEntry(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 6, 59, 0, 0, time.UTC)
+	manual := clock.NewManual(start)
+
+	executed := make(chan lamarzocco.Command, 1)
+	s := New(func(source string, cmd lamarzocco.Command) error {
+		executed <- cmd
+		return nil
+	})
+	s.SetClock(manual)
+
+	spec, err := ParseTimeSpec("07:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetEntries([]ScheduleEntry{{Name: "morning", Time: spec, Command: lamarzocco.Command{Power: lamarzocco.PowerOn}}})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go s.Run(stopCh)
+	manual.WaitForTickers(1)
+
+	manual.Advance(checkInterval)
+	select {
+	case cmd := <-executed:
+		t.Fatalf("executed %+v before 07:00", cmd)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	manual.Advance(checkInterval)
+	select {
+	case cmd := <-executed:
+		if cmd.Power != lamarzocco.PowerOn {
+			t.Errorf("executed %+v, want power on", cmd)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("schedule entry did not fire at 07:00")
+	}
+}
@@ -0,0 +1,246 @@
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/automation"
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+	"github.com/philipparndt/go-logger"
+)
+
+// PendingCommand is a one-shot command waiting for its execution time, or
+// for the machine to be ready
+type PendingCommand struct {
+	ID        string             `json:"id"`
+	Command   lamarzocco.Command `json:"command"`
+	CreatedAt time.Time          `json:"createdAt"`
+	ExecuteAt time.Time          `json:"executeAt,omitzero"`
+	WhenReady bool               `json:"whenReady,omitempty"` // Executed once the machine is on and the coffee boiler ready
+	Source    string             `json:"source,omitempty"`    // Where the command came from, passed on when it executes
+}
+
+type pendingEntry struct {
+	PendingCommand
+	timer clock.Timer // nil while waiting for the machine to be ready
+}
+
+func (e *pendingEntry) stop() {
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+}
+
+type Scheduler struct {
+	execute         func(source string, cmd lamarzocco.Command) error
+	pending         map[string]*pendingEntry
+	clock           clock.Clock
+	entries         []ScheduleEntry
+	location        Location
+	variables       *automation.Variables
+	stats           *automation.Stats
+	autoOnSuspended bool
+	mu              sync.Mutex
+	onChange        func([]PendingCommand)
+}
+
+// New creates a scheduler. execute gets the source a pending command was
+// registered with, recurring schedule entries have no source.
+func New(execute func(source string, cmd lamarzocco.Command) error) *Scheduler {
+	return &Scheduler{
+		execute: execute,
+		pending: make(map[string]*pendingEntry),
+		clock:   clock.System,
+	}
+}
+
+// SetClock replaces the system clock, e.g. for tests
+func (s *Scheduler) SetClock(c clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = c
+}
+
+func (s *Scheduler) now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clock.Now()
+}
+
+func (s *Scheduler) SetChangeCallback(callback func([]PendingCommand)) {
+	s.onChange = callback
+}
+
+// Schedule registers a command to be executed once after the given delay
+func (s *Scheduler) Schedule(source string, cmd lamarzocco.Command, delay time.Duration) PendingCommand {
+	// The delay has been consumed, the stored command executes immediately
+	cmd.In = ""
+	cmd.ReadyBy = ""
+
+	now := s.now()
+	entry := &pendingEntry{
+		PendingCommand: PendingCommand{
+			ID:        uuid.New().String(),
+			Command:   cmd,
+			CreatedAt: now,
+			ExecuteAt: now.Add(delay),
+			Source:    source,
+		},
+	}
+
+	s.mu.Lock()
+	s.pending[entry.ID] = entry
+	entry.timer = s.clock.AfterFunc(delay, func() {
+		s.fire(entry.ID)
+	})
+	s.mu.Unlock()
+
+	logger.Info("Scheduled command", "id", entry.ID, "execute_at", entry.ExecuteAt)
+	s.notifyChange()
+
+	return entry.PendingCommand
+}
+
+// DeferUntilReady registers a command to be executed once the machine is
+// ready, see SetReady
+func (s *Scheduler) DeferUntilReady(source string, cmd lamarzocco.Command) PendingCommand {
+	cmd.In = ""
+	cmd.ReadyBy = ""
+
+	entry := &pendingEntry{
+		PendingCommand: PendingCommand{
+			ID:        uuid.New().String(),
+			Command:   cmd,
+			CreatedAt: s.now(),
+			WhenReady: true,
+			Source:    source,
+		},
+	}
+
+	s.mu.Lock()
+	s.pending[entry.ID] = entry
+	s.mu.Unlock()
+
+	logger.Info("Deferred command until the machine is ready", "id", entry.ID)
+	s.notifyChange()
+
+	return entry.PendingCommand
+}
+
+// SetReady executes the commands waiting for the machine to be ready, in the
+// order they were deferred
+func (s *Scheduler) SetReady() {
+	s.mu.Lock()
+	var due []*pendingEntry
+	for id, entry := range s.pending {
+		if entry.WhenReady {
+			due = append(due, entry)
+			delete(s.pending, id)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+
+	s.notifyChange()
+	for _, entry := range due {
+		logger.Info("Executing command deferred until the machine is ready", "id", entry.ID)
+		s.execute(entry.Source, entry.Command)
+	}
+}
+
+func (s *Scheduler) fire(id string) {
+	s.mu.Lock()
+	entry, ok := s.pending[id]
+	if ok {
+		delete(s.pending, id)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	logger.Info("Executing scheduled command", "id", id)
+	s.notifyChange()
+	s.execute(entry.Source, entry.Command)
+}
+
+// Cancel removes a pending command, returns false if it does not exist
+func (s *Scheduler) Cancel(id string) bool {
+	s.mu.Lock()
+	entry, ok := s.pending[id]
+	if ok {
+		entry.stop()
+		delete(s.pending, id)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		logger.Info("Cancelled scheduled command", "id", id)
+		s.notifyChange()
+	}
+	return ok
+}
+
+// CancelAll removes all pending commands and returns how many were cancelled
+func (s *Scheduler) CancelAll() int {
+	s.mu.Lock()
+	count := len(s.pending)
+	for id, entry := range s.pending {
+		entry.stop()
+		delete(s.pending, id)
+	}
+	s.mu.Unlock()
+
+	if count > 0 {
+		logger.Info("Cancelled all scheduled commands", "count", count)
+		s.notifyChange()
+	}
+	return count
+}
+
+// List returns all pending commands ordered by execution time, those waiting
+// for the machine last
+func (s *Scheduler) List() []PendingCommand {
+	s.mu.Lock()
+	result := make([]PendingCommand, 0, len(s.pending))
+	for _, entry := range s.pending {
+		result = append(result, entry.PendingCommand)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].WhenReady != result[j].WhenReady {
+			return result[j].WhenReady
+		}
+		if result[i].WhenReady {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ExecuteAt.Before(result[j].ExecuteAt)
+	})
+	return result
+}
+
+// Stop cancels all timers without executing them
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.pending {
+		entry.stop()
+	}
+}
+
+func (s *Scheduler) notifyChange() {
+	if s.onChange != nil {
+		s.onChange(s.List())
+	}
+}
@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+)
+
+func TestDeferUntilReady(t *testing.T) {
+	manual := clock.NewManual(time.Date(2026, time.March, 2, 7, 0, 0, 0, time.UTC))
+
+	var executed []lamarzocco.Command
+	var sources []string
+	s := New(func(source string, cmd lamarzocco.Command) error {
+		executed = append(executed, cmd)
+		sources = append(sources, source)
+		return nil
+	})
+	s.SetClock(manual)
+
+	backflush := true
+	dose := 36.0
+	s.DeferUntilReady("mqtt", lamarzocco.Command{BackFlush: &backflush})
+	manual.Advance(time.Second)
+	s.DeferUntilReady("web", lamarzocco.Command{Dose1: &dose})
+	cancelled := s.DeferUntilReady("web", lamarzocco.Command{Dose2: &dose})
+	s.Schedule("mqtt", lamarzocco.Command{Mode: "Dose1"}, time.Hour)
+
+	pending := s.List()
+	if len(pending) != 4 || pending[0].WhenReady || !pending[1].WhenReady || pending[1].Command.BackFlush == nil {
+		t.Fatalf("pending = %+v, want the timed command first, then the deferred ones in order", pending)
+	}
+	if !s.Cancel(cancelled.ID) {
+		t.Fatal("Cancel() = false for a deferred command")
+	}
+
+	s.SetReady()
+	if len(executed) != 2 || executed[0].BackFlush == nil || executed[1].Dose1 == nil {
+		t.Errorf("executed = %+v, want the back flush, then the dose", executed)
+	}
+	if !slices.Equal(sources, []string{"mqtt", "web"}) {
+		t.Errorf("sources = %v, want the sources the commands were deferred from", sources)
+	}
+	if pending := s.List(); len(pending) != 1 || pending[0].WhenReady {
+		t.Errorf("pending = %+v, want the timed command only", pending)
+	}
+}
@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"math"
+	"time"
+)
+
+// Location holds the coordinates used for sunrise/sunset calculation
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+const (
+	julianUnixEpoch = 2440587.5
+	julian2000      = 2451545.0
+)
+
+func rad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func deg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+func julianToTime(j float64) time.Time {
+	seconds := (j - julianUnixEpoch) * 86400
+	return time.Unix(int64(seconds), 0)
+}
+
+// SunTimes calculates sunrise and sunset for the calendar day of date at the
+// given location using the sunrise equation. ok is false during polar day or
+// night, when the sun does not rise or set.
+func SunTimes(date time.Time, loc Location) (sunrise, sunset time.Time, ok bool) {
+	y, m, d := date.Date()
+	noon := time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+	jd := float64(noon.Unix())/86400 + julianUnixEpoch
+
+	// Mean solar noon
+	n := math.Ceil(jd - julian2000 - 0.0009)
+	jStar := n + 0.0009 - loc.Longitude/360
+
+	// Solar mean anomaly and equation of the center
+	meanAnomaly := math.Mod(357.5291+0.98560028*jStar, 360)
+	ma := rad(meanAnomaly)
+	center := 1.9148*math.Sin(ma) + 0.0200*math.Sin(2*ma) + 0.0003*math.Sin(3*ma)
+
+	// Ecliptic longitude and solar transit
+	lambda := rad(math.Mod(meanAnomaly+center+180+102.9372, 360))
+	transit := julian2000 + jStar + 0.0053*math.Sin(ma) - 0.0069*math.Sin(2*lambda)
+
+	// Declination of the sun and hour angle
+	sinDecl := math.Sin(lambda) * math.Sin(rad(23.4397))
+	cosDecl := math.Cos(math.Asin(sinDecl))
+	cosOmega := (math.Sin(rad(-0.833)) - math.Sin(rad(loc.Latitude))*sinDecl) / (math.Cos(rad(loc.Latitude)) * cosDecl)
+	if cosOmega < -1 || cosOmega > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	omega := deg(math.Acos(cosOmega))
+
+	sunrise = julianToTime(transit - omega/360).In(date.Location())
+	sunset = julianToTime(transit + omega/360).In(date.Location())
+	return sunrise, sunset, true
+}
@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	baseClock   = ""
+	baseSunrise = "sunrise"
+	baseSunset  = "sunset"
+)
+
+// TimeSpec is a time of day, either fixed ("07:30") or relative to the sun
+// ("sunrise+30m", "sunset-1h").
+type TimeSpec struct {
+	base         string
+	hour, minute int           // Wall clock time for fixed times
+	offset       time.Duration // Offset from sunrise/sunset
+}
+
+func ParseTimeSpec(s string) (TimeSpec, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	for _, base := range []string{baseSunrise, baseSunset} {
+		if !strings.HasPrefix(s, base) {
+			continue
+		}
+		spec := TimeSpec{base: base}
+		rest := strings.TrimPrefix(s, base)
+		if rest == "" {
+			return spec, nil
+		}
+		if rest[0] != '+' && rest[0] != '-' {
+			return TimeSpec{}, fmt.Errorf("invalid offset in %q, expected e.g. %s+30m", s, base)
+		}
+		offset, err := time.ParseDuration(rest)
+		if err != nil {
+			return TimeSpec{}, fmt.Errorf("invalid offset in %q: %w", s, err)
+		}
+		spec.offset = offset
+		return spec, nil
+	}
+
+	clock, err := time.Parse("15:04", s)
+	if err != nil {
+		return TimeSpec{}, fmt.Errorf("invalid time %q, expected HH:MM, sunrise or sunset with optional offset", s)
+	}
+	return TimeSpec{
+		base:   baseClock,
+		hour:   clock.Hour(),
+		minute: clock.Minute(),
+	}, nil
+}
+
+// UsesSun reports whether the spec needs coordinates to be resolved
+func (t TimeSpec) UsesSun() bool {
+	return t.base != baseClock
+}
+
+// On resolves the spec on the calendar day of day. ok is false if the sun
+// does not rise or set on that day.
+func (t TimeSpec) On(day time.Time, loc Location) (time.Time, bool) {
+	y, m, d := day.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, day.Location())
+
+	switch t.base {
+	case baseSunrise, baseSunset:
+		sunrise, sunset, ok := SunTimes(midnight, loc)
+		if !ok {
+			return time.Time{}, false
+		}
+		if t.base == baseSunrise {
+			return sunrise.Add(t.offset), true
+		}
+		return sunset.Add(t.offset), true
+	default:
+		// Not midnight plus an offset, days with a DST change are shorter or longer
+		return time.Date(y, m, d, t.hour, t.minute, 0, 0, day.Location()), true
+	}
+}
+
+// TimeWindow is a daily window between two time specs. Windows where from is
+// after to wrap around midnight.
+type TimeWindow struct {
+	From TimeSpec
+	To   TimeSpec
+}
+
+func ParseTimeWindow(from, to string) (TimeWindow, error) {
+	fromSpec, err := ParseTimeSpec(from)
+	if err != nil {
+		return TimeWindow{}, err
+	}
+	toSpec, err := ParseTimeSpec(to)
+	if err != nil {
+		return TimeWindow{}, err
+	}
+	return TimeWindow{From: fromSpec, To: toSpec}, nil
+}
+
+// Contains reports whether t lies within the window
+func (w TimeWindow) Contains(t time.Time, loc Location) bool {
+	from, ok := w.From.On(t, loc)
+	if !ok {
+		return false
+	}
+	to, ok := w.To.On(t, loc)
+	if !ok {
+		return false
+	}
+
+	if !from.After(to) {
+		return !t.Before(from) && t.Before(to)
+	}
+	// Wraps around midnight
+	return !t.Before(from) || t.Before(to)
+}
@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeSpecOnDSTChange(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	spec, err := ParseTimeSpec("07:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		day  time.Time
+	}{
+		{"regular day", time.Date(2026, time.March, 20, 12, 0, 0, 0, berlin)},
+		{"clocks go forward", time.Date(2026, time.March, 29, 12, 0, 0, 0, berlin)},
+		{"clocks go back", time.Date(2026, time.October, 25, 12, 0, 0, 0, berlin)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, ok := spec.On(tt.day, Location{})
+			if !ok {
+				t.Fatal("On() not ok")
+			}
+			if at.Hour() != 7 || at.Minute() != 0 {
+				t.Errorf("On() = %s, want 07:00 local time", at.Format("15:04 MST"))
+			}
+			if y, m, d := at.Date(); y != tt.day.Year() || m != tt.day.Month() || d != tt.day.Day() {
+				t.Errorf("On() = %s, want the same day", at)
+			}
+		})
+	}
+}
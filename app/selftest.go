@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/selftest"
+	"github.com/philipparndt/go-logger"
+)
+
+const maxClockSkew = time.Minute
+
+// selfTest checks a deployment and publishes the report to <topic>/selftest
+func (g *gateway) selfTest() selftest.Report {
+	report := selftest.Run([]selftest.Check{
+		{Name: "config", Run: g.checkConfig},
+		{Name: "mqtt", Run: g.checkMQTT},
+		{Name: "cloud_auth", Run: g.checkCloudAuth},
+		{Name: "machine", Run: g.checkMachine},
+		{Name: "storage", Run: g.checkStorage},
+		{Name: "clock", Run: g.checkClock},
+	})
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		logger.Error("Failed to marshal self-test report", err)
+		return report
+	}
+	g.publish(g.cfg.MQTT.Topic+"/selftest", data, true)
+	logger.Info("Self-test finished", "passed", report.Passed)
+	return report
+}
+
+// checkConfig covers settings LoadConfig cannot reject on its own
+func (g *gateway) checkConfig() (string, error) {
+	if g.cfg.LaMarzocco.Username == "" {
+		credentials, err := g.store.LoadCredentials()
+		if err != nil {
+			return "", err
+		}
+		if credentials == nil {
+			return "", errors.New("lamarzocco.username is empty and no credentials are stored")
+		}
+	}
+	return fmt.Sprintf("valid, %d triggers, %d schedules, %d additional accounts",
+		len(g.cfg.Triggers), len(g.cfg.Schedules), len(g.cfg.Accounts)), nil
+}
+
+// checkMQTT publishes a nonce and waits until the broker delivers it back
+func (g *gateway) checkMQTT() (string, error) {
+	rtt, err := g.mqttRoundTrip()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("round trip in %dms", rtt.Milliseconds()), nil
+}
+
+func (g *gateway) checkCloudAuth() (string, error) {
+	if err := g.client.CheckAuth(g.ctx); err != nil {
+		return "", err
+	}
+	return "authenticated", nil
+}
+
+func (g *gateway) checkMachine() (string, error) {
+	// Not connected yet when running with --selftest
+	connect := g.client.Refresh
+	if g.client.GetStatus().Serial == "" {
+		connect = g.client.Connect
+	}
+	if err := connect(g.ctx); err != nil {
+		return "", err
+	}
+
+	status := g.client.GetStatus()
+	return fmt.Sprintf("%s %s reachable via %s", status.Model, status.Serial, status.Transport), nil
+}
+
+// checkStorage creates a file next to the state and in the backup directory
+func (g *gateway) checkStorage() (string, error) {
+	dirs := []string{filepath.Dir(g.cfg.Storage.Path)}
+	if g.cfg.Backup != nil && g.cfg.Backup.Path != "" {
+		dirs = append(dirs, g.cfg.Backup.Path)
+	}
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("%s cannot be created: %w", dir, err)
+		}
+		file, err := os.CreateTemp(dir, ".selftest-*")
+		if err != nil {
+			return "", fmt.Errorf("%s is not writable: %w", dir, err)
+		}
+		_, err = file.WriteString("ok")
+		file.Close()
+		os.Remove(file.Name())
+		if err != nil {
+			return "", fmt.Errorf("%s is not writable: %w", dir, err)
+		}
+	}
+	return fmt.Sprintf("%d directories writable", len(dirs)), nil
+}
+
+// checkClock compares the local time with the API server, tokens and
+// schedules depend on it
+func (g *gateway) checkClock() (string, error) {
+	server, err := g.client.ServerTime(g.ctx)
+	if err != nil {
+		return "", err
+	}
+
+	now := g.clock.Now()
+	skew := now.Sub(server)
+	if skew.Abs() > maxClockSkew {
+		return "", fmt.Errorf("local clock is off by %s", skew.Round(time.Second))
+	}
+	return fmt.Sprintf("off by %s, time zone %s", skew.Round(time.Millisecond), now.Location()), nil
+}
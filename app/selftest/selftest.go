@@ -0,0 +1,50 @@
+// Package selftest runs a list of deployment checks and collects a pass/fail
+// report, e.g. to verify a new installation.
+package selftest
+
+import (
+	"time"
+)
+
+// Check is a single named test, Run returns a short description of the result
+type Check struct {
+	Name string
+	Run  func() (string, error)
+}
+
+type Result struct {
+	Name     string  `json:"name"`
+	Passed   bool    `json:"passed"`
+	Message  string  `json:"message,omitempty"`
+	Duration float64 `json:"duration"` // Seconds
+}
+
+type Report struct {
+	Passed    bool      `json:"passed"`
+	StartedAt time.Time `json:"startedAt"`
+	Duration  float64   `json:"duration"` // Seconds
+	Checks    []Result  `json:"checks"`
+}
+
+// Run executes all checks in order, a failing check does not stop the others
+func Run(checks []Check) Report {
+	report := Report{Passed: true, StartedAt: time.Now()}
+	for _, check := range checks {
+		started := time.Now()
+		message, err := check.Run()
+
+		result := Result{
+			Name:     check.Name,
+			Passed:   err == nil,
+			Message:  message,
+			Duration: time.Since(started).Seconds(),
+		}
+		if err != nil {
+			result.Message = err.Error()
+			report.Passed = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	report.Duration = time.Since(report.StartedAt).Seconds()
+	return report
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/config"
+	"github.com/philipparndt/go-logger"
+)
+
+// runOnStart runs the on_start actions in order once the gateway is connected,
+// e.g. to restore the machine settings after a power outage. A failing action
+// is logged and the next one runs.
+func (g *gateway) runOnStart() {
+	for i, action := range g.cfg.OnStart {
+		if g.ctx.Err() != nil {
+			return
+		}
+		if err := g.runStartupAction(action); err != nil {
+			logger.Error("Startup action failed", "index", i, "error", err)
+			continue
+		}
+		logger.Debug("Startup action done", "index", i)
+	}
+}
+
+func (g *gateway) runStartupAction(action config.StartupAction) error {
+	switch {
+	case action.Refresh:
+		return g.client.Refresh(g.ctx)
+	case action.Notify != "":
+		g.publishEvent("gateway_started", map[string]interface{}{
+			"message": action.Notify,
+		})
+		return nil
+	case len(action.Command) > 0:
+		cmd, err := lamarzocco.ParseCommand(action.Command)
+		if err != nil {
+			return err
+		}
+		if cmd.Requester == "" {
+			cmd.Requester = "on_start"
+		}
+		// Deferred and cancelling commands take the usual path
+		if cmd.HasDelay() || cmd.HasReadyBy() || cmd.HasCancel() {
+			return g.handleCommand(sourceStartup, action.Command)
+		}
+		g.recordCommand(sourceStartup, cmd.Kinds(), cmd.Requester)
+		return g.runCommand(sourceStartup, *cmd)
+	}
+	return fmt.Errorf("empty startup action")
+}
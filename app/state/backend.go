@@ -0,0 +1,183 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Backend persists the state. Save is called with the complete state after
+// every update, backends should only write what changed.
+type Backend interface {
+	// Load returns the stored state, found is false if nothing was stored yet
+	Load() (state State, found bool, err error)
+	Save(state State) error
+	Close() error
+}
+
+const (
+	BackendBolt   = "bbolt"
+	BackendSQLite = "sqlite"
+	BackendJSON   = "json"
+)
+
+// OpenStorage opens the store with the named backend. If the backend is empty
+// and legacyFile (a JSON state file of an earlier version) exists, its state
+// is imported.
+func OpenStorage(kind, path, legacyFile string) (*Store, error) {
+	var backend Backend
+	var err error
+	switch kind {
+	case BackendBolt, "":
+		backend, err = NewBoltBackend(path)
+	case BackendSQLite:
+		backend, err = NewSQLiteBackend(path)
+	case BackendJSON:
+		backend = NewJSONBackend(path)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q, expected bbolt, sqlite or json", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if kind != BackendJSON && legacyFile != "" {
+		if err := importLegacy(backend, legacyFile); err != nil {
+			backend.Close()
+			return nil, err
+		}
+	}
+
+	return OpenBackend(backend)
+}
+
+func importLegacy(backend Backend, legacyFile string) error {
+	if _, found, err := backend.Load(); err != nil || found {
+		return err
+	}
+
+	legacy, found, err := NewJSONBackend(legacyFile).Load()
+	if err != nil || !found {
+		return err
+	}
+
+	if err := backend.Save(legacy); err != nil {
+		return fmt.Errorf("failed to import %s: %w", legacyFile, err)
+	}
+	logger.Info("Imported state file, it is no longer used", "path", legacyFile)
+	return nil
+}
+
+// jsonBackend stores the state as a single JSON file
+type jsonBackend struct {
+	path string
+}
+
+func NewJSONBackend(path string) Backend {
+	return &jsonBackend{path: path}
+}
+
+func (b *jsonBackend) Load() (State, bool, error) {
+	var state State
+
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, false, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	return state, true, nil
+}
+
+func (b *jsonBackend) Save(state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated state
+	tmp := b.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, b.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+func (b *jsonBackend) Close() error {
+	return nil
+}
+
+// splitHistory returns the state without history as JSON and the history
+// records, for backends that store brews separately
+func splitHistory(state State) ([]byte, []BrewRecord, error) {
+	history := state.History
+	state.History = nil
+	data, err := json.Marshal(state)
+	return data, history, err
+}
+
+// historyDiff tracks the serialized records of the last save, so only
+// changed records are written
+type historyDiff struct {
+	saved map[string][]byte
+}
+
+// changes returns the records to write (serialized) and the IDs to delete
+func (d *historyDiff) changes(history []BrewRecord) (map[string][]byte, []string, error) {
+	current := make(map[string][]byte, len(history))
+	changed := make(map[string][]byte)
+	for _, record := range history {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, nil, err
+		}
+		current[record.ID] = data
+		if previous, ok := d.saved[record.ID]; !ok || string(previous) != string(data) {
+			changed[record.ID] = data
+		}
+	}
+
+	var removed []string
+	for id := range d.saved {
+		if _, ok := current[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	return changed, removed, nil
+}
+
+// commit remembers the state of a successful save
+func (d *historyDiff) commit(changed map[string][]byte, removed []string) {
+	if d.saved == nil {
+		d.saved = make(map[string][]byte, len(changed))
+	}
+	for id, data := range changed {
+		d.saved[id] = data
+	}
+	for _, id := range removed {
+		delete(d.saved, id)
+	}
+}
+
+// sortHistory orders records loaded from a backend by start time
+func sortHistory(history []BrewRecord) {
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].StartedAt.Before(history[j].StartedAt)
+	})
+}
@@ -0,0 +1,122 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltStateBucket   = []byte("state")
+	boltHistoryBucket = []byte("history")
+	boltStateKey      = []byte("state")
+)
+
+// boltBackend stores the state in a bbolt database, brews are stored
+// individually so adding one does not rewrite the whole history
+type boltBackend struct {
+	db   *bolt.DB
+	diff historyDiff
+}
+
+func NewBoltBackend(path string) (Backend, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltStateBucket, boltHistoryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	return &boltBackend{db: db}, nil
+}
+
+func (b *boltBackend) Load() (State, bool, error) {
+	var state State
+	found := false
+	saved := make(map[string][]byte)
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(boltStateBucket).Get(boltStateKey); data != nil {
+			found = true
+			if err := json.Unmarshal(data, &state); err != nil {
+				return fmt.Errorf("failed to parse state: %w", err)
+			}
+		}
+
+		return tx.Bucket(boltHistoryBucket).ForEach(func(id, data []byte) error {
+			var record BrewRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return fmt.Errorf("failed to parse brew %s: %w", id, err)
+			}
+			state.History = append(state.History, record)
+			saved[string(id)] = append([]byte(nil), data...)
+			return nil
+		})
+	})
+	if err != nil {
+		return State{}, false, err
+	}
+
+	sortHistory(state.History)
+	b.diff.saved = saved
+	return state, found, nil
+}
+
+func (b *boltBackend) Save(state State) error {
+	data, history, err := splitHistory(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	changed, removed, err := b.diff.changes(history)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(boltStateBucket).Put(boltStateKey, data); err != nil {
+			return err
+		}
+
+		bucket := tx.Bucket(boltHistoryBucket)
+		for id, record := range changed {
+			if err := bucket.Put([]byte(id), record); err != nil {
+				return err
+			}
+		}
+		for _, id := range removed {
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	b.diff.commit(changed, removed)
+	return nil
+}
+
+func (b *boltBackend) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,128 @@
+package state
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+)
+
+var ErrCredentialsLocked = errors.New("stored credentials are encrypted, but no encryption key is configured")
+
+// EncryptionKeySize is the length of the AES-256 credential key
+const EncryptionKeySize = 32
+
+// LoadEncryptionKey decodes the credential key from a secret, or from the
+// content of file if secret is empty. Returns nil if neither is set.
+func LoadEncryptionKey(secret, file string) ([]byte, error) {
+	if secret == "" && file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key: %w", err)
+		}
+		secret = strings.TrimSpace(string(data))
+		if secret == "" {
+			return nil, fmt.Errorf("encryption key file %s is empty", file)
+		}
+	}
+	if secret == "" {
+		return nil, nil
+	}
+
+	return parseEncryptionKey(secret)
+}
+
+// parseEncryptionKey accepts 32 random bytes as hex or base64. Passphrases are
+// rejected, a fast hash of them would make the key easy to guess.
+func parseEncryptionKey(secret string) ([]byte, error) {
+	if key, err := hex.DecodeString(secret); err == nil && len(key) == EncryptionKeySize {
+		return key, nil
+	}
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if key, err := encoding.DecodeString(secret); err == nil && len(key) == EncryptionKeySize {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("encryption key must be %d random bytes as hex or base64, e.g. from `openssl rand -hex %d`", EncryptionKeySize, EncryptionKeySize)
+}
+
+// SetEncryptionKey enables encryption of the credentials at rest. Plain
+// credentials of earlier versions are encrypted right away.
+func (s *Store) SetEncryptionKey(key []byte) error {
+	s.mu.Lock()
+	s.key = key
+	s.mu.Unlock()
+
+	if plain := s.Get().Credentials; plain != nil && key != nil {
+		return s.SaveCredentials(plain)
+	}
+	return nil
+}
+
+func (s *Store) encryptionKey() []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.key
+}
+
+func encryptCredentials(key []byte, credentials *lamarzocco.Credentials) (string, error) {
+	plain, err := json.Marshal(credentials)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptCredentials(key []byte, encoded string) (*lamarzocco.Credentials, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted credentials: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted credentials")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credentials, wrong encryption key?")
+	}
+
+	var credentials lamarzocco.Credentials
+	if err := json.Unmarshal(plain, &credentials); err != nil {
+		return nil, fmt.Errorf("invalid encrypted credentials: %w", err)
+	}
+	return &credentials, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
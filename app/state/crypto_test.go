@@ -0,0 +1,37 @@
+package state
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseEncryptionKey(t *testing.T) {
+	want := bytes.Repeat([]byte{0xab}, EncryptionKeySize)
+
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{"hex", hex.EncodeToString(want), false},
+		{"base64", base64.StdEncoding.EncodeToString(want), false},
+		{"raw url base64", base64.RawURLEncoding.EncodeToString(want), false},
+		{"passphrase", "correct horse battery staple", true},
+		{"short hex", hex.EncodeToString(want[:16]), true},
+		{"long base64", base64.StdEncoding.EncodeToString(append(want, 0)), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseEncryptionKey(tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEncryptionKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(key, want) {
+				t.Errorf("parseEncryptionKey() = %x, want %x", key, want)
+			}
+		})
+	}
+}
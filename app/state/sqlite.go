@@ -0,0 +1,165 @@
+package state
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// The brews table has a column per field for SQL queries, data holds the
+// complete record
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS state (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS brews (
+	id            TEXT PRIMARY KEY,
+	started_at    TEXT NOT NULL,
+	ended_at      TEXT NOT NULL,
+	duration      REAL,
+	mode          TEXT,
+	target_weight REAL,
+	profile       TEXT,
+	ground_weight REAL,
+	dose          REAL,
+	ratio         REAL,
+	rating        INTEGER,
+	note          TEXT,
+	data          TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS brews_started_at ON brews (started_at);
+`
+
+// sqliteBackend stores the state in a SQLite database, so the brew history
+// can be queried with SQL
+type sqliteBackend struct {
+	db   *sql.DB
+	diff historyDiff
+}
+
+func NewSQLiteBackend(path string) (Backend, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite allows a single writer, the store serializes updates anyway
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	return &sqliteBackend{db: db}, nil
+}
+
+func (b *sqliteBackend) Load() (State, bool, error) {
+	var state State
+	found := false
+
+	var value string
+	err := b.db.QueryRow(`SELECT value FROM state WHERE key = 'state'`).Scan(&value)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return State{}, false, fmt.Errorf("failed to read state: %w", err)
+	default:
+		found = true
+		if err := json.Unmarshal([]byte(value), &state); err != nil {
+			return State{}, false, fmt.Errorf("failed to parse state: %w", err)
+		}
+	}
+
+	rows, err := b.db.Query(`SELECT id, data FROM brews ORDER BY started_at`)
+	if err != nil {
+		return State{}, false, fmt.Errorf("failed to read history: %w", err)
+	}
+	defer rows.Close()
+
+	saved := make(map[string][]byte)
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return State{}, false, fmt.Errorf("failed to read history: %w", err)
+		}
+		var record BrewRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return State{}, false, fmt.Errorf("failed to parse brew %s: %w", id, err)
+		}
+		state.History = append(state.History, record)
+		saved[id] = []byte(data)
+	}
+	if err := rows.Err(); err != nil {
+		return State{}, false, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	sortHistory(state.History)
+	b.diff.saved = saved
+	return state, found, nil
+}
+
+func (b *sqliteBackend) Save(state State) error {
+	data, history, err := splitHistory(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	changed, removed, err := b.diff.changes(history)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO state (key, value) VALUES ('state', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, string(data)); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	for _, record := range history {
+		recordData, ok := changed[record.ID]
+		if !ok {
+			continue
+		}
+		_, err := tx.Exec(`INSERT OR REPLACE INTO brews
+			(id, started_at, ended_at, duration, mode, target_weight, profile, ground_weight, dose, ratio, rating, note, data)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			record.ID, record.StartedAt.UTC().Format(sqliteTimeFormat), record.EndedAt.UTC().Format(sqliteTimeFormat),
+			record.Duration, string(record.Mode), record.TargetWeight, record.Profile, record.GroundWeight,
+			record.Dose, record.Ratio, record.Rating, record.Note, string(recordData))
+		if err != nil {
+			return fmt.Errorf("failed to save brew %s: %w", record.ID, err)
+		}
+	}
+	for _, id := range removed {
+		if _, err := tx.Exec(`DELETE FROM brews WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete brew %s: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	b.diff.commit(changed, removed)
+	return nil
+}
+
+func (b *sqliteBackend) Close() error {
+	return b.db.Close()
+}
+
+// sqliteTimeFormat sorts lexically and is understood by SQLite date functions
+const sqliteTimeFormat = "2006-01-02 15:04:05.000"
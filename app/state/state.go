@@ -0,0 +1,234 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/philipparndt/go-logger"
+)
+
+// Profile is a named set of machine settings for a bean or recipe
+type Profile struct {
+	Name              string   `json:"name"`
+	Bean              string   `json:"bean,omitempty"`
+	Dose1             *float64 `json:"dose1,omitempty"`             // Target weight in grams
+	Dose2             *float64 `json:"dose2,omitempty"`             // Target weight in grams
+	CoffeeTemperature *float64 `json:"coffeeTemperature,omitempty"` // Coffee boiler target in °C
+	Notes             string   `json:"notes,omitempty"`
+}
+
+// BrewRecord is a brew history entry
+type BrewRecord struct {
+	ID string `json:"id"`
+	lamarzocco.BrewEvent
+	Profile      string  `json:"profile,omitempty"`
+	GroundWeight float64 `json:"groundWeight,omitempty"` // Input dose in grams reported by the grinder
+	Dose         float64 `json:"dose"`                   // Input dose in grams (grinder or configured default)
+	Ratio        float64 `json:"ratio,omitempty"`        // Output weight / input dose
+
+	Rating      int       `json:"rating,omitempty"` // 1 (worst) to 5 (best)
+	Note        string    `json:"note,omitempty"`
+	AnnotatedAt time.Time `json:"annotatedAt,omitempty"`
+}
+
+// DailyRollup aggregates the brews of one local day that were removed from
+// the history. Sums are kept so rollups can be merged.
+type DailyRollup struct {
+	Day          string  `json:"day"` // YYYY-MM-DD
+	Shots        int     `json:"shots"`
+	Dose         float64 `json:"dose"`         // Grams of ground coffee
+	TargetWeight float64 `json:"targetWeight"` // Grams of espresso (brew-by-weight shots)
+	RatioShots   int     `json:"ratioShots"`
+	RatioSum     float64 `json:"ratioSum"`
+	RatedShots   int     `json:"ratedShots"`
+	RatingSum    int     `json:"ratingSum"`
+}
+
+// BeanInventory tracks the remaining beans of the active bag
+type BeanInventory struct {
+	Bean      string    `json:"bean,omitempty"`
+	BagSize   float64   `json:"bagSize"`   // Grams
+	Remaining float64   `json:"remaining"` // Grams
+	OpenedAt  time.Time `json:"openedAt,omitempty"`
+}
+
+// WaterUsage holds estimated water consumption in milliliters
+type WaterUsage struct {
+	Total           float64            `json:"total"`
+	SinceFilter     float64            `json:"sinceFilter"`
+	FilterChangedAt time.Time          `json:"filterChangedAt,omitempty"`
+	Daily           map[string]float64 `json:"daily,omitempty"` // Keyed by local date (YYYY-MM-DD)
+}
+
+// Maintenance holds runtime accounting, all durations in seconds of powered-on time
+type Maintenance struct {
+	OnTime            float64            `json:"onTime"`
+	DailyOnTime       map[string]float64 `json:"dailyOnTime,omitempty"` // Keyed by local date (YYYY-MM-DD)
+	LastBackflush     time.Time          `json:"lastBackflush,omitempty"`
+	OnTimeAtBackflush float64            `json:"onTimeAtBackflush"`
+	LastDescale       time.Time          `json:"lastDescale,omitempty"`
+	OnTimeAtDescale   float64            `json:"onTimeAtDescale"`
+
+	ShotsSinceBackflush int `json:"shotsSinceBackflush"`
+	MachineCoffees      int `json:"machineCoffees,omitempty"`     // Coffee counter of the machine at the last statistics fetch
+	MachineBackflushes  int `json:"machineBackflushes,omitempty"` // Backflush counter of the machine at the last statistics fetch
+	CoffeesAtBackflush  int `json:"coffeesAtBackflush,omitempty"` // Coffee counter of the machine at the last backflush, 0 if unknown
+}
+
+// WarmupSample is one observed cold start, from power-on until the coffee boiler was ready
+type WarmupSample struct {
+	PoweredOnAt time.Time `json:"poweredOnAt"`
+	Seconds     float64   `json:"seconds"`
+	Ambient     *float64  `json:"ambient,omitempty"` // °C at power-on, if known
+}
+
+// FormatVersion is the format of the stored state. State of a later format,
+// written by a newer gateway, is not loaded so it is not overwritten.
+const FormatVersion = 1
+
+// State is the gateway state persisted across restarts
+type State struct {
+	Version         int            `json:"version,omitempty"` // Format, see FormatVersion; 0 before it was stored
+	LastBrew        time.Time      `json:"lastBrew,omitempty"`
+	AutoOnSuspended bool           `json:"autoOnSuspended,omitempty"`
+	Profiles        []Profile      `json:"profiles,omitempty"`
+	ActiveProfile   string         `json:"activeProfile,omitempty"`
+	History         []BrewRecord   `json:"history,omitempty"`
+	HistoryRollups  []DailyRollup  `json:"historyRollups,omitempty"` // Ordered by day
+	Inventory       *BeanInventory `json:"inventory,omitempty"`
+	TargetRatio     float64        `json:"targetRatio,omitempty"`
+	Water           *WaterUsage    `json:"water,omitempty"`
+	Maintenance     *Maintenance   `json:"maintenance,omitempty"`
+	Warmup          []WarmupSample `json:"warmup,omitempty"`
+
+	Credentials          *lamarzocco.Credentials `json:"credentials,omitempty"`
+	EncryptedCredentials string                  `json:"encryptedCredentials,omitempty"` // AES-GCM sealed Credentials, see SetEncryptionKey
+}
+
+func (s State) clone() State {
+	s.Profiles = append([]Profile(nil), s.Profiles...)
+	s.History = append([]BrewRecord(nil), s.History...)
+	s.HistoryRollups = append([]DailyRollup(nil), s.HistoryRollups...)
+	s.Warmup = append([]WarmupSample(nil), s.Warmup...)
+	if s.Inventory != nil {
+		inventory := *s.Inventory
+		s.Inventory = &inventory
+	}
+	if s.Water != nil {
+		water := *s.Water
+		water.Daily = make(map[string]float64, len(s.Water.Daily))
+		for day, ml := range s.Water.Daily {
+			water.Daily[day] = ml
+		}
+		s.Water = &water
+	}
+	if s.Maintenance != nil {
+		maintenance := *s.Maintenance
+		maintenance.DailyOnTime = make(map[string]float64, len(s.Maintenance.DailyOnTime))
+		for day, seconds := range s.Maintenance.DailyOnTime {
+			maintenance.DailyOnTime[day] = seconds
+		}
+		s.Maintenance = &maintenance
+	}
+	if s.Credentials != nil {
+		credentials := *s.Credentials
+		s.Credentials = &credentials
+	}
+	return s
+}
+
+var ErrClosed = errors.New("state store closed")
+
+type Store struct {
+	backend Backend
+	state   State
+	closed  bool
+	key     []byte // Credential encryption key, nil stores them in plain text
+	mu      sync.RWMutex
+}
+
+// Open loads the state file, a missing file results in an empty state
+func Open(path string) (*Store, error) {
+	return OpenBackend(NewJSONBackend(path))
+}
+
+// OpenBackend loads the state from the backend
+func OpenBackend(backend Backend) (*Store, error) {
+	loaded, found, err := backend.Load()
+	if err != nil {
+		backend.Close()
+		return nil, err
+	}
+	if !found {
+		logger.Info("No stored state found, starting with empty state")
+	}
+	if loaded.Version > FormatVersion {
+		backend.Close()
+		return nil, fmt.Errorf("the state has format %d, this version reads up to %d: upgrade the gateway or restore a backup", loaded.Version, FormatVersion)
+	}
+	return &Store{backend: backend, state: loaded}, nil
+}
+
+// Get returns a copy of the state that is safe to use while it is updated
+func (s *Store) Get() State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.clone()
+}
+
+// Update modifies the state and persists it
+func (s *Store) Update(fn func(*State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(&s.state)
+	s.state.Version = FormatVersion
+	if s.closed {
+		return ErrClosed
+	}
+	return s.backend.Save(s.state)
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.backend.Close()
+}
+
+// LoadCredentials implements lamarzocco.StateStore
+func (s *Store) LoadCredentials() (*lamarzocco.Credentials, error) {
+	current := s.Get()
+	if current.EncryptedCredentials == "" {
+		return current.Credentials, nil
+	}
+
+	key := s.encryptionKey()
+	if key == nil {
+		return nil, ErrCredentialsLocked
+	}
+	return decryptCredentials(key, current.EncryptedCredentials)
+}
+
+// SaveCredentials implements lamarzocco.StateStore
+func (s *Store) SaveCredentials(credentials *lamarzocco.Credentials) error {
+	var encrypted string
+	if key := s.encryptionKey(); key != nil && credentials != nil {
+		var err error
+		if encrypted, err = encryptCredentials(key, credentials); err != nil {
+			return fmt.Errorf("failed to encrypt credentials: %w", err)
+		}
+		credentials = nil
+	}
+
+	return s.Update(func(state *State) {
+		state.Credentials = credentials
+		state.EncryptedCredentials = encrypted
+	})
+}
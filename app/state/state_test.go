@@ -0,0 +1,37 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := store.Update(func(state *State) { state.TargetRatio = 2 }); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	store.Close()
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if version := store.Get().Version; version != FormatVersion {
+		t.Errorf("version = %d, want %d", version, FormatVersion)
+	}
+	store.Close()
+
+	// State of a newer gateway is not loaded, so it is not overwritten
+	if err := os.WriteFile(path, []byte(`{"version":99,"targetRatio":2}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("Open() of a newer format succeeded, want an error")
+	}
+}
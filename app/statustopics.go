@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// flattenStatus returns the values of a status message by their path, e.g.
+// "boilers/coffee/ready". Strings are unquoted, arrays stay JSON.
+func flattenStatus(data []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var status map[string]any
+	if err := decoder.Decode(&status); err != nil {
+		return nil, err
+	}
+
+	flat := make(map[string]string)
+	var walk func(path string, value any)
+	walk = func(path string, value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			for key, child := range v {
+				if path != "" {
+					key = path + "/" + key
+				}
+				walk(key, child)
+			}
+		case nil:
+		case string:
+			flat[path] = v
+		case json.Number:
+			flat[path] = v.String()
+		case bool:
+			flat[path] = strconv.FormatBool(v)
+		default: // Arrays
+			raw, _ := json.Marshal(v)
+			flat[path] = string(raw)
+		}
+	}
+	walk("", status)
+	return flat, nil
+}
+
+// publishStatusTopics publishes the values of the status message that changed
+// retained to <topic>/status/<path>, for consumers that cannot parse JSON.
+// Values that are no longer part of the status are removed.
+func (g *gateway) publishStatusTopics(data []byte) {
+	values, err := flattenStatus(data)
+	if err != nil {
+		logger.Error("Failed to flatten status", "error", err)
+		return
+	}
+	prefix := g.cfg.MQTT.Topic + "/status/"
+
+	g.statusTopicsMu.Lock()
+	defer g.statusTopicsMu.Unlock()
+	for path, value := range values {
+		if last, ok := g.statusTopics[path]; !ok || last != value {
+			g.publish(prefix+path, []byte(value), true)
+		}
+	}
+	for path := range g.statusTopics {
+		if _, ok := values[path]; !ok {
+			g.unpublish(prefix + path)
+		}
+	}
+	g.statusTopics = values
+}
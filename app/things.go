@@ -0,0 +1,132 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/philipparndt/go-logger"
+)
+
+// machineList returns the gateways of the other machines of the account
+func (g *gateway) machineList() []*gateway {
+	g.machinesMu.RLock()
+	defer g.machinesMu.RUnlock()
+	return slices.Clone(g.machines)
+}
+
+// watchThings re-fetches the machines of the account every interval, so a
+// machine bought or sold does not need a restart of the gateway
+func (g *gateway) watchThings(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-g.stopCh:
+			return
+		}
+
+		things, err := g.client.RefreshThings(g.ctx)
+		if err != nil {
+			logger.Warn("Failed to refresh the machines of the account", "error", err)
+			continue
+		}
+		g.syncMachines(things)
+	}
+}
+
+// syncMachines starts the machines that were added to the account, or failed
+// to start before, and stops those that were removed. Each change of the
+// account is published as machine_added or machine_removed event.
+func (g *gateway) syncMachines(things []lamarzocco.Thing) {
+	previous := g.things
+	g.things = things
+	known := func(list []lamarzocco.Thing, serial string) bool {
+		return slices.ContainsFunc(list, func(t lamarzocco.Thing) bool { return t.SerialNumber == serial })
+	}
+
+	changed := false
+	for _, thing := range things {
+		if !known(previous, thing.SerialNumber) {
+			logger.Info("Machine added to the account", "serial", g.client.DeviceID(thing.SerialNumber), "model", thing.ModelName)
+			g.publishEvent("machine_added", g.thingEvent(thing))
+		}
+		if g.servesMachine(thing.SerialNumber) {
+			continue
+		}
+		if m := g.startMachine(thing); m != nil {
+			changed = true
+			if g.webServer != nil && m.webServer != nil {
+				g.webServer.MountMachine(g.client.DeviceID(m.machine), m.webServer)
+			}
+		}
+	}
+
+	for _, thing := range previous {
+		if known(things, thing.SerialNumber) {
+			continue
+		}
+		id := g.client.DeviceID(thing.SerialNumber)
+		logger.Info("Machine removed from the account", "serial", id, "model", thing.ModelName)
+		g.publishEvent("machine_removed", g.thingEvent(thing))
+		if !g.removeMachine(thing.SerialNumber) && id == g.client.GetStatus().Serial {
+			logger.Warn("The machine of the base topic was removed from the account, it is served until the gateway restarts", "serial", id)
+		}
+		changed = true
+	}
+
+	if changed {
+		g.subscribeToBroadcast()
+		if len(g.machineList()) == 0 {
+			g.clearAggregate()
+		} else {
+			g.publishAggregate()
+		}
+	}
+}
+
+// servesMachine reports whether the gateway or one of its machines serves the
+// machine with the serial
+func (g *gateway) servesMachine(serial string) bool {
+	if g.client.DeviceID(serial) == g.client.GetStatus().Serial {
+		return true
+	}
+	return slices.ContainsFunc(g.machineList(), func(m *gateway) bool { return m.machine == serial })
+}
+
+// removeMachine stops serving a machine and removes its retained topics, false
+// if it was not served
+func (g *gateway) removeMachine(serial string) bool {
+	g.machinesMu.Lock()
+	i := slices.IndexFunc(g.machines, func(m *gateway) bool { return m.machine == serial })
+	if i < 0 {
+		g.machinesMu.Unlock()
+		return false
+	}
+	m := g.machines[i]
+	g.machines = slices.Delete(g.machines, i, i+1)
+	g.machinesMu.Unlock()
+
+	if g.webServer != nil {
+		g.webServer.UnmountMachine(g.client.DeviceID(m.machine))
+	}
+	m.stop()
+	m.unpublish()
+	logger.Info("Machine stopped", "serial", g.client.DeviceID(serial), "topic", m.cfg.MQTT.Topic)
+	return true
+}
+
+// thingEvent describes a machine of the account in machine_added and
+// machine_removed events
+func (g *gateway) thingEvent(thing lamarzocco.Thing) map[string]interface{} {
+	event := map[string]interface{}{
+		"serial": g.client.DeviceID(thing.SerialNumber),
+		"model":  thing.ModelName,
+	}
+	if thing.Name != "" {
+		event["name"] = thing.Name
+	}
+	return event
+}
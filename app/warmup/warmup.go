@@ -0,0 +1,220 @@
+package warmup
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/philipparndt/go-logger"
+)
+
+const (
+	bucketSize = 5.0 // °C per ambient temperature bucket
+	maxSamples = 200
+	// Longer heat-ups are not plausible cold starts, e.g. the machine lost its connection
+	maxWarmup = time.Hour
+
+	// DefaultEstimate is used until the first cold start was observed
+	DefaultEstimate = 20 * time.Minute
+)
+
+// Bucket is the average warm-up time for an ambient temperature range
+type Bucket struct {
+	MinAmbient *float64 `json:"minAmbient,omitempty"` // °C, unset for samples without ambient temperature
+	MaxAmbient *float64 `json:"maxAmbient,omitempty"`
+	Samples    int      `json:"samples"`
+	Minutes    float64  `json:"minutes"`
+}
+
+// Report is the learned warm-up curve
+type Report struct {
+	Ambient  *float64 `json:"ambient,omitempty"` // Current ambient temperature
+	Estimate float64  `json:"estimate"`          // Minutes until ready after power-on at the current ambient temperature
+	Buckets  []Bucket `json:"buckets"`
+}
+
+// Learner records the time from power-on until the coffee boiler is ready
+type Learner struct {
+	store *state.Store
+	clock clock.Clock
+
+	ambient          *float64
+	initialized      bool
+	machineOn        bool
+	poweredOnAt      time.Time // Start of the cold start being observed, zero if none
+	poweredOnAmbient *float64
+	mu               sync.Mutex
+}
+
+func New(store *state.Store) *Learner {
+	return &Learner{
+		store: store,
+		clock: clock.System,
+	}
+}
+
+// SetClock replaces the system clock, e.g. for tests
+func (l *Learner) SetClock(c clock.Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = c
+}
+
+// SetAmbient updates the current ambient temperature in °C
+func (l *Learner) SetAmbient(celsius float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ambient = &celsius
+}
+
+// OnStatus observes power-on and boiler ready transitions. The first status
+// only initializes the power state, so a restart during heat-up is not recorded.
+func (l *Learner) OnStatus(status lamarzocco.MachineStatus) {
+	ready := status.Boilers != nil && status.Boilers.Coffee != nil && status.Boilers.Coffee.Ready
+
+	l.mu.Lock()
+	now := l.clock.Now()
+	if l.initialized && status.MachineOn && !l.machineOn && !ready {
+		l.poweredOnAt = now
+		l.poweredOnAmbient = l.ambient
+	}
+	if !status.MachineOn {
+		l.poweredOnAt = time.Time{}
+	}
+
+	var sample *state.WarmupSample
+	if !l.poweredOnAt.IsZero() && ready {
+		if elapsed := now.Sub(l.poweredOnAt); elapsed <= maxWarmup {
+			sample = &state.WarmupSample{
+				PoweredOnAt: l.poweredOnAt,
+				Seconds:     elapsed.Seconds(),
+				Ambient:     l.poweredOnAmbient,
+			}
+		}
+		l.poweredOnAt = time.Time{}
+	}
+
+	l.initialized = true
+	l.machineOn = status.MachineOn
+	l.mu.Unlock()
+
+	if sample != nil {
+		l.record(*sample)
+	}
+}
+
+func (l *Learner) record(sample state.WarmupSample) {
+	logger.Info("Recorded warm-up", "minutes", math.Round(sample.Seconds/60*10)/10)
+	err := l.store.Update(func(s *state.State) {
+		s.Warmup = append(s.Warmup, sample)
+		if len(s.Warmup) > maxSamples {
+			s.Warmup = s.Warmup[len(s.Warmup)-maxSamples:]
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to persist warm-up sample", "error", err)
+	}
+}
+
+// Estimate returns the expected warm-up time at the current ambient
+// temperature. Without samples for it, the average of all samples is used.
+func (l *Learner) Estimate() time.Duration {
+	l.mu.Lock()
+	ambient := l.ambient
+	l.mu.Unlock()
+
+	return estimate(l.store.Get().Warmup, ambient)
+}
+
+func (l *Learner) Get() Report {
+	l.mu.Lock()
+	ambient := l.ambient
+	l.mu.Unlock()
+
+	samples := l.store.Get().Warmup
+	return Report{
+		Ambient:  ambient,
+		Estimate: minutes(estimate(samples, ambient).Seconds()),
+		Buckets:  buckets(samples),
+	}
+}
+
+func estimate(samples []state.WarmupSample, ambient *float64) time.Duration {
+	if len(samples) == 0 {
+		return DefaultEstimate
+	}
+
+	var total, matching float64
+	var matches int
+	for _, sample := range samples {
+		total += sample.Seconds
+		if ambient != nil && sample.Ambient != nil && bucketOf(*sample.Ambient) == bucketOf(*ambient) {
+			matching += sample.Seconds
+			matches++
+		}
+	}
+
+	if matches > 0 {
+		return time.Duration(matching / float64(matches) * float64(time.Second))
+	}
+	return time.Duration(total / float64(len(samples)) * float64(time.Second))
+}
+
+func buckets(samples []state.WarmupSample) []Bucket {
+	type sum struct {
+		seconds float64
+		count   int
+	}
+	known := make(map[float64]*sum)
+	unknown := &sum{}
+
+	for _, sample := range samples {
+		target := unknown
+		if sample.Ambient != nil {
+			key := bucketOf(*sample.Ambient)
+			if known[key] == nil {
+				known[key] = &sum{}
+			}
+			target = known[key]
+		}
+		target.seconds += sample.Seconds
+		target.count++
+	}
+
+	keys := make([]float64, 0, len(known))
+	for key := range known {
+		keys = append(keys, key)
+	}
+	sort.Float64s(keys)
+
+	result := make([]Bucket, 0, len(keys)+1)
+	for _, key := range keys {
+		from, to := key, key+bucketSize
+		result = append(result, Bucket{
+			MinAmbient: &from,
+			MaxAmbient: &to,
+			Samples:    known[key].count,
+			Minutes:    minutes(known[key].seconds / float64(known[key].count)),
+		})
+	}
+	if unknown.count > 0 {
+		result = append(result, Bucket{
+			Samples: unknown.count,
+			Minutes: minutes(unknown.seconds / float64(unknown.count)),
+		})
+	}
+	return result
+}
+
+// bucketOf returns the lower bound of the bucket containing the temperature
+func bucketOf(celsius float64) float64 {
+	return math.Floor(celsius/bucketSize) * bucketSize
+}
+
+func minutes(seconds float64) float64 {
+	return math.Round(seconds/60*10) / 10
+}
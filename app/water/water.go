@@ -0,0 +1,186 @@
+package water
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/clock"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/philipparndt/go-logger"
+)
+
+const (
+	dayFormat = "2006-01-02"
+	keepDays  = 31
+)
+
+// Settings configures the water estimates, all volumes in milliliters
+type Settings struct {
+	ShotOverhead   float64 // Added to each shot's output weight (group flush, puck absorption)
+	DefaultShot    float64 // Used for shots without a target weight (continuous mode)
+	Backflush      float64
+	FilterCapacity float64 // Liters between filter changes, 0 to disable the alert
+}
+
+// Usage is the published water report
+type Usage struct {
+	Today           float64   `json:"today"`       // Liters
+	Total           float64   `json:"total"`       // Liters
+	SinceFilter     float64   `json:"sinceFilter"` // Liters
+	FilterCapacity  float64   `json:"filterCapacity,omitempty"`
+	FilterChangedAt time.Time `json:"filterChangedAt,omitempty"`
+	FilterExhausted bool      `json:"filterExhausted"`
+}
+
+// Tracker estimates water consumption from shots, flushes and hot water
+type Tracker struct {
+	store    *state.Store
+	settings Settings
+	clock    clock.Clock
+
+	onChange          func(Usage)
+	onFilterExhausted func(Usage)
+}
+
+func New(store *state.Store, settings Settings) *Tracker {
+	return &Tracker{
+		store:    store,
+		settings: settings,
+		clock:    clock.System,
+	}
+}
+
+// SetClock replaces the system clock, e.g. for tests
+func (t *Tracker) SetClock(c clock.Clock) {
+	t.clock = c
+}
+
+func (t *Tracker) SetChangeCallback(callback func(Usage)) {
+	t.onChange = callback
+}
+
+// SetFilterExhaustedCallback registers a callback invoked once the filter
+// capacity is reached
+func (t *Tracker) SetFilterExhaustedCallback(callback func(Usage)) {
+	t.onFilterExhausted = callback
+}
+
+// AddShot accounts for a shot with the given output weight in grams
+func (t *Tracker) AddShot(outputWeight float64) {
+	ml := t.settings.DefaultShot
+	if outputWeight > 0 {
+		ml = outputWeight
+	}
+	t.add(ml + t.settings.ShotOverhead)
+}
+
+func (t *Tracker) AddBackflush() {
+	t.add(t.settings.Backflush)
+}
+
+// AddHotWater accounts for an externally reported hot water dispense
+func (t *Tracker) AddHotWater(ml float64) {
+	t.add(ml)
+}
+
+// ResetFilter records a filter change
+func (t *Tracker) ResetFilter() error {
+	err := t.update(func(usage *state.WaterUsage) {
+		usage.SinceFilter = 0
+		usage.FilterChangedAt = t.clock.Now()
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info("Water filter changed")
+	t.notifyChange()
+	return nil
+}
+
+func (t *Tracker) Get() Usage {
+	usage := t.store.Get().Water
+	if usage == nil {
+		usage = &state.WaterUsage{}
+	}
+
+	result := Usage{
+		Today:           usage.Daily[t.clock.Now().Format(dayFormat)] / 1000,
+		Total:           usage.Total / 1000,
+		SinceFilter:     usage.SinceFilter / 1000,
+		FilterCapacity:  t.settings.FilterCapacity,
+		FilterChangedAt: usage.FilterChangedAt,
+	}
+	result.FilterExhausted = t.settings.FilterCapacity > 0 && result.SinceFilter >= t.settings.FilterCapacity
+	return result
+}
+
+// Daily returns the liters per day of the retained days
+func (t *Tracker) Daily() map[string]float64 {
+	result := make(map[string]float64)
+	if usage := t.store.Get().Water; usage != nil {
+		for day, ml := range usage.Daily {
+			result[day] = ml / 1000
+		}
+	}
+	return result
+}
+
+func (t *Tracker) add(ml float64) {
+	if ml <= 0 {
+		return
+	}
+
+	wasExhausted := t.Get().FilterExhausted
+	today := t.clock.Now().Format(dayFormat)
+
+	err := t.update(func(usage *state.WaterUsage) {
+		usage.Total += ml
+		usage.SinceFilter += ml
+		if usage.Daily == nil {
+			usage.Daily = make(map[string]float64)
+		}
+		usage.Daily[today] += ml
+		pruneDays(usage.Daily)
+	})
+	if err != nil {
+		logger.Error("Failed to persist water usage", "error", err)
+	}
+
+	t.notifyChange()
+
+	if usage := t.Get(); !wasExhausted && usage.FilterExhausted {
+		logger.Warn("Water filter capacity reached", "liters", usage.SinceFilter)
+		if t.onFilterExhausted != nil {
+			t.onFilterExhausted(usage)
+		}
+	}
+}
+
+func pruneDays(daily map[string]float64) {
+	if len(daily) <= keepDays {
+		return
+	}
+	days := make([]string, 0, len(daily))
+	for day := range daily {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	for _, day := range days[:len(days)-keepDays] {
+		delete(daily, day)
+	}
+}
+
+func (t *Tracker) update(fn func(*state.WaterUsage)) error {
+	return t.store.Update(func(s *state.State) {
+		if s.Water == nil {
+			s.Water = &state.WaterUsage{}
+		}
+		fn(s.Water)
+	})
+}
+
+func (t *Tracker) notifyChange() {
+	if t.onChange != nil {
+		t.onChange(t.Get())
+	}
+}
@@ -0,0 +1,59 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminRequiresToken(t *testing.T) {
+	resyncs := 0
+	ws := NewWebServer(Options{
+		AdminToken: "secret",
+		Resync: func() error {
+			resyncs++
+			return nil
+		},
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer guess", http.StatusUnauthorized},
+		{"not a bearer token", "secret", http.StatusUnauthorized},
+	}
+
+	for _, path := range []string{"/api/admin/resync", "/api/admin/selftest"} {
+		for _, tt := range tests {
+			t.Run(path+" "+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, path, nil)
+				if tt.authorization != "" {
+					req.Header.Set("Authorization", tt.authorization)
+				}
+				rec := httptest.NewRecorder()
+				ws.router.ServeHTTP(rec, req)
+				if rec.Code != tt.want {
+					t.Errorf("status = %d, want %d", rec.Code, tt.want)
+				}
+			})
+		}
+	}
+	if resyncs != 0 {
+		t.Errorf("resync ran %d times without a valid token", resyncs)
+	}
+}
+
+func TestAdminWithoutConfiguredToken(t *testing.T) {
+	ws := NewWebServer(Options{Resync: func() error { return nil }})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/resync", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	ws.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,180 @@
+package web
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/config"
+)
+
+// AuthProvider authenticates requests to the web UI and API
+type AuthProvider interface {
+	// Authenticate returns the user of the request, ok is false if it is not
+	// authenticated
+	Authenticate(r *http.Request) (user string, ok bool)
+	// Challenge answers a request that is not authenticated
+	Challenge(w http.ResponseWriter, r *http.Request)
+}
+
+// NewAuthProvider returns the provider configured in web.auth, nil if the web
+// UI is open
+func NewAuthProvider(cfg *config.WebAuthConfig) AuthProvider {
+	if cfg == nil {
+		return nil
+	}
+	switch cfg.Provider {
+	case config.AuthToken:
+		return StaticToken(cfg.Token)
+	case config.AuthBasic:
+		users := make(map[string]string, len(cfg.Users))
+		for _, user := range cfg.Users {
+			users[user.Username] = user.Password
+		}
+		return BasicAuth(users)
+	case config.AuthForward:
+		return ForwardAuth(cfg.Header, cfg.AllowedUsers)
+	}
+	return nil
+}
+
+// equal compares secrets in constant time, also regarding their length
+func equal(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+type staticToken struct {
+	token string
+}
+
+// StaticToken accepts requests with "Authorization: Bearer <token>". EventSource
+// cannot set headers, so the event streams also accept the token as
+// access_token query parameter. Other routes do not, query strings end up in
+// access logs.
+func StaticToken(token string) AuthProvider {
+	return staticToken{token: token}
+}
+
+func (p staticToken) Authenticate(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && eventStream(r) {
+		token = r.URL.Query().Get("access_token")
+	}
+	if token == "" || !equal(token, p.token) {
+		return "", false
+	}
+	return "token", true
+}
+
+// eventStream reports whether the request opens an event stream, /api/events or
+// /api/jobs/{id}/events, also of a mounted account or machine
+func eventStream(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	if strings.HasSuffix(r.URL.Path, "/api/events") {
+		return true
+	}
+	job, ok := strings.CutSuffix(r.URL.Path, "/events")
+	if !ok {
+		return false
+	}
+	i := strings.LastIndex(job, "/")
+	return i < len(job)-1 && strings.HasSuffix(job[:i], "/api/jobs")
+}
+
+func (p staticToken) Challenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="lamarzocco"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+type basicAuth struct {
+	users map[string]string
+}
+
+// BasicAuth accepts the users with their passwords, keyed by user name
+func BasicAuth(users map[string]string) AuthProvider {
+	return basicAuth{users: users}
+}
+
+func (p basicAuth) Authenticate(r *http.Request) (string, bool) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+	expected, known := p.users[user]
+	// Compare anyway, so unknown users take as long as wrong passwords
+	if !equal(password, expected) || !known {
+		return "", false
+	}
+	return user, true
+}
+
+func (p basicAuth) Challenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="lamarzocco", charset="UTF-8"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+type forwardAuth struct {
+	header  string
+	allowed []string
+}
+
+// ForwardAuth trusts the user name an SSO reverse proxy (e.g. Authelia or
+// authentik) puts into header after the login. Only requests from trusted
+// proxies are considered, see Options.TrustedProxies. An empty allowed list
+// admits every user of the proxy.
+func ForwardAuth(header string, allowed []string) AuthProvider {
+	return forwardAuth{header: header, allowed: allowed}
+}
+
+func (p forwardAuth) Authenticate(r *http.Request) (string, bool) {
+	if !viaTrustedProxy(r) {
+		return "", false
+	}
+	user := strings.TrimSpace(r.Header.Get(p.header))
+	if user == "" || (len(p.allowed) > 0 && !slices.Contains(p.allowed, user)) {
+		return "", false
+	}
+	return user, true
+}
+
+func (p forwardAuth) Challenge(w http.ResponseWriter, r *http.Request) {
+	// The login happens at the proxy, a request without the header bypassed it
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
+
+type userKey struct{}
+
+// authenticated returns the user the request was authenticated as, empty
+// without web.auth
+func authenticated(r *http.Request) string {
+	user, _ := r.Context().Value(userKey{}).(string)
+	return user
+}
+
+// authenticate rejects requests the auth provider does not accept. The admin
+// token is accepted as well, so the admin endpoints stay usable with the
+// token provider. The health check stays open for container health checks.
+func (ws *WebServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ws.auth == nil || r.URL.Path == "/api/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, ok := ws.auth.Authenticate(r)
+		if !ok && ws.validAdminToken(r) {
+			user, ok = "admin", true
+		}
+		if !ok {
+			ws.auth.Challenge(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	})
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+// whoami answers with the requester of the request
+var whoami = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(requester(r)))
+})
+
+func TestAuthProviders(t *testing.T) {
+	proxy := []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}
+
+	tests := []struct {
+		name    string
+		auth    AuthProvider
+		prepare func(r *http.Request)
+		want    int
+	}{
+		{"open", nil, func(r *http.Request) {}, http.StatusOK},
+		{"token", StaticToken("secret"), func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer secret")
+		}, http.StatusOK},
+		{"token query", StaticToken("secret"), func(r *http.Request) {
+			r.URL.Path = "/api/events"
+			r.URL.RawQuery = "access_token=secret"
+		}, http.StatusOK},
+		{"token query for a job", StaticToken("secret"), func(r *http.Request) {
+			r.URL.Path = "/machines/GS1/api/jobs/42/events"
+			r.URL.RawQuery = "access_token=secret"
+		}, http.StatusOK},
+		{"token query outside event streams", StaticToken("secret"), func(r *http.Request) {
+			r.URL.RawQuery = "access_token=secret"
+		}, http.StatusUnauthorized},
+		{"wrong token", StaticToken("secret"), func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer guess")
+		}, http.StatusUnauthorized},
+		{"admin token", StaticToken("secret"), func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer admin")
+		}, http.StatusOK},
+		{"basic", BasicAuth(map[string]string{"anna": "pw"}), func(r *http.Request) {
+			r.SetBasicAuth("anna", "pw")
+		}, http.StatusOK},
+		{"basic wrong password", BasicAuth(map[string]string{"anna": "pw"}), func(r *http.Request) {
+			r.SetBasicAuth("anna", "guess")
+		}, http.StatusUnauthorized},
+		{"basic unknown user", BasicAuth(map[string]string{"anna": "pw"}), func(r *http.Request) {
+			r.SetBasicAuth("bob", "")
+		}, http.StatusUnauthorized},
+		{"forward", ForwardAuth("Remote-User", nil), func(r *http.Request) {
+			r.RemoteAddr = "10.0.0.1:4321"
+			r.Header.Set("Remote-User", "anna")
+		}, http.StatusOK},
+		{"forward not allowed", ForwardAuth("Remote-User", []string{"bob"}), func(r *http.Request) {
+			r.RemoteAddr = "10.0.0.1:4321"
+			r.Header.Set("Remote-User", "anna")
+		}, http.StatusForbidden},
+		{"forward bypassing the proxy", ForwardAuth("Remote-User", nil), func(r *http.Request) {
+			r.RemoteAddr = "192.168.1.20:4321"
+			r.Header.Set("Remote-User", "anna")
+		}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := NewWebServer(Options{Auth: tt.auth, AdminToken: "admin", TrustedProxies: proxy})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+			tt.prepare(req)
+			rec := httptest.NewRecorder()
+			ws.forwardedHeaders(ws.authenticate(whoami)).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthRequesterIsUser(t *testing.T) {
+	ws := NewWebServer(Options{Auth: BasicAuth(map[string]string{"anna": "pw"})})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	req.SetBasicAuth("anna", "pw")
+	rec := httptest.NewRecorder()
+	ws.forwardedHeaders(ws.authenticate(whoami)).ServeHTTP(rec, req)
+	if got := rec.Body.String(); got != "anna" {
+		t.Errorf("requester = %q, want anna", got)
+	}
+}
+
+func TestAuthHealthStaysOpen(t *testing.T) {
+	ws := NewWebServer(Options{Auth: StaticToken("secret")})
+
+	rec := httptest.NewRecorder()
+	ws.authenticate(whoami).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,369 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/config"
+	"github.com/philipparndt/go-logger"
+)
+
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+var doseType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Dose",
+	Fields: graphql.Fields{
+		"weight":        &graphql.Field{Type: graphql.Float},
+		"machineWeight": &graphql.Field{Type: graphql.Float},
+	},
+})
+
+var boilerType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Boiler",
+	Fields: graphql.Fields{
+		"ready":            &graphql.Field{Type: graphql.Boolean},
+		"remainingSeconds": &graphql.Field{Type: graphql.Int},
+		"temperature":      &graphql.Field{Type: graphql.Float},
+		"level":            &graphql.Field{Type: graphql.String},
+		"enabled":          &graphql.Field{Type: graphql.Boolean},
+	},
+})
+
+var boilersType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Boilers",
+	Fields: graphql.Fields{
+		"coffee": &graphql.Field{Type: boilerType},
+		"steam":  &graphql.Field{Type: boilerType},
+	},
+})
+
+var preExtractionTimesType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PreExtractionTimes",
+	Fields: graphql.Fields{
+		"dose": &graphql.Field{Type: graphql.String},
+		"in":   &graphql.Field{Type: graphql.Float},
+		"out":  &graphql.Field{Type: graphql.Float},
+	},
+})
+
+var preExtractionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PreExtraction",
+	Fields: graphql.Fields{
+		"mode":        &graphql.Field{Type: graphql.String},
+		"perDose":     &graphql.Field{Type: graphql.Boolean},
+		"preBrewing":  &graphql.Field{Type: graphql.NewList(preExtractionTimesType)},
+		"preInfusion": &graphql.Field{Type: graphql.NewList(preExtractionTimesType)},
+	},
+})
+
+var hotWaterType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "HotWater",
+	Fields: graphql.Fields{
+		"enabled": &graphql.Field{Type: graphql.Boolean},
+		"doses": &graphql.Field{Type: graphql.NewList(graphql.NewObject(graphql.ObjectConfig{
+			Name: "HotWaterDose",
+			Fields: graphql.Fields{
+				"dose":    &graphql.Field{Type: graphql.String},
+				"seconds": &graphql.Field{Type: graphql.Float},
+			},
+		}))},
+	},
+})
+
+var accessoriesType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Accessories",
+	Fields: graphql.Fields{
+		"cupWarmer":     &graphql.Field{Type: graphql.Boolean},
+		"baristaLights": &graphql.Field{Type: graphql.Boolean},
+	},
+})
+
+var scaleType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Scale",
+	Fields: graphql.Fields{
+		"connected":    &graphql.Field{Type: graphql.Boolean},
+		"batteryLevel": &graphql.Field{Type: graphql.Int},
+		"name":         &graphql.Field{Type: graphql.String},
+		"address":      &graphql.Field{Type: graphql.String},
+	},
+})
+
+var statusType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Status",
+	Fields: graphql.Fields{
+		"mode":           &graphql.Field{Type: graphql.String},
+		"connected":      &graphql.Field{Type: graphql.Boolean},
+		"serial":         &graphql.Field{Type: graphql.String},
+		"model":          &graphql.Field{Type: graphql.String},
+		"dose1":          &graphql.Field{Type: doseType},
+		"dose2":          &graphql.Field{Type: doseType},
+		"machineOn":      &graphql.Field{Type: graphql.Boolean},
+		"cloudConnected": &graphql.Field{Type: graphql.Boolean},
+		"lastSeen":       &graphql.Field{Type: graphql.DateTime},
+		"power":          &graphql.Field{Type: graphql.String},
+		"brewing":        &graphql.Field{Type: graphql.Boolean},
+		"boilers":        &graphql.Field{Type: boilersType},
+		"scale":          &graphql.Field{Type: scaleType},
+		"preExtraction":  &graphql.Field{Type: preExtractionType},
+		"hotWater":       &graphql.Field{Type: hotWaterType},
+		"accessories":    &graphql.Field{Type: accessoriesType},
+		"reportedAt":     &graphql.Field{Type: graphql.DateTime},
+		"receivedAt":     &graphql.Field{Type: graphql.DateTime},
+	},
+})
+
+var brewType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Brew",
+	Fields: graphql.Fields{
+		"id":           &graphql.Field{Type: graphql.String},
+		"startedAt":    &graphql.Field{Type: graphql.DateTime},
+		"endedAt":      &graphql.Field{Type: graphql.DateTime},
+		"duration":     &graphql.Field{Type: graphql.Float},
+		"mode":         &graphql.Field{Type: graphql.String},
+		"targetWeight": &graphql.Field{Type: graphql.Float},
+		"reportedAt":   &graphql.Field{Type: graphql.DateTime},
+		"receivedAt":   &graphql.Field{Type: graphql.DateTime},
+		"rating":       &graphql.Field{Type: graphql.Int},
+		"note":         &graphql.Field{Type: graphql.String},
+		"profile":      &graphql.Field{Type: graphql.String},
+		"groundWeight": &graphql.Field{Type: graphql.Float},
+		"dose":         &graphql.Field{Type: graphql.Float},
+		"ratio":        &graphql.Field{Type: graphql.Float},
+	},
+})
+
+var statisticsType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Statistics",
+	Fields: graphql.Fields{
+		"onTimeToday":         &graphql.Field{Type: graphql.Float},
+		"onTimeTotal":         &graphql.Field{Type: graphql.Float},
+		"lastBackflush":       &graphql.Field{Type: graphql.DateTime},
+		"hoursSinceBackflush": &graphql.Field{Type: graphql.Float},
+		"lastDescale":         &graphql.Field{Type: graphql.DateTime},
+		"hoursSinceDescale":   &graphql.Field{Type: graphql.Float},
+	},
+})
+
+var triggerType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Trigger",
+	Fields: graphql.Fields{
+		"topic": &graphql.Field{Type: graphql.String},
+		"mode": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(config.Trigger).Action.Mode, nil
+			},
+		},
+		"conditions": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				data, err := json.Marshal(p.Source.(config.Trigger).Conditions)
+				return string(data), err
+			},
+		},
+	},
+})
+
+type scheduleView struct {
+	Name    string   `json:"name"`
+	Time    string   `json:"time"`
+	Days    []string `json:"days"`
+	NextRun string   `json:"nextRun,omitempty"`
+}
+
+var scheduleType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Schedule",
+	Fields: graphql.Fields{
+		"name":    &graphql.Field{Type: graphql.String},
+		"time":    &graphql.Field{Type: graphql.String},
+		"days":    &graphql.Field{Type: graphql.NewList(graphql.String)},
+		"nextRun": &graphql.Field{Type: graphql.String},
+	},
+})
+
+func (ws *WebServer) buildGraphQLSchema() (graphql.Schema, error) {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"status": &graphql.Field{
+				Type: statusType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return ws.client.GetStatus(), nil
+				},
+			},
+			"history": &graphql.Field{
+				Type: graphql.NewList(brewType),
+				Args: graphql.FieldConfigArgument{
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 50},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, _ := p.Args["limit"].(int)
+					return ws.history.List(limit), nil
+				},
+			},
+			"statistics": &graphql.Field{
+				Type: statisticsType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return ws.maintenance.Get(), nil
+				},
+			},
+			"triggers": &graphql.Field{
+				Type: graphql.NewList(triggerType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return ws.triggers, nil
+				},
+			},
+			"schedules": &graphql.Field{
+				Type: graphql.NewList(scheduleType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return ws.scheduleViews(), nil
+				},
+			},
+		},
+	})
+
+	subscription := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: graphql.Fields{
+			"status": &graphql.Field{
+				Type: statusType,
+				Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+					return ws.subscribeStatus(p.Context), nil
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:        query,
+		Subscription: subscription,
+	})
+}
+
+func (ws *WebServer) scheduleViews() []scheduleView {
+	entries := ws.schedules
+	configured := ws.scheduler.Entries()
+
+	result := make([]scheduleView, 0, len(configured))
+	for i, entry := range configured {
+		view := scheduleView{Name: entry.Name}
+		if i < len(entries) {
+			view.Time = entries[i].Time
+			view.Days = entries[i].Days
+		}
+		if next, ok := ws.scheduler.NextRun(entry); ok {
+			view.NextRun = next.Format("2006-01-02T15:04:05Z07:00")
+		}
+		result = append(result, view)
+	}
+	return result
+}
+
+// subscribeStatus returns a channel receiving status updates until ctx is done
+func (ws *WebServer) subscribeStatus(ctx context.Context) chan interface{} {
+	updates := make(chan interface{}, 10)
+
+	statuses := make(chan lamarzocco.MachineStatus, 10)
+	ws.sseClientsMu.Lock()
+	ws.subscribers[statuses] = struct{}{}
+	ws.sseClientsMu.Unlock()
+
+	go func() {
+		defer func() {
+			ws.sseClientsMu.Lock()
+			delete(ws.subscribers, statuses)
+			ws.sseClientsMu.Unlock()
+			close(updates)
+		}()
+
+		updates <- ws.client.GetStatus()
+		for {
+			select {
+			case status := <-statuses:
+				select {
+				case updates <- status:
+				default:
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return updates
+}
+
+// handleGraphQL executes queries via POST and streams subscriptions as
+// server-sent events via GET (?query=...)
+func (ws *WebServer) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req GraphQLRequest
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				http.Error(w, "Invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Query == "" {
+		http.Error(w, "Query is required", http.StatusBadRequest)
+		return
+	}
+
+	params := graphql.Params{
+		Schema:         ws.graphqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	}
+
+	if r.Method == http.MethodGet && r.Header.Get("Accept") == "text/event-stream" {
+		ws.streamGraphQL(w, r, params)
+		return
+	}
+
+	result := graphql.Do(params)
+	if len(result.Errors) > 0 {
+		logger.Debug("GraphQL query returned errors", "errors", result.Errors)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (ws *WebServer) streamGraphQL(w http.ResponseWriter, r *http.Request, params graphql.Params) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	flusher, ok := w.(http.Flusher)
+	for result := range graphql.Subscribe(params) {
+		message, err := json.Marshal(result)
+		if err != nil {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", message); err != nil {
+			return
+		}
+		if ok {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/philipparndt/go-logger"
+)
+
+func (ws *WebServer) startBackFlush(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Starting back flush via web API")
+	ws.commandIssued(r, "backflush")
+
+	job, err := ws.backFlush()
+	if errors.Is(err, lamarzocco.ErrNotSupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success", "jobId": job.ID})
+}
+
+func (ws *WebServer) getJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.jobs.List())
+}
+
+func (ws *WebServer) getJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := ws.jobs.Get(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleJobSSE streams the progress of a job until it finished
+func (ws *WebServer) handleJobSSE(w http.ResponseWriter, r *http.Request) {
+	updates, cancel, ok := ws.jobs.Subscribe(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	flusher, _ := w.(http.Flusher)
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case job, open := <-updates:
+			if !open {
+				return
+			}
+			data, err := json.Marshal(job)
+			if err != nil {
+				logger.Error("Failed to marshal job", "error", err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			// Keep proxies from closing an idle stream
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
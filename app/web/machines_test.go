@@ -0,0 +1,31 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMountMachineWhileServing(t *testing.T) {
+	ws := NewWebServer(Options{})
+	machine := NewWebServer(Options{AdminToken: "secret"})
+
+	status := func() int {
+		rec := httptest.NewRecorder()
+		ws.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/machines/GS012345/api/admin/resync", nil))
+		return rec.Code
+	}
+
+	if got := status(); got != http.StatusNotFound {
+		t.Errorf("before mounting: status = %d, want %d", got, http.StatusNotFound)
+	}
+	ws.MountMachine("GS012345", machine)
+	// Answered by the admin guard of the machine
+	if got := status(); got != http.StatusUnauthorized {
+		t.Errorf("mounted: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	ws.UnmountMachine("GS012345")
+	if got := status(); got != http.StatusNotFound {
+		t.Errorf("unmounted: status = %d, want %d", got, http.StatusNotFound)
+	}
+}
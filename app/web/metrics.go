@@ -0,0 +1,104 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/flap"
+	"github.com/mqtt-home/mqtt-lamarzocco/latency"
+)
+
+// getMetrics serves up/down gauges per connection in the Prometheus text format
+func (ws *WebServer) getMetrics(w http.ResponseWriter, r *http.Request) {
+	health := ws.client.Health()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeUpGauge(w, "lamarzocco_cloud_up", "Cloud API requests succeed", health.Cloud)
+	if ws.mqttState != nil {
+		writeUpGauge(w, "lamarzocco_mqtt_up", "MQTT messages make a round trip through the broker", ws.mqttState())
+	}
+	writeUpGauge(w, "lamarzocco_machine_connected", "The machine is connected to the cloud", health.Machine)
+	writeUpGauge(w, "lamarzocco_stream_up", "Live updates are received over the cloud websocket", health.Stream)
+	if ws.pollStats != nil {
+		writePollStats(w, ws.pollStats())
+	}
+	if ws.outages != nil {
+		writeOutages(w, ws.outages())
+	}
+	if ws.latency != nil {
+		writeLatency(w, ws.latency.Snapshot())
+	}
+}
+
+// writeLatency writes the update delays as summary with a stage label, sorted
+// by stage. The quantiles are of the recent updates.
+func writeLatency(w io.Writer, summaries map[string]latency.Summary) {
+	fmt.Fprintf(w, "# HELP lamarzocco_update_latency_seconds Delay of machine updates, cloud: report to receipt, mqtt and sse: receipt to delivery\n# TYPE lamarzocco_update_latency_seconds summary\n")
+	for _, stage := range slices.Sorted(maps.Keys(summaries)) {
+		s := summaries[stage]
+		for _, q := range []struct {
+			quantile string
+			ms       float64
+		}{{"0.5", s.P50}, {"0.95", s.P95}, {"0.99", s.P99}} {
+			fmt.Fprintf(w, "lamarzocco_update_latency_seconds{stage=%q,quantile=%q} %g\n", stage, q.quantile, q.ms/1000)
+		}
+		fmt.Fprintf(w, "lamarzocco_update_latency_seconds_sum{stage=%q} %g\n", stage, s.Sum/1000)
+		fmt.Fprintf(w, "lamarzocco_update_latency_seconds_count{stage=%q} %d\n", stage, s.Count)
+	}
+}
+
+// writeOutages writes the outage counters with a link label, sorted by link
+func writeOutages(w io.Writer, outages map[string]flap.Stats) {
+	links := slices.Sorted(maps.Keys(outages))
+	fmt.Fprintf(w, "# HELP lamarzocco_outages_total Outages, including those shorter than flap_window\n# TYPE lamarzocco_outages_total counter\n")
+	for _, link := range links {
+		fmt.Fprintf(w, "lamarzocco_outages_total{link=%q} %d\n", link, outages[link].Outages)
+	}
+	fmt.Fprintf(w, "# HELP lamarzocco_outages_suppressed_total Outages that ended within flap_window without events\n# TYPE lamarzocco_outages_suppressed_total counter\n")
+	for _, link := range links {
+		fmt.Fprintf(w, "lamarzocco_outages_suppressed_total{link=%q} %d\n", link, outages[link].Suppressed)
+	}
+}
+
+// writePollStats writes the poll timings with a machine label, sorted by serial
+func writePollStats(w io.Writer, stats map[string]lamarzocco.PollStats) {
+	machines := slices.Sorted(maps.Keys(stats))
+	metrics := []struct {
+		name, help, kind string
+		value            func(lamarzocco.PollStats) float64
+	}{
+		{"lamarzocco_polls_total", "Status polls", "counter", func(s lamarzocco.PollStats) float64 { return float64(s.Polls) }},
+		{"lamarzocco_poll_failures_total", "Status polls that failed", "counter", func(s lamarzocco.PollStats) float64 { return float64(s.Failures) }},
+		{"lamarzocco_poll_duration_seconds_total", "Time spent in status polls", "counter", func(s lamarzocco.PollStats) float64 { return s.TotalDuration }},
+		{"lamarzocco_poll_wait_seconds_total", "Time status polls waited for the poll budget of the account", "counter", func(s lamarzocco.PollStats) float64 { return s.TotalWait }},
+		{"lamarzocco_poll_last_duration_seconds", "Duration of the last status poll", "gauge", func(s lamarzocco.PollStats) float64 { return s.LastDuration }},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, machine := range machines {
+			fmt.Fprintf(w, "%s{machine=%q} %s\n", m.name, machine, strconv.FormatFloat(m.value(stats[machine]), 'f', -1, 64))
+		}
+	}
+}
+
+// writeUpGauge writes the gauge and <name>_last_transition_timestamp, which
+// is 0 until the state is first known
+func writeUpGauge(w io.Writer, name, help string, state lamarzocco.UpState) {
+	up := 0
+	if state.Up {
+		up = 1
+	}
+	var transition float64
+	if !state.LastTransition.IsZero() {
+		transition = float64(state.LastTransition.UnixMilli()) / 1000
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, up)
+	fmt.Fprintf(w, "# HELP %s_last_transition_timestamp Unix time of the last change of %s\n# TYPE %s_last_transition_timestamp gauge\n%s_last_transition_timestamp %s\n",
+		name, name, name, name, strconv.FormatFloat(transition, 'f', -1, 64))
+}
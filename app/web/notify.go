@@ -0,0 +1,50 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/notify"
+	"github.com/philipparndt/go-logger"
+)
+
+// TestNotificationRequest previews an event as the notifiers would send it
+type TestNotificationRequest struct {
+	Notifier string                 `json:"notifier,omitempty"` // Empty for all notifiers
+	Event    string                 `json:"event,omitempty"`    // Event type, default: test
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Send     bool                   `json:"send,omitempty"` // Deliver instead of only rendering
+}
+
+func (ws *WebServer) testNotification(w http.ResponseWriter, r *http.Request) {
+	if ws.notifyTest == nil {
+		http.Error(w, "Notifications not available", http.StatusNotImplemented)
+		return
+	}
+
+	var req TestNotificationRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Event == "" {
+		req.Event = "test"
+	}
+
+	results, err := ws.notifyTest(req.Notifier, req.Event, req.Data, req.Send)
+	if errors.Is(err, notify.ErrUnknownNotifier) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Tested notifiers via web API", "event", req.Event, "send", req.Send)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// forwardedHeaders applies X-Forwarded-For and X-Forwarded-Proto of requests
+// from trusted proxies, so logging sees the real client and r.URL.Scheme the
+// protocol the client used. Requests over a unix socket come from the proxy by
+// definition and are trusted. The headers of all other requests are dropped.
+// Requests from trusted proxies are marked, see viaTrustedProxy.
+func (ws *WebServer) forwardedHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, ok := remoteIP(r.RemoteAddr)
+		if ok && !ws.trustedProxy(peer) {
+			r.Header.Del("X-Forwarded-For")
+			r.Header.Del("X-Forwarded-Proto")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), trustedProxyKey{}, true))
+		if client, found := ws.forwardedClient(r.Header.Values("X-Forwarded-For")); found {
+			r.RemoteAddr = client.String()
+		}
+		switch proto := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto"))); proto {
+		case "http", "https":
+			r.URL.Scheme = proto
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedClient returns the first address from the right that is not a
+// trusted proxy, earlier entries may be forged by the client
+func (ws *WebServer) forwardedClient(headers []string) (netip.Addr, bool) {
+	var chain []string
+	for _, header := range headers {
+		chain = append(chain, strings.Split(header, ",")...)
+	}
+
+	var client netip.Addr
+	found := false
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(chain[i]))
+		if err != nil {
+			break
+		}
+		client, found = addr.Unmap(), true
+		if !ws.trustedProxy(client) {
+			break
+		}
+	}
+	return client, found
+}
+
+type trustedProxyKey struct{}
+
+// viaTrustedProxy reports whether the request came from a trusted proxy
+func viaTrustedProxy(r *http.Request) bool {
+	trusted, _ := r.Context().Value(trustedProxyKey{}).(bool)
+	return trusted
+}
+
+func (ws *WebServer) trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range ws.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP parses the IP of a remote address, false for unix sockets
+func remoteIP(remoteAddr string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
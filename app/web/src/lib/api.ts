@@ -1,6 +1,10 @@
 import { MachineStatus, DoseMode } from '@/types/status';
 
-export const API_BASE = import.meta.env.DEV ? 'http://localhost:8080/api' : '/api';
+// Additional accounts are served under /accounts/<name>/, other machines of
+// an account under /machines/<serial>/
+const ACCOUNT_PREFIX = window.location.pathname.match(/^(\/accounts\/[^/]+)?(\/machines\/[^/]+)?/)?.[0] ?? '';
+
+export const API_BASE = import.meta.env.DEV ? `http://localhost:8080${ACCOUNT_PREFIX}/api` : `${ACCOUNT_PREFIX}/api`;
 
 export async function fetchStatus(): Promise<MachineStatus> {
   const response = await fetch(`${API_BASE}/status`);
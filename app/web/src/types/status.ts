@@ -19,6 +19,8 @@ export interface BoilersInfo {
 export interface ScaleInfo {
   connected: boolean;
   batteryLevel?: number; // Battery percentage 0-100
+  name?: string;
+  address?: string; // Bluetooth address
 }
 
 export interface MachineStatus {
@@ -29,6 +31,9 @@ export interface MachineStatus {
   dose1?: DoseInfo;
   dose2?: DoseInfo;
   machineOn?: boolean;
+  cloudConnected?: boolean; // The machine is connected to the cloud, also in standby
+  lastSeen?: string;
+  power?: "on" | "standby" | "off";
   boilers?: BoilersInfo;
   scale?: ScaleInfo;
 }
@@ -0,0 +1,158 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/philipparndt/go-logger"
+)
+
+// framePool holds the buffers used to encode SSE frames
+var framePool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// statusFrame encodes the status as a complete SSE frame
+func statusFrame(status lamarzocco.MachineStatus) ([]byte, error) {
+	buf := framePool.Get().(*bytes.Buffer)
+	defer framePool.Put(buf)
+	buf.Reset()
+
+	buf.WriteString("data: ")
+	// Encode terminates the JSON with a newline, one more ends the event
+	if err := json.NewEncoder(buf).Encode(status); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// currentFrame returns the frame of the last broadcast, the status is only
+// encoded if nothing has been broadcast yet
+func (ws *WebServer) currentFrame() []byte {
+	if frame := ws.lastFrame.Load(); frame != nil {
+		return frame.Data
+	}
+
+	frame, err := statusFrame(ws.client.GetStatus())
+	if err != nil {
+		logger.Error("Failed to marshal status", "error", err)
+		return nil
+	}
+	return frame
+}
+
+func (ws *WebServer) handleSSE(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	clientID := fmt.Sprintf("%d", time.Now().UnixNano())
+	logger.Info("SSE client connected", "id", clientID)
+
+	channel := make(chan Frame, 10)
+
+	ws.sseClientsMu.Lock()
+	ws.sseClients[clientID] = &SSEClient{
+		ID:      clientID,
+		Channel: channel,
+	}
+	ws.sseClientsMu.Unlock()
+
+	flusher, ok := w.(http.Flusher)
+	write := func(frame []byte) bool {
+		if _, err := w.Write(frame); err != nil {
+			return false
+		}
+		if ok {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	// Send initial state
+	write(ws.currentFrame())
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	defer func() {
+		logger.Info("SSE client disconnected", "id", clientID)
+		ws.sseClientsMu.Lock()
+		delete(ws.sseClients, clientID)
+		close(channel)
+		ws.sseClientsMu.Unlock()
+	}()
+
+	for {
+		select {
+		case frame := <-channel:
+			if !write(frame.Data) {
+				return
+			}
+			ws.latency.Observe("sse", frame.ReceivedAt)
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if !write(ws.currentFrame()) {
+				return
+			}
+		}
+	}
+}
+
+// OnScaleWeight sends the reading to the SSE clients as a "weight" event.
+// Readings are dropped for clients that are behind, the next one follows soon.
+func (ws *WebServer) OnScaleWeight(reading lamarzocco.ScaleReading) {
+	data, err := json.Marshal(reading)
+	if err != nil {
+		logger.Error("Failed to marshal scale reading", "error", err)
+		return
+	}
+	frame := Frame{Data: []byte("event: weight\ndata: " + string(data) + "\n\n")}
+
+	ws.sseClientsMu.RLock()
+	defer ws.sseClientsMu.RUnlock()
+	for _, client := range ws.sseClients {
+		select {
+		case client.Channel <- frame:
+		default:
+		}
+	}
+}
+
+// broadcastStatus encodes the status once and hands the same frame to all clients
+func (ws *WebServer) broadcastStatus(status lamarzocco.MachineStatus) {
+	data, err := statusFrame(status)
+	if err != nil {
+		logger.Error("Failed to marshal status", "error", err)
+		return
+	}
+	frame := Frame{Data: data, ReceivedAt: status.UpdateReceivedAt}
+	ws.lastFrame.Store(&frame)
+
+	ws.sseClientsMu.RLock()
+	for _, client := range ws.sseClients {
+		select {
+		case client.Channel <- frame:
+		default:
+			// Channel full, skip
+		}
+	}
+	for subscriber := range ws.subscribers {
+		select {
+		case subscriber <- status:
+		default:
+		}
+	}
+	ws.sseClientsMu.RUnlock()
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+)
+
+func benchmarkStatus() lamarzocco.MachineStatus {
+	return lamarzocco.MachineStatus{
+		Mode:      lamarzocco.DoseModeDose1,
+		Connected: true,
+		Serial:    "GS012345",
+		Model:     "GS3",
+		Dose1:     &lamarzocco.DoseInfo{Weight: 36.5},
+		Dose2:     &lamarzocco.DoseInfo{Weight: 42},
+		MachineOn: true,
+		Boilers: &lamarzocco.BoilersInfo{
+			Coffee: &lamarzocco.BoilerInfo{Ready: true, Temperature: 93.5},
+			Steam:  &lamarzocco.BoilerInfo{Ready: false, RemainingSeconds: 120, Level: "Level2"},
+		},
+		Scale: &lamarzocco.ScaleInfo{Connected: true, BatteryLevel: 80},
+	}
+}
+
+func BenchmarkStatusFrame(b *testing.B) {
+	status := benchmarkStatus()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := statusFrame(status); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBroadcastStatus(b *testing.B) {
+	for _, clients := range []int{1, 100, 500} {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			ws := &WebServer{
+				sseClients:  make(map[string]*SSEClient),
+				subscribers: make(map[chan lamarzocco.MachineStatus]struct{}),
+			}
+
+			done := make(chan struct{})
+			defer close(done)
+			for i := 0; i < clients; i++ {
+				channel := make(chan Frame, 10)
+				ws.sseClients[fmt.Sprint(i)] = &SSEClient{ID: fmt.Sprint(i), Channel: channel}
+				go func() {
+					for {
+						select {
+						case <-channel:
+						case <-done:
+							return
+						}
+					}
+				}()
+			}
+
+			status := benchmarkStatus()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ws.broadcastStatus(status)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package web
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/latency"
+)
+
+func TestSSELatency(t *testing.T) {
+	ws := &WebServer{
+		sseClients:  make(map[string]*SSEClient),
+		subscribers: make(map[chan lamarzocco.MachineStatus]struct{}),
+		latency:     latency.New(),
+	}
+	ws.broadcastStatus(benchmarkStatus())
+
+	server := httptest.NewServer(http.HandlerFunc(ws.handleSSE))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewReader(resp.Body)
+	readFrame := func() string {
+		line, err := lines.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines.ReadString('\n') // The empty line ending the event
+		return line
+	}
+	readFrame() // Initial state, no update
+
+	status := benchmarkStatus()
+	status.Mode = lamarzocco.DoseModeDose2
+	status.UpdateReceivedAt = time.Now()
+	ws.broadcastStatus(status)
+	if frame := readFrame(); !strings.Contains(frame, `"Dose2"`) {
+		t.Fatalf("frame = %s, want the update", frame)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for ws.latency.Snapshot()["sse"].Count == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	sse := ws.latency.Snapshot()["sse"]
+	if sse.Count != 1 || sse.Max >= 1000 {
+		t.Errorf("sse latency = %+v, want one sample below a second", sse)
+	}
+}
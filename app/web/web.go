@@ -1,33 +1,136 @@
 package web
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
-	"github.com/mqtt-home/mqtt-lamarzocco/lamarzocco"
+	"github.com/graphql-go/graphql"
+	"github.com/mqtt-home/mqtt-lamarzocco/app/lamarzocco"
+	"github.com/mqtt-home/mqtt-lamarzocco/automation"
+	"github.com/mqtt-home/mqtt-lamarzocco/config"
+	"github.com/mqtt-home/mqtt-lamarzocco/export"
+	"github.com/mqtt-home/mqtt-lamarzocco/flap"
+	"github.com/mqtt-home/mqtt-lamarzocco/history"
+	"github.com/mqtt-home/mqtt-lamarzocco/inventory"
+	"github.com/mqtt-home/mqtt-lamarzocco/jobs"
+	"github.com/mqtt-home/mqtt-lamarzocco/latency"
+	"github.com/mqtt-home/mqtt-lamarzocco/maintenance"
+	"github.com/mqtt-home/mqtt-lamarzocco/notify"
+	"github.com/mqtt-home/mqtt-lamarzocco/profiles"
+	"github.com/mqtt-home/mqtt-lamarzocco/scheduler"
+	"github.com/mqtt-home/mqtt-lamarzocco/selftest"
+	"github.com/mqtt-home/mqtt-lamarzocco/state"
+	"github.com/mqtt-home/mqtt-lamarzocco/warmup"
+	"github.com/mqtt-home/mqtt-lamarzocco/water"
 	"github.com/philipparndt/go-logger"
 	loggerchi "github.com/philipparndt/go-logger-chi"
 )
 
 type SSEClient struct {
 	ID      string
-	Channel chan string
+	Channel chan Frame
+}
+
+// Frame is a complete SSE frame, shared between all clients and read-only
+type Frame struct {
+	Data       []byte
+	ReceivedAt time.Time // Receipt of the cloud update it reports, zero if it reports none
 }
 
 type WebServer struct {
-	client        *lamarzocco.Client
-	router        *chi.Mux
-	sseClients    map[string]*SSEClient
-	sseClientsMu  sync.RWMutex
-	statusChan    chan lamarzocco.MachineStatus
+	client          *lamarzocco.Client
+	scheduler       *scheduler.Scheduler
+	profiles        *profiles.Manager
+	history         *history.History
+	inventory       *inventory.Inventory
+	water           *water.Tracker
+	maintenance     *maintenance.Tracker
+	warmup          *warmup.Learner
+	triggers        []config.Trigger
+	schedules       []config.ScheduleEntry
+	accounts        []string              // Names of the additional accounts mounted under /accounts/
+	machines        map[string]*WebServer // Other machines of the account by serial, served under /machines/
+	machinesMu      sync.RWMutex
+	resync          func() error
+	jobs            *jobs.Manager
+	backFlush       func() (jobs.Job, error)
+	selfTest        func() selftest.Report
+	mqttState       func() lamarzocco.UpState
+	pollStats       func() map[string]lamarzocco.PollStats
+	outages         func() map[string]flap.Stats
+	latency         *latency.Recorder
+	trustedProxies  []netip.Prefix
+	adminToken      string
+	auth            AuthProvider
+	rawCommands     bool
+	notifyTest      func(notifier, eventType string, data map[string]interface{}, send bool) ([]notify.Result, error)
+	onCommand       func(command, requester string)
+	onCommandFailed func(requester string, err error)
+	automation      *automation.Stats
+	router          *chi.Mux
+	sseClients      map[string]*SSEClient
+	subscribers     map[chan lamarzocco.MachineStatus]struct{} // GraphQL subscriptions
+	sseClientsMu    sync.RWMutex
+	lastFrame       atomic.Pointer[Frame]
+	statusChan      chan lamarzocco.MachineStatus
+
+	graphqlSchema graphql.Schema
+}
+
+// Options holds the dependencies of the web server. Inventory and Water are
+// nil if tracking is disabled.
+type Options struct {
+	Client      *lamarzocco.Client
+	Scheduler   *scheduler.Scheduler
+	Profiles    *profiles.Manager
+	History     *history.History
+	Inventory   *inventory.Inventory
+	Water       *water.Tracker
+	Maintenance *maintenance.Tracker
+	Warmup      *warmup.Learner
+	GraphQL     bool
+	Triggers    []config.Trigger
+	Schedules   []config.ScheduleEntry
+	Resync      func() error // Re-fetches the machine state and republishes retained topics
+	Jobs        *jobs.Manager
+	BackFlush   func() (jobs.Job, error) // Starts a back flush job
+	SelfTest    func() selftest.Report
+	MQTTState   func() lamarzocco.UpState // Broker round trips, nil omits the gauge
+	// Poll timings of the machines of the account by serial, nil omits them
+	PollStats func() map[string]lamarzocco.PollStats
+	// Outages per link, including those not reported within the flap window, nil omits them
+	Outages func() map[string]flap.Stats
+	// Delays from the receipt of cloud updates to their delivery, nil omits them
+	Latency *latency.Recorder
+	// Proxies whose X-Forwarded-For and X-Forwarded-Proto headers are honored
+	TrustedProxies []netip.Prefix
+	// Renders an event for the named notifier (empty for all), sends it if requested
+	TestNotification func(notifier, eventType string, data map[string]interface{}, send bool) ([]notify.Result, error)
+	AutomationStats  *automation.Stats
+	// Called for each machine command, requester is the user or client IP
+	CommandCallback func(command, requester string)
+	// Called for each machine command that failed
+	CommandFailedCallback func(requester string, err error)
+	AdminToken            string       // Bearer token of the guarded admin endpoints
+	RawCommands           bool         // Serve /api/raw/command/{name}, requires AdminToken
+	Auth                  AuthProvider // Login for the UI and API, nil leaves them open
 }
 
 type SetModeRequest struct {
@@ -39,20 +142,48 @@ type SetDoseRequest struct {
 	Dose   float64 `json:"dose"`
 }
 
-func NewWebServer(client *lamarzocco.Client) *WebServer {
+func NewWebServer(opts Options) *WebServer {
 	ws := &WebServer{
-		client:     client,
-		router:     chi.NewRouter(),
-		sseClients: make(map[string]*SSEClient),
-		statusChan: make(chan lamarzocco.MachineStatus, 10),
+		client:          opts.Client,
+		scheduler:       opts.Scheduler,
+		profiles:        opts.Profiles,
+		history:         opts.History,
+		inventory:       opts.Inventory,
+		water:           opts.Water,
+		maintenance:     opts.Maintenance,
+		warmup:          opts.Warmup,
+		triggers:        opts.Triggers,
+		schedules:       opts.Schedules,
+		resync:          opts.Resync,
+		jobs:            opts.Jobs,
+		backFlush:       opts.BackFlush,
+		selfTest:        opts.SelfTest,
+		mqttState:       opts.MQTTState,
+		pollStats:       opts.PollStats,
+		outages:         opts.Outages,
+		latency:         opts.Latency,
+		trustedProxies:  opts.TrustedProxies,
+		adminToken:      opts.AdminToken,
+		auth:            opts.Auth,
+		rawCommands:     opts.RawCommands && opts.AdminToken != "",
+		notifyTest:      opts.TestNotification,
+		automation:      opts.AutomationStats,
+		onCommand:       opts.CommandCallback,
+		onCommandFailed: opts.CommandFailedCallback,
+		router:          chi.NewRouter(),
+		sseClients:      make(map[string]*SSEClient),
+		subscribers:     make(map[chan lamarzocco.MachineStatus]struct{}),
+		statusChan:      make(chan lamarzocco.MachineStatus, 10),
 	}
 
-	// Set callback to receive status updates
-	originalCallback := client.SetStatusChangeCallback
-	client.SetStatusChangeCallback(func(status lamarzocco.MachineStatus) {
-		ws.onStatusChange(status)
-	})
-	_ = originalCallback // suppress unused warning
+	if opts.GraphQL {
+		schema, err := ws.buildGraphQLSchema()
+		if err != nil {
+			logger.Error("Failed to build GraphQL schema", "error", err)
+		} else {
+			ws.graphqlSchema = schema
+		}
+	}
 
 	ws.setupRoutes()
 	go ws.broadcastLoop()
@@ -60,7 +191,8 @@ func NewWebServer(client *lamarzocco.Client) *WebServer {
 	return ws
 }
 
-func (ws *WebServer) onStatusChange(status lamarzocco.MachineStatus) {
+// OnStatusChange forwards a status update to all connected SSE clients
+func (ws *WebServer) OnStatusChange(status lamarzocco.MachineStatus) {
 	select {
 	case ws.statusChan <- status:
 	default:
@@ -75,8 +207,10 @@ func (ws *WebServer) broadcastLoop() {
 }
 
 func (ws *WebServer) setupRoutes() {
+	ws.router.Use(ws.forwardedHeaders)
 	ws.router.Use(loggerchi.Middleware())
 	ws.router.Use(middleware.Recoverer)
+	ws.router.Use(ws.authenticate)
 
 	ws.router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
@@ -87,19 +221,152 @@ func (ws *WebServer) setupRoutes() {
 		MaxAge:           300,
 	}))
 
+	ws.router.Get("/metrics", ws.getMetrics)
+
 	ws.router.Route("/api", func(r chi.Router) {
 		r.Get("/health", ws.healthCheck)
+		r.Get("/accounts", ws.getAccounts)
+		r.Get("/machines", ws.getMachines)
+		r.With(ws.requireAdmin).Route("/admin", func(r chi.Router) {
+			r.Post("/resync", ws.resyncState)
+			r.Post("/selftest", ws.runSelfTest)
+		})
+		r.Post("/notify/test", ws.testNotification)
 		r.Get("/status", ws.getStatus)
 		r.Post("/mode", ws.setMode)
 		r.Post("/dose", ws.setDose)
 		r.Post("/power", ws.setPower)
+		r.Post("/steam", ws.setSteam)
+		r.Post("/accessories", ws.setAccessories)
+		r.Post("/scale", ws.setScale)
+		r.Get("/hot-water", ws.getHotWater)
+		r.Post("/hot-water", ws.setHotWater)
+		r.Get("/pre-extraction", ws.getPreExtraction)
+		r.Post("/pre-extraction", ws.setPreExtraction)
 		r.Post("/backflush", ws.startBackFlush)
+		r.Get("/jobs", ws.getJobs)
+		r.Get("/jobs/{id}", ws.getJob)
+		r.Get("/jobs/{id}/events", ws.handleJobSSE)
+		r.Get("/statistics", ws.getStatistics)
+		r.Get("/automation/stats", ws.getAutomationStats)
+		r.Get("/debug/latency", ws.getLatency)
+		r.Get("/schedule", ws.getSchedule)
+		r.Put("/schedule", ws.setSchedule)
+		r.Delete("/schedule/{id}", ws.deleteSchedule)
 		r.Get("/events", ws.handleSSE)
+		if ws.graphqlSchema.QueryType() != nil {
+			r.Get("/graphql", ws.handleGraphQL)
+			r.Post("/graphql", ws.handleGraphQL)
+		}
+		r.Get("/pending", ws.getPending)
+		r.Delete("/pending", ws.cancelAllPending)
+		r.Delete("/pending/{id}", ws.cancelPending)
+		r.Get("/profiles", ws.getProfiles)
+		r.Post("/profiles", ws.saveProfile)
+		r.Delete("/profiles/{name}", ws.deleteProfile)
+		r.Post("/profiles/{name}/apply", ws.applyProfile)
+		r.Get("/history", ws.getHistory)
+		r.Post("/history/{id}/annotate", ws.annotateBrew)
+		r.Get("/history/rollups", ws.getHistoryRollups)
+		r.Get("/export/statistics", ws.exportStatistics)
+		r.Get("/inventory", ws.getInventory)
+		r.Put("/inventory", ws.setInventory)
+		r.Post("/inventory/refill", ws.refillInventory)
+		r.Get("/water", ws.getWater)
+		r.Post("/water/filter", ws.resetWaterFilter)
+		r.Post("/water/hotwater", ws.addHotWater)
+		r.Get("/maintenance", ws.getMaintenance)
+		r.Post("/maintenance/descale", ws.recordDescale)
+		r.Get("/warmup", ws.getWarmup)
+		if ws.rawCommands {
+			r.With(ws.requireAdmin).Post("/raw/command/{name}", ws.rawCommand)
+		}
 	})
 
+	// Machines come and go while serving, so they are looked up per request
+	ws.router.Handle("/machines/{serial}", http.HandlerFunc(ws.serveMachine))
+	ws.router.Handle("/machines/{serial}/*", http.HandlerFunc(ws.serveMachine))
+
 	// Serve static files (React app)
 	fileServer := http.FileServer(http.Dir("./web/dist/"))
-	ws.router.Handle("/*", fileServer)
+	ws.router.Handle("/*", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Mounted for an additional account, serve the files relative to the mount point
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+			r = r.Clone(r.Context())
+			r.URL.Path = rctx.RoutePath
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
+}
+
+// MountAccount serves the web UI and API of an additional account under
+// /accounts/{name}/. Must be called before Start.
+func (ws *WebServer) MountAccount(name string, account *WebServer) {
+	ws.accounts = append(ws.accounts, name)
+	ws.router.Mount("/accounts/"+name, account.router)
+}
+
+// MountMachine serves another machine of the account under /machines/<id>/,
+// also while the web server is running. id is the device ID of the machine,
+// i.e. its pseudonym with redact_serial.
+func (ws *WebServer) MountMachine(id string, machine *WebServer) {
+	ws.machinesMu.Lock()
+	defer ws.machinesMu.Unlock()
+	if ws.machines == nil {
+		ws.machines = make(map[string]*WebServer)
+	}
+	ws.machines[id] = machine
+}
+
+// UnmountMachine stops serving a machine, e.g. one removed from the account
+func (ws *WebServer) UnmountMachine(id string) {
+	ws.machinesMu.Lock()
+	defer ws.machinesMu.Unlock()
+	delete(ws.machines, id)
+}
+
+// serveMachine hands the request to the web server of the machine, with the
+// path below /machines/<id> like a mounted router
+func (ws *WebServer) serveMachine(w http.ResponseWriter, r *http.Request) {
+	ws.machinesMu.RLock()
+	machine, ok := ws.machines[chi.URLParam(r, "serial")]
+	ws.machinesMu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	chi.RouteContext(r.Context()).RoutePath = "/" + chi.URLParam(r, "*")
+	machine.router.ServeHTTP(w, r)
+}
+
+// MachineInfo is a machine of the account, Path is empty for the one served on /api
+type MachineInfo struct {
+	lamarzocco.Thing
+	Path string `json:"path"`
+}
+
+func (ws *WebServer) getMachines(w http.ResponseWriter, r *http.Request) {
+	machines := []MachineInfo{}
+	for _, thing := range ws.client.Things() {
+		// Serials are only shown without redact_serial
+		thing.SerialNumber = ws.client.DeviceID(thing.SerialNumber)
+		info := MachineInfo{Thing: thing}
+		ws.machinesMu.RLock()
+		if _, ok := ws.machines[thing.SerialNumber]; ok {
+			info.Path = "/machines/" + thing.SerialNumber
+		}
+		ws.machinesMu.RUnlock()
+		machines = append(machines, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(machines)
+}
+
+func (ws *WebServer) getAccounts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(append([]string{}, ws.accounts...))
 }
 
 func (ws *WebServer) healthCheck(w http.ResponseWriter, r *http.Request) {
@@ -111,13 +378,161 @@ func (ws *WebServer) healthCheck(w http.ResponseWriter, r *http.Request) {
 			defer ws.sseClientsMu.RUnlock()
 			return len(ws.sseClients)
 		}(),
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"stream":          ws.client.StreamInfo(),
+		"unknown_states":  ws.client.UnknownStates(),
+		"unknown_widgets": ws.client.UnknownWidgets(),
+		"connections":     ws.client.Health(),
+		"timestamp":       time.Now().UTC().Format(time.RFC3339),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(health)
 }
 
+func (ws *WebServer) resyncState(w http.ResponseWriter, r *http.Request) {
+	if ws.resync == nil {
+		http.Error(w, "Resync not available", http.StatusNotImplemented)
+		return
+	}
+
+	if err := ws.resync(); err != nil {
+		logger.Error("Failed to resync", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Resynced via web API")
+	ws.getStatus(w, r)
+}
+
+func (ws *WebServer) getAutomationStats(w http.ResponseWriter, r *http.Request) {
+	stats := ws.automation.All()
+	if stats == nil {
+		stats = []automation.Stat{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// getLatency reports the delays from the receipt of cloud updates to their
+// delivery, per stage
+func (ws *WebServer) getLatency(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.latency.Snapshot())
+}
+
+func (ws *WebServer) runSelfTest(w http.ResponseWriter, r *http.Request) {
+	if ws.selfTest == nil {
+		http.Error(w, "Self-test not available", http.StatusNotImplemented)
+		return
+	}
+
+	logger.Info("Running self-test via web API")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.selfTest())
+}
+
+// errorStatus maps the error classes of the client to HTTP status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, lamarzocco.ErrNotSupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, lamarzocco.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, lamarzocco.ErrUnauthorized):
+		return http.StatusBadGateway
+	case errors.Is(err, lamarzocco.ErrMachineOffline), errors.Is(err, lamarzocco.ErrTransient):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// requireAdmin rejects requests without the admin bearer token, and all of
+// them while no token is configured
+func (ws *WebServer) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ws.validAdminToken(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (ws *WebServer) validAdminToken(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && ws.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(ws.adminToken)) == 1
+}
+
+// maxRawPayload limits the body of raw commands
+const maxRawPayload = 64 << 10
+
+// rawCommand forwards a payload to a cloud command the gateway does not wrap
+// and answers with the response of the cloud
+func (ws *WebServer) rawCommand(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxRawPayload+1))
+	if err != nil || len(payload) > maxRawPayload {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(payload) > 0 && !json.Valid(payload) {
+		http.Error(w, "Payload must be JSON", http.StatusBadRequest)
+		return
+	}
+
+	logger.Warn("Sending raw command via web API", "command", name)
+	ws.commandIssued(r, "raw")
+
+	status, body, err := ws.client.RawCommand(r.Context(), name, payload)
+	if err != nil {
+		logger.Error("Failed to send raw command", "command", name, "error", err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// commandIssued reports a machine command sent via the web API
+func (ws *WebServer) commandIssued(r *http.Request, command string) {
+	if ws.onCommand == nil {
+		return
+	}
+	ws.onCommand(command, requester(r))
+}
+
+// requester is reported as the requester of commands: the authenticated
+// user, or the client IP without web.auth
+func requester(r *http.Request) string {
+	if user := authenticated(r); user != "" {
+		return user
+	}
+	if addr, ok := remoteIP(r.RemoteAddr); ok {
+		return addr.String()
+	}
+	return ""
+}
+
+// commandResult answers a machine command, failures are reported with the
+// status code of their error class
+func (ws *WebServer) commandResult(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	if err != nil {
+		logger.Error(msg, "error", err)
+		if ws.onCommandFailed != nil && r.Context().Err() == nil {
+			ws.onCommandFailed(requester(r), err)
+		}
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
 func (ws *WebServer) getStatus(w http.ResponseWriter, r *http.Request) {
 	status := ws.client.GetStatus()
 
@@ -134,15 +549,10 @@ func (ws *WebServer) setMode(w http.ResponseWriter, r *http.Request) {
 
 	mode := lamarzocco.ParseDoseMode(req.Mode)
 	logger.Info("Setting mode via web API", "mode", mode)
+	ws.commandIssued(r, "mode")
 
-	go func() {
-		if err := ws.client.SetMode(mode); err != nil {
-			logger.Error("Failed to set mode", "error", err)
-		}
-	}()
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	err := ws.client.SetMode(r.Context(), mode)
+	ws.commandResult(w, r, "Failed to set mode", err)
 }
 
 func (ws *WebServer) setDose(w http.ResponseWriter, r *http.Request) {
@@ -158,26 +568,22 @@ func (ws *WebServer) setDose(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate dose range
-	if req.Dose < 5 || req.Dose > 100 {
-		http.Error(w, "Dose must be between 5 and 100 grams", http.StatusBadRequest)
+	// Rounding and clamping to the configured bounds happen in the client
+	if err := lamarzocco.CheckDose(req.Dose); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	logger.Info("Setting dose via web API", "doseId", req.DoseId, "dose", req.Dose)
+	ws.commandIssued(r, "dose")
 
-	go func() {
-		if err := ws.client.SetDose(req.DoseId, req.Dose); err != nil {
-			logger.Error("Failed to set dose", "error", err)
-		}
-	}()
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	err := ws.client.SetDose(r.Context(), req.DoseId, req.Dose)
+	ws.commandResult(w, r, "Failed to set dose", err)
 }
 
 type SetPowerRequest struct {
-	On bool `json:"on"`
+	On    *bool                 `json:"on,omitempty"`
+	Power lamarzocco.PowerState `json:"power,omitempty"` // on, standby or off, takes precedence over on
 }
 
 func (ws *WebServer) setPower(w http.ResponseWriter, r *http.Request) {
@@ -187,117 +593,595 @@ func (ws *WebServer) setPower(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logger.Info("Setting power via web API", "on", req.On)
+	state := req.Power
+	if state == "" {
+		if req.On == nil {
+			http.Error(w, "on or power is required", http.StatusBadRequest)
+			return
+		}
+		state = lamarzocco.PowerStandby
+		if *req.On {
+			state = lamarzocco.PowerOn
+		}
+	}
+	if state == lamarzocco.PowerOff && !ws.client.Capabilities().FullOff {
+		http.Error(w, "Full off is not supported by this machine", http.StatusNotImplemented)
+		return
+	}
+
+	logger.Info("Setting power via web API", "power", state)
+	ws.commandIssued(r, "power")
 
-	go func() {
-		if err := ws.client.SetPower(req.On); err != nil {
-			logger.Error("Failed to set power", "error", err)
+	err := ws.client.SetPowerState(r.Context(), state)
+	ws.commandResult(w, r, "Failed to set power", err)
+}
+
+type SetSteamRequest struct {
+	Enabled *bool                 `json:"enabled"`
+	Level   lamarzocco.SteamLevel `json:"level"` // 1-3 or Level1-Level3
+}
+
+func (ws *WebServer) setSteam(w http.ResponseWriter, r *http.Request) {
+	var req SetSteamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Enabled == nil && req.Level == "" {
+		http.Error(w, "enabled or level is required", http.StatusBadRequest)
+		return
+	}
+	if req.Level != "" && !req.Level.Valid() {
+		http.Error(w, "Invalid level, must be 1-3 or Level1-Level3", http.StatusBadRequest)
+		return
+	}
+
+	logger.Info("Setting steam boiler via web API", "enabled", req.Enabled, "level", req.Level)
+	ws.commandIssued(r, "steam")
+
+	var errs []error
+	if req.Enabled != nil {
+		if err := ws.client.SetSteamBoiler(r.Context(), *req.Enabled); err != nil {
+			errs = append(errs, fmt.Errorf("set steam boiler: %w", err))
+		}
+	}
+	if req.Level != "" {
+		if err := ws.client.SetSteamLevel(r.Context(), req.Level); err != nil {
+			errs = append(errs, fmt.Errorf("set steam level: %w", err))
 		}
-	}()
+	}
+	ws.commandResult(w, r, "Failed to set steam boiler", errors.Join(errs...))
+}
+
+type SetAccessoriesRequest struct {
+	CupWarmer     *bool `json:"cupWarmer"`
+	BaristaLights *bool `json:"baristaLights"`
+}
+
+func (ws *WebServer) setAccessories(w http.ResponseWriter, r *http.Request) {
+	var req SetAccessoriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.CupWarmer == nil && req.BaristaLights == nil {
+		http.Error(w, "cupWarmer or baristaLights is required", http.StatusBadRequest)
+		return
+	}
+	capabilities := ws.client.Capabilities()
+	if (req.CupWarmer != nil && !capabilities.CupWarmer) || (req.BaristaLights != nil && !capabilities.BaristaLights) {
+		http.Error(w, "Accessory is not supported by this machine", http.StatusNotImplemented)
+		return
+	}
+
+	logger.Info("Setting accessories via web API", "cupWarmer", req.CupWarmer, "baristaLights", req.BaristaLights)
+	ws.commandIssued(r, "accessories")
+
+	var errs []error
+	if req.CupWarmer != nil {
+		if err := ws.client.SetCupWarmer(r.Context(), *req.CupWarmer); err != nil {
+			errs = append(errs, fmt.Errorf("set cup warmer: %w", err))
+		}
+	}
+	if req.BaristaLights != nil {
+		if err := ws.client.SetBaristaLights(r.Context(), *req.BaristaLights); err != nil {
+			errs = append(errs, fmt.Errorf("set barista lights: %w", err))
+		}
+	}
+	ws.commandResult(w, r, "Failed to set accessories", errors.Join(errs...))
+}
+
+func (ws *WebServer) setScale(w http.ResponseWriter, r *http.Request) {
+	var req lamarzocco.ScaleCommand
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ws.client.Capabilities().ScaleSupport {
+		http.Error(w, "Scale is not supported by this machine", http.StatusNotImplemented)
+		return
+	}
+
+	logger.Info("Changing scale via web API", "pair", req.Pair, "unpair", req.Unpair, "name", req.Name)
+	ws.commandIssued(r, "scale")
+
+	var err error
+	switch {
+	case req.Unpair:
+		err = ws.client.UnpairScale(r.Context())
+	case req.Pair != "":
+		err = ws.client.PairScale(r.Context(), req.Pair, req.Name)
+	default:
+		err = ws.client.RenameScale(r.Context(), req.Name)
+	}
+	ws.commandResult(w, r, "Failed to change scale", err)
+}
+
+func (ws *WebServer) getHotWater(w http.ResponseWriter, r *http.Request) {
+	info := ws.client.GetStatus().HotWater
+	if info == nil {
+		http.Error(w, "Hot water dose not reported by the machine", http.StatusNotFound)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	json.NewEncoder(w).Encode(info)
 }
 
-func (ws *WebServer) startBackFlush(w http.ResponseWriter, r *http.Request) {
-	logger.Info("Starting back flush via web API")
+func (ws *WebServer) setHotWater(w http.ResponseWriter, r *http.Request) {
+	var req lamarzocco.HotWaterDose
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logger.Info("Setting hot water dose via web API", "dose", req.Dose, "seconds", req.Seconds)
+	ws.commandIssued(r, "hot_water")
+
+	err := ws.client.SetHotWaterDose(r.Context(), req.Dose, req.Seconds)
+	ws.commandResult(w, r, "Failed to set hot water dose", err)
+}
+
+func (ws *WebServer) getPreExtraction(w http.ResponseWriter, r *http.Request) {
+	info := ws.client.GetStatus().PreExtraction
+	if info == nil {
+		http.Error(w, "Pre-extraction settings not reported by the machine", http.StatusNotFound)
+		return
+	}
 
-	go func() {
-		if err := ws.client.StartBackFlush(); err != nil {
-			logger.Error("Failed to start back flush", "error", err)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func (ws *WebServer) setPreExtraction(w http.ResponseWriter, r *http.Request) {
+	var req lamarzocco.PreExtractionCommand
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logger.Info("Setting pre-extraction via web API", "mode", req.Mode, "dose", req.Dose, "in", req.In, "out", req.Out)
+	ws.commandIssued(r, "pre_extraction")
+
+	ws.commandResult(w, r, "Failed to set pre-extraction", ws.applyPreExtraction(r.Context(), req))
+}
+
+// applyPreExtraction sets the mode before the times, so they apply to it
+func (ws *WebServer) applyPreExtraction(ctx context.Context, req lamarzocco.PreExtractionCommand) error {
+	if req.Mode != "" {
+		if err := ws.client.SetPreExtractionMode(ctx, lamarzocco.PreExtractionMode(req.Mode)); err != nil {
+			return fmt.Errorf("set pre-extraction mode: %w", err)
+		}
+	}
+	if req.HasTimes() {
+		if err := ws.client.SetPreExtractionTimes(ctx, req.Dose, req.GetIn(), req.GetOut()); err != nil {
+			return fmt.Errorf("set pre-extraction times: %w", err)
 		}
-	}()
+	}
+	return nil
+}
+
+func (ws *WebServer) getStatistics(w http.ResponseWriter, r *http.Request) {
+	stats, err := ws.client.GetStatistics(r.Context())
+	if errors.Is(err, lamarzocco.ErrNotSupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to fetch statistics", "error", err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	json.NewEncoder(w).Encode(stats)
 }
 
-func (ws *WebServer) handleSSE(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+func (ws *WebServer) getSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := ws.client.FetchSchedule(r.Context())
+	ws.writeSchedule(w, schedule, err)
+}
 
-	clientID := fmt.Sprintf("%d", time.Now().UnixNano())
-	logger.Info("SSE client connected", "id", clientID)
+func (ws *WebServer) setSchedule(w http.ResponseWriter, r *http.Request) {
+	var req lamarzocco.WakeUpSchedule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	channel := make(chan string, 10)
+	logger.Info("Setting wake-up schedule via web API", "id", req.ID, "on", req.On, "off", req.Off)
+	ws.commandIssued(r, "schedule")
+	schedule, err := ws.client.SetWakeUpSchedule(r.Context(), req)
+	ws.writeSchedule(w, schedule, err)
+}
+
+func (ws *WebServer) deleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	logger.Info("Deleting wake-up schedule via web API", "id", id)
+	ws.commandIssued(r, "schedule")
+	schedule, err := ws.client.DeleteWakeUpSchedule(r.Context(), id)
+	ws.writeSchedule(w, schedule, err)
+}
 
-	ws.sseClientsMu.Lock()
-	ws.sseClients[clientID] = &SSEClient{
-		ID:      clientID,
-		Channel: channel,
+func (ws *WebServer) writeSchedule(w http.ResponseWriter, schedule lamarzocco.MachineSchedule, err error) {
+	if errors.Is(err, lamarzocco.ErrNotSupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to access schedule", "error", err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
 	}
-	ws.sseClientsMu.Unlock()
 
-	// Send initial state
-	status := ws.client.GetStatus()
-	message, _ := json.Marshal(status)
-	fmt.Fprintf(w, "data: %s\n\n", string(message))
-
-	flusher, ok := w.(http.Flusher)
-	if ok {
-		flusher.Flush()
-	}
-
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
-	defer func() {
-		logger.Info("SSE client disconnected", "id", clientID)
-		ws.sseClientsMu.Lock()
-		delete(ws.sseClients, clientID)
-		close(channel)
-		ws.sseClientsMu.Unlock()
-	}()
-
-	for {
-		select {
-		case msg := <-channel:
-			_, writeErr := fmt.Fprintf(w, "data: %s\n\n", msg)
-			if writeErr != nil {
-				return
-			}
-			if ok {
-				flusher.Flush()
-			}
-		case <-r.Context().Done():
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+func (ws *WebServer) getPending(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.scheduler.List())
+}
+
+func (ws *WebServer) cancelAllPending(w http.ResponseWriter, r *http.Request) {
+	count := ws.scheduler.CancelAll()
+	logger.Info("Cancelled pending commands via web API", "count", count)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "cancelled": count})
+}
+
+func (ws *WebServer) cancelPending(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !ws.scheduler.Cancel(id) {
+		http.Error(w, "Pending command not found", http.StatusNotFound)
+		return
+	}
+
+	logger.Info("Cancelled pending command via web API", "id", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (ws *WebServer) getProfiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"active":   ws.profiles.Active(),
+		"profiles": ws.profiles.List(),
+	})
+}
+
+func (ws *WebServer) saveProfile(w http.ResponseWriter, r *http.Request) {
+	var profile state.Profile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := ws.profiles.Save(profile); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logger.Info("Saved profile via web API", "name", profile.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (ws *WebServer) deleteProfile(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := ws.profiles.Delete(name); err != nil {
+		if errors.Is(err, profiles.ErrNotFound) {
+			http.Error(w, "Profile not found", http.StatusNotFound)
 			return
-		case <-ticker.C:
-			status := ws.client.GetStatus()
-			message, _ := json.Marshal(status)
-			_, writeErr := fmt.Fprintf(w, "data: %s\n\n", string(message))
-			if writeErr != nil {
-				return
-			}
-			if ok {
-				flusher.Flush()
-			}
 		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+
+	logger.Info("Deleted profile via web API", "name", name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
-func (ws *WebServer) broadcastStatus(status lamarzocco.MachineStatus) {
-	message, err := json.Marshal(status)
-	if err != nil {
-		logger.Error("Failed to marshal status", "error", err)
+func (ws *WebServer) applyProfile(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if _, ok := ws.profiles.Get(name); !ok {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	logger.Info("Applying profile via web API", "name", name)
+	ws.commandIssued(r, "profile")
+
+	err := ws.profiles.Apply(r.Context(), name)
+	ws.commandResult(w, r, "Failed to apply profile", err)
+}
+
+func (ws *WebServer) getHistory(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.history.List(limit))
+}
+
+func (ws *WebServer) getHistoryRollups(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.history.Rollups())
+}
+
+type AnnotateRequest struct {
+	Rating int    `json:"rating"`
+	Note   string `json:"note"`
+}
+
+func (ws *WebServer) annotateBrew(w http.ResponseWriter, r *http.Request) {
+	var req AnnotateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	messageStr := string(message)
 
-	ws.sseClientsMu.RLock()
-	for _, client := range ws.sseClients {
-		select {
-		case client.Channel <- messageStr:
+	id := chi.URLParam(r, "id")
+	record, err := ws.history.Annotate(id, req.Rating, req.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, history.ErrNotFound):
+			http.Error(w, "Brew not found", http.StatusNotFound)
+		case errors.Is(err, history.ErrAnnotationClosed):
+			http.Error(w, "Brew is too old to be annotated", http.StatusConflict)
 		default:
-			// Channel full, skip
+			http.Error(w, err.Error(), http.StatusBadRequest)
 		}
+		return
 	}
-	ws.sseClientsMu.RUnlock()
+
+	logger.Info("Annotated brew via web API", "id", id, "rating", record.Rating)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
 }
 
-func (ws *WebServer) Start(port int) error {
-	addr := ":" + strconv.Itoa(port)
-	logger.Info("Starting web server", "address", addr)
-	return http.ListenAndServe(addr, ws.router)
+type RefillRequest struct {
+	Bean    string  `json:"bean"`
+	BagSize float64 `json:"bagSize"`
+}
+
+func (ws *WebServer) getInventory(w http.ResponseWriter, r *http.Request) {
+	if ws.inventory == nil {
+		http.Error(w, "Bean inventory is not enabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.inventory.Get())
+}
+
+func (ws *WebServer) setInventory(w http.ResponseWriter, r *http.Request) {
+	if ws.inventory == nil {
+		http.Error(w, "Bean inventory is not enabled", http.StatusNotFound)
+		return
+	}
+
+	var req state.BeanInventory
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Remaining < 0 {
+		http.Error(w, "Remaining must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if err := ws.inventory.Set(req); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Updated bean inventory via web API", "bean", req.Bean, "remaining", req.Remaining)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.inventory.Get())
+}
+
+func (ws *WebServer) refillInventory(w http.ResponseWriter, r *http.Request) {
+	if ws.inventory == nil {
+		http.Error(w, "Bean inventory is not enabled", http.StatusNotFound)
+		return
+	}
+
+	var req RefillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := ws.inventory.Refill(req.Bean, req.BagSize); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.inventory.Get())
+}
+
+type HotWaterRequest struct {
+	Ml float64 `json:"ml"`
+}
+
+func (ws *WebServer) getWater(w http.ResponseWriter, r *http.Request) {
+	if ws.water == nil {
+		http.Error(w, "Water tracking is not enabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"usage": ws.water.Get(),
+		"daily": ws.water.Daily(),
+	})
+}
+
+func (ws *WebServer) resetWaterFilter(w http.ResponseWriter, r *http.Request) {
+	if ws.water == nil {
+		http.Error(w, "Water tracking is not enabled", http.StatusNotFound)
+		return
+	}
+
+	if err := ws.water.ResetFilter(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.water.Get())
+}
+
+func (ws *WebServer) addHotWater(w http.ResponseWriter, r *http.Request) {
+	if ws.water == nil {
+		http.Error(w, "Water tracking is not enabled", http.StatusNotFound)
+		return
+	}
+
+	var req HotWaterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Ml <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ws.water.AddHotWater(req.Ml)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.water.Get())
+}
+
+func (ws *WebServer) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.maintenance.Get())
+}
+
+func (ws *WebServer) recordDescale(w http.ResponseWriter, r *http.Request) {
+	ws.maintenance.RecordDescale()
+	logger.Info("Recorded descale via web API")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.maintenance.Get())
+}
+
+func (ws *WebServer) getWarmup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.warmup.Get())
+}
+
+// exportStatistics emits the brew history for backfilling, either as Home
+// Assistant statistics (default) or InfluxDB line protocol (?format=influx).
+// from/to accept RFC3339 timestamps.
+func (ws *WebServer) exportStatistics(w http.ResponseWriter, r *http.Request) {
+	var from, to time.Time
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid "+name+" timestamp, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		*target = parsed
+	}
+
+	serial := ws.client.GetStatus().Serial
+	records := export.Filter(ws.history.List(0), from, to)
+
+	switch r.URL.Query().Get("format") {
+	case "", "homeassistant":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(export.HomeAssistantStatistics(serial, records))
+	case "influx":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, export.InfluxLines(serial, records))
+	default:
+		http.Error(w, "Invalid format, must be homeassistant or influx", http.StatusBadRequest)
+	}
+}
+
+// Start serves on all addresses (host:port or unix socket paths) and returns
+// once one of the listeners fails
+func (ws *WebServer) Start(addresses ...string) error {
+	var listeners []net.Listener
+	for _, address := range addresses {
+		listener, err := listen(address)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		logger.Info("Starting web server", "address", address)
+		listeners = append(listeners, listener)
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func() {
+			errs <- http.Serve(listener, ws.router)
+		}()
+	}
+	return <-errs
+}
+
+// listen opens a TCP or unix socket listener, a stale socket file of a
+// previous run is replaced
+func listen(address string) (net.Listener, error) {
+	path, unix := config.UnixSocketPath(address)
+	if !unix {
+		return net.Listen("tcp", address)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
 }